@@ -0,0 +1,50 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package main
+
+import (
+	"os"
+
+	"github.com/mattermost/awat/model"
+	"github.com/spf13/cobra"
+)
+
+const (
+	apiKeyFlag = "api-key"
+	tokenFlag  = "token"
+)
+
+// addClientFlags adds the flags selecting the AWAT to communicate with
+// and the credentials to authenticate with to the command.
+func addClientFlags(command *cobra.Command) {
+	command.PersistentFlags().String(serverFlag, "http://localhost:8077", "The AWAT to communicate with")
+	command.PersistentFlags().String(apiKeyFlag, "", "The API key to authenticate with (default: the AWAT_API_KEY environment variable)")
+	command.PersistentFlags().String(tokenFlag, "", "The OAuth2 bearer token to authenticate with (default: the AWAT_TOKEN environment variable)")
+}
+
+// newClient returns a client of the AWAT selected by the flags of the
+// command, authenticating with the credentials given by them.
+func newClient(command *cobra.Command) *model.Client {
+	server, _ := command.Flags().GetString(serverFlag)
+	client := model.NewClient(server)
+
+	apiKey, _ := command.Flags().GetString(apiKeyFlag)
+	if apiKey == "" {
+		apiKey = os.Getenv("AWAT_API_KEY")
+	}
+	if apiKey != "" {
+		client.SetAPIKey(apiKey)
+	}
+
+	token, _ := command.Flags().GetString(tokenFlag)
+	if token == "" {
+		token = os.Getenv("AWAT_TOKEN")
+	}
+	if token != "" {
+		client.SetToken(token)
+	}
+
+	return client
+}
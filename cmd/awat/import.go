@@ -5,20 +5,35 @@
 package main
 
 import (
-	"errors"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/mattermost/awat/model"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
-const id = "id"
+const (
+	id                 = "id"
+	importSizeFlag     = "import-size"
+	importEnvFlag      = "import-env"
+	postImportSizeFlag = "post-import-size"
+)
 
 func init() {
-	importCmd.PersistentFlags().String(serverFlag, "http://localhost:8077", "The AWAT to communicate with")
+	addClientFlags(importCmd)
 	importCmd.AddCommand(getImportCmd)
 	importCmd.AddCommand(listImportCmd)
+	importCmd.AddCommand(cancelImportCmd)
+	importCmd.AddCommand(unlockImportCmd)
+	importCmd.AddCommand(historyImportCmd)
+	listImportCmd.Flags().String(installationID, "", "Only list the imports into this installation")
+	addListFlags(listImportCmd, strings.Join(model.AllImportStates, ", "))
 	getImportCmd.PersistentFlags().String(id, "", "ID of the item by which to select Imports")
+	cancelImportCmd.PersistentFlags().String(id, "", "ID of the Import to cancel")
+	unlockImportCmd.PersistentFlags().String(id, "", "ID of the Import to unlock")
+	historyImportCmd.PersistentFlags().String(id, "", "ID of the Import whose state changes to list")
 
 	getImportCmd.AddCommand(getImportByIDCmd)
 	getImportCmd.AddCommand(getImportByTranslationCmd)
@@ -47,9 +62,8 @@ var getImportByTranslationCmd = &cobra.Command{
 	Use:   "translation",
 	Short: "Get Imports by the Translation ID to which they correlate",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		server, _ := cmd.Flags().GetString(serverFlag)
 		translation, _ := cmd.Flags().GetString(id)
-		awat := model.NewClient(server)
+		awat := newClient(cmd)
 		if translation == "" {
 			return errors.New("must provide a Translation ID")
 		}
@@ -71,8 +85,7 @@ var getImportByIDCmd = &cobra.Command{
 	Short: "Get an Import by its ID",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		imprt, _ := cmd.Flags().GetString(id)
-		server, _ := cmd.Flags().GetString(serverFlag)
-		awat := model.NewClient(server)
+		awat := newClient(cmd)
 		status, err := awat.GetImportStatus(imprt)
 		if err != nil {
 			return err
@@ -90,9 +103,8 @@ var getImportByInstallationCmd = &cobra.Command{
 	Use:   "installation",
 	Short: "Get the translations which correlate to the given Installation",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		server, _ := cmd.Flags().GetString(serverFlag)
 		installation, _ := cmd.Flags().GetString(id)
-		awat := model.NewClient(server)
+		awat := newClient(cmd)
 		if installation == "" {
 			return errors.New("must provide an Installation ID")
 		}
@@ -104,14 +116,82 @@ var getImportByInstallationCmd = &cobra.Command{
 	},
 }
 
+var cancelImportCmd = &cobra.Command{
+	Use:   "cancel",
+	Short: "Cancel an Import, reverting its Installation if the Import has already started",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		imprt, _ := cmd.Flags().GetString(id)
+		awat := newClient(cmd)
+		if imprt == "" {
+			return errors.New("must provide an Import ID")
+		}
+
+		status, err := awat.CancelImport(imprt)
+		if err != nil {
+			return err
+		}
+		if status == nil {
+			fmt.Printf("No Import found with ID %s\n", imprt)
+			return nil
+		}
+
+		return printJSON(status)
+	},
+}
+
+var unlockImportCmd = &cobra.Command{
+	Use:   "unlock",
+	Short: "Release the locks a server and a Provisioner hold on an Import, making it available to be claimed again",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		imprt, _ := cmd.Flags().GetString(id)
+		awat := newClient(cmd)
+		if imprt == "" {
+			return errors.New("must provide an Import ID")
+		}
+
+		status, err := awat.UnlockImport(imprt)
+		if err != nil {
+			return err
+		}
+		if status == nil {
+			fmt.Printf("No Import found with ID %s\n", imprt)
+			return nil
+		}
+
+		return printJSON(status)
+	},
+}
+
+var historyImportCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List the state changes of an Import and why they happened",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		imprt, _ := cmd.Flags().GetString(id)
+		awat := newClient(cmd)
+		if imprt == "" {
+			return errors.New("must provide an Import ID")
+		}
+
+		transitions, err := awat.GetImportTransitions(imprt)
+		if err != nil {
+			return err
+		}
+		if transitions == nil {
+			fmt.Printf("No Import found with ID %s\n", imprt)
+			return nil
+		}
+
+		return printJSON(transitions)
+	},
+}
+
 var listImportCmd = &cobra.Command{
 	Use:   "list",
-	Short: "List multiple imports from the AWAT",
+	Short: "List a page of imports from the AWAT",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		server, _ := cmd.Flags().GetString(serverFlag)
-		awat := model.NewClient(server)
+		awat := newClient(cmd)
 
-		statuses, err := awat.GetAllImports()
+		statuses, err := awat.ListImports(getListOptions(cmd))
 		if err != nil {
 			return err
 		}
@@ -119,3 +199,41 @@ var listImportCmd = &cobra.Command{
 		return printJSON(statuses)
 	},
 }
+
+// addImportProfileFlags adds the flags setting an ImportProfile to the
+// command, with the values of the given profile as their defaults.
+func addImportProfileFlags(cmd *cobra.Command, defaults *model.ImportProfile) {
+	var env []string
+	for key, value := range defaults.Env {
+		env = append(env, key+"="+value)
+	}
+	sort.Strings(env)
+
+	cmd.PersistentFlags().String(importSizeFlag, defaults.Size, "The size the installation is resized to while it is imported into")
+	cmd.PersistentFlags().StringArray(importEnvFlag, env, "A priority env var set on the installation while it is imported into, given as KEY=VALUE; may be repeated")
+	cmd.PersistentFlags().String(postImportSizeFlag, defaults.PostImportSize, "The size the installation is resized to after the import (default: its size before the import)")
+}
+
+// getImportProfile returns the ImportProfile set by the flags added by
+// addImportProfileFlags.
+func getImportProfile(cmd *cobra.Command) (*model.ImportProfile, error) {
+	profile := &model.ImportProfile{}
+	profile.Size, _ = cmd.Flags().GetString(importSizeFlag)
+	profile.PostImportSize, _ = cmd.Flags().GetString(postImportSizeFlag)
+
+	pairs, _ := cmd.Flags().GetStringArray(importEnvFlag)
+	env, err := model.ParseImportEnv(pairs)
+	if err != nil {
+		return nil, err
+	}
+	if len(env) > 0 {
+		profile.Env = env
+	}
+
+	err = profile.Validate()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid import profile")
+	}
+
+	return profile, nil
+}
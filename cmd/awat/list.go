@@ -0,0 +1,46 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package main
+
+import (
+	"github.com/mattermost/awat/model"
+	"github.com/spf13/cobra"
+)
+
+const (
+	pageFlag      = "page"
+	perPageFlag   = "per-page"
+	stateFlag     = "state"
+	listTypeFlag  = "type"
+	sortFlag      = "sort"
+	sortOrderFlag = "order"
+)
+
+// addListFlags adds the flags selecting the page of items listed, the
+// filters and the sort order to the command.
+func addListFlags(command *cobra.Command, states string) {
+	command.Flags().Int(pageFlag, 0, "The page of items to list, starting at 0")
+	command.Flags().Int(perPageFlag, model.DefaultPerPage, "The number of items to list per page")
+	command.Flags().String(stateFlag, "", "Only list items in this state (valid options: "+states+")")
+	command.Flags().String(listTypeFlag, "", "Only list items of this backup type (valid options: discord, mattermost, rocketchat, slack, teams, zulip)")
+	command.Flags().String(sortFlag, model.SortByCreateAt, "The field to sort items by (valid options: create_at, complete_at)")
+	command.Flags().String(sortOrderFlag, model.SortAscending, "The order to sort items in (valid options: asc, desc)")
+}
+
+// getListOptions returns the ListOptions given by the flags of the
+// command.
+func getListOptions(command *cobra.Command) *model.ListOptions {
+	options := &model.ListOptions{}
+	options.Page, _ = command.Flags().GetInt(pageFlag)
+	options.PerPage, _ = command.Flags().GetInt(perPageFlag)
+	options.State, _ = command.Flags().GetString(stateFlag)
+	backupType, _ := command.Flags().GetString(listTypeFlag)
+	options.Type = model.BackupType(backupType)
+	options.InstallationID, _ = command.Flags().GetString(installationID)
+	options.SortBy, _ = command.Flags().GetString(sortFlag)
+	options.SortOrder, _ = command.Flags().GetString(sortOrderFlag)
+
+	return options
+}
@@ -27,6 +27,7 @@ func init() {
 	rootCmd.AddCommand(translationCmd)
 	rootCmd.AddCommand(importCmd)
 	rootCmd.AddCommand(uploadCmd)
+	rootCmd.AddCommand(webhookCmd)
 	rootCmd.AddCommand(schemaCmd)
 }
 
@@ -9,11 +9,15 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/mattermost/awat/internal/api"
+	"github.com/mattermost/awat/internal/common"
+	"github.com/mattermost/awat/internal/objectstore"
+	"github.com/mattermost/awat/internal/slack"
 	"github.com/mattermost/awat/internal/store"
 	"github.com/mattermost/awat/internal/supervisor"
 	"github.com/mattermost/awat/model"
@@ -27,19 +31,37 @@ const (
 	databaseFlag          = "database"
 	listenFlag            = "listen"
 	bucketFlag            = "bucket"
+	storageFlag           = "storage"
 	workingDirectoryFlag  = "workdir"
 	serverFlag            = "server"
 	provisionerFlag       = "provisioner"
 	debugFlag             = "debug"
 	keepImportDataFlag    = "keep-import-data"
+	installTimeoutFlag    = "import-installation-timeout"
+	importTimeoutFlag     = "import-timeout"
+	maxAttemptsFlag       = "translation-max-attempts"
+	retryDelayFlag        = "translation-retry-delay"
+	workersFlag           = "translation-workers"
+	diskBudgetFlag        = "translation-disk-budget-gb"
+	instanceIDFlag        = "instance-id"
 	authClientIDFlag      = "auth-client-id"
 	authClientSecretFlag  = "auth-client-secret"
 	authTokenEndpointFlag = "auth-token-endpoint"
+	webhookAttemptsFlag   = "webhook-max-attempts"
+	webhookRetryDelayFlag = "webhook-retry-delay"
+	eventRetentionFlag    = "event-retention"
+	attachmentWorkersFlag = "slack-attachment-workers"
+	encryptionKeyFlag     = "encryption-key"
+	jwksURLFlag           = "jwks-url"
+	jwtIssuerFlag         = "jwt-issuer"
+	jwtAudienceFlag       = "jwt-audience"
+	jwtRolesClaimFlag     = "jwt-roles-claim"
 )
 
 func init() {
 	serverCmd.PersistentFlags().String(listenFlag, "localhost:8077", "Local interface and port to listen on")
-	serverCmd.PersistentFlags().String(bucketFlag, "", "S3 URI where the input can be found")
+	serverCmd.PersistentFlags().String(bucketFlag, "", "S3 URI where the input can be found, or the directory holding archives when using local storage")
+	serverCmd.PersistentFlags().String(storageFlag, objectstore.StorageTypeS3, "The storage backend for input and output archives (valid options: s3, local)")
 	serverCmd.PersistentFlags().String(workingDirectoryFlag, "/tmp/awat/workdir", "The directory to which attachments can be fetched and where the input can be extracted. In production, this will contain the location where the EBS volume is mounted.")
 	serverCmd.PersistentFlags().String(databaseFlag, "postgres://localhost:5435", "Location of a Postgres database for the server to use")
 	serverCmd.PersistentFlags().String(provisionerFlag, "http://localhost:8075", "Address of the Provisioner")
@@ -47,6 +69,24 @@ func init() {
 	serverCmd.PersistentFlags().String(authClientSecretFlag, "", "Client secret for provisioner authentication")
 	serverCmd.PersistentFlags().String(authTokenEndpointFlag, "", "Auth endpoint for provisioner authentication")
 	serverCmd.PersistentFlags().Bool(keepImportDataFlag, true, "Whether to preserve import bundles after import completion or not")
+	addImportProfileFlags(serverCmd, model.DefaultImportProfile())
+	serverCmd.PersistentFlags().Duration(installTimeoutFlag, 2*time.Hour, "How long an import may wait for its installation in any state but in progress before it fails (0 waits forever)")
+	serverCmd.PersistentFlags().Duration(importTimeoutFlag, 72*time.Hour, "How long an import may stay in progress before it fails (0 waits forever)")
+	serverCmd.PersistentFlags().Int(maxAttemptsFlag, 3, "How often a translation failing for a transient reason is attempted before it is marked as failed")
+	serverCmd.PersistentFlags().Duration(retryDelayFlag, 5*time.Minute, "How long to wait before attempting a failed translation again; the delay doubles with every further attempt")
+	serverCmd.PersistentFlags().Int(webhookAttemptsFlag, 10, "How often the delivery of an event to a webhook is attempted before it is given up")
+	serverCmd.PersistentFlags().Duration(webhookRetryDelayFlag, 30*time.Second, "How long to wait before delivering an event to a webhook again; the delay doubles with every further attempt")
+	serverCmd.PersistentFlags().Duration(eventRetentionFlag, 24*time.Hour, "How long the state changes and progress of translations and imports are kept for the event stream")
+	serverCmd.PersistentFlags().Int(workersFlag, 1, "The number of translations to perform concurrently")
+	serverCmd.PersistentFlags().Int(attachmentWorkersFlag, slack.DefaultFetchOptions.Workers, "The number of files attached to a Slack archive which each translation fetches concurrently")
+	serverCmd.PersistentFlags().String(encryptionKeyFlag, "", "The hex encoded 32 byte key Slack tokens and webhook secrets are stored encrypted with (default: the AWAT_ENCRYPTION_KEY environment variable)")
+	serverCmd.PersistentFlags().StringArray(apiKeyFlag, nil, "An API key granting a role, given as <role>:<key>, where role is one of admin, provisioner or read-only; may be repeated (default: the comma separated keys of the AWAT_API_KEYS environment variable)")
+	serverCmd.PersistentFlags().String(jwksURLFlag, "", "The URL of the JSON Web Key Set which OAuth2 bearer tokens are validated against")
+	serverCmd.PersistentFlags().String(jwtIssuerFlag, "", "The issuer OAuth2 bearer tokens must be issued by")
+	serverCmd.PersistentFlags().String(jwtAudienceFlag, "", "The audience OAuth2 bearer tokens must be meant for")
+	serverCmd.PersistentFlags().String(jwtRolesClaimFlag, api.DefaultRolesClaim, "The claim of OAuth2 bearer tokens holding the roles of their subject")
+	serverCmd.PersistentFlags().Int64(diskBudgetFlag, 0, "The disk space in GiB each translation worker may use below the working directory (default: the free space of the working directory shared evenly between the workers)")
+	serverCmd.PersistentFlags().String(instanceIDFlag, "", "A stable identity of this server, used to lock the work it performs (default: the POD_NAME environment variable or the host name)")
 	serverCmd.PersistentFlags().Bool(debugFlag, true, "Whether to output debug logs")
 	_ = serverCmd.MarkPersistentFlagRequired(bucketFlag)
 }
@@ -98,16 +138,93 @@ var serverCmd = &cobra.Command{
 		}
 
 		bucket, _ := command.Flags().GetString(bucketFlag)
+		storage, _ := command.Flags().GetString(storageFlag)
 		provisionerURL, _ := command.Flags().GetString(provisionerFlag)
 		keepImportData, _ := command.Flags().GetBool(keepImportDataFlag)
+		installTimeout, _ := command.Flags().GetDuration(installTimeoutFlag)
+		importTimeout, _ := command.Flags().GetDuration(importTimeoutFlag)
+		importProfile, err := getImportProfile(command)
+		if err != nil {
+			return err
+		}
+
+		maxAttempts, _ := command.Flags().GetInt(maxAttemptsFlag)
+		if maxAttempts < 1 {
+			return errors.Errorf("the server command requires the --%s flag to be at least 1", maxAttemptsFlag)
+		}
+		retryDelay, _ := command.Flags().GetDuration(retryDelayFlag)
+
+		webhookAttempts, _ := command.Flags().GetInt(webhookAttemptsFlag)
+		if webhookAttempts < 1 {
+			return errors.Errorf("the server command requires the --%s flag to be at least 1", webhookAttemptsFlag)
+		}
+		webhookRetryDelay, _ := command.Flags().GetDuration(webhookRetryDelayFlag)
+		eventRetention, _ := command.Flags().GetDuration(eventRetentionFlag)
+
+		workers, _ := command.Flags().GetInt(workersFlag)
+		if workers < 1 {
+			return errors.Errorf("the server command requires the --%s flag to be at least 1", workersFlag)
+		}
+
+		attachmentWorkers, _ := command.Flags().GetInt(attachmentWorkersFlag)
+		if attachmentWorkers < 1 {
+			return errors.Errorf("the server command requires the --%s flag to be at least 1", attachmentWorkersFlag)
+		}
+
+		diskBudgetGiB, _ := command.Flags().GetInt64(diskBudgetFlag)
+		diskBudget := diskBudgetGiB << 30
+		freeSpace, err := supervisor.FreeDiskSpace(workdir)
+		if err != nil {
+			return err
+		}
+		if diskBudget == 0 {
+			diskBudget = freeSpace / int64(workers)
+		} else if diskBudget*int64(workers) > freeSpace {
+			logger.Warnf("The disk budget of %d workers exceeds the %d bytes free in the working directory", workers, freeSpace)
+		}
+
+		instanceID, err := getInstanceID(command)
+		if err != nil {
+			return err
+		}
+
+		encryptor, err := getEncryptor(command)
+		if err != nil {
+			return err
+		}
+		if encryptor == nil {
+			logger.Warnf("No --%s is configured, translations with a Slack token and webhooks will be rejected", encryptionKeyFlag)
+		}
+
+		authenticator, err := getAuthenticator(command)
+		if err != nil {
+			return err
+		}
+		if authenticator == nil {
+			logger.Warnf("Neither --%s nor --%s is configured, the API is open to everyone", apiKeyFlag, jwksURLFlag)
+		}
 
 		logger.WithFields(logrus.Fields{
-			"build-hash":         model.BuildHash,
-			provisionerFlag:      provisionerURL,
-			bucketFlag:           bucket,
-			workingDirectoryFlag: workdir,
-			keepImportDataFlag:   keepImportData,
-			debugFlag:            debug,
+			"build-hash":          model.BuildHash,
+			provisionerFlag:       provisionerURL,
+			bucketFlag:            bucket,
+			storageFlag:           storage,
+			workingDirectoryFlag:  workdir,
+			keepImportDataFlag:    keepImportData,
+			installTimeoutFlag:    installTimeout,
+			importTimeoutFlag:     importTimeout,
+			importSizeFlag:        importProfile.Size,
+			importEnvFlag:         importProfile.Env,
+			postImportSizeFlag:    importProfile.PostImportSize,
+			maxAttemptsFlag:       maxAttempts,
+			retryDelayFlag:        retryDelay,
+			webhookAttemptsFlag:   webhookAttempts,
+			eventRetentionFlag:    eventRetention,
+			workersFlag:           workers,
+			attachmentWorkersFlag: attachmentWorkers,
+			diskBudgetFlag:        diskBudget >> 30,
+			instanceIDFlag:        instanceID,
+			debugFlag:             debug,
 		}).Info("Starting AWAT Server")
 
 		cloudAuth := CloudAuth{}
@@ -125,24 +242,55 @@ var serverCmd = &cobra.Command{
 			return errors.Wrap(err, "failed to check provisioner connectivity")
 		}
 
-		awsContext, err := api.NewAWSContext(bucket)
+		objectStore, err := objectstore.New(storage, bucket)
 		if err != nil {
-			return err
+			return errors.Wrap(err, "failed to initialize object storage")
 		}
+		awsContext := api.NewAWSContext(objectStore)
 
-		translationSupervisor := supervisor.NewTranslationSupervisor(sqlStore, logger, bucket, workdir)
+		translationSupervisor, err := supervisor.NewTranslationSupervisor(sqlStore, logger, objectStore,
+			supervisor.TranslationSupervisorOptions{
+				Workdir:     workdir,
+				Workers:     workers,
+				InstanceID:  instanceID,
+				DiskBudget:  diskBudget,
+				MaxAttempts: maxAttempts,
+				RetryDelay:  retryDelay,
+
+				AttachmentWorkers: attachmentWorkers,
+				Encryptor:         encryptor,
+			})
+		if err != nil {
+			return errors.Wrap(err, "failed to create translation supervisor")
+		}
 		translationSupervisor.Start()
 
-		importSupervisor := supervisor.NewImportSupervisor(sqlStore, logger, cloudClient, bucket, keepImportData)
+		importSupervisor := supervisor.NewImportSupervisor(sqlStore, logger, cloudClient, objectStore, supervisor.ImportSupervisorOptions{
+			KeepImportData:      keepImportData,
+			InstallationTimeout: installTimeout,
+			ImportTimeout:       importTimeout,
+			ImportProfile:       importProfile,
+		})
 		go importSupervisor.Start()
 
+		supervisor.NewLockReaper(sqlStore, logger).Start()
+
+		supervisor.NewWebhookSupervisor(sqlStore, logger, encryptor, webhookAttempts, webhookRetryDelay).Start()
+
+		supervisor.NewUploadSupervisor(sqlStore, logger, objectStore, workdir).Start()
+
+		supervisor.NewEventPruner(sqlStore, logger, eventRetention).Start()
+
 		router := mux.NewRouter()
 		api.Register(router,
 			&api.Context{
-				Store:   sqlStore,
-				Logger:  logger,
-				AWS:     awsContext,
-				Workdir: workdir,
+				Store:     sqlStore,
+				Logger:    logger,
+				AWS:       awsContext,
+				Workdir:   workdir,
+				Encryptor: encryptor,
+
+				Authenticator: authenticator,
 			})
 
 		srv := &http.Server{
@@ -176,3 +324,79 @@ var serverCmd = &cobra.Command{
 		return srv.Shutdown(ctx)
 	},
 }
+
+// getInstanceID returns the identity of this server given by the
+// --instance-id flag, falling back to the name of the pod it runs in
+// and then the host name.
+func getInstanceID(command *cobra.Command) (string, error) {
+	instanceID, _ := command.Flags().GetString(instanceIDFlag)
+	if instanceID != "" {
+		return instanceID, nil
+	}
+
+	instanceID = os.Getenv("POD_NAME")
+	if instanceID != "" {
+		return instanceID, nil
+	}
+
+	instanceID, err := os.Hostname()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to determine host name; provide an --instance-id")
+	}
+
+	return instanceID, nil
+}
+
+// getEncryptor returns the Encryptor using the encryption key given to
+// the server, or nil if none was given.
+func getEncryptor(command *cobra.Command) (*common.Encryptor, error) {
+	key, _ := command.Flags().GetString(encryptionKeyFlag)
+	if key == "" {
+		key = os.Getenv("AWAT_ENCRYPTION_KEY")
+	}
+	if key == "" {
+		return nil, nil
+	}
+
+	encryptor, err := common.NewEncryptor(key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid --%s", encryptionKeyFlag)
+	}
+
+	return encryptor, nil
+}
+
+// getAuthenticator returns the Authenticator of API requests configured
+// by the --api-key and --jwks-url flags, falling back to the API keys of
+// the AWAT_API_KEYS environment variable, or nil if neither is
+// configured.
+func getAuthenticator(command *cobra.Command) (api.Authenticator, error) {
+	var authenticators api.Authenticators
+
+	apiKeys, _ := command.Flags().GetStringArray(apiKeyFlag)
+	if len(apiKeys) == 0 && os.Getenv("AWAT_API_KEYS") != "" {
+		apiKeys = strings.Split(os.Getenv("AWAT_API_KEYS"), ",")
+	}
+	if len(apiKeys) > 0 {
+		keys, err := api.ParseAPIKeys(apiKeys)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid --%s", apiKeyFlag)
+		}
+		authenticators = append(authenticators, api.NewAPIKeyAuthenticator(keys))
+	}
+
+	jwksURL, _ := command.Flags().GetString(jwksURLFlag)
+	if jwksURL != "" {
+		config := api.JWTConfig{JWKSURL: jwksURL}
+		config.Issuer, _ = command.Flags().GetString(jwtIssuerFlag)
+		config.Audience, _ = command.Flags().GetString(jwtAudienceFlag)
+		config.RolesClaim, _ = command.Flags().GetString(jwtRolesClaimFlag)
+		authenticators = append(authenticators, api.NewJWTAuthenticator(config))
+	}
+
+	if len(authenticators) == 0 {
+		return nil, nil
+	}
+
+	return authenticators, nil
+}
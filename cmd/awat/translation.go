@@ -8,6 +8,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/aws/smithy-go/ptr"
 	"github.com/mattermost/awat/model"
@@ -23,23 +25,38 @@ const (
 	translationTypeFlag = "type"
 	uploadFile          = "upload"
 	validateArchive     = "validate"
+	followImportFlag    = "follow-import"
+	slackTokenFlag      = "slack-token"
 )
 
 func init() {
 	translationCmd.PersistentFlags().String(installationID, "", "ID of the installation associated with a translation")
-	translationCmd.PersistentFlags().String(serverFlag, "http://localhost:8077", "The AWAT to communicate with")
+	addClientFlags(translationCmd)
 
 	getTranslationCmd.PersistentFlags().String(translationID, "", "ID of the translation to operate on")
+	cancelTranslationCmd.PersistentFlags().String(translationID, "", "ID of the translation to cancel")
+	retryTranslationCmd.PersistentFlags().String(translationID, "", "ID of the failed translation to retry")
+	unlockTranslationCmd.PersistentFlags().String(translationID, "", "ID of the translation to unlock")
+	watchTranslationCmd.PersistentFlags().String(translationID, "", "ID of the translation to watch")
+	watchTranslationCmd.PersistentFlags().Bool(followImportFlag, false, "Whether to keep watching the import of the translation once the translation completed")
 
 	startTranslationCmd.PersistentFlags().String(archiveFilename, "", "The name of the file holding the input for the translation, assumed to be stored in the root of the S3 bucket")
 	startTranslationCmd.PersistentFlags().String(teamFlag, "", "The Team in Mattermost which is the intended destination of the import")
-	startTranslationCmd.PersistentFlags().String(translationTypeFlag, string(model.SlackWorkspaceBackupType), "The type of backup being translated & imported (default: slack; valid options: mattermost, slack)")
+	startTranslationCmd.PersistentFlags().String(translationTypeFlag, string(model.SlackWorkspaceBackupType), "The type of backup being translated & imported (default: slack; valid options: discord, mattermost, rocketchat, slack, teams, zulip)")
 	startTranslationCmd.PersistentFlags().Bool(uploadFile, false, "Whether or not to upload the file provided before proceeding")
+	startTranslationCmd.PersistentFlags().String(slackTokenFlag, "", "A Slack token with the files:read scope to fetch the files attached to a Slack export with (default: the SLACK_TOKEN environment variable)")
+	addImportProfileFlags(startTranslationCmd, &model.ImportProfile{})
+	addListFlags(listTranslationCmd, strings.Join(model.AllTranslationStates, ", "))
+
 	startTranslationCmd.PersistentFlags().Bool(validateArchive, true, "Whether or not to validate the archive file provided before proceeding")
 
 	translationCmd.AddCommand(getTranslationCmd)
 	translationCmd.AddCommand(listTranslationCmd)
 	translationCmd.AddCommand(startTranslationCmd)
+	translationCmd.AddCommand(cancelTranslationCmd)
+	translationCmd.AddCommand(retryTranslationCmd)
+	translationCmd.AddCommand(unlockTranslationCmd)
+	translationCmd.AddCommand(watchTranslationCmd)
 }
 
 var translationCmd = &cobra.Command{
@@ -59,8 +76,7 @@ var getTranslationCmd = &cobra.Command{
 		installation, _ := cmd.Flags().GetString(installationID)
 		translation, _ := cmd.Flags().GetString(translationID)
 
-		server, _ := cmd.Flags().GetString(serverFlag)
-		awat := model.NewClient(server)
+		awat := newClient(cmd)
 
 		if (installation == "" && translation == "") ||
 			(installation != "" && translation != "") {
@@ -92,17 +108,167 @@ var getTranslationCmd = &cobra.Command{
 	},
 }
 
+var cancelTranslationCmd = &cobra.Command{
+	Use:   "cancel",
+	Short: "Cancel a translation which has not completed yet",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		translation, _ := cmd.Flags().GetString(translationID)
+		awat := newClient(cmd)
+		if translation == "" {
+			return errors.New("must provide a Translation ID")
+		}
+
+		status, err := awat.CancelTranslation(translation)
+		if err != nil {
+			return err
+		}
+		if status == nil {
+			fmt.Printf("No translation found with ID %s\n", translation)
+			return nil
+		}
+
+		return printJSON(status)
+	},
+}
+
+var retryTranslationCmd = &cobra.Command{
+	Use:   "retry",
+	Short: "Start a failed translation over",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		translation, _ := cmd.Flags().GetString(translationID)
+		awat := newClient(cmd)
+		if translation == "" {
+			return errors.New("must provide a Translation ID")
+		}
+
+		status, err := awat.RetryTranslation(translation)
+		if err != nil {
+			return err
+		}
+		if status == nil {
+			fmt.Printf("No translation found with ID %s\n", translation)
+			return nil
+		}
+
+		return printJSON(status)
+	},
+}
+
+var unlockTranslationCmd = &cobra.Command{
+	Use:   "unlock",
+	Short: "Release the lock a server holds on a translation, e.g. after its pod crashed",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		translation, _ := cmd.Flags().GetString(translationID)
+		awat := newClient(cmd)
+		if translation == "" {
+			return errors.New("must provide a Translation ID")
+		}
+
+		status, err := awat.UnlockTranslation(translation)
+		if err != nil {
+			return err
+		}
+		if status == nil {
+			fmt.Printf("No translation found with ID %s\n", translation)
+			return nil
+		}
+
+		return printJSON(status)
+	},
+}
+
+var watchTranslationCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Follow the state changes and progress of a translation live until it finishes",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		translation, _ := cmd.Flags().GetString(translationID)
+		followImport, _ := cmd.Flags().GetBool(followImportFlag)
+		awat := newClient(cmd)
+		if translation == "" {
+			return errors.New("must provide a Translation ID")
+		}
+
+		status, err := awat.GetTranslationStatus(translation)
+		if err != nil {
+			return err
+		}
+		if status == nil {
+			fmt.Printf("No translation found with ID %s\n", translation)
+			return nil
+		}
+
+		view := &progressView{followImport: followImport}
+		fmt.Printf("Translation %s is %s\n", translation, status.State)
+		if view.finished(model.WebhookEventTranslation, status.State) {
+			return view.err
+		}
+
+		err = awat.WatchTranslation(translation, view.handle)
+		if err != nil {
+			return err
+		}
+
+		return view.err
+	},
+}
+
+// progressView renders the events of a Translation and its Imports on
+// the terminal, rewriting the last line while the Translation makes
+// progress within a phase.
+type progressView struct {
+	followImport bool
+	progressLine bool
+	err          error
+}
+
+// handle renders an event and returns false once the Translation, or
+// its Import when following it, finished.
+func (v *progressView) handle(event *model.Event) bool {
+	timestamp := time.UnixMilli(event.Timestamp).Format("15:04:05")
+
+	if event.Kind == model.EventKindProgress {
+		line := fmt.Sprintf("%s [%s] %s", timestamp, event.Phase, event.Message)
+		if event.Total > 0 {
+			line += fmt.Sprintf(" (%d%%)", event.Done*100/event.Total)
+		}
+		// rewrite the line of the previous progress event
+		fmt.Printf("\r%s\033[K", line)
+		v.progressLine = true
+		return true
+	}
+
+	if v.progressLine {
+		fmt.Println()
+		v.progressLine = false
+	}
+	fmt.Printf("%s %s %s: %s -> %s\n", timestamp, event.Type, event.ResourceID, event.OldState, event.NewState)
+
+	return !v.finished(event.Type, event.NewState)
+}
+
+// finished returns true if the Translation or Import is done with, in
+// which case err is set if it did not succeed.
+func (v *progressView) finished(eventType, state string) bool {
+	switch state {
+	case model.TranslationStateComplete:
+		return !v.followImport
+	case model.ImportStateSucceeded:
+		return true
+	case model.TranslationStateFailed, model.TranslationStateCancelled, model.ImportStateFailed, model.ImportStateCancelled:
+		v.err = errors.Errorf("%s ended as %s", eventType, state)
+		return true
+	}
+
+	return false
+}
+
 var listTranslationCmd = &cobra.Command{
 	Use:   "list",
-	Short: "List all translations from the AWAT",
+	Short: "List a page of translations from the AWAT, optionally of an installation",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		server, _ := cmd.Flags().GetString(serverFlag)
-		awat := model.NewClient(server)
-
-		var err error
-		var statuses []*model.TranslationStatus
-		statuses, err = awat.GetAllTranslations()
+		awat := newClient(cmd)
 
+		statuses, err := awat.ListTranslations(getListOptions(cmd))
 		if err != nil {
 			return err
 		}
@@ -121,13 +287,11 @@ var startTranslationCmd = &cobra.Command{
 	Short: "Start a translation",
 	RunE: func(cmd *cobra.Command, args []string) error {
 
-		server, _ := cmd.Flags().GetString(serverFlag)
-		awat := model.NewClient(server)
+		awat := newClient(cmd)
 
 		translationTypeString, _ := cmd.Flags().GetString(translationTypeFlag)
 		translationType := model.BackupType(translationTypeString)
-		if translationType != model.MattermostWorkspaceBackupType &&
-			translationType != model.SlackWorkspaceBackupType {
+		if !translationType.IsValid() {
 			return errors.Errorf("unknown Translation type %q provided", translationType)
 		}
 
@@ -136,8 +300,8 @@ var startTranslationCmd = &cobra.Command{
 			return errors.New("the installation ID to which this translation pertains must be specified")
 		}
 		team, _ := cmd.Flags().GetString(teamFlag)
-		if team == "" && translationType != model.MattermostWorkspaceBackupType {
-			// Mattermost backups include their team names, but other types don't
+		if team == "" && (translationType == model.SlackWorkspaceBackupType || translationType == model.RocketChatWorkspaceBackupType) {
+			// Slack and Rocket.Chat backups have no concept of teams, while the other types include them
 			return errors.New("the team name to which this translation pertains must be specified")
 		}
 		archive, _ := cmd.Flags().GetString(archiveFilename)
@@ -145,21 +309,32 @@ var startTranslationCmd = &cobra.Command{
 			return errors.New("the archive filename to which this translation pertains must be specified")
 		}
 		validate, _ := cmd.Flags().GetBool(validateArchive)
+		slackToken, _ := cmd.Flags().GetString(slackTokenFlag)
+		if slackToken == "" && translationType == model.SlackWorkspaceBackupType {
+			slackToken = os.Getenv("SLACK_TOKEN")
+		}
+
+		var importProfile *model.ImportProfile
+		if cmd.Flags().Changed(importSizeFlag) || cmd.Flags().Changed(importEnvFlag) || cmd.Flags().Changed(postImportSizeFlag) {
+			var err error
+			importProfile, err = getImportProfile(cmd)
+			if err != nil {
+				return err
+			}
+		}
 
 		var err error
 		var uploadID *string
 		upload, _ := cmd.Flags().GetBool(uploadFile)
 		if upload {
-			archive, err = awat.UploadArchiveForTranslation(archive, translationType)
+			var completed *model.Upload
+			completed, err = awat.UploadArchive(archive, translationType, model.DefaultUploadOptions)
 			if err != nil {
 				return errors.Wrapf(err, "failed to upload %s", archive)
 			}
 
-			uploadID = ptr.String(model.TrimExtensionFromArchiveFilename(archive))
-
-			if err = awat.WaitForUploadToComplete(*uploadID); err != nil {
-				return errors.Wrapf(err, "failed to upload %s", archive)
-			}
+			archive = completed.ArchiveName()
+			uploadID = ptr.String(completed.ID)
 		}
 
 		var status *model.TranslationStatus
@@ -171,6 +346,8 @@ var startTranslationCmd = &cobra.Command{
 				UploadID:        uploadID,
 				Team:            team,
 				ValidateArchive: validate,
+				SlackToken:      slackToken,
+				ImportProfile:   importProfile,
 			})
 
 		if status != nil {
@@ -5,22 +5,44 @@
 package main
 
 import (
+	"fmt"
+
 	"github.com/mattermost/awat/model"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
 const (
-	uploadID = "upload-id"
+	uploadID       = "upload-id"
+	validationFlag = "validation"
+	chunkSizeFlag  = "chunk-size"
+	retriesFlag    = "retries"
+	directFlag     = "direct"
 )
 
 func init() {
-	uploadCmd.PersistentFlags().String(serverFlag, "http://localhost:8077", "The AWAT to communicate with")
+	addClientFlags(uploadCmd)
 
 	getUploadCmd.PersistentFlags().String(uploadID, "", "ID of the upload to get")
 	getUploadCmd.MarkPersistentFlagRequired(uploadID)
+	getUploadCmd.PersistentFlags().Bool(validationFlag, false, "Print the report of the validation of the upload instead of the upload")
+
+	uploadArchiveCmd.PersistentFlags().String(archiveFilename, "", "The archive to upload")
+	uploadArchiveCmd.MarkPersistentFlagRequired(archiveFilename)
+	uploadArchiveCmd.PersistentFlags().String(translationTypeFlag, string(model.SlackWorkspaceBackupType), "The type of the archive (valid options: discord, mattermost, rocketchat, slack, teams, zulip)")
+	uploadArchiveCmd.PersistentFlags().String(uploadID, "", "ID of an interrupted upload of the archive to resume")
+	uploadArchiveCmd.PersistentFlags().Int64(chunkSizeFlag, 0, "Size of the chunks the archive is uploaded in, in bytes (default: picked by the AWAT)")
+	uploadArchiveCmd.PersistentFlags().Int(retriesFlag, model.DefaultUploadOptions.Retries, "How often to retry a request which failed with a network or server error")
+	uploadArchiveCmd.PersistentFlags().Bool(directFlag, false, "Upload the archive straight to the bucket with requests presigned by the AWAT")
+	uploadArchiveCmd.PersistentFlags().Bool(validateArchive, false, "Have the AWAT validate an archive uploaded straight to the bucket")
+
+	abortUploadCmd.PersistentFlags().String(uploadID, "", "ID of the upload to abort")
+	abortUploadCmd.MarkPersistentFlagRequired(uploadID)
 
 	uploadCmd.AddCommand(getUploadCmd)
 	uploadCmd.AddCommand(getUploadsCmd)
+	uploadCmd.AddCommand(uploadArchiveCmd)
+	uploadCmd.AddCommand(abortUploadCmd)
 }
 
 var uploadCmd = &cobra.Command{
@@ -38,8 +60,21 @@ var getUploadCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		uploadID, _ := cmd.Flags().GetString(uploadID)
 
-		server, _ := cmd.Flags().GetString(serverFlag)
-		client := model.NewClient(server)
+		client := newClient(cmd)
+
+		if validation, _ := cmd.Flags().GetBool(validationFlag); validation {
+			report, err := client.GetUploadValidation(uploadID)
+			if err != nil {
+				return err
+			}
+			if report == nil {
+				fmt.Printf("Upload %s was not validated\n", uploadID)
+				return nil
+			}
+
+			printValidationReport(report)
+			return nil
+		}
 
 		upload, err := client.GetUpload(uploadID)
 		if err != nil {
@@ -50,12 +85,64 @@ var getUploadCmd = &cobra.Command{
 	},
 }
 
+var uploadArchiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "Upload an archive to the AWAT in chunks, resuming after network failures",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filename, _ := cmd.Flags().GetString(archiveFilename)
+		archiveTypeString, _ := cmd.Flags().GetString(translationTypeFlag)
+		archiveType := model.BackupType(archiveTypeString)
+		if !archiveType.IsValid() {
+			return errors.Errorf("unknown archive type %q provided", archiveType)
+		}
+
+		options := model.DefaultUploadOptions
+		options.UploadID, _ = cmd.Flags().GetString(uploadID)
+		options.ChunkSize, _ = cmd.Flags().GetInt64(chunkSizeFlag)
+		options.Retries, _ = cmd.Flags().GetInt(retriesFlag)
+
+		client := newClient(cmd)
+
+		var upload *model.Upload
+		var err error
+		if direct, _ := cmd.Flags().GetBool(directFlag); direct {
+			if options.UploadID != "" {
+				return errors.New("uploads straight to the bucket cannot be resumed")
+			}
+			validate, _ := cmd.Flags().GetBool(validateArchive)
+			upload, err = client.UploadArchiveDirect(filename, archiveType, validate, options)
+		} else {
+			upload, err = client.UploadArchive(filename, archiveType, options)
+		}
+		var validationErr *model.ValidationError
+		if errors.As(err, &validationErr) {
+			printValidationReport(validationErr.Report)
+		}
+		if err != nil {
+			return err
+		}
+
+		return printJSON(upload)
+	},
+}
+
+var abortUploadCmd = &cobra.Command{
+	Use:   "abort",
+	Short: "Abort an upload of an archive in chunks, discarding the chunks uploaded",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		uploadID, _ := cmd.Flags().GetString(uploadID)
+
+		client := newClient(cmd)
+
+		return client.AbortUploadSession(uploadID)
+	},
+}
+
 var getUploadsCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all uploads from the AWAT",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		server, _ := cmd.Flags().GetString(serverFlag)
-		client := model.NewClient(server)
+		client := newClient(cmd)
 
 		statuses, err := client.GetUploads()
 		if err != nil {
@@ -65,3 +152,27 @@ var getUploadsCmd = &cobra.Command{
 		return printJSON(statuses)
 	},
 }
+
+// printValidationReport prints a ValidationReport for humans to read.
+func printValidationReport(report *model.ValidationReport) {
+	if report.Valid() {
+		fmt.Printf("The %s archive is valid.\n", report.Type)
+	} else {
+		fmt.Printf("The %s archive is invalid.\n", report.Type)
+	}
+	fmt.Printf("\nTeams:    %d\nChannels: %d\nUsers:    %d\nPosts:    %d\n",
+		report.Teams, report.Channels, report.Users, report.Posts)
+
+	if len(report.Errors) > 0 {
+		fmt.Printf("\nErrors (%d):\n", len(report.Errors))
+		for _, issue := range report.Errors {
+			fmt.Printf("  %s\n", issue)
+		}
+	}
+	if len(report.Warnings) > 0 {
+		fmt.Printf("\nWarnings (%d):\n", len(report.Warnings))
+		for _, issue := range report.Warnings {
+			fmt.Printf("  %s\n", issue)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/mattermost/awat/model"
+	"github.com/spf13/cobra"
+)
+
+const (
+	webhookURLFlag    = "url"
+	webhookSecretFlag = "secret"
+)
+
+func init() {
+	addClientFlags(webhookCmd)
+
+	createWebhookCmd.PersistentFlags().String(webhookURLFlag, "", "The URL state changes of Translations and Imports are POSTed to")
+	createWebhookCmd.MarkPersistentFlagRequired(webhookURLFlag)
+	createWebhookCmd.PersistentFlags().String(webhookSecretFlag, "", "The secret the events are signed with")
+	createWebhookCmd.MarkPersistentFlagRequired(webhookSecretFlag)
+
+	getWebhookCmd.PersistentFlags().String(id, "", "ID of the webhook to get")
+	getWebhookCmd.MarkPersistentFlagRequired(id)
+	deleteWebhookCmd.PersistentFlags().String(id, "", "ID of the webhook to delete")
+	deleteWebhookCmd.MarkPersistentFlagRequired(id)
+	getWebhookDeliveriesCmd.PersistentFlags().String(id, "", "ID of the webhook to get the deliveries of")
+	getWebhookDeliveriesCmd.MarkPersistentFlagRequired(id)
+
+	webhookCmd.AddCommand(createWebhookCmd)
+	webhookCmd.AddCommand(listWebhooksCmd)
+	webhookCmd.AddCommand(getWebhookCmd)
+	webhookCmd.AddCommand(deleteWebhookCmd)
+	webhookCmd.AddCommand(getWebhookDeliveriesCmd)
+}
+
+var webhookCmd = &cobra.Command{
+	Use:   "webhook",
+	Short: "Manage the webhooks notified of state changes by the AWAT",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return nil
+	},
+}
+
+var createWebhookCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Register a webhook",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		url, _ := cmd.Flags().GetString(webhookURLFlag)
+		secret, _ := cmd.Flags().GetString(webhookSecretFlag)
+
+		webhook, err := newClient(cmd).CreateWebhook(&model.WebhookRequest{
+			URL:    url,
+			Secret: secret,
+		})
+		if err != nil {
+			return err
+		}
+
+		return printJSON(webhook)
+	},
+}
+
+var listWebhooksCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the webhooks",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		webhooks, err := newClient(cmd).GetWebhooks()
+		if err != nil {
+			return err
+		}
+
+		return printJSON(webhooks)
+	},
+}
+
+var getWebhookCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get a webhook by its ID",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		webhookID, _ := cmd.Flags().GetString(id)
+		webhook, err := newClient(cmd).GetWebhook(webhookID)
+		if err != nil {
+			return err
+		}
+		if webhook == nil {
+			fmt.Printf("No webhook found with ID %s\n", webhookID)
+			return nil
+		}
+
+		return printJSON(webhook)
+	},
+}
+
+var deleteWebhookCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete a webhook, dropping the events not delivered to it yet",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		webhookID, _ := cmd.Flags().GetString(id)
+		return newClient(cmd).DeleteWebhook(webhookID)
+	},
+}
+
+var getWebhookDeliveriesCmd = &cobra.Command{
+	Use:   "deliveries",
+	Short: "Show the log of the deliveries of events to a webhook",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		webhookID, _ := cmd.Flags().GetString(id)
+		deliveries, err := newClient(cmd).GetWebhookDeliveries(webhookID)
+		if err != nil {
+			return err
+		}
+
+		return printJSON(deliveries)
+	},
+}
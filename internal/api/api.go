@@ -9,27 +9,57 @@ import (
 )
 
 // Register sets up the routing of HTTP endpoints to their respective handler functions.
-// It associates each route with a specific handler and HTTP method in the provided router.
+// It associates each route with a specific handler and HTTP method in the provided router,
+// and with the Role a client needs to use it.
 func Register(rootRouter *mux.Router, context *Context) {
-	addContext := func(handler contextHandlerFunc) *contextHandler {
-		return newContextHandler(context, handler)
+	readOnly := func(handler contextHandlerFunc) *contextHandler {
+		return newContextHandler(context, handler, RoleReadOnly)
 	}
+	provisioner := func(handler contextHandlerFunc) *contextHandler {
+		return newContextHandler(context, handler, RoleProvisioner)
+	}
+	admin := func(handler contextHandlerFunc) *contextHandler {
+		return newContextHandler(context, handler, RoleAdmin)
+	}
+
+	rootRouter.Handle("/upload", admin(handleReceiveArchive)).Methods("POST")
+	rootRouter.Handle("/upload/{id}", readOnly(handleCheckUploadStatus)).Methods("GET")
+	rootRouter.Handle("/upload/{id}/validation", readOnly(handleGetUploadValidation)).Methods("GET")
+	rootRouter.Handle("/upload/session", admin(handleCreateUploadSession)).Methods("POST")
+	rootRouter.Handle("/upload/session/{id}", readOnly(handleGetUploadSession)).Methods("GET")
+	rootRouter.Handle("/upload/session/{id}", admin(handleAbortUploadSession)).Methods("DELETE")
+	rootRouter.Handle("/upload/session/{id}/chunk/{number}", admin(handleUploadChunk)).Methods("PUT")
+	rootRouter.Handle("/upload/session/{id}/complete", admin(handleCompleteUploadSession)).Methods("POST")
+	rootRouter.Handle("/upload/presign", admin(handlePresignUpload)).Methods("POST")
+	rootRouter.Handle("/upload/presign/{id}/complete", admin(handleCompletePresignedUpload)).Methods("POST")
+	rootRouter.Handle("/uploads", readOnly(handleListUploads)).Methods("GET")
+
+	rootRouter.Handle("/translate", admin(handleStartTranslation)).Methods("POST")
+	rootRouter.Handle("/translation/{id}", readOnly(handleGetTranslationStatus)).Methods("GET")
+	rootRouter.Handle("/translation/{id}", admin(handleCancelTranslation)).Methods("DELETE")
+	rootRouter.Handle("/translation/{id}/retry", admin(handleRetryTranslation)).Methods("POST")
+	rootRouter.Handle("/translation/{id}/unlock", admin(handleUnlockTranslation)).Methods("POST")
+	rootRouter.Handle("/translation/{id}/import", readOnly(handleGetImportStatusesForTranslation)).Methods("GET")
+	rootRouter.Handle("/translations", readOnly(handleListTranslations)).Methods("GET")
 
-	rootRouter.Handle("/upload", addContext(handleReceiveArchive)).Methods("POST")
-	rootRouter.Handle("/upload/{id}", addContext(handleCheckUploadStatus)).Methods("GET")
-	rootRouter.Handle("/uploads", addContext(handleListUploads)).Methods("GET")
+	rootRouter.Handle("/import", provisioner(handleStartImport)).Methods("POST")
+	rootRouter.Handle("/import", provisioner(handleCompleteImport)).Methods("PUT")
+	rootRouter.Handle("/import/{id}", readOnly(handleGetImport)).Methods("GET")
+	rootRouter.Handle("/import/{id}/release", provisioner(handleReleaseLockOnImport)).Methods("GET")
+	rootRouter.Handle("/import/{id}/cancel", admin(handleCancelImport)).Methods("POST")
+	rootRouter.Handle("/import/{id}/unlock", admin(handleUnlockImport)).Methods("POST")
+	rootRouter.Handle("/import/{id}/transitions", readOnly(handleGetImportTransitions)).Methods("GET")
+	rootRouter.Handle("/import/{id}/heartbeat", provisioner(handleRenewImportClaim)).Methods("POST")
+	rootRouter.Handle("/imports", readOnly(handleListImports)).Methods("GET")
 
-	rootRouter.Handle("/translate", addContext(handleStartTranslation)).Methods("POST")
-	rootRouter.Handle("/translation/{id}", addContext(handleGetTranslationStatus)).Methods("GET")
-	rootRouter.Handle("/translation/{id}/import", addContext(handleGetImportStatusesForTranslation)).Methods("GET")
-	rootRouter.Handle("/translations", addContext(handleListTranslations)).Methods("GET")
+	rootRouter.Handle("/webhooks", admin(handleCreateWebhook)).Methods("POST")
+	rootRouter.Handle("/webhooks", readOnly(handleListWebhooks)).Methods("GET")
+	rootRouter.Handle("/webhook/{id}", readOnly(handleGetWebhook)).Methods("GET")
+	rootRouter.Handle("/webhook/{id}", admin(handleDeleteWebhook)).Methods("DELETE")
+	rootRouter.Handle("/webhook/{id}/deliveries", readOnly(handleGetWebhookDeliveries)).Methods("GET")
 
-	rootRouter.Handle("/import", addContext(handleStartImport)).Methods("POST")
-	rootRouter.Handle("/import", addContext(handleCompleteImport)).Methods("PUT")
-	rootRouter.Handle("/import/{id}", addContext(handleGetImport)).Methods("GET")
-	rootRouter.Handle("/import/{id}/release", addContext(handleReleaseLockOnImport)).Methods("GET")
-	rootRouter.Handle("/imports", addContext(handleListImports)).Methods("GET")
+	rootRouter.Handle("/events", readOnly(handleStreamEvents)).Methods("GET")
 
-	rootRouter.Handle("/installation/translation/{id}", addContext(handleGetTranslationStatusesByInstallation)).Methods("GET")
-	rootRouter.Handle("/installation/import/{id}", addContext(handleGetImportStatusesByInstallation)).Methods("GET")
+	rootRouter.Handle("/installation/translation/{id}", readOnly(handleGetTranslationStatusesByInstallation)).Methods("GET")
+	rootRouter.Handle("/installation/import/{id}", readOnly(handleGetImportStatusesByInstallation)).Methods("GET")
 }
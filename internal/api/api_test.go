@@ -5,24 +5,72 @@
 package api
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/mattermost/awat/internal/common"
 	mock_api "github.com/mattermost/awat/internal/mocks/api"
 	mock_context "github.com/mattermost/awat/internal/mocks/context"
 	"github.com/mattermost/awat/internal/testlib"
 	"github.com/mattermost/awat/model"
 )
 
+func TestStartTranslationWithSlackToken(t *testing.T) {
+	logger := testlib.MakeLogger(t)
+	mockController := gomock.NewController(t)
+	store := mock_api.NewMockStore(mockController)
+	router := mux.NewRouter()
+	encryptor, err := common.NewEncryptor(strings.Repeat("ab", common.EncryptionKeySize))
+	require.NoError(t, err)
+	Register(router, &Context{
+		Store:     store,
+		Logger:    logger,
+		AWS:       &mock_context.MockAWS{ResourceExists: true},
+		Encryptor: encryptor,
+	})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	gomock.InOrder(
+		store.EXPECT().GetUpload("foo").Return(nil, nil).Times(1),
+		store.EXPECT().CreateUpload("foo", model.SlackWorkspaceBackupType).Return(nil).Times(1),
+		store.EXPECT().
+			CreateTranslation(gomock.Any()).
+			DoAndReturn(func(translation *model.Translation) error {
+				assert.NotContains(t, translation.SlackToken, "xoxb-token")
+				token, err := encryptor.Decrypt(translation.SlackToken)
+				assert.NoError(t, err)
+				assert.Equal(t, "xoxb-token", token)
+				return nil
+			}).
+			Times(1),
+		expectWebhookEvent(t, store, model.WebhookEventTranslation, "", model.TranslationStateRequested),
+	)
+
+	resp, err := http.Post(fmt.Sprintf("%s/translate", ts.URL), "application/json",
+		strings.NewReader(
+			`{"Type": "slack", "InstallationID": "installationID", "Archive": "foo.zip", "Team": "teamname", "SlackToken": "xoxb-token"}`,
+		))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), "SlackToken")
+}
+
 func TestTranslations(t *testing.T) {
 	logger := testlib.MakeLogger(t)
 	mockController := gomock.NewController(t)
@@ -79,7 +127,7 @@ func TestTranslations(t *testing.T) {
 	t.Run("fetch all translations", func(t *testing.T) {
 		translationID := model.NewID()
 		store.EXPECT().
-			GetAllTranslations().
+			GetTranslations(&model.ListOptions{PerPage: model.AllPerPage}).
 			Return([]*model.Translation{
 				{ID: translationID},
 			}, nil).
@@ -95,6 +143,56 @@ func TestTranslations(t *testing.T) {
 		assert.Equal(t, translationID, translations[0].ID)
 	})
 
+	t.Run("fetch the first page of translations", func(t *testing.T) {
+		store.EXPECT().
+			GetTranslations(&model.ListOptions{PerPage: model.DefaultPerPage}).
+			Return([]*model.Translation{}, nil).
+			Times(1)
+
+		resp, err := http.Get(fmt.Sprintf("%s/translations?page=0", ts.URL))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("fetch a filtered page of translations", func(t *testing.T) {
+		store.EXPECT().
+			GetTranslations(&model.ListOptions{
+				Page:           2,
+				PerPage:        10,
+				State:          model.TranslationStateFailed,
+				Type:           model.SlackWorkspaceBackupType,
+				InstallationID: "installationID",
+				CreatedAfter:   1000,
+				CreatedBefore:  2000,
+				SortBy:         model.SortByCompleteAt,
+				SortOrder:      model.SortDescending,
+			}).
+			Return([]*model.Translation{}, nil).
+			Times(1)
+
+		resp, err := http.Get(fmt.Sprintf("%s/translations?page=2&per_page=10&state=translation-failed&type=slack&installation=installationID&created_after=1000&created_before=2000&sort=complete_at&order=desc", ts.URL))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("reject invalid list options", func(t *testing.T) {
+		for _, query := range []string{
+			"page=-1",
+			"per_page=0",
+			"per_page=100000",
+			"page=first",
+			"state=import-failed",
+			"type=irc",
+			"sort=name",
+			"order=up",
+			"created_after=yesterday",
+		} {
+			resp, err := http.Get(fmt.Sprintf("%s/translations?%s", ts.URL, query))
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+		}
+	})
+
 	t.Run("start a new translation", func(t *testing.T) {
 		gomock.InOrder(
 			store.EXPECT().GetUpload("foo").Return(nil, nil).Times(1),
@@ -113,6 +211,7 @@ func TestTranslations(t *testing.T) {
 				).
 				Return(nil).
 				Times(1),
+			expectWebhookEvent(t, store, model.WebhookEventTranslation, "", model.TranslationStateRequested),
 		)
 
 		resp, err := http.Post(fmt.Sprintf("%s/translate", ts.URL), "application/json",
@@ -133,7 +232,8 @@ func TestTranslations(t *testing.T) {
 		gomock.InOrder(
 			store.EXPECT().GetUpload("foo").Return(
 				&model.Upload{
-					ID: "foo",
+					ID:         "foo",
+					CompleteAt: 1000,
 				}, nil).Times(1),
 			store.EXPECT().
 				CreateTranslation(
@@ -146,6 +246,7 @@ func TestTranslations(t *testing.T) {
 				).
 				Return(nil).
 				Times(1),
+			expectWebhookEvent(t, store, model.WebhookEventTranslation, "", model.TranslationStateRequested),
 		)
 
 		resp, errTest := http.Post(fmt.Sprintf("%s/translate", ts.URL), "application/json",
@@ -163,6 +264,37 @@ func TestTranslations(t *testing.T) {
 		assert.Equal(t, "foo", *translation.UploadID)
 	})
 
+	t.Run("start a new translation of an upload still being verified", func(t *testing.T) {
+		store.EXPECT().GetUpload("foo").Return(&model.Upload{ID: "foo"}, nil).Times(1)
+
+		resp, err := http.Post(fmt.Sprintf("%s/translate", ts.URL), "application/json",
+			strings.NewReader(
+				`{"Type": "mattermost", "InstallationID": "installationID", "Archive": "foo.zip", "Team": "teamname", "UploadID": "foo"}`,
+			))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+
+	t.Run("start a new translation of a failed upload", func(t *testing.T) {
+		store.EXPECT().GetUpload("foo").Return(&model.Upload{ID: "foo", CompleteAt: 1000, Error: "archive has 14 bytes"}, nil).Times(1)
+
+		resp, err := http.Post(fmt.Sprintf("%s/translate", ts.URL), "application/json",
+			strings.NewReader(
+				`{"Type": "mattermost", "InstallationID": "installationID", "Archive": "foo.zip", "Team": "teamname", "UploadID": "foo"}`,
+			))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("start a new translation with a Slack token, but no encryption key", func(t *testing.T) {
+		resp, err := http.Post(fmt.Sprintf("%s/translate", ts.URL), "application/json",
+			strings.NewReader(
+				`{"Type": "slack", "InstallationID": "installationID", "Archive": "foo.zip", "Team": "teamname", "SlackToken": "xoxb-token"}`,
+			))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
 	t.Run("start a new translation, bad resource name", func(t *testing.T) {
 		mockAWS.ResourceExists = false
 
@@ -174,6 +306,140 @@ func TestTranslations(t *testing.T) {
 		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
 	})
 
+	t.Run("cancel a pending translation", func(t *testing.T) {
+		translationID := model.NewID()
+		translation := &model.Translation{ID: translationID}
+
+		gomock.InOrder(
+			store.EXPECT().
+				GetTranslation(translationID).
+				Return(translation, nil).
+				Times(1),
+
+			store.EXPECT().
+				CancelTranslation(translation).
+				DoAndReturn(func(t *model.Translation) (bool, error) {
+					t.CancelAt = 1000
+					return true, nil
+				}).
+				Times(1),
+			expectWebhookEvent(t, store, model.WebhookEventTranslation, model.TranslationStateRequested, model.TranslationStateCancelled),
+		)
+
+		req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/translation/%s", ts.URL, translationID), nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		status, err := model.NewTranslationStatusFromReader(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, model.TranslationStateCancelled, status.State)
+	})
+
+	t.Run("cancel a completed translation", func(t *testing.T) {
+		translationID := model.NewID()
+
+		store.EXPECT().
+			GetTranslation(translationID).
+			Return(&model.Translation{ID: translationID, StartAt: 500, CompleteAt: 1000}, nil).
+			Times(1)
+
+		req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/translation/%s", ts.URL, translationID), nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+
+	t.Run("retry a failed translation", func(t *testing.T) {
+		translationID := model.NewID()
+		translation := &model.Translation{ID: translationID, StartAt: 500, FailAt: 1000, Attempts: 3, Error: "boom"}
+
+		gomock.InOrder(
+			store.EXPECT().
+				GetTranslation(translationID).
+				Return(translation, nil).
+				Times(1),
+
+			store.EXPECT().
+				RetryTranslation(translation).
+				DoAndReturn(func(t *model.Translation) (bool, error) {
+					t.StartAt, t.FailAt, t.Attempts, t.Error = 0, 0, 0, ""
+					return true, nil
+				}).
+				Times(1),
+			expectWebhookEvent(t, store, model.WebhookEventTranslation, model.TranslationStateFailed, model.TranslationStateRequested),
+		)
+
+		resp, err := http.Post(fmt.Sprintf("%s/translation/%s/retry", ts.URL, translationID), "application/json", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		status, err := model.NewTranslationStatusFromReader(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, model.TranslationStateRequested, status.State)
+	})
+
+	t.Run("retry a translation which has not failed", func(t *testing.T) {
+		translationID := model.NewID()
+
+		store.EXPECT().
+			GetTranslation(translationID).
+			Return(&model.Translation{ID: translationID, StartAt: 500}, nil).
+			Times(1)
+
+		resp, err := http.Post(fmt.Sprintf("%s/translation/%s/retry", ts.URL, translationID), "application/json", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+
+	t.Run("unlock a translation held by a crashed worker", func(t *testing.T) {
+		translationID := model.NewID()
+		translation := &model.Translation{ID: translationID, StartAt: 500, LockedBy: "pod-a/worker-1", LockExpiresAt: 1000}
+
+		gomock.InOrder(
+			store.EXPECT().
+				GetTranslation(translationID).
+				Return(translation, nil).
+				Times(1),
+
+			store.EXPECT().
+				ReleaseTranslationLock(translation, model.LockReleaseReasonManual).
+				DoAndReturn(func(t *model.Translation, reason string) (bool, error) {
+					t.LockedBy, t.LockExpiresAt, t.StartAt = "", 0, 0
+					return true, nil
+				}).
+				Times(1),
+			expectWebhookEvent(t, store, model.WebhookEventTranslation, model.TranslationStateInProgress, model.TranslationStateRequested),
+		)
+
+		resp, err := http.Post(fmt.Sprintf("%s/translation/%s/unlock", ts.URL, translationID), "application/json", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("unlock a translation whose lock was renewed", func(t *testing.T) {
+		translationID := model.NewID()
+		translation := &model.Translation{ID: translationID, StartAt: 500, LockedBy: "pod-a/worker-1", LockExpiresAt: 1000}
+
+		gomock.InOrder(
+			store.EXPECT().
+				GetTranslation(translationID).
+				Return(translation, nil).
+				Times(1),
+
+			store.EXPECT().
+				ReleaseTranslationLock(translation, model.LockReleaseReasonManual).
+				Return(false, nil).
+				Times(1),
+		)
+
+		resp, err := http.Post(fmt.Sprintf("%s/translation/%s/unlock", ts.URL, translationID), "application/json", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+
 	t.Run("get a translation by Installation ID", func(t *testing.T) {
 		installationID := "installationID"
 		translationID := "translationID"
@@ -281,7 +547,7 @@ func TestImports(t *testing.T) {
 		translationID := "translationID"
 
 		store.EXPECT().
-			GetAllImports().
+			GetImports(&model.ListOptions{PerPage: model.AllPerPage}).
 			Return([]*model.Import{
 				{ID: importID, TranslationID: translationID},
 			}, nil).
@@ -366,6 +632,31 @@ func TestImports(t *testing.T) {
 		assert.Equal(t, http.StatusOK, resp.StatusCode)
 	})
 
+	t.Run("get the transitions of an Import", func(t *testing.T) {
+		importID := "importID"
+		transitions := []*model.ImportTransition{
+			{ID: "a", ImportID: importID, NewState: model.ImportStateRequested},
+			{ID: "b", ImportID: importID, OldState: model.ImportStateRequested, NewState: model.ImportStateFailed, Reason: "installation not found"},
+		}
+
+		store.EXPECT().
+			GetImport(importID).
+			Return(&model.Import{ID: importID}, nil).
+			Times(1)
+		store.EXPECT().
+			GetImportTransitions(importID).
+			Return(transitions, nil).
+			Times(1)
+
+		resp, err := http.Get(fmt.Sprintf("%s/import/%s/transitions", ts.URL, importID))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		got, err := model.NewImportTransitionListFromReader(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, transitions, got)
+	})
+
 	t.Run("release lock on a locked Import", func(t *testing.T) {
 		importID := "importID"
 		translationID := "translationID"
@@ -393,6 +684,145 @@ func TestImports(t *testing.T) {
 		assert.Equal(t, http.StatusOK, resp.StatusCode)
 	})
 
+	t.Run("cancel a requested import", func(t *testing.T) {
+		importID := model.NewID()
+		translationID := "translationID"
+		imprt := &model.Import{ID: importID, TranslationID: translationID, State: model.ImportStateRequested}
+
+		gomock.InOrder(
+			store.EXPECT().
+				GetImport(importID).
+				Return(imprt, nil).
+				Times(1),
+
+			store.EXPECT().
+				CancelImport(imprt, model.ImportStateCancelled, "cancelled").
+				DoAndReturn(func(imp *model.Import, state, reason string) (bool, error) {
+					imp.State = state
+					return true, nil
+				}).
+				Times(1),
+
+			store.EXPECT().
+				GetTranslation(translationID).
+				Return(&model.Translation{ID: translationID}, nil).
+				Times(1),
+
+			expectWebhookEvent(t, store, model.WebhookEventImport, model.ImportStateRequested, model.ImportStateCancelled),
+		)
+
+		resp, err := http.Post(fmt.Sprintf("%s/import/%s/cancel", ts.URL, importID), "application/json", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		status, err := model.NewImportStatusFromReader(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, model.ImportStateCancelled, status.State)
+	})
+
+	t.Run("cancel a locked import", func(t *testing.T) {
+		importID := model.NewID()
+		imprt := &model.Import{ID: importID, State: model.ImportStateInProgress, LockedBy: "supervisor"}
+
+		gomock.InOrder(
+			store.EXPECT().
+				GetImport(importID).
+				Return(imprt, nil).
+				Times(1),
+
+			store.EXPECT().
+				CancelImport(imprt, model.ImportStateCancelRequested, "cancelled").
+				Return(false, nil).
+				Times(1),
+		)
+
+		resp, err := http.Post(fmt.Sprintf("%s/import/%s/cancel", ts.URL, importID), "application/json", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+
+	t.Run("cancel a succeeded import", func(t *testing.T) {
+		importID := model.NewID()
+
+		store.EXPECT().
+			GetImport(importID).
+			Return(&model.Import{ID: importID, State: model.ImportStateSucceeded}, nil).
+			Times(1)
+
+		resp, err := http.Post(fmt.Sprintf("%s/import/%s/cancel", ts.URL, importID), "application/json", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+
+	t.Run("unlock an import claimed by a provisioner", func(t *testing.T) {
+		importID := model.NewID()
+		translationID := "translationID"
+		imprt := &model.Import{
+			ID:                importID,
+			TranslationID:     translationID,
+			State:             model.ImportStateInProgress,
+			LockedBy:          "supervisor",
+			LockExpiresAt:     1000,
+			ImportBy:          "provisioner",
+			ImportByExpiresAt: 2000,
+			StartAt:           500,
+		}
+
+		gomock.InOrder(
+			store.EXPECT().
+				GetImport(importID).
+				Return(imprt, nil).
+				Times(1),
+
+			store.EXPECT().
+				ReleaseImportLock(imprt, model.LockReleaseReasonManual).
+				Return(true, nil).
+				Times(1),
+
+			store.EXPECT().
+				ReleaseImportClaim(imprt, model.LockReleaseReasonManual).
+				Return(true, nil).
+				Times(1),
+
+			store.EXPECT().
+				GetTranslation(translationID).
+				Return(&model.Translation{ID: translationID}, nil).
+				Times(1),
+		)
+
+		resp, err := http.Post(fmt.Sprintf("%s/import/%s/unlock", ts.URL, importID), "application/json", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("renew the claim on an import", func(t *testing.T) {
+		importID := model.NewID()
+
+		store.EXPECT().
+			RenewImportClaim(importID, "provisioner").
+			Return(true, nil).
+			Times(1)
+
+		body := strings.NewReader(`{"ProvisionerID": "provisioner"}`)
+		resp, err := http.Post(fmt.Sprintf("%s/import/%s/heartbeat", ts.URL, importID), "application/json", body)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("renew a released claim on an import", func(t *testing.T) {
+		importID := model.NewID()
+
+		store.EXPECT().
+			RenewImportClaim(importID, "provisioner").
+			Return(false, nil).
+			Times(1)
+
+		body := strings.NewReader(`{"ProvisionerID": "provisioner"}`)
+		resp, err := http.Post(fmt.Sprintf("%s/import/%s/heartbeat", ts.URL, importID), "application/json", body)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+
 	t.Run("get an import by Installation ID", func(t *testing.T) {
 		importID := "importID"
 		installationID := "installationID"
@@ -418,3 +848,127 @@ func TestImports(t *testing.T) {
 		assert.Equal(t, importID, imports[0].ID)
 	})
 }
+
+func TestUploads(t *testing.T) {
+	logger := testlib.MakeLogger(t)
+	mockController := gomock.NewController(t)
+	store := mock_api.NewMockStore(mockController)
+	router := mux.NewRouter()
+	Register(router, &Context{
+		Store:   store,
+		Logger:  logger,
+		AWS:     &mock_context.MockAWS{ResourceExists: true},
+		Workdir: t.TempDir(),
+	})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	t.Run("upload an invalid Slack archive", func(t *testing.T) {
+		gomock.InOrder(
+			store.EXPECT().
+				CreateUpload(gomock.Any(), model.SlackWorkspaceBackupType).
+				Return(nil).
+				Times(1),
+
+			store.EXPECT().
+				UpdateUploadValidation(gomock.Any(), gomock.Any()).
+				Return(nil).
+				Times(1),
+
+			store.EXPECT().
+				CompleteUpload(gomock.Any(), "archive validation failed").
+				Return(nil).
+				Times(1),
+		)
+
+		resp, err := http.Post(fmt.Sprintf("%s/upload?type=slack", ts.URL), "application/octet-stream", strings.NewReader("not a zip file"))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		upload, err := model.NewUploadFromReader(resp.Body)
+		require.NoError(t, err)
+		assert.NotEmpty(t, upload.ID)
+		require.NotNil(t, upload.Validation)
+		assert.False(t, upload.Validation.Valid())
+	})
+
+	t.Run("upload an archive", func(t *testing.T) {
+		archive := []byte("discord archive")
+		completed := make(chan struct{})
+		gomock.InOrder(
+			store.EXPECT().
+				CreateUpload(gomock.Any(), model.DiscordWorkspaceBackupType).
+				Return(nil).
+				Times(1),
+
+			store.EXPECT().
+				UpdateUploadChecksum(gomock.Any(), model.ChunkChecksum(archive)).
+				Return(nil).
+				Times(1),
+
+			store.EXPECT().
+				CompleteUpload(gomock.Any(), "").
+				DoAndReturn(func(uploadID, errorMessage string) error {
+					close(completed)
+					return nil
+				}).
+				Times(1),
+		)
+
+		resp, err := http.Post(fmt.Sprintf("%s/upload?type=discord", ts.URL), "application/octet-stream", bytes.NewReader(archive))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		select {
+		case <-completed:
+		case <-time.After(10 * time.Second):
+			t.Fatal("the upload was not completed")
+		}
+	})
+
+	t.Run("get the validation report of an upload", func(t *testing.T) {
+		report := model.NewValidationReport(model.MattermostWorkspaceBackupType)
+		report.AddError(model.ValidationIssue{File: "import.jsonl", Line: 3, Entity: "user", Field: "user", Message: "invalid username"})
+
+		store.EXPECT().
+			GetUpload("uploadID").
+			Return(&model.Upload{ID: "uploadID", Validation: report}, nil).
+			Times(1)
+
+		resp, err := http.Get(fmt.Sprintf("%s/upload/uploadID/validation", ts.URL))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		fetched, err := model.NewValidationReportFromReader(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, report, fetched)
+	})
+
+	t.Run("get the validation report of an upload which was not validated", func(t *testing.T) {
+		store.EXPECT().
+			GetUpload("uploadID").
+			Return(&model.Upload{ID: "uploadID"}, nil).
+			Times(1)
+
+		resp, err := http.Get(fmt.Sprintf("%s/upload/uploadID/validation", ts.URL))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("start a translation of an upload which failed validation", func(t *testing.T) {
+		report := model.NewValidationReport(model.SlackWorkspaceBackupType)
+		report.AddError(model.ValidationIssue{File: "users.json", Message: "missing from the export"})
+
+		store.EXPECT().
+			GetUpload("uploadID").
+			Return(&model.Upload{ID: "uploadID", Validation: report}, nil).
+			Times(1)
+
+		resp, err := http.Post(fmt.Sprintf("%s/translate", ts.URL), "application/json",
+			strings.NewReader(
+				`{"Type": "slack", "InstallationID": "installationID", "Archive": "uploadID.zip", "Team": "teamname", "UploadID": "uploadID"}`,
+			))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
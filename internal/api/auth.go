@@ -0,0 +1,193 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/awat/model"
+	"github.com/pkg/errors"
+)
+
+// Role is what a client of the API is allowed to do. Every role may
+// do what the roles before it may do.
+type Role int
+
+// The roles of clients of the API, from least to most privileged.
+const (
+	// RoleNone is not allowed to use the API at all.
+	RoleNone Role = iota
+
+	// RoleReadOnly may read the state of uploads, translations,
+	// imports and webhooks, and follow their events.
+	RoleReadOnly
+
+	// RoleProvisioner may also claim, renew, release and complete
+	// imports, as the provisioner performing them does.
+	RoleProvisioner
+
+	// RoleAdmin may also upload archives, start, cancel, retry and
+	// unlock translations and imports, and manage webhooks.
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleReadOnly:    "read-only",
+	RoleProvisioner: "provisioner",
+	RoleAdmin:       "admin",
+}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+
+	return "none"
+}
+
+// ParseRole returns the Role with the given name.
+func ParseRole(name string) (Role, error) {
+	for role, roleName := range roleNames {
+		if roleName == name {
+			return role, nil
+		}
+	}
+
+	return RoleNone, errors.Errorf("unknown role %q (valid options: admin, provisioner, read-only)", name)
+}
+
+// Principal is the client which sent a request, as told by its
+// credentials.
+type Principal struct {
+	Name string
+	Role Role
+}
+
+// Authenticator tells who sent a request by its credentials.
+type Authenticator interface {
+	// Authenticate returns the Principal which sent the request, nil
+	// if the request carries no credentials of the kind the
+	// Authenticator handles, or an error if its credentials are
+	// invalid.
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Authenticators is an Authenticator which asks each of its
+// Authenticators in turn, using the first Principal returned.
+type Authenticators []Authenticator
+
+// Authenticate satisfies the Authenticator interface.
+func (a Authenticators) Authenticate(r *http.Request) (*Principal, error) {
+	for _, authenticator := range a {
+		principal, err := authenticator.Authenticate(r)
+		if err != nil || principal != nil {
+			return principal, err
+		}
+	}
+
+	return nil, nil
+}
+
+// APIKeyAuthenticator authenticates requests by the static API key
+// they carry in the model.APIKeyHeader header.
+type APIKeyAuthenticator struct {
+	keys map[[sha256.Size]byte]Role
+}
+
+// NewAPIKeyAuthenticator returns an APIKeyAuthenticator granting the
+// given roles to the requests carrying the keys they are mapped to.
+func NewAPIKeyAuthenticator(keys map[string]Role) *APIKeyAuthenticator {
+	// Keys are looked up by their hash, so that the time taken does
+	// not tell how much of a key was guessed right.
+	hashed := make(map[[sha256.Size]byte]Role, len(keys))
+	for key, role := range keys {
+		hashed[sha256.Sum256([]byte(key))] = role
+	}
+
+	return &APIKeyAuthenticator{keys: hashed}
+}
+
+// Authenticate satisfies the Authenticator interface.
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(model.APIKeyHeader)
+	if key == "" {
+		return nil, nil
+	}
+
+	hash := sha256.Sum256([]byte(key))
+	for known, role := range a.keys {
+		if subtle.ConstantTimeCompare(hash[:], known[:]) == 1 {
+			// A prefix of the hash of the key tells keys apart
+			// without giving any part of them away.
+			return &Principal{Name: "api-key:" + hex.EncodeToString(hash[:6]), Role: role}, nil
+		}
+	}
+
+	return nil, errors.New("unknown API key")
+}
+
+// ParseAPIKeys parses API keys given as <role>:<key>.
+func ParseAPIKeys(values []string) (map[string]Role, error) {
+	keys := make(map[string]Role, len(values))
+	for _, value := range values {
+		name, key, found := strings.Cut(value, ":")
+		if !found || key == "" {
+			return nil, errors.New("API keys must be given as <role>:<key>")
+		}
+		role, err := ParseRole(name)
+		if err != nil {
+			return nil, err
+		}
+		keys[key] = role
+	}
+
+	return keys, nil
+}
+
+// bearerToken returns the bearer token of the Authorization header of
+// the request, or an empty string if it has none.
+func bearerToken(r *http.Request) string {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
+
+// authorize authenticates the request and checks that its Principal
+// has at least the given Role. Unless it does, an error response is
+// written and false is returned. Every request is authorized when no
+// Authenticator is configured.
+func authorize(c *Context, w http.ResponseWriter, r *http.Request, role Role) bool {
+	if c.Authenticator == nil {
+		return true
+	}
+
+	principal, err := c.Authenticator.Authenticate(r)
+	if err != nil {
+		c.Logger.WithError(err).Warn("failed to authenticate request")
+	}
+	if principal == nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="awat"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return false
+	}
+
+	c.Principal = principal
+	c.Logger = c.Logger.WithField("principal", principal.Name)
+
+	if principal.Role < role {
+		c.Logger.Warnf("the %s role is required, but the principal has the %s role", role, principal.Role)
+		w.WriteHeader(http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
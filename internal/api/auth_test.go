@@ -0,0 +1,343 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mock_api "github.com/mattermost/awat/internal/mocks/api"
+	mock_context "github.com/mattermost/awat/internal/mocks/context"
+	"github.com/mattermost/awat/internal/testlib"
+	"github.com/mattermost/awat/model"
+)
+
+func TestAPIKeyAuthorization(t *testing.T) {
+	logger := testlib.MakeLogger(t)
+	store := mock_api.NewMockStore(gomock.NewController(t))
+	router := mux.NewRouter()
+	Register(router, &Context{
+		Store:  store,
+		Logger: logger,
+		AWS:    &mock_context.MockAWS{ResourceExists: true},
+		Authenticator: NewAPIKeyAuthenticator(map[string]Role{
+			"admin-key":       RoleAdmin,
+			"provisioner-key": RoleProvisioner,
+			"read-only-key":   RoleReadOnly,
+		}),
+	})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	store.EXPECT().GetTranslation("foo").Return(nil, nil).AnyTimes()
+
+	// The requests allowed fail with a bad request or not found,
+	// as they are handled.
+	for _, tc := range []struct {
+		name   string
+		method string
+		path   string
+		key    string
+		status int
+	}{
+		{"no key", http.MethodGet, "/translation/foo", "", http.StatusUnauthorized},
+		{"unknown key", http.MethodGet, "/translation/foo", "bogus-key", http.StatusUnauthorized},
+		{"read-only reads", http.MethodGet, "/translation/foo", "read-only-key", http.StatusNotFound},
+		{"read-only completes import", http.MethodPut, "/import", "read-only-key", http.StatusForbidden},
+		{"provisioner reads", http.MethodGet, "/translation/foo", "provisioner-key", http.StatusNotFound},
+		{"provisioner completes import", http.MethodPut, "/import", "provisioner-key", http.StatusBadRequest},
+		{"provisioner creates webhook", http.MethodPost, "/webhooks", "provisioner-key", http.StatusForbidden},
+		{"admin completes import", http.MethodPut, "/import", "admin-key", http.StatusBadRequest},
+		{"admin creates webhook", http.MethodPost, "/webhooks", "admin-key", http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, ts.URL+tc.path, strings.NewReader("{"))
+			require.NoError(t, err)
+			if tc.key != "" {
+				req.Header.Set(model.APIKeyHeader, tc.key)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tc.status, resp.StatusCode)
+			if tc.status == http.StatusUnauthorized {
+				assert.NotEmpty(t, resp.Header.Get("WWW-Authenticate"))
+			}
+		})
+	}
+
+	t.Run("client", func(t *testing.T) {
+		client := model.NewClient(ts.URL)
+		_, err := client.GetTranslationStatus("foo")
+		assert.Error(t, err)
+
+		client.SetAPIKey("read-only-key")
+		status, err := client.GetTranslationStatus("foo")
+		assert.NoError(t, err)
+		assert.Nil(t, status)
+	})
+}
+
+func TestAPIKeyPrincipal(t *testing.T) {
+	authenticator := NewAPIKeyAuthenticator(map[string]Role{
+		"shared-prefix-a": RoleAdmin,
+		"shared-prefix-b": RoleReadOnly,
+	})
+	authenticate := func(key string) *Principal {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(model.APIKeyHeader, key)
+		principal, err := authenticator.Authenticate(req)
+		require.NoError(t, err)
+		return principal
+	}
+
+	a := authenticate("shared-prefix-a")
+	b := authenticate("shared-prefix-b")
+	assert.NotEqual(t, a.Name, b.Name)
+	assert.Equal(t, RoleAdmin, a.Role)
+	for _, principal := range []*Principal{a, b} {
+		assert.True(t, strings.HasPrefix(principal.Name, "api-key:"))
+		assert.NotContains(t, principal.Name, "shar")
+	}
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	keys, err := ParseAPIKeys([]string{"admin:a", "read-only:b:c"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Role{"a": RoleAdmin, "b:c": RoleReadOnly}, keys)
+
+	_, err = ParseAPIKeys([]string{"superuser:a"})
+	assert.Error(t, err)
+
+	_, err = ParseAPIKeys([]string{"admin"})
+	assert.Error(t, err)
+}
+
+// testIssuer signs tokens with an RSA and an EC key, which it serves
+// as a JWKS.
+type testIssuer struct {
+	rsaKey   *rsa.PrivateKey
+	ecKey    *ecdsa.PrivateKey
+	ec384Key *ecdsa.PrivateKey
+	server   *httptest.Server
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ec384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+
+	encode := func(i *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(i.Bytes())
+	}
+	jwks, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": encode(rsaKey.N), "e": encode(big.NewInt(int64(rsaKey.E)))},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encode(ecKey.X), "y": encode(ecKey.Y)},
+			{"kty": "EC", "kid": "ec384", "crv": "P-384", "x": encode(ec384Key.X), "y": encode(ec384Key.Y)},
+		},
+	})
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(jwks)
+	}))
+	t.Cleanup(server.Close)
+
+	return &testIssuer{rsaKey: rsaKey, ecKey: ecKey, ec384Key: ec384Key, server: server}
+}
+
+func (i *testIssuer) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	var err error
+	switch alg {
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, i.rsaKey, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case "ES256":
+		// The key with the ID ec384 signs with its own curve despite
+		// the algorithm.
+		key, size := i.ecKey, 32
+		if kid == "ec384" {
+			key, size = i.ec384Key, 48
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		require.NoError(t, err)
+		signature = append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTAuthorization(t *testing.T) {
+	issuer := newTestIssuer(t)
+	other := newTestIssuer(t)
+
+	logger := testlib.MakeLogger(t)
+	store := mock_api.NewMockStore(gomock.NewController(t))
+	router := mux.NewRouter()
+	Register(router, &Context{
+		Store:  store,
+		Logger: logger,
+		AWS:    &mock_context.MockAWS{ResourceExists: true},
+		Authenticator: NewJWTAuthenticator(JWTConfig{
+			JWKSURL:  issuer.server.URL,
+			Issuer:   "https://issuer",
+			Audience: "awat",
+		}),
+	})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	store.EXPECT().GetTranslation("foo").Return(nil, nil).AnyTimes()
+
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{
+			"sub":   "provisioner",
+			"iss":   "https://issuer",
+			"aud":   []string{"other", "awat"},
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"roles": []string{"read-only", "provisioner"},
+		}
+		for k, v := range changes {
+			if v == nil {
+				delete(claims, k)
+				continue
+			}
+			claims[k] = v
+		}
+		return claims
+	}
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{"no token", http.MethodGet, "/translation/foo", "", http.StatusUnauthorized},
+		{"valid RSA token", http.MethodPut, "/import", issuer.sign(t, "RS256", "rsa", claims(nil)), http.StatusBadRequest},
+		{"valid EC token", http.MethodPut, "/import", issuer.sign(t, "ES256", "ec", claims(nil)), http.StatusBadRequest},
+		{"token without key ID", http.MethodGet, "/translation/foo", issuer.sign(t, "RS256", "", claims(nil)), http.StatusNotFound},
+		{"roles as string", http.MethodPost, "/webhooks", issuer.sign(t, "RS256", "rsa", claims(map[string]interface{}{"roles": "admin"})), http.StatusBadRequest},
+		{"insufficient role", http.MethodPost, "/webhooks", issuer.sign(t, "RS256", "rsa", claims(nil)), http.StatusForbidden},
+		{"no role", http.MethodGet, "/translation/foo", issuer.sign(t, "RS256", "rsa", claims(map[string]interface{}{"roles": nil})), http.StatusForbidden},
+		{"expired", http.MethodGet, "/translation/foo", issuer.sign(t, "RS256", "rsa", claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})), http.StatusUnauthorized},
+		{"no expiry", http.MethodGet, "/translation/foo", issuer.sign(t, "RS256", "rsa", claims(map[string]interface{}{"exp": nil})), http.StatusUnauthorized},
+		{"not valid yet", http.MethodGet, "/translation/foo", issuer.sign(t, "RS256", "rsa", claims(map[string]interface{}{"nbf": time.Now().Add(time.Hour).Unix()})), http.StatusUnauthorized},
+		{"wrong issuer", http.MethodGet, "/translation/foo", issuer.sign(t, "RS256", "rsa", claims(map[string]interface{}{"iss": "https://other"})), http.StatusUnauthorized},
+		{"wrong audience", http.MethodGet, "/translation/foo", issuer.sign(t, "RS256", "rsa", claims(map[string]interface{}{"aud": "other"})), http.StatusUnauthorized},
+		{"unknown key", http.MethodGet, "/translation/foo", other.sign(t, "RS256", "rsa", claims(nil)), http.StatusUnauthorized},
+		{"unsigned", http.MethodGet, "/translation/foo", issuer.sign(t, "none", "rsa", claims(nil)), http.StatusUnauthorized},
+		{"wrong algorithm for key", http.MethodGet, "/translation/foo", issuer.sign(t, "ES256", "rsa", claims(nil)), http.StatusUnauthorized},
+		{"wrong curve for algorithm", http.MethodGet, "/translation/foo", issuer.sign(t, "ES256", "ec384", claims(nil)), http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, ts.URL+tc.path, strings.NewReader("{"))
+			require.NoError(t, err)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tc.status, resp.StatusCode)
+		})
+	}
+
+	t.Run("client", func(t *testing.T) {
+		client := model.NewClient(ts.URL)
+		client.SetToken(issuer.sign(t, "RS256", "rsa", claims(nil)))
+		status, err := client.GetTranslationStatus("foo")
+		assert.NoError(t, err)
+		assert.Nil(t, status)
+	})
+}
+
+func TestJWKSFetch(t *testing.T) {
+	var fetches int32
+	var failing, slow atomic.Bool
+	failing.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		if slow.Load() {
+			time.Sleep(200 * time.Millisecond)
+		}
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer server.Close()
+
+	authenticator := NewJWTAuthenticator(JWTConfig{JWKSURL: server.URL})
+
+	t.Run("failed fetch is not retried right away", func(t *testing.T) {
+		_, err := authenticator.getKeys("key")
+		assert.Error(t, err)
+		_, err = authenticator.getKeys("key")
+		assert.Error(t, err)
+		_, err = authenticator.getKeys("")
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+	})
+
+	t.Run("fetched again after the refetch interval", func(t *testing.T) {
+		failing.Store(false)
+		authenticator.fetchedAt = time.Now().Add(-2 * jwksMinRefetchInterval)
+		keys, err := authenticator.getKeys("")
+		assert.NoError(t, err)
+		assert.Empty(t, keys)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+	})
+
+	t.Run("concurrent fetches are shared", func(t *testing.T) {
+		authenticator.fetchedAt = time.Time{}
+		slow.Store(true)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, _ = authenticator.getKeys("")
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(3), atomic.LoadInt32(&fetches))
+	})
+}
@@ -5,15 +5,13 @@
 package api
 
 import (
-	"context"
 	"net/http"
 	"os"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	s3manager "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/smithy-go"
 	"github.com/mattermost/awat/internal/common"
+	"github.com/mattermost/awat/internal/objectstore"
+	"github.com/mattermost/awat/model"
 	cloudModel "github.com/mattermost/mattermost-cloud/model"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -27,119 +25,169 @@ type Context struct {
 	Logger    logrus.FieldLogger
 	AWS       AWS
 	Workdir   string
+	Encryptor *common.Encryptor
+
+	// Authenticator authenticates every request. If it is nil, every
+	// request is allowed.
+	Authenticator Authenticator
+
 	RequestID string
+	Principal *Principal
 }
 
-// AWS provides an interface to interact with AWS services.
+// AWS provides an interface to interact with the storage backend
+// holding uploaded and translated archives.
 type AWS interface {
 	GetBucketName() string
 	CheckBucketFileExists(file string) (bool, error)
 	UploadArchiveToS3(uploadFileName, destKeyName string) error
 	DownloadArchiveFromS3(filename string) (string, func(), error)
+	DeleteArchiveFromS3(filename string) error
+	StartMultipartUpload(destKeyName string) (string, error)
+	UploadArchivePart(destKeyName, multipartID string, number int, partFileName, checksum string) (string, error)
+	CompleteMultipartUpload(destKeyName, multipartID string, parts []*model.UploadPart) error
+	AbortMultipartUpload(destKeyName, multipartID string) error
+	PresignArchiveUpload(destKeyName string, size int64, checksum string, expires time.Duration) (*model.PresignedRequest, error)
+	PresignArchivePartUpload(destKeyName, multipartID string, number int, size int64, checksum string, expires time.Duration) (*model.PresignedRequest, error)
 }
 
-// AWSContext implements the AWS interface and provides methods to interact with AWS S3.
+// AWSContext implements the AWS interface on top of an ObjectStore,
+// which may be backed by S3 or by the local filesystem.
 type AWSContext struct {
-	s3Client *s3.Client
-	bucket   string
+	objectStore objectstore.ObjectStore
 }
 
-// NewAWSContext creates a new AWSContext with the specified bucket name.
-func NewAWSContext(bucket string) (*AWSContext, error) {
-	awsConfig, err := common.NewAWSConfig()
-	if err != nil {
-		return nil, err
-	}
-
-	s3Client := s3.NewFromConfig(awsConfig)
-
+// NewAWSContext creates a new AWSContext which stores archives in the
+// given ObjectStore.
+func NewAWSContext(objectStore objectstore.ObjectStore) *AWSContext {
 	return &AWSContext{
-		s3Client: s3Client,
-		bucket:   bucket,
-	}, nil
+		objectStore: objectStore,
+	}
 }
 
-// GetBucketName returns the name of the S3 bucket used in AWSContext.
+// GetBucketName returns the name of the bucket used in AWSContext.
 func (a *AWSContext) GetBucketName() string {
-	return a.bucket
+	return a.objectStore.Bucket()
 }
 
-// CheckBucketFileExists checks if a file exists in the S3 bucket.
+// CheckBucketFileExists checks if a file exists in the bucket.
 func (a *AWSContext) CheckBucketFileExists(file string) (bool, error) {
-	_, err := a.s3Client.HeadObject(context.TODO(), &s3.HeadObjectInput{
-		Bucket: aws.String(a.bucket),
-		Key:    aws.String(file),
-	})
+	return a.objectStore.Exists(file)
+}
+
+// UploadArchiveToS3 uploads a file to the bucket.
+func (a *AWSContext) UploadArchiveToS3(uploadFileName, destKeyName string) error {
+	return a.objectStore.Upload(uploadFileName, destKeyName)
+}
 
+// DownloadArchiveFromS3 downloads a file from the bucket.
+func (a *AWSContext) DownloadArchiveFromS3(archiveName string) (path string, cleanup func(), err error) {
+	tempFile, err := os.CreateTemp("", "awat-archive-")
 	if err != nil {
-		var awsErr smithy.APIError
-		if errors.As(err, &awsErr) {
-			switch awsErr.ErrorCode() {
-			case "NoSuchBucket":
-				return false, errors.Errorf("bucket %s does not exist", a.bucket)
-			case "NotFound":
-				return false, nil
-			}
-		}
-		return false, err
+		return "", nil, errors.Wrap(err, "error creating tempoorary file to write to")
 	}
+	tempFile.Close()
 
-	return true, nil
-}
+	path = tempFile.Name()
+	cleanup = func() {
+		os.Remove(path)
+	}
 
-// UploadArchiveToS3 uploads a file to an S3 bucket.
-func (a *AWSContext) UploadArchiveToS3(uploadFileName, destKeyName string) error {
-	uploadFile, err := os.Open(uploadFileName)
+	_, err = a.objectStore.Download(archiveName, path)
 	if err != nil {
-		return errors.New("failed to open file before upload")
+		cleanup()
+		return "", nil, errors.Wrap(err, "error downloading archive")
 	}
 
-	uploader := s3manager.NewUploader(a.s3Client)
-	_, err = uploader.Upload(
-		context.TODO(),
-		&s3.PutObjectInput{
-			Bucket: aws.String(a.GetBucketName()),
-			Key:    &destKeyName,
-			Body:   uploadFile,
+	return path, cleanup, nil
+}
+
+// DeleteArchiveFromS3 deletes a file from the bucket.
+func (a *AWSContext) DeleteArchiveFromS3(archiveName string) error {
+	return a.objectStore.Delete(archiveName)
+}
+
+// StartMultipartUpload starts uploading a file to the bucket in parts
+// and returns the ID of the multipart upload.
+func (a *AWSContext) StartMultipartUpload(destKeyName string) (string, error) {
+	return a.objectStore.CreateMultipartUpload(destKeyName)
+}
+
+// UploadArchivePart uploads a part of a file to the bucket and returns
+// its ETag.
+func (a *AWSContext) UploadArchivePart(destKeyName, multipartID string, number int, partFileName, checksum string) (string, error) {
+	return a.objectStore.UploadPart(destKeyName, multipartID, int32(number), partFileName, checksum)
+}
+
+// CompleteMultipartUpload assembles a file in the bucket from its
+// uploaded parts.
+func (a *AWSContext) CompleteMultipartUpload(destKeyName, multipartID string, parts []*model.UploadPart) error {
+	objectParts := make([]objectstore.Part, 0, len(parts))
+	for _, part := range parts {
+		objectParts = append(objectParts, objectstore.Part{
+			Number:   int32(part.Number),
+			ETag:     part.ETag,
+			Checksum: part.Checksum,
 		})
-	return err
+	}
+
+	return a.objectStore.CompleteMultipartUpload(destKeyName, multipartID, objectParts)
 }
 
-// DownloadArchiveFromS3 downloads a file from an S3 bucket.
-func (a *AWSContext) DownloadArchiveFromS3(archiveName string) (path string, cleanup func(), err error) {
-	tempFile, err := os.CreateTemp("", "awat-archive-")
+// AbortMultipartUpload discards the uploaded parts of a file.
+func (a *AWSContext) AbortMultipartUpload(destKeyName, multipartID string) error {
+	return a.objectStore.AbortMultipartUpload(destKeyName, multipartID)
+}
+
+// PresignArchiveUpload returns a request uploading a file with the
+// given size and checksum straight to the bucket.
+func (a *AWSContext) PresignArchiveUpload(destKeyName string, size int64, checksum string, expires time.Duration) (*model.PresignedRequest, error) {
+	request, err := a.objectStore.PresignUpload(destKeyName, size, checksum, expires)
 	if err != nil {
-		return "", nil, errors.Wrap(err, "error creating tempoorary file to write to")
+		return nil, err
 	}
 
-	downloader := s3manager.NewDownloader(a.s3Client)
+	return presignedRequest(request), nil
+}
 
-	_, err = downloader.Download(
-		context.TODO(),
-		tempFile,
-		&s3.GetObjectInput{
-			Bucket: aws.String(a.GetBucketName()),
-			Key:    aws.String(archiveName),
-		})
+// PresignArchivePartUpload returns a request uploading a part of a
+// multipart upload straight to the bucket.
+func (a *AWSContext) PresignArchivePartUpload(destKeyName, multipartID string, number int, size int64, checksum string, expires time.Duration) (*model.PresignedRequest, error) {
+	request, err := a.objectStore.PresignUploadPart(destKeyName, multipartID, int32(number), size, checksum, expires)
 	if err != nil {
-		return "", nil, errors.Wrap(err, "error downloading from s3")
+		return nil, err
 	}
 
-	path = tempFile.Name()
-	cleanup = func() {
-		os.Remove(path)
+	return presignedRequest(request), nil
+}
+
+// presignedRequest converts a request presigned by the ObjectStore for
+// clients, leaving out the headers their HTTP client sets.
+func presignedRequest(request *objectstore.PresignedRequest) *model.PresignedRequest {
+	header := make(map[string]string, len(request.Header))
+	for k := range request.Header {
+		if k == "Host" || k == "Content-Length" {
+			continue
+		}
+		header[k] = request.Header.Get(k)
 	}
 
-	return path, cleanup, err
+	return &model.PresignedRequest{
+		Method: request.Method,
+		URL:    request.URL,
+		Header: header,
+	}
 }
 
 // Clone creates a shallow copy of context, allowing clones to apply per-request changes.
 func (c *Context) Clone() *Context {
 	return &Context{
-		Store:   c.Store,
-		Logger:  c.Logger,
-		AWS:     c.AWS,
-		Workdir: c.Workdir,
+		Store:         c.Store,
+		Logger:        c.Logger,
+		AWS:           c.AWS,
+		Workdir:       c.Workdir,
+		Encryptor:     c.Encryptor,
+		Authenticator: c.Authenticator,
 	}
 }
 
@@ -148,6 +196,7 @@ type contextHandlerFunc func(c *Context, w http.ResponseWriter, r *http.Request)
 type contextHandler struct {
 	context *Context
 	handler contextHandlerFunc
+	role    Role
 }
 
 // ServeHTTP satisfies the Handler interface for contextHandler
@@ -160,12 +209,19 @@ func (h contextHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			"request": context.RequestID,
 		})
 
+	if !authorize(context, w, r, h.role) {
+		return
+	}
+
 	h.handler(context, w, r)
 }
 
-func newContextHandler(context *Context, handler contextHandlerFunc) *contextHandler {
+// newContextHandler returns a contextHandler serving the requests of
+// principals with at least the given Role.
+func newContextHandler(context *Context, handler contextHandlerFunc, role Role) *contextHandler {
 	return &contextHandler{
 		context: context,
 		handler: handler,
+		role:    role,
 	}
 }
@@ -0,0 +1,151 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mattermost/awat/model"
+)
+
+// eventPollInterval is how often a stream of events looks for new
+// events. Events are read from the database rather than passed between
+// goroutines, so that a stream receives the events of every AWAT.
+var eventPollInterval = time.Second
+
+// eventKeepAliveInterval is how long a stream may be idle before a
+// comment is sent to keep proxies from closing the connection.
+const eventKeepAliveInterval = 15 * time.Second
+
+// eventBatchSize is the number of events read from the database at
+// once.
+const eventBatchSize = 100
+
+// handleStreamEvents responds to GET /events with a stream of
+// server-sent events holding the state changes of Translations and
+// Imports and the progress of running Translations. The installation,
+// translation and import query parameters filter the events. The
+// stream starts with the events created after the one whose Sequence
+// is given as the Last-Event-ID header or the after query parameter,
+// or else with the events created from now on.
+func handleStreamEvents(c *Context, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := &model.EventFilter{
+		InstallationID: query.Get("installation"),
+		TranslationID:  query.Get("translation"),
+		ImportID:       query.Get("import"),
+	}
+
+	after := r.Header.Get("Last-Event-ID")
+	if after == "" {
+		after = query.Get("after")
+	}
+	if after != "" {
+		sequence, err := strconv.ParseInt(after, 10, 64)
+		if err != nil || sequence < 0 {
+			c.Logger.WithError(err).Errorf("invalid event ID %q to resume the stream after", after)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		filter.After = sequence
+	} else {
+		sequence, err := c.Store.GetLatestEventSequence()
+		if err != nil {
+			c.Logger.WithError(err).Error("failed to find the latest event")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		filter.After = sequence
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		c.Logger.Error("response writer does not support streaming")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// The stream runs until the client goes away, which the write
+	// timeout of the server must not cut short.
+	err := http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil {
+		c.Logger.WithError(err).Debug("failed to lift the write deadline of the event stream")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	// Announce where the stream starts, so that clients resume it from
+	// there even if it breaks off before any event is sent.
+	_, err = fmt.Fprintf(w, "id: %d\n\n", filter.After)
+	if err != nil {
+		return
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(eventPollInterval)
+	defer ticker.Stop()
+	lastWrite := time.Now()
+
+	for {
+		events, err := c.Store.GetEvents(filter, eventBatchSize)
+		if err != nil {
+			// Ending the stream makes the client reconnect and resume
+			// from the last event it received.
+			c.Logger.WithError(err).Error("failed to fetch events")
+			return
+		}
+
+		for _, event := range events {
+			err = writeEvent(w, event)
+			if err != nil {
+				c.Logger.WithError(err).Debug("failed to write event, the client most likely went away")
+				return
+			}
+			filter.After = event.Sequence
+		}
+
+		if len(events) > 0 {
+			flusher.Flush()
+			lastWrite = time.Now()
+		} else if time.Since(lastWrite) >= eventKeepAliveInterval {
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+			lastWrite = time.Now()
+		}
+
+		if len(events) == eventBatchSize {
+			// there are likely more events waiting
+			continue
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeEvent writes an event in the format of server-sent events,
+// using its Kind as the event type and its Sequence as the event ID.
+func writeEvent(w http.ResponseWriter, event *model.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Sequence, event.Kind, data)
+	return err
+}
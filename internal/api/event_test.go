@@ -0,0 +1,100 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mock_api "github.com/mattermost/awat/internal/mocks/api"
+	"github.com/mattermost/awat/internal/testlib"
+	"github.com/mattermost/awat/model"
+)
+
+func TestStreamEvents(t *testing.T) {
+	eventPollInterval = 10 * time.Millisecond
+
+	logger := testlib.MakeLogger(t)
+	mockController := gomock.NewController(t)
+	store := mock_api.NewMockStore(mockController)
+	router := mux.NewRouter()
+	Register(router, &Context{
+		Store:  store,
+		Logger: logger,
+	})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	events := []*model.Event{
+		{Sequence: 6, Kind: model.EventKindState, Type: model.WebhookEventTranslation, ResourceID: "translationID", TranslationID: "translationID", OldState: model.TranslationStateRequested, NewState: model.TranslationStateInProgress},
+		{Sequence: 7, Kind: model.EventKindProgress, Type: model.WebhookEventTranslation, ResourceID: "translationID", TranslationID: "translationID", Phase: model.TranslationPhaseUpload, Message: "Uploaded 50 of 100 bytes", Done: 50, Total: 100},
+		{Sequence: 8, Kind: model.EventKindState, Type: model.WebhookEventTranslation, ResourceID: "translationID", TranslationID: "translationID", OldState: model.TranslationStateInProgress, NewState: model.TranslationStateComplete},
+	}
+	getEvents := func(filter *model.EventFilter, limit uint64) ([]*model.Event, error) {
+		assert.Equal(t, "translationID", filter.TranslationID)
+		assert.Equal(t, uint64(eventBatchSize), limit)
+		var after []*model.Event
+		for _, event := range events {
+			if event.Sequence > filter.After {
+				after = append(after, event)
+			}
+		}
+		return after, nil
+	}
+
+	t.Run("stream the events from now on", func(t *testing.T) {
+		store.EXPECT().
+			GetLatestEventSequence().
+			Return(int64(6), nil).
+			Times(1)
+		store.EXPECT().
+			GetEvents(gomock.Any(), gomock.Any()).
+			DoAndReturn(getEvents).
+			AnyTimes()
+
+		var received []*model.Event
+		err := model.NewClient(ts.URL).WatchTranslation("translationID", func(event *model.Event) bool {
+			received = append(received, event)
+			return event.Kind != model.EventKindState
+		})
+		require.NoError(t, err)
+		require.Len(t, received, 2)
+		assert.Equal(t, int64(7), received[0].Sequence)
+		assert.Equal(t, model.TranslationPhaseUpload, received[0].Phase)
+		assert.Equal(t, int64(50), received[0].Done)
+		assert.Equal(t, int64(8), received[1].Sequence)
+		assert.Equal(t, model.TranslationStateComplete, received[1].NewState)
+	})
+
+	t.Run("resume the stream", func(t *testing.T) {
+		store.EXPECT().
+			GetEvents(gomock.Any(), gomock.Any()).
+			DoAndReturn(getEvents).
+			AnyTimes()
+
+		var received []int64
+		err := model.NewClient(ts.URL).WatchEvents(&model.EventFilter{TranslationID: "translationID", After: 5}, func(event *model.Event) bool {
+			received = append(received, event.Sequence)
+			return event.Sequence < 8
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []int64{6, 7, 8}, received)
+	})
+
+	t.Run("resume after an invalid event", func(t *testing.T) {
+		resp, err := http.Get(fmt.Sprintf("%s/events?after=bogus", ts.URL))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
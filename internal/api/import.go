@@ -16,7 +16,9 @@ import (
 // handleStartImport handles POST requests sent to /import This
 // endpoint takes an ID, locks the oldest Import awaiting work with
 // that ID, and returns the metadata associated with that Import in
-// order for a Provisioner to being work on it
+// order for a Provisioner to being work on it. The archive of the
+// Import was verified against its checksum by the supervisor before
+// the Import became ready.
 func handleStartImport(c *Context, w http.ResponseWriter, r *http.Request) {
 	workRequest, err := model.NewImportWorkRequestFromReader(r.Body)
 	if err != nil {
@@ -37,14 +39,15 @@ func handleStartImport(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
 	status, err := importStatusFromImport(work, c.Store)
 	if err != nil {
 		c.Logger.WithError(err).Errorf("failed to get ImportStatus for Import %s", work.ID)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
 	outputJSON(c, w, status)
 }
 
@@ -70,11 +73,173 @@ func handleReleaseLockOnImport(c *Context, w http.ResponseWriter, r *http.Reques
 	w.WriteHeader(http.StatusOK)
 }
 
-// handleListImports responds to GET /imports and returns all Imports
-// in the database
-// TODO add pagination to this endpoint
+// handleCancelImport responds to POST /import/{id}/cancel by
+// cancelling the Import. An Import which has not been claimed by a
+// Provisioner yet is cancelled right away. Otherwise the Import is
+// marked for cancellation and the supervisor reverts the Installation
+// once it is stable again; an import already running on the
+// Installation cannot be stopped.
+func handleCancelImport(c *Context, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	importID := vars["id"]
+	imprt, err := c.Store.GetImport(importID)
+	if err != nil {
+		c.Logger.WithError(err).Errorf("failed to fetch import with ID %s", importID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if imprt == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	oldState := imprt.State
+	if imprt.State != model.ImportStateCancelled && imprt.State != model.ImportStateCancelRequested {
+		state, ok := imprt.CancelState()
+		if !ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		reason := "cancelled"
+		if c.Principal != nil {
+			reason += " by " + c.Principal.Name
+		}
+		cancelled, err := c.Store.CancelImport(imprt, state, reason)
+		if err != nil {
+			c.Logger.WithError(err).Errorf("failed to cancel import with ID %s", importID)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !cancelled {
+			// the Import is being worked on or changed state in
+			// the meantime, so the request may be retried
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		c.Logger.WithField("import", importID).Infof("Moved import to state %s", state)
+	}
+
+	status, err := importStatusFromImport(imprt, c.Store)
+	if err != nil {
+		c.Logger.WithError(err).Errorf("failed to generate ImportStatus with ID %s", importID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	emitEvent(c, model.NewImportEvent(imprt, status.InstallationID, oldState))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	outputJSON(c, w, status)
+}
+
+// handleUnlockImport responds to POST /import/{id}/unlock by releasing
+// both the lock a supervisor holds on the Import and the claim of a
+// Provisioner on it. An Import which has not completed yet becomes
+// available to be claimed again.
+func handleUnlockImport(c *Context, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	importID := vars["id"]
+	imprt, err := c.Store.GetImport(importID)
+	if err != nil {
+		c.Logger.WithError(err).Errorf("failed to fetch import with ID %s", importID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if imprt == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	logger := c.Logger.WithField("import", importID)
+	if imprt.LockedBy != "" {
+		owner := imprt.LockedBy
+		released, err := c.Store.ReleaseImportLock(imprt, model.LockReleaseReasonManual)
+		if err != nil {
+			logger.WithError(err).Error("failed to unlock import")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !released {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		logger.WithField("owner", owner).Warn("Released import lock")
+	}
+
+	if imprt.ImportBy != "" {
+		provisioner := imprt.ImportBy
+		released, err := c.Store.ReleaseImportClaim(imprt, model.LockReleaseReasonManual)
+		if err != nil {
+			logger.WithError(err).Error("failed to release provisioner claim on import")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !released {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		logger.WithField("provisioner", provisioner).Warn("Released provisioner claim on import")
+	}
+
+	status, err := importStatusFromImport(imprt, c.Store)
+	if err != nil {
+		logger.WithError(err).Error("failed to generate ImportStatus")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	outputJSON(c, w, status)
+}
+
+// handleRenewImportClaim responds to POST /import/{id}/heartbeat by
+// extending the lease of the claim the Provisioner in the request
+// holds on the Import. Provisioners working on an Import for a long
+// time should send heartbeats so that their claim is not released as
+// stale.
+func handleRenewImportClaim(c *Context, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	importID := vars["id"]
+
+	workRequest, err := model.NewImportWorkRequestFromReader(r.Body)
+	if err != nil {
+		c.Logger.WithError(err).Error("failed to unmarshal heartbeat")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if workRequest.ProvisionerID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	renewed, err := c.Store.RenewImportClaim(importID, workRequest.ProvisionerID)
+	if err != nil {
+		c.Logger.WithError(err).Errorf("failed to renew claim on import with ID %s", importID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !renewed {
+		// the claim was released, or the Import does not exist
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleListImports responds to GET /imports and returns the page of
+// Imports selected by the page, per_page, state, type, installation,
+// created_after, created_before, sort and order query parameters
 func handleListImports(c *Context, w http.ResponseWriter, r *http.Request) {
-	imports, err := c.Store.GetAllImports()
+	options := parseListOptions(c, w, r, model.AllImportStates)
+	if options == nil {
+		return
+	}
+
+	imports, err := c.Store.GetImports(options)
 	if err != nil {
 		c.Logger.WithError(err).Error("failed to fetch imports")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -118,6 +283,34 @@ func handleGetImport(c *Context, w http.ResponseWriter, r *http.Request) {
 	outputJSON(c, w, status)
 }
 
+// handleGetImportTransitions responds to GET /import/{id}/transitions
+// with the state changes of the Import, oldest first
+func handleGetImportTransitions(c *Context, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	importID := vars["id"]
+	imprt, err := c.Store.GetImport(importID)
+	if err != nil {
+		c.Logger.WithError(err).Errorf("failed to fetch import with ID %s", importID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if imprt == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	transitions, err := c.Store.GetImportTransitions(importID)
+	if err != nil {
+		c.Logger.WithError(err).Errorf("failed to fetch transitions of import with ID %s", importID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	outputJSON(c, w, transitions)
+}
+
 // handleGetImportStatusesByInstallation allows easily looking up all
 // Imports related to an Installation by the Installation ID
 func handleGetImportStatusesByInstallation(c *Context, w http.ResponseWriter, r *http.Request) {
@@ -167,7 +360,11 @@ func handleCompleteImport(c *Context, w http.ResponseWriter, r *http.Request) {
 
 	imp.CompleteAt = completed.CompleteAt
 	imp.ImportBy = ""
-	imp.Error = completed.Error
+	if completed.Error != "" {
+		// keep the reason the supervisor may have recorded already,
+		// e.g. the import exceeding its deadline
+		imp.AddError(completed.Error)
+	}
 
 	err = c.Store.UpdateImport(imp)
 	if err != nil {
@@ -191,6 +388,9 @@ func importStatusFromImport(imp *model.Import, store Store) (*model.ImportStatus
 		Team:           translation.Team,
 		State:          imp.State,
 		Type:           translation.Type,
+		Checksum:       translation.OutputChecksum,
+
+		InstallationChanges: imp.InstallationChanges(),
 	}, nil
 }
 
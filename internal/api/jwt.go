@@ -0,0 +1,368 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// jwtLeeway is how far the clocks of the AWAT and the issuer of a
+	// token may be apart.
+	jwtLeeway = time.Minute
+
+	// jwksMaxAge is how long the keys of the JWKS are used before they
+	// are fetched again.
+	jwksMaxAge = time.Hour
+
+	// jwksMinRefetchInterval is how long the JWKS is not fetched again
+	// after it was, or after fetching it failed, even for tokens signed
+	// by an unknown key, so that such tokens cannot be used to flood the
+	// issuer with requests.
+	jwksMinRefetchInterval = time.Minute
+
+	// DefaultRolesClaim is the claim of a token holding the roles of
+	// its subject unless configured otherwise.
+	DefaultRolesClaim = "roles"
+)
+
+// jwtMethods are the signing algorithms tokens are accepted with. Only
+// asymmetric algorithms are supported, so that tokens cannot be forged
+// with the public keys.
+var jwtMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+}
+
+// JWTConfig configures how bearer tokens are validated.
+type JWTConfig struct {
+	// JWKSURL is the URL of the JSON Web Key Set holding the keys the
+	// tokens are signed with.
+	JWKSURL string
+
+	// Issuer, if set, must be the iss claim of the tokens.
+	Issuer string
+
+	// Audience, if set, must be one of the aud claim of the tokens.
+	Audience string
+
+	// RolesClaim is the claim holding the roles of the subject of a
+	// token, either as an array or as a space separated string. The
+	// most privileged of the roles is granted. DefaultRolesClaim is
+	// used if it is not set.
+	RolesClaim string
+
+	// HTTPClient is the client to fetch the JWKS with, or a client
+	// with a timeout if it is nil.
+	HTTPClient *http.Client
+}
+
+// JWTAuthenticator authenticates requests by the signed JSON Web Token
+// they carry as an OAuth2 bearer token.
+type JWTAuthenticator struct {
+	config JWTConfig
+
+	// fetches makes concurrent requests share a single fetch of the
+	// JWKS, which is done without holding mu.
+	fetches singleflight.Group
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// NewJWTAuthenticator returns a JWTAuthenticator validating tokens as
+// configured.
+func NewJWTAuthenticator(config JWTConfig) *JWTAuthenticator {
+	if config.RolesClaim == "" {
+		config.RolesClaim = DefaultRolesClaim
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &JWTAuthenticator{config: config}
+}
+
+// Authenticate satisfies the Authenticator interface.
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, nil
+	}
+
+	claims, err := a.verify(token, time.Now())
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid bearer token")
+	}
+
+	subject, _ := claims["sub"].(string)
+	principal := &Principal{Name: "jwt:" + subject, Role: RoleNone}
+	for _, name := range claimStrings(claims[a.config.RolesClaim]) {
+		role, err := ParseRole(name)
+		if err == nil && role > principal.Role {
+			principal.Role = role
+		}
+	}
+
+	return principal, nil
+}
+
+// verify checks the signature and the claims of the token and returns
+// its claims.
+func (a *JWTAuthenticator) verify(token string, now time.Time) (jwt.MapClaims, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(jwtMethods),
+		jwt.WithLeeway(jwtLeeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(func() time.Time { return now }),
+	}
+	if a.config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(a.config.Issuer))
+	}
+	if a.config.Audience != "" {
+		options = append(options, jwt.WithAudience(a.config.Audience))
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, a.keyFunc, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// keyFunc returns the keys the token may have been signed with, which
+// are those of the JWKS with the key ID of the token, or every key if
+// the token names none, that fit its signing algorithm.
+func (a *JWTAuthenticator) keyFunc(token *jwt.Token) (interface{}, error) {
+	keyID, _ := token.Header["kid"].(string)
+	keys, err := a.getKeys(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var set jwt.VerificationKeySet
+	for _, key := range keys {
+		if keyFitsMethod(key, token.Method) {
+			set.Keys = append(set.Keys, key)
+		}
+	}
+	if len(set.Keys) == 0 {
+		return nil, errors.Errorf("no key for algorithm %s", token.Method.Alg())
+	}
+
+	return set, nil
+}
+
+// keyFitsMethod returns whether the key may verify signatures made with
+// the signing method: RSA keys those of the RSA algorithms, and EC keys
+// those of the ECDSA algorithm for their curve.
+func keyFitsMethod(key crypto.PublicKey, method jwt.SigningMethod) bool {
+	switch method := method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok := key.(*rsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodECDSA:
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		return ok && ecKey.Curve.Params().BitSize == method.CurveBits
+	default:
+		return false
+	}
+}
+
+// getKeys returns the key with the given ID, or every key if the token
+// names none, fetching the JWKS if it is stale or lacks the key.
+func (a *JWTAuthenticator) getKeys(keyID string) ([]crypto.PublicKey, error) {
+	a.mu.Lock()
+	sinceFetch := time.Since(a.fetchedAt)
+	_, known := a.keys[keyID]
+	missing := a.keys == nil || (keyID != "" && !known)
+	a.mu.Unlock()
+
+	if sinceFetch > jwksMaxAge || (missing && sinceFetch > jwksMinRefetchInterval) {
+		_, err, _ := a.fetches.Do("jwks", func() (interface{}, error) {
+			keys, err := fetchJWKS(a.config.HTTPClient, a.config.JWKSURL)
+
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			// The keys fetched before are used while the JWKS cannot
+			// be fetched, and a failed fetch is not retried before
+			// jwksMinRefetchInterval either.
+			a.fetchedAt = time.Now()
+			if err == nil {
+				a.keys = keys
+			}
+			return nil, err
+		})
+		if err != nil {
+			a.mu.Lock()
+			loaded := a.keys != nil
+			a.mu.Unlock()
+			if !loaded {
+				return nil, err
+			}
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.keys == nil {
+		return nil, errors.New("JWKS has not been fetched")
+	}
+	if keyID != "" {
+		key, ok := a.keys[keyID]
+		if !ok {
+			return nil, errors.Errorf("unknown key %q", keyID)
+		}
+		return []crypto.PublicKey{key}, nil
+	}
+
+	keys := make([]crypto.PublicKey, 0, len(a.keys))
+	for _, key := range a.keys {
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// jwk is a JSON Web Key holding an RSA or EC public key.
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// fetchJWKS fetches the JWKS at url and returns its signing keys by
+// their IDs. Keys of unsupported types are skipped.
+func fetchJWKS(client *http.Client, url string) (map[string]crypto.PublicKey, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch JWKS")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&set)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode JWKS")
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.KeyID] = key
+	}
+
+	return keys, nil
+}
+
+// publicKey returns the public key the JWK holds.
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("RSA exponent is too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, errors.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+// decodeBigInt decodes a base64url encoded unsigned integer of a JWK.
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("integer is empty")
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
+
+// claimStrings returns the strings of a claim which is either a space
+// separated string or an array of strings.
+func claimStrings(claim interface{}) []string {
+	switch claim := claim.(type) {
+	case string:
+		return strings.Fields(claim)
+	case []interface{}:
+		var values []string
+		for _, value := range claim {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
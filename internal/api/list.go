@@ -0,0 +1,31 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package api
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/mattermost/awat/model"
+	"github.com/pkg/errors"
+)
+
+// parseListOptions parses the paging, filters and sort order of a
+// request listing items, which may filter by the given states. If they
+// are invalid, a bad request response is written and nil is returned.
+func parseListOptions(c *Context, w http.ResponseWriter, r *http.Request, states []string) *model.ListOptions {
+	options, err := model.NewListOptionsFromQuery(r.URL.Query())
+	if err == nil && options.State != "" && !slices.Contains(states, options.State) {
+		err = errors.Errorf("invalid state %q", options.State)
+	}
+	if err != nil {
+		c.Logger.WithError(err).Error("invalid list options")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(err.Error()))
+		return nil
+	}
+
+	return options
+}
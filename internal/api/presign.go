@@ -0,0 +1,231 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mattermost/awat/internal/objectstore"
+	"github.com/mattermost/awat/model"
+	"github.com/pkg/errors"
+)
+
+// presignExpiry is how long presigned requests may be used for.
+const presignExpiry = 12 * time.Hour
+
+// handlePresignUpload responds to POST /upload/presign with presigned
+// requests uploading an archive straight to the bucket, in parts of an
+// S3 multipart upload if the request lists their checksums. The
+// requests carry the checksums, so that S3 rejects corrupted uploads.
+func handlePresignUpload(c *Context, w http.ResponseWriter, r *http.Request) {
+	request, err := model.NewPresignRequestFromReader(r.Body)
+	if err != nil {
+		c.Logger.WithError(err).Error("failed to unmarshal JSON from request")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err = request.Validate(); err != nil {
+		c.Logger.WithError(err).Error("presign request validation failed")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	session := &model.UploadSession{
+		ID:              model.NewID(),
+		Type:            request.Type,
+		Size:            request.Size,
+		ChunkSize:       request.Size,
+		Presigned:       true,
+		Checksum:        request.Checksum,
+		ValidateArchive: request.ValidateArchive,
+	}
+	logger := c.Logger.WithField("upload", session.ID)
+	presigned := &model.PresignedUpload{
+		UploadID:  session.ID,
+		ExpiresAt: model.GetMillis() + presignExpiry.Milliseconds(),
+	}
+
+	if len(request.PartChecksums) == 0 {
+		presigned.Request, err = c.AWS.PresignArchiveUpload(session.ArchiveName(), session.Size, session.Checksum, presignExpiry)
+	} else {
+		session.ChunkSize = request.ChunkSize
+		session.MultipartID, err = c.AWS.StartMultipartUpload(session.ArchiveName())
+		if err != nil {
+			logger.WithError(err).Error("failed to start multipart upload")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		presigned.Parts, err = presignParts(c, session, request.PartChecksums)
+		if err != nil {
+			abortErr := c.AWS.AbortMultipartUpload(session.ArchiveName(), session.MultipartID)
+			if abortErr != nil {
+				logger.WithError(abortErr).Warn("failed to abort multipart upload")
+			}
+		}
+	}
+	if errors.Is(err, objectstore.ErrPresignNotSupported) {
+		logger.WithError(err).Error("cannot presign uploads")
+		w.WriteHeader(http.StatusNotImplemented)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	if err != nil {
+		logger.WithError(err).Error("failed to presign upload")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = c.Store.CreateUploadSession(session)
+	if err != nil {
+		logger.WithError(err).Error("failed to store upload session")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	logger.Infof("Presigned upload of %d bytes in %d parts", session.Size, session.Chunks())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	outputJSON(c, w, presigned)
+}
+
+// presignParts presigns the requests uploading each part of a
+// multipart upload.
+func presignParts(c *Context, session *model.UploadSession, checksums []string) ([]*model.PresignedPart, error) {
+	parts := make([]*model.PresignedPart, 0, session.Chunks())
+	for number := 1; number <= session.Chunks(); number++ {
+		size := session.ChunkLength(number)
+		request, err := c.AWS.PresignArchivePartUpload(session.ArchiveName(), session.MultipartID, number, size, checksums[number-1], presignExpiry)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, &model.PresignedPart{
+			PresignedRequest: *request,
+			Number:           number,
+			Offset:           int64(number-1) * session.ChunkSize,
+			Size:             size,
+		})
+	}
+
+	return parts, nil
+}
+
+// handleCompletePresignedUpload responds to POST
+// /upload/presign/{id}/complete, which a client calls once it uploaded
+// an archive straight to the bucket, by completing the multipart
+// upload, if the archive was uploaded in parts, and then having the
+// UploadSupervisor verify the archive in the background. The Upload is
+// complete once its size and checksum were verified, and it was
+// validated if that was requested.
+func handleCompletePresignedUpload(c *Context, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uploadID := vars["id"]
+	logger := c.Logger.WithField("upload", uploadID)
+
+	request, err := model.NewPresignCompleteRequestFromReader(r.Body)
+	if err != nil {
+		logger.WithError(err).Error("failed to unmarshal JSON from request")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	session, err := c.Store.GetUploadSession(uploadID)
+	if err != nil {
+		logger.WithError(err).Error("failed to look up upload session")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if session == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if !session.Presigned {
+		logger.Error("upload session is not uploaded straight to the bucket")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if session.CompleteAt == 0 {
+		var parts []*model.UploadPart
+		if session.MultipartID != "" {
+			parts, err = uploadedParts(session, request)
+			if err != nil {
+				logger.WithError(err).Error("invalid parts")
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(err.Error()))
+				return
+			}
+		}
+
+		// The archive exists already if completing was interrupted
+		// after the multipart upload was completed.
+		var exists bool
+		exists, err = c.AWS.CheckBucketFileExists(session.ArchiveName())
+		if err != nil {
+			logger.WithError(err).Error("failed to check if archive exists")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !exists && session.MultipartID == "" {
+			logger.Error("archive was not uploaded")
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if !exists {
+			err = c.AWS.CompleteMultipartUpload(session.ArchiveName(), session.MultipartID, parts)
+			if err != nil {
+				logger.WithError(err).Error("failed to complete multipart upload")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// The UploadSupervisor verifies the archive once the session
+		// is complete.
+		_, err = c.Store.CompleteUploadSession(uploadID, true)
+		if err != nil {
+			logger.WithError(err).Error("failed to mark upload session complete")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	upload, err := c.Store.GetUpload(uploadID)
+	if err != nil || upload == nil {
+		logger.WithError(err).Error("failed to look up upload")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	outputCompletedUpload(c, w, upload)
+}
+
+// uploadedParts returns the parts of a multipart upload listed by the
+// client, which must be every part of the session.
+func uploadedParts(session *model.UploadSession, request *model.PresignCompleteRequest) ([]*model.UploadPart, error) {
+	if len(request.Parts) != session.Chunks() {
+		return nil, errors.Errorf("the archive has %d parts, but %d were listed", session.Chunks(), len(request.Parts))
+	}
+
+	parts := make([]*model.UploadPart, 0, len(request.Parts))
+	for i, part := range request.Parts {
+		if part.Number != i+1 {
+			return nil, errors.Errorf("part %d is listed as part %d", i+1, part.Number)
+		}
+		if part.ETag == "" || part.Checksum == "" {
+			return nil, errors.Errorf("part %d has no ETag or checksum", part.Number)
+		}
+		parts = append(parts, &model.UploadPart{
+			UploadID: session.ID,
+			Number:   part.Number,
+			Size:     session.ChunkLength(part.Number),
+			Checksum: part.Checksum,
+			ETag:     part.ETag,
+		})
+	}
+
+	return parts, nil
+}
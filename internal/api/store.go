@@ -11,20 +11,47 @@ import "github.com/mattermost/awat/model"
 type Store interface {
 	GetTranslation(id string) (*model.Translation, error)
 	GetTranslationsByInstallation(id string) ([]*model.Translation, error)
-	GetAllTranslations() ([]*model.Translation, error)
+	GetTranslations(options *model.ListOptions) ([]*model.Translation, error)
 	CreateTranslation(t *model.Translation) error
 	UpdateTranslation(t *model.Translation) error
+	CancelTranslation(t *model.Translation) (bool, error)
+	RetryTranslation(t *model.Translation) (bool, error)
+	ReleaseTranslationLock(t *model.Translation, reason string) (bool, error)
 
 	GetAndClaimNextReadyImport(provisionerID string) (*model.Import, error)
-	GetAllImports() ([]*model.Import, error)
+	GetImports(options *model.ListOptions) ([]*model.Import, error)
 	GetImport(id string) (*model.Import, error)
 	GetImportsInProgress() ([]*model.Import, error)
 	GetImportsByInstallation(id string) ([]*model.Import, error)
 	GetImportsByTranslation(id string) ([]*model.Import, error)
 	UpdateImport(imp *model.Import) error
+	CancelImport(imp *model.Import, state, reason string) (bool, error)
+	GetImportTransitions(importID string) ([]*model.ImportTransition, error)
+	RenewImportClaim(id, provisionerID string) (bool, error)
+	ReleaseImportLock(imp *model.Import, reason string) (bool, error)
+	ReleaseImportClaim(imp *model.Import, reason string) (bool, error)
 
 	GetUpload(id string) (*model.Upload, error)
-	GetUploads() ([]*model.Upload, error)
+	GetUploads(options *model.ListOptions) ([]*model.Upload, error)
 	CreateUpload(id string, archiveType model.BackupType) error
 	CompleteUpload(uploadID, errorMessage string) error
+	UpdateUploadValidation(uploadID string, report *model.ValidationReport) error
+	UpdateUploadChecksum(uploadID, checksum string) error
+
+	CreateUploadSession(session *model.UploadSession) error
+	GetUploadSession(id string) (*model.UploadSession, error)
+	AddUploadPart(part *model.UploadPart) error
+	UpdateUploadSessionHash(session *model.UploadSession, state []byte, hashedSize int64) (bool, error)
+	ResetUploadSessionHash(id string) error
+	CompleteUploadSession(id string, verify bool) (bool, error)
+
+	CreateWebhook(webhook *model.Webhook) error
+	GetWebhook(id string) (*model.Webhook, error)
+	GetWebhooks() ([]*model.Webhook, error)
+	DeleteWebhook(id string) error
+	GetWebhookDeliveries(webhookID string) ([]*model.WebhookDelivery, error)
+	CreateWebhookEvent(event *model.WebhookEvent) error
+
+	GetEvents(filter *model.EventFilter, limit uint64) ([]*model.Event, error)
+	GetLatestEventSequence() (int64, error)
 }
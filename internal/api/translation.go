@@ -16,10 +16,15 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// handleListTranslations returns all Translations in the database. Responds to GET /translations
-// TODO add pagination
+// handleListTranslations returns the page of Translations selected by the query parameters,
+// like handleListImports. Responds to GET /translations
 func handleListTranslations(c *Context, w http.ResponseWriter, r *http.Request) {
-	translations, err := c.Store.GetAllTranslations()
+	options := parseListOptions(c, w, r, model.AllTranslationStates)
+	if options == nil {
+		return
+	}
+
+	translations, err := c.Store.GetTranslations(options)
 	if err != nil {
 		c.Logger.WithError(err).Error("failed to fetch translations")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -50,6 +55,20 @@ func handleStartTranslation(c *Context, w http.ResponseWriter, r *http.Request)
 	})
 
 	translation := model.NewTranslationFromRequest(translationRequest)
+	if translationRequest.SlackToken != "" {
+		if c.Encryptor == nil {
+			logger.Error("a Slack token was given, but no encryption key is configured to store it with")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		translation.SlackToken, err = c.Encryptor.Encrypt(translationRequest.SlackToken)
+		if err != nil {
+			logger.WithError(err).Error("failed to encrypt the Slack token")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
 	exists, err := c.AWS.CheckBucketFileExists(translation.Resource)
 	if err != nil {
 		logger.WithError(err).Error("failed to check if bucket and file exist")
@@ -62,7 +81,7 @@ func handleStartTranslation(c *Context, w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	responseHeader, err := handleTranslationUpload(c, translationRequest, logger)
+	responseHeader, err := handleTranslationUpload(c, translationRequest, translation, logger)
 	if err != nil {
 		logger.WithError(err).Error("failed to ensure upload")
 		w.WriteHeader(responseHeader)
@@ -73,8 +92,10 @@ func handleStartTranslation(c *Context, w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		c.Logger.WithError(err).Errorf("failed to store the translation request in the database")
 		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 	defer r.Body.Close()
+	emitEvent(c, model.NewTranslationEvent(translation, ""))
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
@@ -87,7 +108,12 @@ func handleStartTranslation(c *Context, w http.ResponseWriter, r *http.Request)
 	}).Debug("Started new translation")
 }
 
-func handleTranslationUpload(c *Context, translationRequest *model.TranslationRequest, logger logrus.FieldLogger) (int, error) {
+// handleTranslationUpload ensures there is a valid Upload of the input
+// archive of the Translation, validating and recording archives which
+// were not uploaded to the AWAT, and records the checksum of the
+// archive, if it is known, for the input to be verified against. An
+// Upload given by its ID must have completed without an error.
+func handleTranslationUpload(c *Context, translationRequest *model.TranslationRequest, translation *model.Translation, logger logrus.FieldLogger) (int, error) {
 	// If we're providing an archive from a bucket (and not uploading it directly)
 	// we need to download and validate it locally before trying to import it to
 	// avoid import errors later.
@@ -98,8 +124,16 @@ func handleTranslationUpload(c *Context, translationRequest *model.TranslationRe
 		}
 		if upload == nil {
 			return http.StatusBadRequest, errors.Errorf("no upload with ID %s found", *translationRequest.UploadID)
+		} else if upload.Validation != nil && !upload.Validation.Valid() {
+			return http.StatusBadRequest, errors.Wrapf(upload.Validation.Err(), "upload %s failed validation", upload.ID)
+		} else if upload.CompleteAt == 0 {
+			// the archive is still being received or verified
+			return http.StatusConflict, errors.Errorf("upload %s has not completed yet", upload.ID)
+		} else if upload.Error != "" {
+			return http.StatusBadRequest, errors.Errorf("upload %s failed: %s", upload.ID, upload.Error)
 		} else {
 			logger.Debugf("Upload with ID %s exists, skipping archive validation...", *translationRequest.UploadID)
+			translation.InputChecksum = upload.Checksum
 			return http.StatusOK, nil
 		}
 	}
@@ -111,11 +145,22 @@ func handleTranslationUpload(c *Context, translationRequest *model.TranslationRe
 		return http.StatusInternalServerError, errors.Wrap(err, "failed to get upload")
 	}
 	if upload != nil {
+		if upload.Validation != nil && !upload.Validation.Valid() {
+			return http.StatusBadRequest, errors.Wrapf(upload.Validation.Err(), "upload %s failed validation", upload.ID)
+		}
+		if upload.Error != "" {
+			return http.StatusBadRequest, errors.Errorf("upload %s failed: %s", upload.ID, upload.Error)
+		}
 		logger.Debugf("Upload with archive name %s exists, skipping archive validation...", trimmedArchiveName)
+		translation.InputChecksum = upload.Checksum
 		return http.StatusOK, nil
 	}
 
-	if !translationRequest.ValidateArchive || translationRequest.Type == model.SlackWorkspaceBackupType {
+	var report *model.ValidationReport
+	if !translationRequest.ValidateArchive ||
+		translationRequest.Type == model.SlackWorkspaceBackupType ||
+		translationRequest.Type == model.TeamsWorkspaceBackupType ||
+		translationRequest.Type == model.DiscordWorkspaceBackupType {
 		logger.Debug("Skipping archive validation...")
 	} else {
 		logger.Info("Downloading archive for validation")
@@ -134,8 +179,11 @@ func handleTranslationUpload(c *Context, translationRequest *model.TranslationRe
 		logger = logger.WithField("archivePath", archivePath)
 		logger.Debug("Downloaded archive for validation")
 
-		err = validator.Validate(archivePath)
+		report, err = validator.Validate(archivePath)
 		if err != nil {
+			return http.StatusInternalServerError, errors.Wrap(err, "error validating archive")
+		}
+		if err = report.Err(); err != nil {
 			return http.StatusBadRequest, errors.Wrap(err, "archive validation failed")
 		}
 
@@ -147,6 +195,13 @@ func handleTranslationUpload(c *Context, translationRequest *model.TranslationRe
 		return http.StatusInternalServerError, errors.Wrap(err, "failed to store upload in database")
 	}
 
+	if report != nil {
+		err = c.Store.UpdateUploadValidation(trimmedArchiveName, report)
+		if err != nil {
+			return http.StatusInternalServerError, errors.Wrap(err, "failed to store validation report in database")
+		}
+	}
+
 	return http.StatusOK, nil
 }
 
@@ -171,6 +226,136 @@ func handleGetTranslationStatus(c *Context, w http.ResponseWriter, r *http.Reque
 	outputJSON(c, w, translationStatusFromTranslation(translation))
 }
 
+// handleCancelTranslation responds to DELETE /translation/{id} by
+// cancelling the Translation. A Translation which has not started yet
+// will never be started, and one which is running is interrupted by
+// the supervisor working on it. Completed Translations cannot be
+// cancelled.
+func handleCancelTranslation(c *Context, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	translationID := vars["id"]
+	translation, err := c.Store.GetTranslation(translationID)
+	if err != nil {
+		c.Logger.WithError(err).Errorf("failed to fetch translation with ID %s", translationID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if translation == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if translation.CancelAt == 0 {
+		if !translation.IsCancellable() {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		oldState := translation.State()
+		cancelled, err := c.Store.CancelTranslation(translation)
+		if err != nil {
+			c.Logger.WithError(err).Errorf("failed to cancel translation with ID %s", translationID)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !cancelled {
+			// the Translation completed in the meantime
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		c.Logger.WithField("translation", translationID).Info("Cancelled translation")
+		emitEvent(c, model.NewTranslationEvent(translation, oldState))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	outputJSON(c, w, translationStatusFromTranslation(translation))
+}
+
+// handleRetryTranslation responds to POST /translation/{id}/retry by
+// starting a failed Translation over with a fresh set of attempts.
+func handleRetryTranslation(c *Context, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	translationID := vars["id"]
+	translation, err := c.Store.GetTranslation(translationID)
+	if err != nil {
+		c.Logger.WithError(err).Errorf("failed to fetch translation with ID %s", translationID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if translation == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if translation.State() != model.TranslationStateFailed {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	oldState := translation.State()
+	retried, err := c.Store.RetryTranslation(translation)
+	if err != nil {
+		c.Logger.WithError(err).Errorf("failed to retry translation with ID %s", translationID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !retried {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	c.Logger.WithField("translation", translationID).Info("Retrying failed translation")
+	emitEvent(c, model.NewTranslationEvent(translation, oldState))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	outputJSON(c, w, translationStatusFromTranslation(translation))
+}
+
+// handleUnlockTranslation responds to POST /translation/{id}/unlock by
+// releasing the lock a supervisor holds on the Translation, e.g. when
+// its pod is known to be gone and waiting for the lease to expire is
+// not desired.
+func handleUnlockTranslation(c *Context, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	translationID := vars["id"]
+	translation, err := c.Store.GetTranslation(translationID)
+	if err != nil {
+		c.Logger.WithError(err).Errorf("failed to fetch translation with ID %s", translationID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if translation == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if translation.LockedBy != "" {
+		owner := translation.LockedBy
+		oldState := translation.State()
+		released, err := c.Store.ReleaseTranslationLock(translation, model.LockReleaseReasonManual)
+		if err != nil {
+			c.Logger.WithError(err).Errorf("failed to unlock translation with ID %s", translationID)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !released {
+			// the lock was renewed or released in the meantime
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		c.Logger.WithFields(logrus.Fields{"translation": translationID, "owner": owner}).Warn("Released translation lock")
+		emitEvent(c, model.NewTranslationEvent(translation, oldState))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	outputJSON(c, w, translationStatusFromTranslation(translation))
+}
+
 // handleGetTranslationStatusesByInstallation returns a list of
 // Translations with the given Installation ID in order to ease
 // discovery of which Translation or Translations may be in progress
@@ -225,10 +410,16 @@ func outputJSON(c *Context, w io.Writer, data interface{}) {
 }
 
 func translationStatusFromTranslation(t *model.Translation) (status *model.TranslationStatus) {
-	return &model.TranslationStatus{
+	status = &model.TranslationStatus{
 		State:       t.State(),
 		Translation: *t,
 	}
+	if status.State == model.TranslationStateInProgress {
+		status.PhaseETA = t.EstimatePhaseCompletion()
+		status.ETA = t.EstimateCompletion()
+	}
+
+	return status
 }
 
 func translationStatusListFromTranslations(translations []*model.Translation) (translationStatusList []*model.TranslationStatus) {
@@ -5,6 +5,8 @@
 package api
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -14,13 +16,24 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/mattermost/awat/internal/validators"
 	"github.com/mattermost/awat/model"
+	"github.com/pkg/errors"
 )
 
 func handleReceiveArchive(c *Context, w http.ResponseWriter, r *http.Request) {
 	uploadFile, err := os.CreateTemp(c.Workdir, "upload-")
 	if err != nil {
-		c.Logger.Error("failed to open temp file to write upload to")
+		c.Logger.WithError(err).Error("failed to open temp file to write upload to")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
+	defer uploadFile.Close()
+	// The archive is removed unless it is handed over to be stored.
+	stored := false
+	defer func() {
+		if !stored {
+			_ = os.Remove(uploadFile.Name())
+		}
+	}()
 
 	uploadLengthString := r.Header.Get("Content-Length")
 	if uploadLengthString == "" {
@@ -50,7 +63,8 @@ func handleReceiveArchive(c *Context, w http.ResponseWriter, r *http.Request) {
 	uploadID := model.NewID()
 	destKeyName := uploadID + ".zip"
 
-	totalWritten, err := io.Copy(uploadFile, r.Body)
+	hash := sha256.New()
+	totalWritten, err := io.Copy(io.MultiWriter(uploadFile, hash), r.Body)
 	if err != nil {
 		c.Logger.WithError(err).Error("failed to copy body to temp file")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -63,17 +77,6 @@ func handleReceiveArchive(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if params.Type == model.MattermostWorkspaceBackupType {
-		c.Logger.Info("Validating upload")
-		validator := validators.NewMattermostValidator()
-		if err := validator.Validate(uploadFile.Name()); err != nil {
-			c.Logger.WithError(err).Error("archive validation failed")
-			w.WriteHeader(http.StatusBadRequest)
-			_, _ = w.Write([]byte(err.Error()))
-			return
-		}
-	}
-
 	err = c.Store.CreateUpload(uploadID, params.Type)
 	if err != nil {
 		c.Logger.WithError(err).Error("failed to store upload ID for tracking progress")
@@ -81,7 +84,30 @@ func handleReceiveArchive(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	report, err := validateUpload(c, uploadID, params.Type, uploadFile.Name())
+	if err != nil {
+		c.Logger.WithError(err).Error("failed to validate archive")
+		failUpload(c, uploadID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if report != nil && !report.Valid() {
+		// Keep the Upload so that its report can be looked up,
+		// but do not store the archive.
+		rejectUpload(c, w, uploadID, params.Type, report)
+		return
+	}
+
+	err = c.Store.UpdateUploadChecksum(uploadID, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		c.Logger.WithError(err).Error("failed to store checksum of upload")
+		failUpload(c, uploadID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
 	c.Logger.Debugf("finished reading and writing file; %d bytes written", totalWritten)
+	stored = true
 	go func(context *Context, uploadID, uploadFileName, destinationKeyName string) {
 		err = c.AWS.UploadArchiveToS3(uploadFileName, destinationKeyName)
 		defer os.Remove(uploadFileName)
@@ -105,6 +131,63 @@ func handleReceiveArchive(c *Context, w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte(destKeyName))
 }
 
+// validateUpload validates the archive of an Upload at archivePath,
+// if archives of its type are validated, and stores the report. It
+// returns nil if the archive was not validated, which is the case for
+// Teams and Discord exports, for which there is no validator.
+func validateUpload(c *Context, uploadID string, archiveType model.BackupType, archivePath string) (*model.ValidationReport, error) {
+	switch archiveType {
+	case model.MattermostWorkspaceBackupType,
+		model.SlackWorkspaceBackupType,
+		model.RocketChatWorkspaceBackupType,
+		model.ZulipWorkspaceBackupType:
+	default:
+		return nil, nil
+	}
+
+	c.Logger.Info("Validating upload")
+	validator, err := validators.NewValidator(archiveType)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get validator")
+	}
+	report, err := validator.Validate(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.Store.UpdateUploadValidation(uploadID, report)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// rejectUpload marks an Upload whose archive failed validation as
+// failed and responds with it, including the validation report.
+func rejectUpload(c *Context, w http.ResponseWriter, uploadID string, archiveType model.BackupType, report *model.ValidationReport) {
+	c.Logger.WithError(report.Err()).Error("archive validation failed")
+	upload := &model.Upload{ID: uploadID, Type: archiveType, Error: "archive validation failed", Validation: report}
+	err := c.Store.CompleteUpload(uploadID, upload.Error)
+	if err != nil {
+		c.Logger.WithError(err).Errorf("failed to mark upload %s failed", uploadID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	outputJSON(c, w, upload)
+}
+
+// failUpload marks an Upload as failed with the given error.
+func failUpload(c *Context, uploadID string, err error) {
+	storageErr := c.Store.CompleteUpload(uploadID, err.Error())
+	if storageErr != nil {
+		c.Logger.WithError(storageErr).Errorf("failed to mark upload %s failed with error %s", uploadID, err.Error())
+	}
+}
+
 func handleCheckUploadStatus(c *Context, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	uploadID, ok := vars["id"]
@@ -141,9 +224,42 @@ func handleCheckUploadStatus(c *Context, w http.ResponseWriter, r *http.Request)
 	}
 }
 
-// handleListUploads returns all updloads in the database. Responds to GET /translations
+// handleGetUploadValidation responds to GET /upload/{id}/validation
+// with the report of the validation of the upload, if it was validated
+func handleGetUploadValidation(c *Context, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uploadID := vars["id"]
+
+	upload, err := c.Store.GetUpload(uploadID)
+	if err != nil {
+		c.Logger.WithError(err).Errorf("failed to look up upload %s", uploadID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if upload == nil || upload.Validation == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	outputJSON(c, w, upload.Validation)
+}
+
+// handleListUploads returns the page of uploads selected by the query parameters, which
+// cannot filter by state or installation. Responds to GET /uploads
 func handleListUploads(c *Context, w http.ResponseWriter, r *http.Request) {
-	uploads, err := c.Store.GetUploads()
+	options := parseListOptions(c, w, r, nil)
+	if options == nil {
+		return
+	}
+	if options.InstallationID != "" {
+		c.Logger.Error("uploads cannot be filtered by installation")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	uploads, err := c.Store.GetUploads(options)
 	if err != nil {
 		c.Logger.WithError(err).Error("failed to fetch uploads")
 		w.WriteHeader(http.StatusInternalServerError)
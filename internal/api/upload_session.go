@@ -0,0 +1,390 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package api
+
+import (
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/mattermost/awat/model"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// handleCreateUploadSession responds to POST /upload/session by
+// starting an upload of an archive in chunks, which is stored as an S3
+// multipart upload.
+func handleCreateUploadSession(c *Context, w http.ResponseWriter, r *http.Request) {
+	request, err := model.NewUploadSessionRequestFromReader(r.Body)
+	if err != nil {
+		c.Logger.WithError(err).Error("failed to unmarshal JSON from request")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err = request.Validate(); err != nil {
+		c.Logger.WithError(err).Error("upload session request validation failed")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	session := &model.UploadSession{
+		ID:        model.NewID(),
+		Type:      request.Type,
+		Size:      request.Size,
+		ChunkSize: request.ChunkSize,
+	}
+	logger := c.Logger.WithField("upload", session.ID)
+
+	session.MultipartID, err = c.AWS.StartMultipartUpload(session.ArchiveName())
+	if err != nil {
+		logger.WithError(err).Error("failed to start multipart upload")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = c.Store.CreateUploadSession(session)
+	if err != nil {
+		logger.WithError(err).Error("failed to store upload session")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	logger.Infof("Started upload of %d bytes in %d chunks", session.Size, session.Chunks())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	outputJSON(c, w, session)
+}
+
+// handleGetUploadSession responds to GET /upload/session/{id} with the
+// upload session, including the chunks received so far and the offset
+// an interrupted upload resumes from.
+func handleGetUploadSession(c *Context, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uploadID := vars["id"]
+
+	session, err := c.Store.GetUploadSession(uploadID)
+	if err != nil {
+		c.Logger.WithError(err).Errorf("failed to look up upload session %s", uploadID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if session == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	outputJSON(c, w, session)
+}
+
+// handleUploadChunk responds to PUT /upload/session/{id}/chunk/{number}
+// by storing the body as the chunk with the given number. The body must
+// have the length of the chunk and the checksum in the
+// ChunkChecksumHeader; a chunk whose body does not match its checksum
+// is rejected with 422 Unprocessable Entity so that it can be sent
+// again. Chunks may be sent more than once and in any order, but only
+// chunks sent in order add to the checksum of the archive computed as
+// they arrive.
+func handleUploadChunk(c *Context, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uploadID := vars["id"]
+	logger := c.Logger.WithFields(logrus.Fields{
+		"upload": uploadID,
+		"chunk":  vars["number"],
+	})
+
+	number, err := strconv.Atoi(vars["number"])
+	if err != nil {
+		logger.WithError(err).Error("invalid chunk number")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	checksum := strings.ToLower(r.Header.Get(model.ChunkChecksumHeader))
+	if checksum == "" {
+		logger.Errorf("%s header must be set", model.ChunkChecksumHeader)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	session, err := c.Store.GetUploadSession(uploadID)
+	if err != nil {
+		logger.WithError(err).Error("failed to look up upload session")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if session == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if session.Presigned {
+		logger.Error("upload session is uploaded straight to the bucket")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if session.CompleteAt != 0 {
+		logger.Warn("upload session is already complete")
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	if number < 1 || number > session.Chunks() {
+		logger.Errorf("the upload has chunks 1 to %d", session.Chunks())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	length := session.ChunkLength(number)
+	if r.ContentLength != length {
+		logger.Errorf("chunk has %d bytes instead of %d", r.ContentLength, length)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(fmt.Sprintf("chunk %d must have %d bytes", number, length)))
+		return
+	}
+
+	chunkFile, err := os.CreateTemp(c.Workdir, "chunk-")
+	if err != nil {
+		logger.WithError(err).Error("failed to open temp file to write chunk to")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(chunkFile.Name())
+
+	chunkHash := sha256.New()
+	writers := []io.Writer{chunkFile, chunkHash}
+	var archiveHash hash.Hash
+	if session.ChunkOffset(number) == session.HashedSize {
+		archiveHash, err = session.ArchiveHash()
+		if err != nil {
+			logger.WithError(err).Warn("failed to continue checksum of archive")
+		} else {
+			writers = append(writers, archiveHash)
+		}
+	}
+	written, err := io.Copy(io.MultiWriter(writers...), io.LimitReader(r.Body, length))
+	closeErr := chunkFile.Close()
+	if err != nil || closeErr != nil {
+		logger.WithError(err).Error("failed to copy body to temp file")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if written != length {
+		logger.Errorf("received %d bytes instead of %d", written, length)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+	if sum := hex.EncodeToString(chunkHash.Sum(nil)); sum != checksum {
+		logger.Errorf("chunk has checksum %s instead of %s", sum, checksum)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte(fmt.Sprintf("chunk %d does not match its checksum", number)))
+		return
+	}
+
+	part := &model.UploadPart{
+		UploadID: uploadID,
+		Number:   number,
+		Size:     written,
+		Checksum: checksum,
+	}
+	part.ETag, err = c.AWS.UploadArchivePart(session.ArchiveName(), session.MultipartID, number, chunkFile.Name(), checksum)
+	if err != nil {
+		logger.WithError(err).Error("failed to upload chunk to S3")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	previous := session.Part(number)
+	err = c.Store.AddUploadPart(part)
+	if err != nil {
+		logger.WithError(err).Error("failed to store chunk")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	updateArchiveHash(c, session, part, previous, archiveHash, logger)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	outputJSON(c, w, part)
+}
+
+// updateArchiveHash records archiveHash, if it is the checksum of the
+// archive up to the end of the part, or discards the checksum recorded
+// if the part replaced a previous part included in it with different
+// contents, or another request raced to change it. The checksum is
+// computed once the archive was assembled if it is discarded.
+func updateArchiveHash(c *Context, session *model.UploadSession, part, previous *model.UploadPart, archiveHash hash.Hash, logger logrus.FieldLogger) {
+	offset := session.ChunkOffset(part.Number)
+	switch {
+	case archiveHash != nil:
+		state, err := archiveHash.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			logger.WithError(err).Warn("failed to save checksum of archive")
+			break
+		}
+		updated, err := c.Store.UpdateUploadSessionHash(session, state, offset+part.Size)
+		if err != nil {
+			logger.WithError(err).Warn("failed to store checksum of archive")
+			break
+		}
+		if updated {
+			return
+		}
+	case offset < session.HashedSize && (previous == nil || previous.Checksum != part.Checksum):
+	default:
+		return
+	}
+
+	err := c.Store.ResetUploadSessionHash(session.ID)
+	if err != nil {
+		logger.WithError(err).Warn("failed to reset checksum of archive")
+	}
+}
+
+// handleCompleteUploadSession responds to POST
+// /upload/session/{id}/complete by assembling the archive from its
+// chunks and having the UploadSupervisor validate it in the
+// background, after which the Upload is complete. Completing a session
+// again responds with the state of the Upload, so that a client which
+// missed the response can retry.
+func handleCompleteUploadSession(c *Context, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uploadID := vars["id"]
+	logger := c.Logger.WithField("upload", uploadID)
+
+	session, err := c.Store.GetUploadSession(uploadID)
+	if err != nil {
+		logger.WithError(err).Error("failed to look up upload session")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if session == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if session.Presigned {
+		logger.Error("upload session is uploaded straight to the bucket")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if session.CompleteAt == 0 {
+		if missing := session.Missing(); len(missing) > 0 {
+			logger.Warnf("cannot complete upload missing %d chunks", len(missing))
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte(fmt.Sprintf("missing %d chunks, starting with chunk %d", len(missing), missing[0])))
+			return
+		}
+
+		// The archive exists already if completing was interrupted
+		// after the multipart upload was completed.
+		var exists bool
+		exists, err = c.AWS.CheckBucketFileExists(session.ArchiveName())
+		if err != nil {
+			logger.WithError(err).Error("failed to check if archive exists")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			err = c.AWS.CompleteMultipartUpload(session.ArchiveName(), session.MultipartID, session.Parts)
+			if err != nil {
+				logger.WithError(err).Error("failed to complete multipart upload")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// The UploadSupervisor validates the archive and determines
+		// its checksum once the session is complete.
+		_, err = c.Store.CompleteUploadSession(uploadID, true)
+		if err != nil {
+			logger.WithError(err).Error("failed to mark upload session complete")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		logger.Infof("Completed upload of %d bytes", session.Size)
+	}
+
+	upload, err := c.Store.GetUpload(uploadID)
+	if err != nil || upload == nil {
+		logger.WithError(err).Error("failed to look up upload")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	outputCompletedUpload(c, w, upload)
+}
+
+// handleAbortUploadSession responds to DELETE /upload/session/{id} by
+// discarding the chunks received, which fails the Upload.
+func handleAbortUploadSession(c *Context, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uploadID := vars["id"]
+	logger := c.Logger.WithField("upload", uploadID)
+
+	session, err := c.Store.GetUploadSession(uploadID)
+	if err != nil {
+		logger.WithError(err).Error("failed to look up upload session")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if session == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if session.CompleteAt != 0 {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	err = c.AWS.AbortMultipartUpload(session.ArchiveName(), session.MultipartID)
+	if err != nil {
+		logger.WithError(err).Error("failed to abort multipart upload")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	aborted, err := c.Store.CompleteUploadSession(uploadID, false)
+	if err != nil {
+		logger.WithError(err).Error("failed to mark upload session complete")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !aborted {
+		// the session completed in the meantime
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	failUpload(c, uploadID, errors.New("upload aborted"))
+
+	logger.Info("Aborted upload")
+	w.WriteHeader(http.StatusOK)
+}
+
+// outputCompletedUpload responds with an Upload whose session was
+// completed, with 202 Accepted while its archive is being verified.
+func outputCompletedUpload(c *Context, w http.ResponseWriter, upload *model.Upload) {
+	status := http.StatusOK
+	switch {
+	case upload.CompleteAt == 0:
+		status = http.StatusAccepted
+	case upload.Validation != nil && !upload.Validation.Valid():
+		status = http.StatusBadRequest
+	case upload.Error != "":
+		// the upload was aborted
+		status = http.StatusConflict
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	outputJSON(c, w, upload)
+}
@@ -5,10 +5,15 @@
 package api
 
 import (
+	"bytes"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/golang/mock/gomock"
@@ -17,6 +22,8 @@ import (
 	"github.com/stretchr/testify/require"
 
 	mock_api "github.com/mattermost/awat/internal/mocks/api"
+	mock_context "github.com/mattermost/awat/internal/mocks/context"
+	"github.com/mattermost/awat/internal/objectstore"
 	"github.com/mattermost/awat/internal/testlib"
 	"github.com/mattermost/awat/model"
 )
@@ -33,6 +40,47 @@ func TestUpload(t *testing.T) {
 	ts := httptest.NewServer(router)
 	defer ts.Close()
 
+	workdir := t.TempDir()
+	receiver := mux.NewRouter()
+	Register(receiver, &Context{
+		Store:   store,
+		Logger:  logger,
+		Workdir: workdir,
+	})
+	receiverServer := httptest.NewServer(receiver)
+	defer receiverServer.Close()
+
+	t.Run("zulip upload is validated", func(t *testing.T) {
+		store.EXPECT().CreateUpload(gomock.Any(), model.ZulipWorkspaceBackupType).Return(nil)
+		store.EXPECT().UpdateUploadValidation(gomock.Any(), gomock.Any()).Return(nil)
+		store.EXPECT().CompleteUpload(gomock.Any(), "archive validation failed").Return(nil)
+
+		resp, err := http.Post(receiverServer.URL+"/upload?type=zulip", "application/octet-stream", strings.NewReader("not an export"))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		upload, err := model.NewUploadFromReader(resp.Body)
+		require.NoError(t, err)
+		require.NotNil(t, upload.Validation)
+		assert.False(t, upload.Validation.Valid())
+
+		entries, err := os.ReadDir(workdir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("temp file is removed on errors", func(t *testing.T) {
+		resp, err := http.Post(receiverServer.URL+"/upload?type=bogus", "application/octet-stream", strings.NewReader("data"))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		entries, err := os.ReadDir(workdir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
 	t.Run("unknown upload", func(t *testing.T) {
 		store.EXPECT().
 			GetUpload("bogusID").
@@ -75,7 +123,7 @@ func TestUpload(t *testing.T) {
 
 	t.Run("fetch all imports", func(t *testing.T) {
 		store.EXPECT().
-			GetUploads().
+			GetUploads(&model.ListOptions{PerPage: model.AllPerPage}).
 			Return([]*model.Upload{
 				{ID: model.NewID()},
 				{ID: model.NewID()},
@@ -92,4 +140,294 @@ func TestUpload(t *testing.T) {
 		assert.Equal(t, 3, len(imports))
 	})
 
+	t.Run("uploads cannot be filtered by state or installation", func(t *testing.T) {
+		for _, query := range []string{"state=complete", "installation=foo"} {
+			resp, err := http.Get(fmt.Sprintf("%s/uploads?%s", ts.URL, query))
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		}
+	})
+
+}
+
+func TestUploadSession(t *testing.T) {
+	logger := testlib.MakeLogger(t)
+	mockController := gomock.NewController(t)
+	store := mock_api.NewMockStore(mockController)
+	objectStore, err := objectstore.NewLocalObjectStore(t.TempDir())
+	require.NoError(t, err)
+	router := mux.NewRouter()
+	Register(router, &Context{
+		Store:   store,
+		Logger:  logger,
+		AWS:     NewAWSContext(objectStore),
+		Workdir: t.TempDir(),
+	})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	putChunk := func(t *testing.T, uploadID string, number int, chunk []byte, checksum string) *http.Response {
+		req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/upload/session/%s/chunk/%d", ts.URL, uploadID, number), bytes.NewReader(chunk))
+		require.NoError(t, err)
+		req.Header.Set(model.ChunkChecksumHeader, checksum)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("invalid session request", func(t *testing.T) {
+		resp, err := http.Post(fmt.Sprintf("%s/upload/session", ts.URL), "application/json",
+			strings.NewReader(`{"Type": "discord", "Size": 0}`))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("upload an archive in chunks", func(t *testing.T) {
+		archive := bytes.Repeat([]byte("chunk of archive"), int(model.MinUploadChunkSize)/16+1)
+
+		var session *model.UploadSession
+		store.EXPECT().
+			CreateUploadSession(gomock.Any()).
+			DoAndReturn(func(s *model.UploadSession) error {
+				session = s
+				return nil
+			}).
+			Times(1)
+		store.EXPECT().
+			GetUploadSession(gomock.Any()).
+			DoAndReturn(func(id string) (*model.UploadSession, error) {
+				return session, nil
+			}).
+			AnyTimes()
+		store.EXPECT().
+			AddUploadPart(gomock.Any()).
+			DoAndReturn(func(part *model.UploadPart) error {
+				for i := range session.Parts {
+					if session.Parts[i].Number == part.Number {
+						session.Parts[i] = part
+						return nil
+					}
+				}
+				session.Parts = append(session.Parts, part)
+				return nil
+			}).
+			Times(5)
+		store.EXPECT().
+			UpdateUploadSessionHash(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(s *model.UploadSession, state []byte, hashedSize int64) (bool, error) {
+				session.HashState, session.HashedSize = state, hashedSize
+				return true, nil
+			}).
+			Times(3)
+		store.EXPECT().
+			ResetUploadSessionHash(gomock.Any()).
+			DoAndReturn(func(id string) error {
+				session.HashState, session.HashedSize = nil, 0
+				return nil
+			}).
+			Times(1)
+		archiveChecksum := func() string {
+			archiveHash, err := session.ArchiveHash()
+			require.NoError(t, err)
+			return hex.EncodeToString(archiveHash.Sum(nil))
+		}
+
+		resp, err := http.Post(fmt.Sprintf("%s/upload/session", ts.URL), "application/json",
+			strings.NewReader(fmt.Sprintf(`{"Type": "discord", "Size": %d, "ChunkSize": %d}`, len(archive), model.MinUploadChunkSize)))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		created, err := model.NewUploadSessionFromReader(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, session.ID, created.ID)
+		assert.Equal(t, 2, created.Chunks())
+
+		first, last := archive[:model.MinUploadChunkSize], archive[model.MinUploadChunkSize:]
+
+		resp = putChunk(t, session.ID, 2, last, model.ChunkChecksum(first))
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode, "the checksum is verified")
+		resp = putChunk(t, session.ID, 2, first, model.ChunkChecksum(first))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "the length is verified")
+		resp = putChunk(t, session.ID, 3, last, model.ChunkChecksum(last))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "the upload has two chunks")
+
+		resp = putChunk(t, session.ID, 2, last, model.ChunkChecksum(last))
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Zero(t, session.HashedSize, "chunks out of order are not hashed")
+
+		resp, err = http.Get(fmt.Sprintf("%s/upload/session/%s", ts.URL, session.ID))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		fetched, err := model.NewUploadSessionFromReader(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), fetched.Offset())
+		assert.Equal(t, []int{1}, fetched.Missing())
+
+		resp, err = http.Post(fmt.Sprintf("%s/upload/session/%s/complete", ts.URL, session.ID), "application/json", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode, "chunk 1 is missing")
+
+		resp = putChunk(t, session.ID, 1, first, model.ChunkChecksum(first))
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, model.MinUploadChunkSize, session.HashedSize)
+		assert.Equal(t, model.ChunkChecksum(first), archiveChecksum())
+
+		other := bytes.Repeat([]byte("x"), len(first))
+		resp = putChunk(t, session.ID, 1, other, model.ChunkChecksum(other))
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Zero(t, session.HashedSize, "replacing a hashed chunk discards the hash")
+
+		resp = putChunk(t, session.ID, 1, first, model.ChunkChecksum(first))
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		resp = putChunk(t, session.ID, 2, last, model.ChunkChecksum(last))
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, int64(len(archive)), session.HashedSize)
+		assert.Equal(t, model.ChunkChecksum(archive), archiveChecksum())
+
+		store.EXPECT().
+			CompleteUploadSession(session.ID, true).
+			DoAndReturn(func(id string, verify bool) (bool, error) {
+				session.CompleteAt = model.GetMillis()
+				return true, nil
+			}).
+			Times(1)
+		gomock.InOrder(
+			store.EXPECT().
+				GetUpload(session.ID).
+				Return(&model.Upload{ID: session.ID}, nil).
+				Times(1),
+			store.EXPECT().
+				GetUpload(session.ID).
+				Return(&model.Upload{ID: session.ID, CompleteAt: model.GetMillis()}, nil).
+				Times(1),
+		)
+
+		resp, err = http.Post(fmt.Sprintf("%s/upload/session/%s/complete", ts.URL, session.ID), "application/json", nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusAccepted, resp.StatusCode, "the archive is validated in the background")
+		upload, err := model.NewUploadFromReader(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, session.ID, upload.ID)
+
+		stored := filepath.Join(t.TempDir(), "archive.zip")
+		_, err = objectStore.Download(session.ArchiveName(), stored)
+		require.NoError(t, err)
+		contents, err := os.ReadFile(stored)
+		require.NoError(t, err)
+		assert.Equal(t, archive, contents)
+
+		resp, err = http.Post(fmt.Sprintf("%s/upload/session/%s/complete", ts.URL, session.ID), "application/json", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "completing again responds with the verified upload")
+
+		resp = putChunk(t, session.ID, 1, first, model.ChunkChecksum(first))
+		assert.Equal(t, http.StatusConflict, resp.StatusCode, "complete sessions take no chunks")
+	})
+}
+
+func TestPresignedUpload(t *testing.T) {
+	logger := testlib.MakeLogger(t)
+	archive := bytes.Repeat([]byte("chunk of archive"), int(model.MinUploadChunkSize)/16+1)
+	first, last := archive[:model.MinUploadChunkSize], archive[model.MinUploadChunkSize:]
+	presignRequest := fmt.Sprintf(`{"Type": "discord", "Size": %d, "Checksum": %q, "ChunkSize": %d, "PartChecksums": [%q, %q]}`,
+		len(archive), model.ChunkChecksum(archive), model.MinUploadChunkSize, model.ChunkChecksum(first), model.ChunkChecksum(last))
+
+	newServer := func(t *testing.T, aws AWS) (*mock_api.MockStore, *httptest.Server) {
+		store := mock_api.NewMockStore(gomock.NewController(t))
+		router := mux.NewRouter()
+		Register(router, &Context{
+			Store:   store,
+			Logger:  logger,
+			AWS:     aws,
+			Workdir: t.TempDir(),
+		})
+		ts := httptest.NewServer(router)
+		t.Cleanup(ts.Close)
+		return store, ts
+	}
+
+	t.Run("bucket cannot presign requests", func(t *testing.T) {
+		objectStore, err := objectstore.NewLocalObjectStore(t.TempDir())
+		require.NoError(t, err)
+		_, ts := newServer(t, NewAWSContext(objectStore))
+
+		resp, err := http.Post(fmt.Sprintf("%s/upload/presign", ts.URL), "application/json",
+			strings.NewReader(fmt.Sprintf(`{"Type": "discord", "Size": 10, "Checksum": %q}`, model.ChunkChecksum(archive))))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	})
+
+	t.Run("invalid presign request", func(t *testing.T) {
+		_, ts := newServer(t, &mock_context.MockAWS{})
+
+		resp, err := http.Post(fmt.Sprintf("%s/upload/presign", ts.URL), "application/json",
+			strings.NewReader(fmt.Sprintf(`{"Type": "discord", "Size": %d, "Checksum": %q, "ChunkSize": %d, "PartChecksums": [%q]}`,
+				len(archive), model.ChunkChecksum(archive), model.MinUploadChunkSize, model.ChunkChecksum(first))))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "a checksum is missing")
+	})
+
+	t.Run("complete an archive uploaded in parts", func(t *testing.T) {
+		store, ts := newServer(t, &mock_context.MockAWS{
+			PresignURL: "https://bucket.example.com",
+		})
+
+		var session *model.UploadSession
+		store.EXPECT().
+			CreateUploadSession(gomock.Any()).
+			DoAndReturn(func(s *model.UploadSession) error {
+				session = s
+				return nil
+			}).
+			Times(1)
+		store.EXPECT().
+			GetUploadSession(gomock.Any()).
+			DoAndReturn(func(id string) (*model.UploadSession, error) {
+				return session, nil
+			}).
+			AnyTimes()
+
+		resp, err := http.Post(fmt.Sprintf("%s/upload/presign", ts.URL), "application/json", strings.NewReader(presignRequest))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		presigned, err := model.NewPresignedUploadFromReader(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, session.ID, presigned.UploadID)
+		assert.Nil(t, presigned.Request)
+		require.Len(t, presigned.Parts, 2)
+		assert.Equal(t, model.MinUploadChunkSize, presigned.Parts[1].Offset)
+		assert.Equal(t, int64(len(last)), presigned.Parts[1].Size)
+		assert.Equal(t, model.ChunkChecksum(last), presigned.Parts[1].Header["X-Amz-Checksum-Sha256"])
+
+		resp, err = http.Post(fmt.Sprintf("%s/upload/session/%s/complete", ts.URL, session.ID), "application/json", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "presigned sessions are completed separately")
+
+		completeURL := fmt.Sprintf("%s/upload/presign/%s/complete", ts.URL, session.ID)
+		resp, err = http.Post(completeURL, "application/json",
+			strings.NewReader(fmt.Sprintf(`{"Parts": [{"Number": 1, "ETag": "a", "Checksum": %q}]}`, model.ChunkChecksum(first))))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "part 2 is missing")
+
+		store.EXPECT().
+			CompleteUploadSession(session.ID, true).
+			DoAndReturn(func(id string, verify bool) (bool, error) {
+				session.CompleteAt = model.GetMillis()
+				return true, nil
+			}).
+			Times(1)
+		store.EXPECT().
+			GetUpload(session.ID).
+			Return(&model.Upload{ID: session.ID}, nil).
+			Times(2)
+
+		body := fmt.Sprintf(`{"Parts": [{"Number": 1, "ETag": "a", "Checksum": %q}, {"Number": 2, "ETag": "b", "Checksum": %q}]}`,
+			model.ChunkChecksum(first), model.ChunkChecksum(last))
+		resp, err = http.Post(completeURL, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode, "the archive is verified in the background")
+
+		resp, err = http.Post(completeURL, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode, "completing is idempotent")
+	})
 }
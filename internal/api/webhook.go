@@ -0,0 +1,160 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mattermost/awat/model"
+)
+
+// handleCreateWebhook responds to POST /webhooks by registering a
+// webhook, which is sent the state changes of Translations and Imports
+// from then on.
+func handleCreateWebhook(c *Context, w http.ResponseWriter, r *http.Request) {
+	request, err := model.NewWebhookRequestFromReader(r.Body)
+	if err != nil {
+		c.Logger.WithError(err).Error("failed to unmarshal JSON from request")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err = request.Validate(); err != nil {
+		c.Logger.WithError(err).Error("webhook request validation failed")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	if c.Encryptor == nil {
+		c.Logger.Error("no encryption key is configured to store the webhook secret with")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	secret, err := c.Encryptor.Encrypt(request.Secret)
+	if err != nil {
+		c.Logger.WithError(err).Error("failed to encrypt the webhook secret")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	webhook := &model.Webhook{
+		URL:    request.URL,
+		Secret: secret,
+	}
+	err = c.Store.CreateWebhook(webhook)
+	if err != nil {
+		c.Logger.WithError(err).Error("failed to store webhook")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	c.Logger.WithField("webhook", webhook.ID).Infof("Registered webhook for %s", webhook.URL)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	outputJSON(c, w, webhook)
+}
+
+// handleListWebhooks responds to GET /webhooks with the webhooks which
+// were not deleted.
+func handleListWebhooks(c *Context, w http.ResponseWriter, r *http.Request) {
+	webhooks, err := c.Store.GetWebhooks()
+	if err != nil {
+		c.Logger.WithError(err).Error("failed to fetch webhooks")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	outputJSON(c, w, webhooks)
+}
+
+// handleGetWebhook responds to GET /webhook/{id} with one webhook.
+func handleGetWebhook(c *Context, w http.ResponseWriter, r *http.Request) {
+	webhook := getWebhook(c, w, r)
+	if webhook == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	outputJSON(c, w, webhook)
+}
+
+// handleDeleteWebhook responds to DELETE /webhook/{id} by deleting the
+// webhook. Events which were not delivered to it yet are dropped.
+func handleDeleteWebhook(c *Context, w http.ResponseWriter, r *http.Request) {
+	webhook := getWebhook(c, w, r)
+	if webhook == nil {
+		return
+	}
+
+	if webhook.DeleteAt == 0 {
+		err := c.Store.DeleteWebhook(webhook.ID)
+		if err != nil {
+			c.Logger.WithError(err).Errorf("failed to delete webhook %s", webhook.ID)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		c.Logger.WithField("webhook", webhook.ID).Info("Deleted webhook")
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleGetWebhookDeliveries responds to GET /webhook/{id}/deliveries
+// with the log of the deliveries of events to the webhook, newest
+// first.
+func handleGetWebhookDeliveries(c *Context, w http.ResponseWriter, r *http.Request) {
+	webhook := getWebhook(c, w, r)
+	if webhook == nil {
+		return
+	}
+
+	deliveries, err := c.Store.GetWebhookDeliveries(webhook.ID)
+	if err != nil {
+		c.Logger.WithError(err).Errorf("failed to fetch deliveries to webhook %s", webhook.ID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	outputJSON(c, w, deliveries)
+}
+
+// getWebhook looks up the webhook with the ID in the path of the
+// request, writing an error response and returning nil if there is
+// none.
+func getWebhook(c *Context, w http.ResponseWriter, r *http.Request) *model.Webhook {
+	webhookID := mux.Vars(r)["id"]
+	webhook, err := c.Store.GetWebhook(webhookID)
+	if err != nil {
+		c.Logger.WithError(err).Errorf("failed to fetch webhook with ID %s", webhookID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil
+	}
+	if webhook == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+
+	return webhook
+}
+
+// emitEvent queues the delivery of the event to the webhooks, unless
+// it is nil because the state did not change. The state change has
+// happened already, so failing to queue the event is only logged.
+func emitEvent(c *Context, event *model.WebhookEvent) {
+	if event == nil {
+		return
+	}
+
+	err := c.Store.CreateWebhookEvent(event)
+	if err != nil {
+		c.Logger.WithError(err).Errorf("failed to queue webhook event for %s state %s", event.Type, event.NewState)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/awat/internal/common"
+	mock_api "github.com/mattermost/awat/internal/mocks/api"
+	"github.com/mattermost/awat/internal/testlib"
+	"github.com/mattermost/awat/model"
+)
+
+// expectWebhookEvent expects a webhook event for a resource of the
+// given type moving from oldState to newState to be queued.
+func expectWebhookEvent(t *testing.T, store *mock_api.MockStore, eventType, oldState, newState string) *gomock.Call {
+	return store.EXPECT().
+		CreateWebhookEvent(gomock.Any()).
+		DoAndReturn(func(event *model.WebhookEvent) error {
+			assert.Equal(t, eventType, event.Type)
+			assert.Equal(t, oldState, event.OldState)
+			assert.Equal(t, newState, event.NewState)
+			assert.NotEmpty(t, event.ID)
+			return nil
+		}).
+		Times(1)
+}
+
+func TestWebhooks(t *testing.T) {
+	logger := testlib.MakeLogger(t)
+	mockController := gomock.NewController(t)
+	store := mock_api.NewMockStore(mockController)
+	encryptor, err := common.NewEncryptor(strings.Repeat("ab", common.EncryptionKeySize))
+	require.NoError(t, err)
+	router := mux.NewRouter()
+	Register(router, &Context{
+		Store:     store,
+		Logger:    logger,
+		Encryptor: encryptor,
+	})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	t.Run("create a webhook", func(t *testing.T) {
+		store.EXPECT().
+			CreateWebhook(gomock.Any()).
+			DoAndReturn(func(webhook *model.Webhook) error {
+				assert.Equal(t, "https://example.com/hook", webhook.URL)
+				assert.NotEqual(t, "secret", webhook.Secret)
+				secret, err := encryptor.Decrypt(webhook.Secret)
+				require.NoError(t, err)
+				assert.Equal(t, "secret", secret)
+				webhook.ID = "webhookID"
+				return nil
+			}).
+			Times(1)
+
+		resp, err := http.Post(fmt.Sprintf("%s/webhooks", ts.URL), "application/json",
+			strings.NewReader(`{"URL": "https://example.com/hook", "Secret": "secret"}`))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		webhook, err := model.NewWebhookFromReader(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "webhookID", webhook.ID)
+		assert.Empty(t, webhook.Secret)
+	})
+
+	t.Run("create a webhook without an encryption key", func(t *testing.T) {
+		router := mux.NewRouter()
+		Register(router, &Context{
+			Store:  store,
+			Logger: logger,
+		})
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+
+		resp, err := http.Post(fmt.Sprintf("%s/webhooks", ts.URL), "application/json",
+			strings.NewReader(`{"URL": "https://example.com/hook", "Secret": "secret"}`))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("create a webhook without a secret", func(t *testing.T) {
+		resp, err := http.Post(fmt.Sprintf("%s/webhooks", ts.URL), "application/json",
+			strings.NewReader(`{"URL": "https://example.com/hook"}`))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("create a webhook with a relative URL", func(t *testing.T) {
+		resp, err := http.Post(fmt.Sprintf("%s/webhooks", ts.URL), "application/json",
+			strings.NewReader(`{"URL": "/hook", "Secret": "secret"}`))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("list webhooks", func(t *testing.T) {
+		store.EXPECT().
+			GetWebhooks().
+			Return([]*model.Webhook{{ID: "webhookID", URL: "https://example.com/hook", Secret: "secret"}}, nil).
+			Times(1)
+
+		resp, err := http.Get(fmt.Sprintf("%s/webhooks", ts.URL))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		webhooks, err := model.NewWebhookListFromReader(resp.Body)
+		require.NoError(t, err)
+		require.Len(t, webhooks, 1)
+		assert.Equal(t, "webhookID", webhooks[0].ID)
+		assert.Empty(t, webhooks[0].Secret)
+	})
+
+	t.Run("get an unknown webhook", func(t *testing.T) {
+		store.EXPECT().
+			GetWebhook("bogusID").
+			Return(nil, nil).
+			Times(1)
+
+		resp, err := http.Get(fmt.Sprintf("%s/webhook/bogusID", ts.URL))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("delete a webhook", func(t *testing.T) {
+		gomock.InOrder(
+			store.EXPECT().
+				GetWebhook("webhookID").
+				Return(&model.Webhook{ID: "webhookID"}, nil).
+				Times(1),
+			store.EXPECT().
+				DeleteWebhook("webhookID").
+				Return(nil).
+				Times(1),
+		)
+
+		req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/webhook/webhookID", ts.URL), nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("get the deliveries to a webhook", func(t *testing.T) {
+		gomock.InOrder(
+			store.EXPECT().
+				GetWebhook("webhookID").
+				Return(&model.Webhook{ID: "webhookID"}, nil).
+				Times(1),
+			store.EXPECT().
+				GetWebhookDeliveries("webhookID").
+				Return([]*model.WebhookDelivery{
+					{WebhookID: "webhookID", EventID: "eventID", Attempts: 2, StatusCode: 200, DeliveredAt: 1000},
+				}, nil).
+				Times(1),
+		)
+
+		resp, err := http.Get(fmt.Sprintf("%s/webhook/webhookID/deliveries", ts.URL))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		deliveries, err := model.NewWebhookDeliveryListFromReader(resp.Body)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, "eventID", deliveries[0].EventID)
+		assert.Equal(t, 2, deliveries[0].Attempts)
+	})
+}
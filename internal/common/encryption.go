@@ -0,0 +1,80 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+)
+
+// EncryptionKeySize is the size in bytes of the keys secrets are
+// encrypted with, which makes for AES-256.
+const EncryptionKeySize = 32
+
+// Encryptor encrypts secrets, like the tokens given to the AWAT to
+// access a workspace with, before they are stored, using AES-GCM.
+type Encryptor struct {
+	aead cipher.AEAD
+}
+
+// NewEncryptor returns an Encryptor using the given hex encoded key of
+// EncryptionKeySize bytes.
+func NewEncryptor(key string) (*Encryptor, error) {
+	rawKey, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "the encryption key must be hex encoded")
+	}
+	if len(rawKey) != EncryptionKeySize {
+		return nil, errors.Errorf("the encryption key must be %d bytes long, not %d", EncryptionKeySize, len(rawKey))
+	}
+
+	block, err := aes.NewCipher(rawKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cipher")
+	}
+
+	return &Encryptor{aead: aead}, nil
+}
+
+// Encrypt returns the base64 encoded ciphertext of the plaintext,
+// prefixed with the random nonce it was encrypted with.
+func (e *Encryptor) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to generate nonce")
+	}
+
+	sealed := e.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plaintext of a ciphertext returned by Encrypt.
+func (e *Encryptor) Decrypt(ciphertext string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decode ciphertext")
+	}
+	if len(sealed) < e.aead.NonceSize() {
+		return "", errors.New("ciphertext is too short")
+	}
+
+	nonce, sealed := sealed[:e.aead.NonceSize()], sealed[e.aead.NonceSize():]
+	plaintext, err := e.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decrypt ciphertext, it was most likely encrypted with another key")
+	}
+
+	return string(plaintext), nil
+}
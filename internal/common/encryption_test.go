@@ -0,0 +1,40 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptor(t *testing.T) {
+	encryptor, err := NewEncryptor(strings.Repeat("ab", EncryptionKeySize))
+	require.NoError(t, err)
+
+	ciphertext, err := encryptor.Encrypt("xoxb-token")
+	require.NoError(t, err)
+	assert.NotContains(t, ciphertext, "xoxb-token")
+
+	again, err := encryptor.Encrypt("xoxb-token")
+	require.NoError(t, err)
+	assert.NotEqual(t, ciphertext, again, "every encryption uses a new nonce")
+
+	plaintext, err := encryptor.Decrypt(ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, "xoxb-token", plaintext)
+
+	other, err := NewEncryptor(strings.Repeat("cd", EncryptionKeySize))
+	require.NoError(t, err)
+	_, err = other.Decrypt(ciphertext)
+	assert.Error(t, err)
+
+	_, err = NewEncryptor("abcd")
+	assert.Error(t, err)
+	_, err = NewEncryptor(strings.Repeat("xy", EncryptionKeySize))
+	assert.Error(t, err)
+}
@@ -0,0 +1,35 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package common
+
+import "errors"
+
+// permanentError marks an error which will recur no matter how often
+// the failed operation is retried, such as one caused by malformed
+// input.
+type permanentError struct {
+	error
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.error
+}
+
+// Permanent marks err as permanent, so that the failed operation is
+// not retried. It returns nil if err is nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err}
+}
+
+// IsPermanent returns true if err or any error it wraps was marked as
+// permanent with Permanent.
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package common
+
+import "context"
+
+// ProgressFunc receives the progress of a running Translation: the
+// phase it is in, a message describing it and how far along the phase
+// it is, as done out of total units, where total is 0 if it is not
+// known. It may be called from several goroutines at once.
+type ProgressFunc func(phase, message string, done, total int64)
+
+type progressKey struct{}
+
+// WithProgress returns a copy of ctx which reports progress to report.
+func WithProgress(ctx context.Context, report ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, report)
+}
+
+// ReportProgress reports progress to the ProgressFunc of ctx, if it
+// has one.
+func ReportProgress(ctx context.Context, phase, message string, done, total int64) {
+	report, ok := ctx.Value(progressKey{}).(ProgressFunc)
+	if !ok {
+		return
+	}
+
+	report(phase, message, done, total)
+}
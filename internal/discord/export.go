@@ -0,0 +1,192 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package discord
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The Discord export is a .zip holding one DiscordChatExporter JSON
+// file per channel or thread, optionally alongside the media
+// directories DiscordChatExporter writes when run with --media, which
+// attachment URLs then point into.
+
+// Guild is a Discord server.
+type Guild struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	IconURL string `json:"iconUrl"`
+}
+
+// Channel is a Discord channel or thread.
+type Channel struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	CategoryID string `json:"categoryId"`
+	Category   string `json:"category"`
+	Name       string `json:"name"`
+	Topic      string `json:"topic"`
+}
+
+// IsThread returns true if the channel is a thread, in which case its
+// category is the channel the thread was started in.
+func (c *Channel) IsThread() bool {
+	return strings.HasSuffix(c.Type, "Thread")
+}
+
+// IsDirect returns true if the channel is a direct or group message
+// conversation rather than a channel of a server.
+func (c *Channel) IsDirect() bool {
+	return strings.HasPrefix(c.Type, "Direct")
+}
+
+// Author is the author of a message or a user who reacted to it.
+type Author struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Discriminator string `json:"discriminator"`
+	Nickname      string `json:"nickname"`
+	IsBot         bool   `json:"isBot"`
+}
+
+// Attachment is a file attached to a message.
+type Attachment struct {
+	ID            string `json:"id"`
+	URL           string `json:"url"`
+	FileName      string `json:"fileName"`
+	FileSizeBytes int64  `json:"fileSizeBytes"`
+}
+
+// Emoji is the emoji of a reaction.
+type Emoji struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Code string `json:"code"`
+}
+
+// Reaction is a reaction to a message.
+type Reaction struct {
+	Emoji Emoji    `json:"emoji"`
+	Count int      `json:"count"`
+	Users []Author `json:"users"`
+}
+
+// Reference points to the message a reply refers to, or to the
+// thread a thread creation message announces.
+type Reference struct {
+	MessageID string `json:"messageId"`
+	ChannelID string `json:"channelId"`
+	GuildID   string `json:"guildId"`
+}
+
+// Message is a message of a channel or thread.
+type Message struct {
+	ID              string       `json:"id"`
+	Type            string       `json:"type"`
+	Timestamp       string       `json:"timestamp"`
+	TimestampEdited string       `json:"timestampEdited"`
+	IsPinned        bool         `json:"isPinned"`
+	Content         string       `json:"content"`
+	Author          Author       `json:"author"`
+	Attachments     []Attachment `json:"attachments"`
+	Reactions       []Reaction   `json:"reactions"`
+	Mentions        []Author     `json:"mentions"`
+	Reference       *Reference   `json:"reference"`
+}
+
+// IsUserMessage returns true if the message was written by a user, as
+// opposed to being a notification Discord posted about an event.
+func (m *Message) IsUserMessage() bool {
+	return m.Type == "" || m.Type == "Default" || m.Type == "Reply"
+}
+
+// ChannelExport is a single DiscordChatExporter JSON file.
+type ChannelExport struct {
+	Guild    Guild     `json:"guild"`
+	Channel  Channel   `json:"channel"`
+	Messages []Message `json:"messages"`
+
+	// fileName is the name of the JSON file in the export archive,
+	// which relative attachment URLs are resolved against.
+	fileName string
+}
+
+// readExport parses every DiscordChatExporter JSON file in the
+// archive, ordered by file name.
+func readExport(archive *zip.Reader) ([]*ChannelExport, error) {
+	var exports []*ChannelExport
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() || !strings.HasSuffix(strings.ToLower(file.Name), ".json") {
+			continue
+		}
+		if isMediaFile(file.Name) {
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to open %s", file.Name)
+		}
+		var export ChannelExport
+		err = json.NewDecoder(reader).Decode(&export)
+		reader.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", file.Name)
+		}
+		if export.Channel.ID == "" {
+			return nil, errors.Errorf("%s is not a DiscordChatExporter JSON file", file.Name)
+		}
+		export.fileName = file.Name
+
+		exports = append(exports, &export)
+	}
+
+	if len(exports) == 0 {
+		return nil, errors.New("no DiscordChatExporter JSON files found in archive")
+	}
+
+	sort.Slice(exports, func(i, j int) bool {
+		return exports[i].fileName < exports[j].fileName
+	})
+
+	return exports, nil
+}
+
+// isMediaFile returns true if the file is stored in one of the
+// directories DiscordChatExporter downloads attachments to, which are
+// named after the export file with a "_Files" suffix.
+func isMediaFile(name string) bool {
+	for _, dir := range strings.Split(path.Dir(name), "/") {
+		if strings.HasSuffix(dir, "_Files") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveAttachment returns the name of the file in the export archive
+// holding an attachment, or an empty string if the attachment was not
+// exported with the channel and has to be linked to instead.
+func (e *ChannelExport) resolveAttachment(attachment Attachment) string {
+	location := attachment.URL
+	if location == "" || strings.Contains(location, "://") {
+		return ""
+	}
+
+	if unescaped, err := url.PathUnescape(location); err == nil {
+		location = unescaped
+	}
+	location = strings.ReplaceAll(location, "\\", "/")
+
+	return path.Clean(path.Join(path.Dir(e.fileName), location))
+}
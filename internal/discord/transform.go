@@ -0,0 +1,616 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package discord
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/awat/internal/mbif"
+	"github.com/mattermost/awat/model"
+	mmmodel "github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/v8/channels/app/imports"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// emailSource is used to build placeholder email addresses, as Discord
+// exports never include the email addresses of users.
+const emailSource = "discord"
+
+// channel is a Discord channel merged from all the export files
+// holding its messages, together with the threads started in it.
+type channel struct {
+	*ChannelExport
+	teamName    string
+	name        string
+	displayName string
+	threads     []*ChannelExport
+}
+
+// transformer holds the state of a single Discord to MBIF
+// transformation.
+type transformer struct {
+	logger        log.FieldLogger
+	files         map[string]*zip.File
+	attachmentDir string
+
+	// destinationTeam is the team every channel is imported into, or
+	// empty if each guild becomes a Mattermost team of its own.
+	destinationTeam string
+
+	usernames       map[string]string
+	users           map[string]*imports.UserImportData
+	userOrder       []string
+	takenUsernames  mbif.Names
+	attachmentNames mbif.Names
+	memberships     *mbif.Memberships
+}
+
+// TransformDiscord reads the DiscordChatExporter JSON files in the
+// archive at inputArchive and writes their contents as MBIF to
+// mbifPath, extracting exported attachments to attachmentDir.
+// Categories become prefixes of channel display names and threads
+// become reply threads of the post they were started from.
+func TransformDiscord(translation *model.Translation, inputArchive, mbifPath, attachmentDir string, logger log.FieldLogger) error {
+	archive, err := zip.OpenReader(inputArchive)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open Discord export %s", inputArchive)
+	}
+	defer archive.Close()
+
+	exports, err := readExport(&archive.Reader)
+	if err != nil {
+		return errors.Wrap(err, "failed to read Discord export")
+	}
+
+	t := &transformer{
+		logger:          logger,
+		files:           make(map[string]*zip.File, len(archive.File)),
+		attachmentDir:   attachmentDir,
+		destinationTeam: translation.Team,
+		usernames:       make(map[string]string),
+		users:           make(map[string]*imports.UserImportData),
+		takenUsernames:  make(mbif.Names),
+		attachmentNames: make(mbif.Names),
+		memberships:     mbif.NewMemberships(),
+	}
+	for _, file := range archive.File {
+		t.files[file.Name] = file
+	}
+
+	writer, err := mbif.NewWriter(mbifPath)
+	if err != nil {
+		return err
+	}
+
+	err = t.transform(writer, exports)
+	if err != nil {
+		writer.Close()
+		return err
+	}
+
+	logger.Infof("Wrote %d lines of MBIF for %d users", writer.Lines(), len(t.users))
+
+	return writer.Close()
+}
+
+func (t *transformer) transform(writer *mbif.Writer, exports []*ChannelExport) error {
+	teams, channels := t.mapGuildsAndChannels(exports)
+
+	var posts []*imports.PostImportData
+	for _, ch := range channels {
+		channelPosts, err := t.channelPosts(ch)
+		if err != nil {
+			return errors.Wrapf(err, "failed to transform messages of channel %s", ch.Channel.Name)
+		}
+		posts = append(posts, channelPosts...)
+	}
+
+	for _, team := range teams {
+		err := writer.Team(team)
+		if err != nil {
+			return err
+		}
+	}
+
+	channelType := mmmodel.ChannelTypeOpen
+	for _, ch := range channels {
+		err := writer.Channel(&imports.ChannelImportData{
+			Team:        mmmodel.NewString(ch.teamName),
+			Name:        mmmodel.NewString(ch.name),
+			DisplayName: mmmodel.NewString(mbif.DisplayName(ch.displayName)),
+			Type:        &channelType,
+			Header:      mmmodel.NewString(mbif.Truncate(ch.Channel.Topic, mmmodel.ChannelHeaderMaxRunes)),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	sort.SliceStable(t.userOrder, func(i, j int) bool {
+		return t.usernames[t.userOrder[i]] < t.usernames[t.userOrder[j]]
+	})
+	for _, userID := range t.userOrder {
+		user := t.users[userID]
+		user.Teams = t.memberships.Teams(userID)
+		err := writer.User(user)
+		if err != nil {
+			return err
+		}
+	}
+
+	sort.SliceStable(posts, func(i, j int) bool {
+		return *posts[i].CreateAt < *posts[j].CreateAt
+	})
+	for _, post := range posts {
+		err := writer.Post(post)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mapGuildsAndChannels merges export files of the same channel,
+// attaches threads to the channels they were started in and assigns
+// Mattermost names to every guild and channel.
+func (t *transformer) mapGuildsAndChannels(exports []*ChannelExport) ([]*imports.TeamImportData, []*channel) {
+	byID := make(map[string]*channel)
+	var channels []*channel
+	var threads []*ChannelExport
+	guilds := make(map[string]Guild)
+	var guildOrder []string
+
+	for _, export := range exports {
+		if export.Channel.IsDirect() {
+			t.logger.Warnf("Skipping direct message export %s, only server channels are supported", export.fileName)
+			continue
+		}
+		if _, ok := guilds[export.Guild.ID]; !ok {
+			guilds[export.Guild.ID] = export.Guild
+			guildOrder = append(guildOrder, export.Guild.ID)
+		}
+		if export.Channel.IsThread() {
+			threads = append(threads, export)
+			continue
+		}
+		if existing, ok := byID[export.Channel.ID]; ok {
+			// DiscordChatExporter splits large channels into several
+			// partitions when asked to.
+			existing.Messages = append(existing.Messages, export.Messages...)
+			if existing.Channel.Topic == "" {
+				existing.Channel.Topic = export.Channel.Topic
+			}
+			continue
+		}
+		ch := &channel{ChannelExport: export}
+		byID[export.Channel.ID] = ch
+		channels = append(channels, ch)
+	}
+
+	for _, thread := range threads {
+		if parent, ok := byID[thread.Channel.CategoryID]; ok {
+			parent.threads = append(parent.threads, thread)
+			continue
+		}
+		// The channel the thread was started in was not exported, so
+		// the thread becomes a channel of its own.
+		ch := &channel{ChannelExport: thread}
+		byID[thread.Channel.ID] = ch
+		channels = append(channels, ch)
+	}
+
+	var teams []*imports.TeamImportData
+	teamNames := make(map[string]string)
+	takenTeamNames := make(mbif.Names)
+	for _, guildID := range guildOrder {
+		guild := guilds[guildID]
+		if t.destinationTeam != "" {
+			teamNames[guildID] = t.destinationTeam
+			continue
+		}
+		name := takenTeamNames.Unique(mbif.ChannelName(guild.Name), "guild-"+mbif.ChannelName(guild.ID))
+		teamNames[guildID] = name
+		teams = append(teams, &imports.TeamImportData{
+			Name:        mmmodel.NewString(name),
+			DisplayName: mmmodel.NewString(mbif.DisplayName(guild.Name)),
+			Type:        mmmodel.NewString(mmmodel.TeamInvite),
+		})
+	}
+
+	prefixGuild := t.destinationTeam != "" && len(guildOrder) > 1
+	channelNames := make(map[string]mbif.Names)
+	for _, ch := range channels {
+		ch.teamName = teamNames[ch.Guild.ID]
+		if channelNames[ch.teamName] == nil {
+			channelNames[ch.teamName] = make(mbif.Names)
+		}
+
+		var prefixes []string
+		if prefixGuild {
+			prefixes = append(prefixes, ch.Guild.Name)
+		}
+		if ch.Channel.Category != "" {
+			prefixes = append(prefixes, ch.Channel.Category)
+		}
+		ch.displayName = strings.Join(append(prefixes, ch.Channel.Name), ": ")
+
+		name := mbif.ChannelName(ch.Channel.Name)
+		if prefixGuild {
+			name = mbif.ChannelName(ch.Guild.Name + " " + ch.Channel.Name)
+		}
+		ch.name = channelNames[ch.teamName].Unique(name, "channel-"+mbif.ChannelName(ch.Channel.ID))
+	}
+
+	return teams, channels
+}
+
+// channelPosts builds the posts of a channel. Replies to messages and
+// messages of threads started in the channel become replies of the
+// post they belong to.
+func (t *transformer) channelPosts(ch *channel) ([]*imports.PostImportData, error) {
+	var posts []*imports.PostImportData
+	rootOf := make(map[string]*imports.PostImportData)
+
+	messages := sortedMessages(ch.Messages)
+	for i := range messages {
+		message := &messages[i]
+		if message.Type == "ThreadCreated" && message.Reference != nil {
+			// Threads which were not started from a message are
+			// announced with this notification, which becomes the root
+			// post of the thread.
+			post, err := t.post(ch, ch.ChannelExport, message)
+			if err != nil {
+				return nil, err
+			}
+			if post == nil {
+				continue
+			}
+			rootOf[message.Reference.ChannelID] = post
+			posts = append(posts, post)
+			continue
+		}
+		if !message.IsUserMessage() {
+			continue
+		}
+
+		if message.Type == "Reply" && message.Reference != nil {
+			if root, ok := rootOf[message.Reference.MessageID]; ok {
+				reply, err := t.reply(ch, ch.ChannelExport, message)
+				if err != nil {
+					return nil, err
+				}
+				if reply != nil {
+					appendReply(root, *reply)
+					rootOf[message.ID] = root
+				}
+				continue
+			}
+		}
+
+		post, err := t.post(ch, ch.ChannelExport, message)
+		if err != nil {
+			return nil, err
+		}
+		if post == nil {
+			continue
+		}
+		rootOf[message.ID] = post
+		posts = append(posts, post)
+	}
+
+	for _, thread := range ch.threads {
+		// Threads started from a message share the ID of that message.
+		root, ok := rootOf[thread.Channel.ID]
+		threadMessages := sortedMessages(thread.Messages)
+		for i := range threadMessages {
+			message := &threadMessages[i]
+			if !message.IsUserMessage() {
+				continue
+			}
+			if !ok {
+				post, err := t.post(ch, thread, message)
+				if err != nil {
+					return nil, err
+				}
+				if post == nil {
+					continue
+				}
+				post.Message = mmmodel.NewString(mbif.Message(fmt.Sprintf("**%s**\n%s", thread.Channel.Name, *post.Message)))
+				root, ok = post, true
+				posts = append(posts, post)
+				continue
+			}
+
+			reply, err := t.reply(ch, thread, message)
+			if err != nil {
+				return nil, err
+			}
+			if reply != nil {
+				appendReply(root, *reply)
+			}
+		}
+	}
+
+	return posts, nil
+}
+
+func sortedMessages(messages []Message) []Message {
+	sorted := make([]Message, len(messages))
+	copy(sorted, messages)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp < sorted[j].Timestamp
+	})
+
+	return sorted
+}
+
+func appendReply(root *imports.PostImportData, reply imports.ReplyImportData) {
+	if root.Replies == nil {
+		root.Replies = &[]imports.ReplyImportData{}
+	}
+	*root.Replies = append(*root.Replies, reply)
+}
+
+// post converts a message to a post, returning nil if the message has
+// no content worth importing.
+func (t *transformer) post(ch *channel, export *ChannelExport, message *Message) (*imports.PostImportData, error) {
+	createAt, editAt, err := messageTimes(message)
+	if err != nil {
+		t.logger.WithError(err).Warnf("Skipping message %s with invalid timestamp", message.ID)
+		return nil, nil
+	}
+
+	text, attachments, err := t.content(export, message)
+	if err != nil {
+		return nil, err
+	}
+	if message.Type == "ThreadCreated" {
+		text = fmt.Sprintf("**%s**", strings.TrimSpace(message.Content))
+	}
+	if text == "" && len(attachments) == 0 {
+		return nil, nil
+	}
+
+	username := t.addUser(message.Author)
+	t.memberships.JoinChannel(message.Author.ID, ch.teamName, ch.name)
+
+	post := &imports.PostImportData{
+		Team:      mmmodel.NewString(ch.teamName),
+		Channel:   mmmodel.NewString(ch.name),
+		User:      mmmodel.NewString(username),
+		Message:   mmmodel.NewString(text),
+		CreateAt:  &createAt,
+		EditAt:    editAt,
+		Reactions: t.reactions(ch, message, createAt),
+	}
+	if message.IsPinned {
+		post.IsPinned = &message.IsPinned
+	}
+	if len(attachments) > 0 {
+		post.Attachments = &attachments
+	}
+
+	return post, nil
+}
+
+// reply converts a message to a reply, returning nil if the message has
+// no content worth importing.
+func (t *transformer) reply(ch *channel, export *ChannelExport, message *Message) (*imports.ReplyImportData, error) {
+	post, err := t.post(ch, export, message)
+	if err != nil || post == nil {
+		return nil, err
+	}
+
+	return &imports.ReplyImportData{
+		User:        post.User,
+		Message:     post.Message,
+		CreateAt:    post.CreateAt,
+		EditAt:      post.EditAt,
+		Reactions:   post.Reactions,
+		Attachments: post.Attachments,
+	}, nil
+}
+
+func messageTimes(message *Message) (int64, *int64, error) {
+	createAt, err := parseTime(message.Timestamp)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if message.TimestampEdited == "" {
+		return createAt, nil, nil
+	}
+	editAt, err := parseTime(message.TimestampEdited)
+	if err != nil {
+		return createAt, nil, nil
+	}
+
+	return createAt, &editAt, nil
+}
+
+// content returns the text of a message with mentions rewritten to
+// Mattermost usernames, and extracts attachments which were exported
+// with the channel to the attachment directory. Attachments which were
+// not exported are linked to instead.
+func (t *transformer) content(export *ChannelExport, message *Message) (string, []imports.AttachmentImportData, error) {
+	text := message.Content
+
+	mentions := make([]Author, len(message.Mentions))
+	copy(mentions, message.Mentions)
+	sort.SliceStable(mentions, func(i, j int) bool {
+		return len(mentionName(mentions[i])) > len(mentionName(mentions[j]))
+	})
+	for _, mention := range mentions {
+		username := t.addUser(mention)
+		for _, name := range []string{mention.Nickname, mention.Name} {
+			if name != "" {
+				text = strings.ReplaceAll(text, "@"+name, "@"+username)
+			}
+		}
+	}
+
+	var attachments []imports.AttachmentImportData
+	var links []string
+	for _, attachment := range message.Attachments {
+		fileName := export.resolveAttachment(attachment)
+		file, ok := t.files[fileName]
+		if fileName == "" || !ok {
+			links = append(links, attachment.URL)
+			continue
+		}
+
+		name := t.attachmentNames.Unique(attachmentName(attachment, fileName), "attachment")
+		err := extractFile(file, filepath.Join(t.attachmentDir, name))
+		if err != nil {
+			return "", nil, err
+		}
+		attachments = append(attachments, imports.AttachmentImportData{Path: mmmodel.NewString(mbif.AttachmentPath(name))})
+	}
+	if len(links) > 0 {
+		text = text + "\n" + strings.Join(links, "\n")
+	}
+
+	return mbif.Message(strings.TrimSpace(text)), attachments, nil
+}
+
+func mentionName(author Author) string {
+	if author.Nickname != "" {
+		return author.Nickname
+	}
+
+	return author.Name
+}
+
+func attachmentName(attachment Attachment, fileName string) string {
+	if attachment.FileName != "" {
+		return path.Base(attachment.FileName)
+	}
+
+	return path.Base(fileName)
+}
+
+func extractFile(file *zip.File, localPath string) error {
+	reader, err := file.Open()
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %s", file.Name)
+	}
+	defer reader.Close()
+
+	output, err := os.Create(localPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create attachment %s", localPath)
+	}
+	defer output.Close()
+
+	_, err = io.Copy(output, reader)
+	if err != nil {
+		return errors.Wrapf(err, "failed to extract %s", file.Name)
+	}
+
+	return nil
+}
+
+// reactions converts the reactions to a message. Discord does not
+// record when a reaction was added, so the time the message was posted
+// is used instead.
+func (t *transformer) reactions(ch *channel, message *Message, createAt int64) *[]imports.ReactionImportData {
+	var reactions []imports.ReactionImportData
+	for _, reaction := range message.Reactions {
+		emoji := emojiName(reaction.Emoji)
+		if emoji == "" {
+			continue
+		}
+		for _, user := range reaction.Users {
+			username := t.addUser(user)
+			t.memberships.JoinChannel(user.ID, ch.teamName, ch.name)
+			reactions = append(reactions, imports.ReactionImportData{
+				User:      mmmodel.NewString(username),
+				EmojiName: mmmodel.NewString(emoji),
+				CreateAt:  mmmodel.NewInt64(createAt),
+			})
+		}
+	}
+	if len(reactions) == 0 {
+		return nil
+	}
+
+	return &reactions
+}
+
+// emojiName returns the Mattermost name of a Discord emoji, or an
+// empty string if it has none.
+func emojiName(emoji Emoji) string {
+	name := emoji.Code
+	if name == "" {
+		name = emoji.Name
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '-' || r == '+' {
+			b.WriteRune(r)
+		}
+	}
+
+	switch b.String() {
+	case "thumbsup":
+		return "+1"
+	case "thumbsdown":
+		return "-1"
+	}
+
+	return b.String()
+}
+
+// addUser returns the Mattermost username of a Discord user, creating
+// the user if it is not yet known.
+func (t *transformer) addUser(author Author) string {
+	if username, ok := t.usernames[author.ID]; ok {
+		return username
+	}
+
+	name := author.Name
+	if author.Discriminator != "" && strings.Trim(author.Discriminator, "0") != "" {
+		// Users who have not migrated to unique usernames are only
+		// unique together with their discriminator.
+		name = fmt.Sprintf("%s_%s", name, author.Discriminator)
+	}
+	username := mbif.Username(name)
+	if username == "" {
+		username = "discord-user-" + author.ID
+	}
+	username = t.takenUsernames.Unique(username, "")
+
+	t.usernames[author.ID] = username
+	t.userOrder = append(t.userOrder, author.ID)
+	t.users[author.ID] = &imports.UserImportData{
+		Username: mmmodel.NewString(username),
+		Email:    mmmodel.NewString(mbif.PlaceholderEmail(username, emailSource)),
+		Nickname: mmmodel.NewString(mbif.Truncate(author.Nickname, 64)),
+	}
+
+	return username
+}
+
+// parseTime parses a DiscordChatExporter timestamp into milliseconds
+// since the epoch.
+func parseTime(value string) (int64, error) {
+	parsed, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return 0, err
+	}
+
+	return parsed.UnixNano() / int64(time.Millisecond), nil
+}
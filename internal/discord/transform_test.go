@@ -0,0 +1,152 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package discord
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/awat/internal/mbif"
+	"github.com/mattermost/awat/internal/testlib"
+	"github.com/mattermost/awat/internal/validators"
+	"github.com/mattermost/awat/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testGuild = `"guild": {"id": "g1", "name": "Gaming Club"}`
+
+// testExport is a small DiscordChatExporter export of one server with
+// a partitioned channel, an inline reply, a reaction, an exported
+// attachment, a thread started from a message, a thread started on its
+// own and a direct message conversation which is skipped.
+var testExport = map[string]string{
+	"Gaming Club - Text Channels - general [100].json": `{` + testGuild + `,
+		"channel": {"id": "100", "type": "GuildTextChat", "categoryId": "10", "category": "Text Channels", "name": "general", "topic": "Talk about anything"},
+		"messages": [
+			{
+				"id": "1001", "type": "Default", "timestamp": "2023-05-01T10:00:00.000+00:00", "isPinned": true,
+				"content": "Hello @Bobby!",
+				"author": {"id": "1", "name": "alice", "discriminator": "0000"},
+				"attachments": [
+					{"id": "a1", "url": "Gaming Club - Text Channels - general [100].json_Files/cat-1A2B.png", "fileName": "cat.png"},
+					{"id": "a2", "url": "https://cdn.discordapp.com/attachments/1/2/missing.txt", "fileName": "missing.txt"}
+				],
+				"reactions": [{"emoji": {"id": "", "name": "👍", "code": "thumbsup"}, "count": 1, "users": [{"id": "2", "name": "bob", "nickname": "Bobby"}]}],
+				"mentions": [{"id": "2", "name": "bob", "nickname": "Bobby"}]
+			},
+			{
+				"id": "1002", "type": "Reply", "timestamp": "2023-05-01T10:01:00+00:00",
+				"timestampEdited": "2023-05-01T10:02:00+00:00",
+				"content": "Hi Alice",
+				"author": {"id": "2", "name": "bob", "nickname": "Bobby"},
+				"reference": {"messageId": "1001", "channelId": "100", "guildId": "g1"}
+			},
+			{
+				"id": "1003", "type": "ChannelPinnedMessage", "timestamp": "2023-05-01T10:03:00+00:00",
+				"content": "Pinned a message.", "author": {"id": "1", "name": "alice"}
+			},
+			{
+				"id": "1004", "type": "ThreadCreated", "timestamp": "2023-05-01T11:00:00+00:00",
+				"content": "Side chat", "author": {"id": "3", "name": "Carol#1234", "discriminator": "1234"},
+				"reference": {"channelId": "300", "guildId": "g1"}
+			}
+		]
+	}`,
+	"Gaming Club - Text Channels - general [100] [part 2].json": `{` + testGuild + `,
+		"channel": {"id": "100", "type": "GuildTextChat", "categoryId": "10", "category": "Text Channels", "name": "general"},
+		"messages": [
+			{"id": "1005", "type": "Default", "timestamp": "2023-05-02T09:00:00+00:00", "content": "Next day", "author": {"id": "1", "name": "alice"}}
+		]
+	}`,
+	"Gaming Club - Text Channels - general [100].json_Files/cat-1A2B.png": "png",
+	"Gaming Club - general - Planning [1001].json": `{` + testGuild + `,
+		"channel": {"id": "1001", "type": "GuildPublicThread", "categoryId": "100", "category": "general", "name": "Planning"},
+		"messages": [
+			{"id": "2001", "type": "Default", "timestamp": "2023-05-01T10:30:00+00:00", "content": "Thread reply", "author": {"id": "2", "name": "bob"}}
+		]
+	}`,
+	"Gaming Club - general - Side chat [300].json": `{` + testGuild + `,
+		"channel": {"id": "300", "type": "GuildPublicThread", "categoryId": "100", "category": "general", "name": "Side chat"},
+		"messages": [
+			{"id": "3001", "type": "Default", "timestamp": "2023-05-01T11:05:00+00:00", "content": "In the side chat", "author": {"id": "1", "name": "alice"}}
+		]
+	}`,
+	"Direct Messages - bob [400].json": `{"guild": {"id": "0", "name": "Direct Messages"},
+		"channel": {"id": "400", "type": "DirectTextChat", "name": "bob"},
+		"messages": [
+			{"id": "4001", "type": "Default", "timestamp": "2023-05-01T10:00:00+00:00", "content": "secret", "author": {"id": "1", "name": "alice"}}
+		]
+	}`,
+}
+
+func TestTransformDiscord(t *testing.T) {
+	logger := testlib.MakeLogger(t)
+	workdir := t.TempDir()
+	inputArchive := testlib.WriteZip(t, filepath.Join(workdir, "discord-export.zip"), testExport)
+	attachmentDir := filepath.Join(workdir, "attachments")
+	require.NoError(t, os.MkdirAll(attachmentDir, 0700))
+	mbifPath := filepath.Join(workdir, "MBIF.jsonl")
+
+	translation := &model.Translation{ID: model.NewID(), Type: model.DiscordWorkspaceBackupType}
+	err := TransformDiscord(translation, inputArchive, mbifPath, attachmentDir, logger)
+	require.NoError(t, err)
+
+	lines := testlib.ReadMBIFLinesByType(t, mbifPath)
+
+	require.Len(t, lines["team"], 1)
+	assert.Equal(t, "gaming-club", *lines["team"][0].Team.Name)
+
+	require.Len(t, lines["channel"], 1)
+	channel := lines["channel"][0].Channel
+	assert.Equal(t, "general", *channel.Name)
+	assert.Equal(t, "Text Channels: general", *channel.DisplayName)
+	assert.Equal(t, "Talk about anything", *channel.Header)
+
+	require.Len(t, lines["user"], 3)
+	assert.Equal(t, "alice", *lines["user"][0].User.Username)
+	assert.Equal(t, "alice@discord.invalid", *lines["user"][0].User.Email)
+	assert.Equal(t, "bob", *lines["user"][1].User.Username)
+	assert.Equal(t, "Bobby", *lines["user"][1].User.Nickname)
+	assert.Equal(t, "carol1234_1234", *lines["user"][2].User.Username)
+
+	posts := lines["post"]
+	require.Len(t, posts, 3)
+
+	first := posts[0].Post
+	assert.Equal(t, "Hello @bob!\nhttps://cdn.discordapp.com/attachments/1/2/missing.txt", *first.Message)
+	assert.True(t, *first.IsPinned)
+	require.NotNil(t, first.Attachments)
+	assert.Equal(t, "attachments/cat.png", *(*first.Attachments)[0].Path)
+	require.NotNil(t, first.Reactions)
+	assert.Equal(t, "+1", *(*first.Reactions)[0].EmojiName)
+	require.NotNil(t, first.Replies)
+	require.Len(t, *first.Replies, 2)
+	assert.Equal(t, "Hi Alice", *(*first.Replies)[0].Message)
+	assert.NotNil(t, (*first.Replies)[0].EditAt)
+	assert.Equal(t, "Thread reply", *(*first.Replies)[1].Message)
+
+	thread := posts[1].Post
+	assert.Equal(t, "**Side chat**", *thread.Message)
+	require.NotNil(t, thread.Replies)
+	assert.Equal(t, "In the side chat", *(*thread.Replies)[0].Message)
+
+	assert.Equal(t, "Next day", *posts[2].Post.Message)
+	assert.Empty(t, lines["direct_post"])
+
+	outputPath := filepath.Join(workdir, "output.zip")
+	_, _, err = mbif.CreateArchive(outputPath, mbifPath, attachmentDir)
+	require.NoError(t, err)
+	report, err := validators.NewMattermostValidator().Validate(outputPath)
+	require.NoError(t, err)
+	assert.Empty(t, report.Errors)
+}
+
+func TestEmojiName(t *testing.T) {
+	assert.Equal(t, "+1", emojiName(Emoji{Name: "👍", Code: "thumbsup"}))
+	assert.Equal(t, "party_parrot", emojiName(Emoji{ID: "123", Name: "Party_Parrot"}))
+	assert.Equal(t, "", emojiName(Emoji{Name: "👍"}))
+}
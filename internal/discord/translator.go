@@ -0,0 +1,73 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package discord
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/mattermost/awat/internal/mbif"
+	"github.com/mattermost/awat/internal/objectstore"
+	"github.com/mattermost/awat/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// DiscordTranslator is responsible for translating Discord server
+// exports into a format compatible with Mattermost.
+type DiscordTranslator struct {
+	objectStore        objectstore.ObjectStore
+	workingDir         string
+	outputZipLocalPath string
+	outputChecksum     string
+}
+
+// NewDiscordTranslator creates a new Translator instance for
+// translating Discord server exports.
+func NewDiscordTranslator(objectStore objectstore.ObjectStore, workingDir string) *DiscordTranslator {
+	return &DiscordTranslator{
+		objectStore: objectStore,
+		workingDir:  workingDir,
+	}
+}
+
+// Translate satisfies the Translator interface for the
+// DiscordTranslator. It converts the DiscordChatExporter archive
+// referenced by the Translation into a Mattermost archive and uploads
+// it to the object store. On success it returns the file name of the
+// output zip file without a path.
+func (dt *DiscordTranslator) Translate(ctx context.Context, translation *model.Translation) (string, error) {
+	logger := log.New().WithField("translation", translation.ID)
+
+	outputPath, checksum, err := mbif.Translate(ctx, dt.objectStore, dt.workingDir, "input.zip", translation, TransformDiscord, logger)
+	if err != nil {
+		return "", err
+	}
+	dt.outputZipLocalPath = outputPath
+	dt.outputChecksum = checksum
+
+	logger.Info("Finished translation")
+
+	return filepath.Base(outputPath), nil
+}
+
+// GetOutputArchiveLocalPath returns the local file path of the translated archive.
+func (dt *DiscordTranslator) GetOutputArchiveLocalPath() (string, error) {
+	return dt.outputZipLocalPath, nil
+}
+
+// GetOutputArchiveChecksum returns the checksum of the translated archive.
+func (dt *DiscordTranslator) GetOutputArchiveChecksum() (string, error) {
+	return dt.outputChecksum, nil
+}
+
+// Cleanup performs necessary cleanup operations after the translation process.
+func (dt *DiscordTranslator) Cleanup() error {
+	if dt.outputZipLocalPath == "" {
+		return nil
+	}
+
+	return os.Remove(dt.outputZipLocalPath)
+}
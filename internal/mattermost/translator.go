@@ -5,13 +5,17 @@
 package mattermost
 
 import (
+	"context"
+
 	"github.com/mattermost/awat/model"
 )
 
 // MattermostTranslator is a type that facilitates the translation of
 // Mattermost workspace archives.
 // nolint
-type MattermostTranslator struct{}
+type MattermostTranslator struct {
+	outputChecksum string
+}
 
 // NewMattermostTranslator creates a new instance of MattermostTranslator.
 func NewMattermostTranslator() *MattermostTranslator {
@@ -19,8 +23,10 @@ func NewMattermostTranslator() *MattermostTranslator {
 }
 
 // Translate performs the translation operation for a Mattermost workspace
-// archive, as defined in the provided Translation object.
-func (mt *MattermostTranslator) Translate(translation *model.Translation) (string, error) {
+// archive, as defined in the provided Translation object. The archive
+// is imported as it is, so the output is the input archive.
+func (mt *MattermostTranslator) Translate(ctx context.Context, translation *model.Translation) (string, error) {
+	mt.outputChecksum = translation.InputChecksum
 	return translation.Resource, nil
 }
 
@@ -30,6 +36,12 @@ func (mt *MattermostTranslator) GetOutputArchiveLocalPath() (string, error) {
 	return "", nil
 }
 
+// GetOutputArchiveChecksum returns the checksum of the input archive,
+// if it was uploaded to the AWAT.
+func (mt *MattermostTranslator) GetOutputArchiveChecksum() (string, error) {
+	return mt.outputChecksum, nil
+}
+
 // Cleanup performs any necessary cleanup operations after translation,
 // such as deleting temporary files.
 func (mt *MattermostTranslator) Cleanup() error {
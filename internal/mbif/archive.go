@@ -0,0 +1,108 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package mbif
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// FileName is the name of the MBIF file inside the output archive.
+	FileName = "MBIF.jsonl"
+
+	// attachmentsDir is the directory, relative to the data directory
+	// of the output archive, that attachments are stored under.
+	attachmentsDir = "attachments"
+
+	// dataDir is the directory of the output archive which Mattermost
+	// resolves attachment paths against.
+	dataDir = "data"
+)
+
+// AttachmentPath returns the path an attachment stored as name in the
+// attachments directory should be referenced by from an import line.
+func AttachmentPath(name string) string {
+	return path.Join(attachmentsDir, name)
+}
+
+// CreateArchive writes a Mattermost import archive to outputPath
+// containing the MBIF file at mbifPath and every file below
+// attachmentDir, which are stored under data/attachments. It returns
+// the number of attachments added to the archive and the hex encoded
+// SHA-256 of the archive, computed while it is written.
+func CreateArchive(outputPath, mbifPath, attachmentDir string) (int, string, error) {
+	output, err := os.Create(outputPath)
+	if err != nil {
+		return 0, "", errors.Wrapf(err, "failed to create output archive %s", outputPath)
+	}
+	defer output.Close()
+
+	hash := sha256.New()
+	archive := zip.NewWriter(io.MultiWriter(output, hash))
+
+	err = addFile(archive, mbifPath, FileName)
+	if err != nil {
+		return 0, "", err
+	}
+
+	attachments := 0
+	err = filepath.Walk(attachmentDir, func(localPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && localPath == attachmentDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(attachmentDir, localPath)
+		if err != nil {
+			return err
+		}
+
+		attachments++
+		return addFile(archive, localPath, path.Join(dataDir, AttachmentPath(filepath.ToSlash(relativePath))))
+	})
+	if err != nil {
+		return 0, "", errors.Wrap(err, "failed to add attachments to output archive")
+	}
+
+	err = archive.Close()
+	if err != nil {
+		return 0, "", errors.Wrap(err, "failed to finalize output archive")
+	}
+
+	return attachments, hex.EncodeToString(hash.Sum(nil)), output.Close()
+}
+
+func addFile(archive *zip.Writer, localPath, name string) error {
+	input, err := os.Open(localPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %s", localPath)
+	}
+	defer input.Close()
+
+	entry, err := archive.Create(name)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s in archive", name)
+	}
+
+	_, err = io.Copy(entry, input)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write %s to archive", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package mbif
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/mattermost/awat/internal/objectstore"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/v8/channels/app/imports"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateArchive(t *testing.T) {
+	workdir := t.TempDir()
+	attachmentDir := filepath.Join(workdir, "attachments")
+	require.NoError(t, os.MkdirAll(filepath.Join(attachmentDir, "nested"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(attachmentDir, "image.png"), []byte("png"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(attachmentDir, "nested", "notes.txt"), []byte("txt"), 0600))
+
+	mbifPath := filepath.Join(workdir, "MBIF.jsonl")
+	writer, err := NewWriter(mbifPath)
+	require.NoError(t, err)
+	require.NoError(t, writer.Post(&imports.PostImportData{
+		Team:        model.NewString("team"),
+		Channel:     model.NewString("channel"),
+		User:        model.NewString("user"),
+		Message:     model.NewString("message"),
+		CreateAt:    model.NewInt64(1),
+		Attachments: &[]imports.AttachmentImportData{{Path: model.NewString(AttachmentPath("image.png"))}},
+	}))
+	assert.Equal(t, 2, writer.Lines())
+	require.NoError(t, writer.Close())
+
+	outputPath := filepath.Join(workdir, "output.zip")
+	attachments, checksum, err := CreateArchive(outputPath, mbifPath, attachmentDir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, attachments)
+	written, err := objectstore.FileChecksum(outputPath)
+	require.NoError(t, err)
+	assert.Equal(t, written, checksum)
+
+	archive, err := zip.OpenReader(outputPath)
+	require.NoError(t, err)
+	defer archive.Close()
+
+	var names []string
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{
+		"MBIF.jsonl",
+		"data/attachments/image.png",
+		"data/attachments/nested/notes.txt",
+	}, names)
+
+	t.Run("missing attachment directory", func(t *testing.T) {
+		attachments, _, err := CreateArchive(outputPath, mbifPath, filepath.Join(workdir, "missing"))
+		require.NoError(t, err)
+		assert.Equal(t, 0, attachments)
+	})
+}
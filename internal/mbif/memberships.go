@@ -0,0 +1,98 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package mbif
+
+import (
+	"sort"
+
+	mmmodel "github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/v8/channels/app/imports"
+)
+
+// Memberships records which teams and channels each user belongs to,
+// so that the teams field of the user import lines can be built once
+// every channel and post has been seen.
+type Memberships struct {
+	// channels maps a user to a team name to the names of the
+	// channels in that team the user belongs to.
+	channels map[string]map[string]map[string]bool
+	admins   map[string]map[string]bool
+}
+
+// NewMemberships creates an empty set of memberships.
+func NewMemberships() *Memberships {
+	return &Memberships{
+		channels: make(map[string]map[string]map[string]bool),
+		admins:   make(map[string]map[string]bool),
+	}
+}
+
+// JoinTeam records the user as a member of the team.
+func (m *Memberships) JoinTeam(user, team string) {
+	if m.channels[user] == nil {
+		m.channels[user] = make(map[string]map[string]bool)
+	}
+	if m.channels[user][team] == nil {
+		m.channels[user][team] = make(map[string]bool)
+	}
+}
+
+// MakeTeamAdmin records the user as an administrator of the team.
+func (m *Memberships) MakeTeamAdmin(user, team string) {
+	m.JoinTeam(user, team)
+	if m.admins[user] == nil {
+		m.admins[user] = make(map[string]bool)
+	}
+	m.admins[user][team] = true
+}
+
+// JoinChannel records the user as a member of the channel and of the
+// team the channel belongs to.
+func (m *Memberships) JoinChannel(user, team, channel string) {
+	m.JoinTeam(user, team)
+	m.channels[user][team][channel] = true
+}
+
+// Teams returns the team memberships of the user for its import line,
+// or nil if the user is not a member of any team.
+func (m *Memberships) Teams(user string) *[]imports.UserTeamImportData {
+	var teamNames []string
+	for team := range m.channels[user] {
+		teamNames = append(teamNames, team)
+	}
+	if len(teamNames) == 0 {
+		return nil
+	}
+	sort.Strings(teamNames)
+
+	teams := make([]imports.UserTeamImportData, 0, len(teamNames))
+	for _, team := range teamNames {
+		var channelNames []string
+		for channel := range m.channels[user][team] {
+			channelNames = append(channelNames, channel)
+		}
+		sort.Strings(channelNames)
+
+		channels := make([]imports.UserChannelImportData, 0, len(channelNames))
+		for _, channel := range channelNames {
+			channels = append(channels, imports.UserChannelImportData{
+				Name:  mmmodel.NewString(channel),
+				Roles: mmmodel.NewString(mmmodel.ChannelUserRoleId),
+			})
+		}
+
+		roles := mmmodel.TeamUserRoleId
+		if m.admins[user][team] {
+			roles = roles + " " + mmmodel.TeamAdminRoleId
+		}
+		teams = append(teams, imports.UserTeamImportData{
+			Name:     mmmodel.NewString(team),
+			Roles:    mmmodel.NewString(roles),
+			Channels: &channels,
+		})
+	}
+
+	return &teams
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package mbif
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	mmmodel "github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	// MaxMessageRunes is the longest post message Mattermost accepts
+	// in an import, as enforced by the mmctl import validator.
+	MaxMessageRunes = 16383
+
+	// maxNameLength is the longest team, channel or user name that
+	// Mattermost accepts.
+	maxNameLength = 64
+
+	// maxDisplayNameRunes is the longest team or channel display name
+	// that Mattermost accepts.
+	maxDisplayNameRunes = 64
+)
+
+// restrictedUsernames are names Mattermost does not allow users to
+// have.
+var restrictedUsernames = map[string]bool{
+	"all":       true,
+	"channel":   true,
+	"here":      true,
+	"matterbot": true,
+	"system":    true,
+}
+
+// ChannelName converts s into a valid Mattermost channel or team name
+// consisting of lowercase letters, digits and single dashes. It
+// returns an empty string if s contains nothing usable.
+func ChannelName(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+
+	name := strings.TrimRight(b.String(), "-")
+	if len(name) > maxNameLength {
+		name = strings.TrimRight(name[:maxNameLength], "-")
+	}
+
+	return name
+}
+
+// Username converts s into a valid Mattermost username. It returns an
+// empty string if s contains nothing usable.
+func Username(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteRune('.')
+		}
+	}
+
+	name := strings.Trim(b.String(), ".-_")
+	if len(name) > maxNameLength {
+		name = name[:maxNameLength]
+	}
+	if restrictedUsernames[name] {
+		name = name + "_"
+	}
+	if name != "" && !mmmodel.IsValidUsername(name) {
+		return ""
+	}
+
+	return name
+}
+
+// DisplayName truncates s to the longest display name Mattermost
+// accepts for teams and channels.
+func DisplayName(s string) string {
+	return Truncate(strings.TrimSpace(s), maxDisplayNameRunes)
+}
+
+// Message truncates s to the longest post message Mattermost accepts.
+func Message(s string) string {
+	return Truncate(s, MaxMessageRunes)
+}
+
+// Truncate shortens s to at most max runes.
+func Truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+
+	return string([]rune(s)[:max])
+}
+
+// Names hands out names which are unique within the set, which is
+// needed because distinct source entities can sanitize to the same
+// Mattermost name.
+type Names map[string]bool
+
+// Unique returns name, or name with a numeric suffix if it has already
+// been handed out, and records the result as taken. An empty name is
+// replaced with fallback.
+func (n Names) Unique(name, fallback string) string {
+	if name == "" {
+		name = fallback
+	}
+
+	candidate := name
+	for i := 2; n[candidate]; i++ {
+		suffix := fmt.Sprintf("-%d", i)
+		base := name
+		if len(base)+len(suffix) > maxNameLength {
+			base = base[:maxNameLength-len(suffix)]
+		}
+		candidate = base + suffix
+	}
+	n[candidate] = true
+
+	return candidate
+}
+
+// PlaceholderEmail returns an address for a user whose source archive
+// does not include one. Mattermost requires every imported user to
+// have an email address, and the .invalid top level domain guarantees
+// that nothing is ever delivered to it.
+func PlaceholderEmail(username, source string) string {
+	return fmt.Sprintf("%s@%s.invalid", username, source)
+}
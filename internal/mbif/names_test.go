@@ -0,0 +1,68 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package mbif
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelName(t *testing.T) {
+	var testCases = []struct {
+		input    string
+		expected string
+	}{
+		{"General", "general"},
+		{"Release Planning 2024", "release-planning-2024"},
+		{"  --Design & UX--  ", "design-ux"},
+		{"日本語", ""},
+		{strings.Repeat("a", 70), strings.Repeat("a", 64)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ChannelName(tc.input))
+		})
+	}
+}
+
+func TestUsername(t *testing.T) {
+	var testCases = []struct {
+		input    string
+		expected string
+	}{
+		{"jane.doe", "jane.doe"},
+		{"Jane Doe", "jane.doe"},
+		{"_admin!_", "admin"},
+		{"all", "all_"},
+		{"日本語", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Username(tc.input))
+		})
+	}
+}
+
+func TestNamesUnique(t *testing.T) {
+	names := make(Names)
+
+	assert.Equal(t, "town-square", names.Unique("town-square", "fallback"))
+	assert.Equal(t, "town-square-2", names.Unique("town-square", "fallback"))
+	assert.Equal(t, "town-square-3", names.Unique("town-square", "fallback"))
+	assert.Equal(t, "fallback", names.Unique("", "fallback"))
+
+	long := strings.Repeat("a", 64)
+	assert.Equal(t, long, names.Unique(long, "fallback"))
+	assert.Equal(t, strings.Repeat("a", 62)+"-2", names.Unique(long, "fallback"))
+}
+
+func TestMessage(t *testing.T) {
+	assert.Equal(t, "short", Message("short"))
+	assert.Len(t, []rune(Message(strings.Repeat("ü", MaxMessageRunes+10))), MaxMessageRunes)
+}
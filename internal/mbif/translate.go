@@ -0,0 +1,97 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package mbif
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mattermost/awat/internal/common"
+	"github.com/mattermost/awat/internal/objectstore"
+	"github.com/mattermost/awat/model"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// TransformFunc converts the input archive at inputPath to MBIF written
+// to mbifPath, extracting attachments to attachmentDir.
+type TransformFunc func(translation *model.Translation, inputPath, mbifPath, attachmentDir string, logger log.FieldLogger) error
+
+// Translate performs the steps every MBIF producing translator shares:
+// it downloads the input archive of the Translation from the object
+// store into a scratch directory below workingDir, runs transform on
+// it, packages the result into <workingDir>/<translation ID>.zip and
+// uploads that archive to the object store. inputName is the file name
+// the input archive is stored as, which matters for transforms which
+// detect the format by extension. The input archive is verified against
+// the InputChecksum of the Translation, if it is set. It returns the
+// local path of the output archive and its hex encoded SHA-256.
+// Cancelling ctx stops the translation between steps.
+// Errors of transform are marked as permanent, as transforming the
+// same input again will fail the same way.
+func Translate(ctx context.Context, objectStore objectstore.ObjectStore, workingDir, inputName string, translation *model.Translation, transform TransformFunc, logger log.FieldLogger) (string, string, error) {
+	workdir := filepath.Join(workingDir, translation.ID)
+	err := os.Mkdir(workdir, 0700)
+	if err != nil {
+		return "", "", err
+	}
+	defer os.RemoveAll(workdir)
+
+	inputPath := filepath.Join(workdir, inputName)
+	common.ReportProgress(ctx, model.TranslationPhaseDownload, fmt.Sprintf("Downloading the %s archive", translation.Type), 0, 0)
+	nBytes, err := objectstore.DownloadWithProgress(ctx, objectStore, translation.Resource, inputPath, translation.InputChecksum)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to download %s from bucket %s", translation.Resource, objectStore.Bucket())
+	}
+	logger.Debugf("Successfully downloaded %d bytes from bucket %s key %s", nBytes, objectStore.Bucket(), translation.Resource)
+
+	if err = ctx.Err(); err != nil {
+		return "", "", err
+	}
+
+	attachmentDir := filepath.Join(workdir, "attachments")
+	err = os.MkdirAll(attachmentDir, 0700)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to create attachments directory %s", attachmentDir)
+	}
+
+	mbifPath := filepath.Join(workdir, fmt.Sprintf("%s_MBIF.jsonl", translation.InstallationID))
+	logger.Infof("Transforming %s archive to MBIF", translation.Type)
+	common.ReportProgress(ctx, model.TranslationPhaseTransform, fmt.Sprintf("Transforming the %s archive to MBIF", translation.Type), 0, 0)
+	err = transform(translation, inputPath, mbifPath, attachmentDir, logger)
+	if err != nil {
+		return "", "", common.Permanent(errors.Wrapf(err, "failed to transform %s archive to MBIF", translation.Type))
+	}
+
+	if err = ctx.Err(); err != nil {
+		return "", "", err
+	}
+
+	logger.Info("Preparing Mattermost archive for upload")
+	common.ReportProgress(ctx, model.TranslationPhaseArchive, "Preparing the Mattermost archive", 0, 0)
+	outputName := fmt.Sprintf("%s.zip", translation.ID)
+	outputPath := filepath.Join(workingDir, outputName)
+	attachments, checksum, err := CreateArchive(outputPath, mbifPath, attachmentDir)
+	if err != nil {
+		return "", "", err
+	}
+	logger.Debugf("Added %d attachments to the Mattermost archive", attachments)
+
+	if err = ctx.Err(); err != nil {
+		os.Remove(outputPath)
+		return "", "", err
+	}
+
+	logger.Info("Uploading Mattermost archive")
+	err = objectstore.UploadWithProgress(ctx, objectStore, outputPath, outputName)
+	if err != nil {
+		os.Remove(outputPath)
+		return "", "", err
+	}
+
+	return outputPath, checksum, nil
+}
@@ -0,0 +1,456 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package mbif
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	mmmodel "github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/v8/channels/app/imports"
+	"github.com/pkg/errors"
+)
+
+// Workspace is a source neutral model of a chat workspace. Translators
+// whose source format maps directly onto users, channels and direct
+// conversations fill one in with the IDs of the source archive and
+// leave it to the Workspace to assign valid, unique Mattermost names,
+// work out memberships and write the MBIF lines in the right order.
+type Workspace struct {
+	// TeamName is the name of the team everything is imported into.
+	TeamName string
+
+	// TeamDisplayName is the display name of the team. If it is set a
+	// team line is written, otherwise the team must already exist.
+	TeamDisplayName string
+
+	// EmailSource names the source of the Workspace in the placeholder
+	// email addresses of users without one.
+	EmailSource string
+
+	Users          []*User
+	Channels       []*Channel
+	DirectChannels []*DirectChannel
+	Posts          []*Post
+}
+
+// User is a user of a Workspace.
+type User struct {
+	ID        string
+	Username  string
+	Email     string
+	FirstName string
+	LastName  string
+	Nickname  string
+	Position  string
+	TeamAdmin bool
+	DeleteAt  int64
+}
+
+// Channel is a public or private channel of a Workspace.
+type Channel struct {
+	ID          string
+	Name        string
+	DisplayName string
+	Header      string
+	Purpose     string
+	Private     bool
+	DeleteAt    int64
+
+	// Members holds the IDs of the members of the channel. Authors of
+	// posts in the channel become members even if they are not listed.
+	Members []string
+}
+
+// DirectChannel is a direct or group message conversation of a
+// Workspace.
+type DirectChannel struct {
+	ID      string
+	Members []string
+}
+
+// Post is a message posted to a Channel or DirectChannel.
+type Post struct {
+	ID        string
+	ChannelID string
+	UserID    string
+	Message   string
+	CreateAt  int64
+	EditAt    int64
+	Pinned    bool
+
+	// ThreadID is the ID of the post this post replies to, if any.
+	ThreadID string
+
+	Reactions []Reaction
+
+	// Attachments holds the names of the files in the attachment
+	// directory attached to the post.
+	Attachments []string
+}
+
+// Reaction is a reaction to a Post.
+type Reaction struct {
+	UserID   string
+	Emoji    string
+	CreateAt int64
+}
+
+// SaveAttachment copies content into attachmentDir under a name based
+// on name which is unique within names, and returns the name it was
+// stored under.
+func SaveAttachment(attachmentDir string, names Names, name string, content io.Reader) (string, error) {
+	name = names.Unique(strings.ReplaceAll(filepath.Base(name), string(filepath.Separator), "_"), "attachment")
+
+	output, err := os.Create(filepath.Join(attachmentDir, name))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to create attachment %s", name)
+	}
+	defer output.Close()
+
+	_, err = io.Copy(output, content)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to write attachment %s", name)
+	}
+
+	return name, output.Close()
+}
+
+// Usernames returns the valid, unique Mattermost usernames the users of
+// the Workspace are written with, keyed by user ID. Users without a
+// username are named after the local part of their email address.
+func (ws *Workspace) Usernames() map[string]string {
+	usernames := make(map[string]string, len(ws.Users))
+	takenUsernames := make(Names)
+	for _, user := range ws.Users {
+		username := Username(user.Username)
+		if username == "" && user.Email != "" {
+			username = Username(strings.SplitN(user.Email, "@", 2)[0])
+		}
+		usernames[user.ID] = takenUsernames.Unique(username, "user-"+ChannelName(user.ID))
+	}
+
+	return usernames
+}
+
+// Write writes the Workspace as MBIF using writer.
+func (ws *Workspace) Write(writer *Writer) error {
+	usernames := ws.Usernames()
+
+	// Group conversations with more members than Mattermost allows in
+	// a group message become private channels.
+	channels := ws.Channels
+	var directChannels []*DirectChannel
+	for _, dc := range ws.DirectChannels {
+		members := knownMembers(dc.Members, usernames)
+		if len(members) > mmmodel.ChannelGroupMaxUsers {
+			channels = append(channels, &Channel{
+				ID:          dc.ID,
+				Name:        "group-" + dc.ID,
+				DisplayName: "Group conversation",
+				Private:     true,
+				Members:     dc.Members,
+			})
+			continue
+		}
+		if len(members) == 0 {
+			continue
+		}
+		directChannels = append(directChannels, dc)
+	}
+
+	memberships := NewMemberships()
+	for _, user := range ws.Users {
+		memberships.JoinTeam(user.ID, ws.TeamName)
+		if user.TeamAdmin {
+			memberships.MakeTeamAdmin(user.ID, ws.TeamName)
+		}
+	}
+
+	channelNames := make(map[string]string, len(channels))
+	takenChannelNames := make(Names)
+	for _, channel := range channels {
+		name := ChannelName(channel.Name)
+		if name == "" {
+			name = ChannelName(channel.DisplayName)
+		}
+		channelNames[channel.ID] = takenChannelNames.Unique(name, "channel-"+ChannelName(channel.ID))
+		for _, member := range channel.Members {
+			if _, ok := usernames[member]; ok {
+				memberships.JoinChannel(member, ws.TeamName, channelNames[channel.ID])
+			}
+		}
+	}
+
+	directMembers := make(map[string][]string, len(directChannels))
+	for _, dc := range directChannels {
+		members := knownMembers(dc.Members, usernames)
+		if len(members) == 1 {
+			// A conversation with oneself.
+			members = append(members, members[0])
+		}
+		directMembers[dc.ID] = members
+	}
+
+	for _, post := range ws.Posts {
+		if channelName, ok := channelNames[post.ChannelID]; ok {
+			if _, ok := usernames[post.UserID]; ok {
+				memberships.JoinChannel(post.UserID, ws.TeamName, channelName)
+			}
+		}
+	}
+
+	if ws.TeamDisplayName != "" {
+		err := writer.Team(&imports.TeamImportData{
+			Name:        mmmodel.NewString(ws.TeamName),
+			DisplayName: mmmodel.NewString(DisplayName(ws.TeamDisplayName)),
+			Type:        mmmodel.NewString(mmmodel.TeamInvite),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, channel := range channels {
+		channelType := mmmodel.ChannelTypeOpen
+		if channel.Private {
+			channelType = mmmodel.ChannelTypePrivate
+		}
+		displayName := channel.DisplayName
+		if displayName == "" {
+			displayName = channel.Name
+		}
+		line := &imports.ChannelImportData{
+			Team:        mmmodel.NewString(ws.TeamName),
+			Name:        mmmodel.NewString(channelNames[channel.ID]),
+			DisplayName: mmmodel.NewString(DisplayName(displayName)),
+			Type:        &channelType,
+			Header:      mmmodel.NewString(Truncate(channel.Header, mmmodel.ChannelHeaderMaxRunes)),
+			Purpose:     mmmodel.NewString(Truncate(channel.Purpose, mmmodel.ChannelPurposeMaxRunes)),
+		}
+		if channel.DeleteAt != 0 {
+			line.DeletedAt = mmmodel.NewInt64(channel.DeleteAt)
+		}
+		err := writer.Channel(line)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, user := range ws.Users {
+		username := usernames[user.ID]
+		email := user.Email
+		if email == "" {
+			email = PlaceholderEmail(username, ws.EmailSource)
+		}
+		line := &imports.UserImportData{
+			Username:  mmmodel.NewString(username),
+			Email:     mmmodel.NewString(strings.ToLower(email)),
+			FirstName: mmmodel.NewString(user.FirstName),
+			LastName:  mmmodel.NewString(user.LastName),
+			Nickname:  mmmodel.NewString(Truncate(user.Nickname, 64)),
+			Position:  mmmodel.NewString(Truncate(user.Position, 128)),
+			Teams:     memberships.Teams(user.ID),
+		}
+		if user.DeleteAt != 0 {
+			line.DeleteAt = mmmodel.NewInt64(user.DeleteAt)
+		}
+		err := writer.User(line)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, dc := range directChannels {
+		members := usernamesOf(directMembers[dc.ID], usernames)
+		err := writer.DirectChannel(&imports.DirectChannelImportData{Members: &members})
+		if err != nil {
+			return err
+		}
+	}
+
+	return ws.writePosts(writer, usernames, channelNames, directMembers)
+}
+
+// writePosts writes the posts of the Workspace, nesting replies in the
+// post they belong to.
+func (ws *Workspace) writePosts(writer *Writer, usernames, channelNames map[string]string, directMembers map[string][]string) error {
+	posts := make([]*Post, 0, len(ws.Posts))
+	for _, post := range ws.Posts {
+		if _, ok := usernames[post.UserID]; !ok {
+			continue
+		}
+		if post.Message == "" && len(post.Attachments) == 0 {
+			continue
+		}
+		posts = append(posts, post)
+	}
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].CreateAt < posts[j].CreateAt
+	})
+
+	byID := make(map[string]*Post, len(posts))
+	for _, post := range posts {
+		byID[post.ID] = post
+	}
+
+	// rootOf resolves replies to replies to the root of their thread.
+	rootOf := func(post *Post) *Post {
+		seen := make(map[string]bool)
+		for post.ThreadID != "" && !seen[post.ID] {
+			seen[post.ID] = true
+			parent, ok := byID[post.ThreadID]
+			if !ok || parent.ChannelID != post.ChannelID {
+				break
+			}
+			post = parent
+		}
+		return post
+	}
+
+	var roots []*Post
+	replies := make(map[string][]*Post)
+	for _, post := range posts {
+		root := rootOf(post)
+		if root == post {
+			roots = append(roots, post)
+			continue
+		}
+		replies[root.ID] = append(replies[root.ID], post)
+	}
+
+	for _, root := range roots {
+		var importReplies []imports.ReplyImportData
+		for _, reply := range replies[root.ID] {
+			importReplies = append(importReplies, imports.ReplyImportData{
+				User:        mmmodel.NewString(usernames[reply.UserID]),
+				Message:     mmmodel.NewString(Message(reply.Message)),
+				CreateAt:    mmmodel.NewInt64(reply.CreateAt),
+				EditAt:      editAt(reply),
+				Reactions:   reactions(reply, usernames),
+				Attachments: attachments(reply),
+			})
+		}
+		var repliesField *[]imports.ReplyImportData
+		if len(importReplies) > 0 {
+			repliesField = &importReplies
+		}
+		var pinned *bool
+		if root.Pinned {
+			pinned = &root.Pinned
+		}
+
+		if channelName, ok := channelNames[root.ChannelID]; ok {
+			err := writer.Post(&imports.PostImportData{
+				Team:        mmmodel.NewString(ws.TeamName),
+				Channel:     mmmodel.NewString(channelName),
+				User:        mmmodel.NewString(usernames[root.UserID]),
+				Message:     mmmodel.NewString(Message(root.Message)),
+				CreateAt:    mmmodel.NewInt64(root.CreateAt),
+				EditAt:      editAt(root),
+				Reactions:   reactions(root, usernames),
+				Replies:     repliesField,
+				Attachments: attachments(root),
+				IsPinned:    pinned,
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if members, ok := directMembers[root.ChannelID]; ok {
+			channelMembers := usernamesOf(members, usernames)
+			err := writer.DirectPost(&imports.DirectPostImportData{
+				ChannelMembers: &channelMembers,
+				User:           mmmodel.NewString(usernames[root.UserID]),
+				Message:        mmmodel.NewString(Message(root.Message)),
+				CreateAt:       mmmodel.NewInt64(root.CreateAt),
+				EditAt:         editAt(root),
+				Reactions:      reactions(root, usernames),
+				Replies:        repliesField,
+				Attachments:    attachments(root),
+				IsPinned:       pinned,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func knownMembers(members []string, usernames map[string]string) []string {
+	var known []string
+	seen := make(map[string]bool)
+	for _, member := range members {
+		if _, ok := usernames[member]; ok && !seen[member] {
+			seen[member] = true
+			known = append(known, member)
+		}
+	}
+
+	return known
+}
+
+func usernamesOf(ids []string, usernames map[string]string) []string {
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		names = append(names, usernames[id])
+	}
+
+	return names
+}
+
+func editAt(post *Post) *int64 {
+	if post.EditAt == 0 {
+		return nil
+	}
+
+	return mmmodel.NewInt64(post.EditAt)
+}
+
+func reactions(post *Post, usernames map[string]string) *[]imports.ReactionImportData {
+	var importReactions []imports.ReactionImportData
+	for _, reaction := range post.Reactions {
+		username, ok := usernames[reaction.UserID]
+		if !ok || reaction.Emoji == "" {
+			continue
+		}
+		createAt := reaction.CreateAt
+		if createAt == 0 {
+			createAt = post.CreateAt
+		}
+		importReactions = append(importReactions, imports.ReactionImportData{
+			User:      mmmodel.NewString(username),
+			EmojiName: mmmodel.NewString(reaction.Emoji),
+			CreateAt:  mmmodel.NewInt64(createAt),
+		})
+	}
+	if len(importReactions) == 0 {
+		return nil
+	}
+
+	return &importReactions
+}
+
+func attachments(post *Post) *[]imports.AttachmentImportData {
+	if len(post.Attachments) == 0 {
+		return nil
+	}
+
+	importAttachments := make([]imports.AttachmentImportData, 0, len(post.Attachments))
+	for _, name := range post.Attachments {
+		importAttachments = append(importAttachments, imports.AttachmentImportData{
+			Path: mmmodel.NewString(AttachmentPath(name)),
+		})
+	}
+
+	return &importAttachments
+}
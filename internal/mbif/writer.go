@@ -0,0 +1,110 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+// Package mbif contains helpers shared by the translators for writing
+// Mattermost Bulk Import Format (MBIF) files and packaging them,
+// together with their attachments, into an importable archive.
+package mbif
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+
+	"github.com/mattermost/mattermost/server/v8/channels/app/imports"
+	"github.com/pkg/errors"
+)
+
+// Writer writes import lines to a MBIF .jsonl file. The version line
+// is written when the Writer is created; the remaining lines must be
+// written in the order Mattermost expects them: teams, channels,
+// users, direct channels, posts and finally direct posts.
+type Writer struct {
+	file    *os.File
+	buffer  *bufio.Writer
+	encoder *json.Encoder
+	lines   int
+}
+
+// NewWriter creates the MBIF file at path and writes the version line
+// to it.
+func NewWriter(path string) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create MBIF file %s", path)
+	}
+
+	buffer := bufio.NewWriter(file)
+	w := &Writer{
+		file:    file,
+		buffer:  buffer,
+		encoder: json.NewEncoder(buffer),
+	}
+
+	version := 1
+	err = w.writeLine(&imports.LineImportData{Type: "version", Version: &version})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Team writes a team line.
+func (w *Writer) Team(team *imports.TeamImportData) error {
+	return w.writeLine(&imports.LineImportData{Type: "team", Team: team})
+}
+
+// Channel writes a channel line.
+func (w *Writer) Channel(channel *imports.ChannelImportData) error {
+	return w.writeLine(&imports.LineImportData{Type: "channel", Channel: channel})
+}
+
+// User writes a user line.
+func (w *Writer) User(user *imports.UserImportData) error {
+	return w.writeLine(&imports.LineImportData{Type: "user", User: user})
+}
+
+// DirectChannel writes a direct or group message channel line.
+func (w *Writer) DirectChannel(channel *imports.DirectChannelImportData) error {
+	return w.writeLine(&imports.LineImportData{Type: "direct_channel", DirectChannel: channel})
+}
+
+// Post writes a post line.
+func (w *Writer) Post(post *imports.PostImportData) error {
+	return w.writeLine(&imports.LineImportData{Type: "post", Post: post})
+}
+
+// DirectPost writes a direct or group message post line.
+func (w *Writer) DirectPost(post *imports.DirectPostImportData) error {
+	return w.writeLine(&imports.LineImportData{Type: "direct_post", DirectPost: post})
+}
+
+// Lines returns the number of lines written so far, including the
+// version line.
+func (w *Writer) Lines() int {
+	return w.lines
+}
+
+// Close flushes any buffered lines and closes the file.
+func (w *Writer) Close() error {
+	err := w.buffer.Flush()
+	if err != nil {
+		w.file.Close()
+		return errors.Wrap(err, "failed to flush MBIF file")
+	}
+
+	return w.file.Close()
+}
+
+func (w *Writer) writeLine(line *imports.LineImportData) error {
+	err := w.encoder.Encode(line)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write %s line", line.Type)
+	}
+	w.lines++
+
+	return nil
+}
@@ -63,19 +63,19 @@ func (mr *MockStoreMockRecorder) GetTranslationsByInstallation(id interface{}) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTranslationsByInstallation", reflect.TypeOf((*MockStore)(nil).GetTranslationsByInstallation), id)
 }
 
-// GetAllTranslations mocks base method
-func (m *MockStore) GetAllTranslations() ([]*model.Translation, error) {
+// GetTranslations mocks base method
+func (m *MockStore) GetTranslations(options *model.ListOptions) ([]*model.Translation, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAllTranslations")
+	ret := m.ctrl.Call(m, "GetTranslations", options)
 	ret0, _ := ret[0].([]*model.Translation)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetAllTranslations indicates an expected call of GetAllTranslations
-func (mr *MockStoreMockRecorder) GetAllTranslations() *gomock.Call {
+// GetTranslations indicates an expected call of GetTranslations
+func (mr *MockStoreMockRecorder) GetTranslations(options interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllTranslations", reflect.TypeOf((*MockStore)(nil).GetAllTranslations))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTranslations", reflect.TypeOf((*MockStore)(nil).GetTranslations), options)
 }
 
 // CreateTranslation mocks base method
@@ -106,6 +106,51 @@ func (mr *MockStoreMockRecorder) UpdateTranslation(t interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateTranslation", reflect.TypeOf((*MockStore)(nil).UpdateTranslation), t)
 }
 
+// CancelTranslation mocks base method
+func (m *MockStore) CancelTranslation(t *model.Translation) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelTranslation", t)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CancelTranslation indicates an expected call of CancelTranslation
+func (mr *MockStoreMockRecorder) CancelTranslation(t interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelTranslation", reflect.TypeOf((*MockStore)(nil).CancelTranslation), t)
+}
+
+// RetryTranslation mocks base method
+func (m *MockStore) RetryTranslation(t *model.Translation) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RetryTranslation", t)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RetryTranslation indicates an expected call of RetryTranslation
+func (mr *MockStoreMockRecorder) RetryTranslation(t interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetryTranslation", reflect.TypeOf((*MockStore)(nil).RetryTranslation), t)
+}
+
+// ReleaseTranslationLock mocks base method
+func (m *MockStore) ReleaseTranslationLock(t *model.Translation, reason string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseTranslationLock", t, reason)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReleaseTranslationLock indicates an expected call of ReleaseTranslationLock
+func (mr *MockStoreMockRecorder) ReleaseTranslationLock(t, reason interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseTranslationLock", reflect.TypeOf((*MockStore)(nil).ReleaseTranslationLock), t, reason)
+}
+
 // GetAndClaimNextReadyImport mocks base method
 func (m *MockStore) GetAndClaimNextReadyImport(provisionerID string) (*model.Import, error) {
 	m.ctrl.T.Helper()
@@ -121,19 +166,19 @@ func (mr *MockStoreMockRecorder) GetAndClaimNextReadyImport(provisionerID interf
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAndClaimNextReadyImport", reflect.TypeOf((*MockStore)(nil).GetAndClaimNextReadyImport), provisionerID)
 }
 
-// GetAllImports mocks base method
-func (m *MockStore) GetAllImports() ([]*model.Import, error) {
+// GetImports mocks base method
+func (m *MockStore) GetImports(options *model.ListOptions) ([]*model.Import, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAllImports")
+	ret := m.ctrl.Call(m, "GetImports", options)
 	ret0, _ := ret[0].([]*model.Import)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetAllImports indicates an expected call of GetAllImports
-func (mr *MockStoreMockRecorder) GetAllImports() *gomock.Call {
+// GetImports indicates an expected call of GetImports
+func (mr *MockStoreMockRecorder) GetImports(options interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllImports", reflect.TypeOf((*MockStore)(nil).GetAllImports))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetImports", reflect.TypeOf((*MockStore)(nil).GetImports), options)
 }
 
 // GetImport mocks base method
@@ -210,6 +255,81 @@ func (mr *MockStoreMockRecorder) UpdateImport(imp interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateImport", reflect.TypeOf((*MockStore)(nil).UpdateImport), imp)
 }
 
+// CancelImport mocks base method
+func (m *MockStore) CancelImport(imp *model.Import, state, reason string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelImport", imp, state, reason)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CancelImport indicates an expected call of CancelImport
+func (mr *MockStoreMockRecorder) CancelImport(imp, state, reason interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelImport", reflect.TypeOf((*MockStore)(nil).CancelImport), imp, state, reason)
+}
+
+// GetImportTransitions mocks base method
+func (m *MockStore) GetImportTransitions(importID string) ([]*model.ImportTransition, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetImportTransitions", importID)
+	ret0, _ := ret[0].([]*model.ImportTransition)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetImportTransitions indicates an expected call of GetImportTransitions
+func (mr *MockStoreMockRecorder) GetImportTransitions(importID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetImportTransitions", reflect.TypeOf((*MockStore)(nil).GetImportTransitions), importID)
+}
+
+// RenewImportClaim mocks base method
+func (m *MockStore) RenewImportClaim(id, provisionerID string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenewImportClaim", id, provisionerID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RenewImportClaim indicates an expected call of RenewImportClaim
+func (mr *MockStoreMockRecorder) RenewImportClaim(id, provisionerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenewImportClaim", reflect.TypeOf((*MockStore)(nil).RenewImportClaim), id, provisionerID)
+}
+
+// ReleaseImportLock mocks base method
+func (m *MockStore) ReleaseImportLock(imp *model.Import, reason string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseImportLock", imp, reason)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReleaseImportLock indicates an expected call of ReleaseImportLock
+func (mr *MockStoreMockRecorder) ReleaseImportLock(imp, reason interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseImportLock", reflect.TypeOf((*MockStore)(nil).ReleaseImportLock), imp, reason)
+}
+
+// ReleaseImportClaim mocks base method
+func (m *MockStore) ReleaseImportClaim(imp *model.Import, reason string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseImportClaim", imp, reason)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReleaseImportClaim indicates an expected call of ReleaseImportClaim
+func (mr *MockStoreMockRecorder) ReleaseImportClaim(imp, reason interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseImportClaim", reflect.TypeOf((*MockStore)(nil).ReleaseImportClaim), imp, reason)
+}
+
 // GetUpload mocks base method
 func (m *MockStore) GetUpload(id string) (*model.Upload, error) {
 	m.ctrl.T.Helper()
@@ -226,18 +346,18 @@ func (mr *MockStoreMockRecorder) GetUpload(id interface{}) *gomock.Call {
 }
 
 // GetUploads mocks base method
-func (m *MockStore) GetUploads() ([]*model.Upload, error) {
+func (m *MockStore) GetUploads(options *model.ListOptions) ([]*model.Upload, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUploads")
+	ret := m.ctrl.Call(m, "GetUploads", options)
 	ret0, _ := ret[0].([]*model.Upload)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUploads indicates an expected call of GetUploads
-func (mr *MockStoreMockRecorder) GetUploads() *gomock.Call {
+func (mr *MockStoreMockRecorder) GetUploads(options interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUploads", reflect.TypeOf((*MockStore)(nil).GetUploads))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUploads", reflect.TypeOf((*MockStore)(nil).GetUploads), options)
 }
 
 // CreateUpload mocks base method
@@ -267,3 +387,235 @@ func (mr *MockStoreMockRecorder) CompleteUpload(uploadID, errorMessage interface
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteUpload", reflect.TypeOf((*MockStore)(nil).CompleteUpload), uploadID, errorMessage)
 }
+
+// UpdateUploadValidation mocks base method
+func (m *MockStore) UpdateUploadValidation(uploadID string, report *model.ValidationReport) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUploadValidation", uploadID, report)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUploadValidation indicates an expected call of UpdateUploadValidation
+func (mr *MockStoreMockRecorder) UpdateUploadValidation(uploadID, report interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUploadValidation", reflect.TypeOf((*MockStore)(nil).UpdateUploadValidation), uploadID, report)
+}
+
+// UpdateUploadChecksum mocks base method
+func (m *MockStore) UpdateUploadChecksum(uploadID, checksum string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUploadChecksum", uploadID, checksum)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUploadChecksum indicates an expected call of UpdateUploadChecksum
+func (mr *MockStoreMockRecorder) UpdateUploadChecksum(uploadID, checksum interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUploadChecksum", reflect.TypeOf((*MockStore)(nil).UpdateUploadChecksum), uploadID, checksum)
+}
+
+// CreateUploadSession mocks base method
+func (m *MockStore) CreateUploadSession(session *model.UploadSession) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUploadSession", session)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateUploadSession indicates an expected call of CreateUploadSession
+func (mr *MockStoreMockRecorder) CreateUploadSession(session interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUploadSession", reflect.TypeOf((*MockStore)(nil).CreateUploadSession), session)
+}
+
+// GetUploadSession mocks base method
+func (m *MockStore) GetUploadSession(id string) (*model.UploadSession, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUploadSession", id)
+	ret0, _ := ret[0].(*model.UploadSession)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUploadSession indicates an expected call of GetUploadSession
+func (mr *MockStoreMockRecorder) GetUploadSession(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUploadSession", reflect.TypeOf((*MockStore)(nil).GetUploadSession), id)
+}
+
+// AddUploadPart mocks base method
+func (m *MockStore) AddUploadPart(part *model.UploadPart) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddUploadPart", part)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddUploadPart indicates an expected call of AddUploadPart
+func (mr *MockStoreMockRecorder) AddUploadPart(part interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddUploadPart", reflect.TypeOf((*MockStore)(nil).AddUploadPart), part)
+}
+
+// UpdateUploadSessionHash mocks base method
+func (m *MockStore) UpdateUploadSessionHash(session *model.UploadSession, state []byte, hashedSize int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUploadSessionHash", session, state, hashedSize)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateUploadSessionHash indicates an expected call of UpdateUploadSessionHash
+func (mr *MockStoreMockRecorder) UpdateUploadSessionHash(session, state, hashedSize interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUploadSessionHash", reflect.TypeOf((*MockStore)(nil).UpdateUploadSessionHash), session, state, hashedSize)
+}
+
+// ResetUploadSessionHash mocks base method
+func (m *MockStore) ResetUploadSessionHash(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetUploadSessionHash", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetUploadSessionHash indicates an expected call of ResetUploadSessionHash
+func (mr *MockStoreMockRecorder) ResetUploadSessionHash(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetUploadSessionHash", reflect.TypeOf((*MockStore)(nil).ResetUploadSessionHash), id)
+}
+
+// CompleteUploadSession mocks base method
+func (m *MockStore) CompleteUploadSession(id string, verify bool) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompleteUploadSession", id, verify)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompleteUploadSession indicates an expected call of CompleteUploadSession
+func (mr *MockStoreMockRecorder) CompleteUploadSession(id, verify interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteUploadSession", reflect.TypeOf((*MockStore)(nil).CompleteUploadSession), id, verify)
+}
+
+// CreateWebhook mocks base method
+func (m *MockStore) CreateWebhook(webhook *model.Webhook) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWebhook", webhook)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateWebhook indicates an expected call of CreateWebhook
+func (mr *MockStoreMockRecorder) CreateWebhook(webhook interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWebhook", reflect.TypeOf((*MockStore)(nil).CreateWebhook), webhook)
+}
+
+// GetWebhook mocks base method
+func (m *MockStore) GetWebhook(id string) (*model.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhook", id)
+	ret0, _ := ret[0].(*model.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWebhook indicates an expected call of GetWebhook
+func (mr *MockStoreMockRecorder) GetWebhook(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhook", reflect.TypeOf((*MockStore)(nil).GetWebhook), id)
+}
+
+// GetWebhooks mocks base method
+func (m *MockStore) GetWebhooks() ([]*model.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhooks")
+	ret0, _ := ret[0].([]*model.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWebhooks indicates an expected call of GetWebhooks
+func (mr *MockStoreMockRecorder) GetWebhooks() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhooks", reflect.TypeOf((*MockStore)(nil).GetWebhooks))
+}
+
+// DeleteWebhook mocks base method
+func (m *MockStore) DeleteWebhook(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWebhook", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteWebhook indicates an expected call of DeleteWebhook
+func (mr *MockStoreMockRecorder) DeleteWebhook(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWebhook", reflect.TypeOf((*MockStore)(nil).DeleteWebhook), id)
+}
+
+// GetWebhookDeliveries mocks base method
+func (m *MockStore) GetWebhookDeliveries(webhookID string) ([]*model.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhookDeliveries", webhookID)
+	ret0, _ := ret[0].([]*model.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWebhookDeliveries indicates an expected call of GetWebhookDeliveries
+func (mr *MockStoreMockRecorder) GetWebhookDeliveries(webhookID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhookDeliveries", reflect.TypeOf((*MockStore)(nil).GetWebhookDeliveries), webhookID)
+}
+
+// CreateWebhookEvent mocks base method
+func (m *MockStore) CreateWebhookEvent(event *model.WebhookEvent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWebhookEvent", event)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateWebhookEvent indicates an expected call of CreateWebhookEvent
+func (mr *MockStoreMockRecorder) CreateWebhookEvent(event interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWebhookEvent", reflect.TypeOf((*MockStore)(nil).CreateWebhookEvent), event)
+}
+
+// GetEvents mocks base method
+func (m *MockStore) GetEvents(filter *model.EventFilter, limit uint64) ([]*model.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetEvents", filter, limit)
+	ret0, _ := ret[0].([]*model.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetEvents indicates an expected call of GetEvents
+func (mr *MockStoreMockRecorder) GetEvents(filter, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEvents", reflect.TypeOf((*MockStore)(nil).GetEvents), filter, limit)
+}
+
+// GetLatestEventSequence mocks base method
+func (m *MockStore) GetLatestEventSequence() (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLatestEventSequence")
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLatestEventSequence indicates an expected call of GetLatestEventSequence
+func (mr *MockStoreMockRecorder) GetLatestEventSequence() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLatestEventSequence", reflect.TypeOf((*MockStore)(nil).GetLatestEventSequence))
+}
@@ -1,11 +1,21 @@
 package mockcontext
 
-import "github.com/mattermost/awat/internal/mocks"
+import (
+	"fmt"
+	"time"
+
+	"github.com/mattermost/awat/internal/mocks"
+	"github.com/mattermost/awat/model"
+)
 
 // MockAWS is a mock implementation of the AWS interface used for testing.
 type MockAWS struct {
 	ResourceExists bool
 
+	// PresignURL is the URL presigned requests are sent to, followed
+	// by the key and, for parts, the part number.
+	PresignURL string
+
 	dummyArchiveFilePath string
 }
 
@@ -36,3 +46,48 @@ func (a *MockAWS) DownloadArchiveFromS3(archiveName string) (string, func(), err
 
 	return a.dummyArchiveFilePath, func() {}, nil
 }
+
+// DeleteArchiveFromS3 mocks the deletion of an archive from S3.
+func (a *MockAWS) DeleteArchiveFromS3(archiveName string) error {
+	return nil
+}
+
+// StartMultipartUpload mocks the start of a multipart upload to S3.
+func (a *MockAWS) StartMultipartUpload(destKeyName string) (string, error) {
+	return "multipart", nil
+}
+
+// UploadArchivePart mocks the upload of a part of an archive to S3.
+func (a *MockAWS) UploadArchivePart(destKeyName, multipartID string, number int, partFileName, checksum string) (string, error) {
+	return checksum, nil
+}
+
+// CompleteMultipartUpload mocks the completion of a multipart upload
+// to S3.
+func (a *MockAWS) CompleteMultipartUpload(destKeyName, multipartID string, parts []*model.UploadPart) error {
+	return nil
+}
+
+// AbortMultipartUpload mocks the abortion of a multipart upload to S3.
+func (a *MockAWS) AbortMultipartUpload(destKeyName, multipartID string) error {
+	return nil
+}
+
+// PresignArchiveUpload mocks presigning the upload of an archive to S3.
+func (a *MockAWS) PresignArchiveUpload(destKeyName string, size int64, checksum string, expires time.Duration) (*model.PresignedRequest, error) {
+	return &model.PresignedRequest{
+		Method: "PUT",
+		URL:    fmt.Sprintf("%s/%s", a.PresignURL, destKeyName),
+		Header: map[string]string{"X-Amz-Checksum-Sha256": checksum},
+	}, nil
+}
+
+// PresignArchivePartUpload mocks presigning the upload of a part of an
+// archive to S3.
+func (a *MockAWS) PresignArchivePartUpload(destKeyName, multipartID string, number int, size int64, checksum string, expires time.Duration) (*model.PresignedRequest, error) {
+	return &model.PresignedRequest{
+		Method: "PUT",
+		URL:    fmt.Sprintf("%s/%s/%d", a.PresignURL, destKeyName, number),
+		Header: map[string]string{"X-Amz-Checksum-Sha256": checksum},
+	}, nil
+}
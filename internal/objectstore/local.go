@@ -0,0 +1,339 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package objectstore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LocalObjectStore is an ObjectStore backed by a directory on the
+// local filesystem. Object keys are treated as paths relative to the
+// root directory.
+type LocalObjectStore struct {
+	root string
+}
+
+// NewLocalObjectStore creates a new LocalObjectStore rooted at the
+// given directory, creating the directory if it does not exist.
+func NewLocalObjectStore(root string) (*LocalObjectStore, error) {
+	if root == "" {
+		return nil, errors.New("local storage requires a root directory")
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to determine absolute path of %s", root)
+	}
+
+	err = os.MkdirAll(root, 0700)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create storage directory %s", root)
+	}
+
+	return &LocalObjectStore{root: root}, nil
+}
+
+// Bucket returns the root directory of the store.
+func (l *LocalObjectStore) Bucket() string {
+	return l.root
+}
+
+// Exists checks if an object exists in the store.
+func (l *LocalObjectStore) Exists(key string) (bool, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return false, err
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to stat %s", key)
+	}
+
+	return !info.IsDir(), nil
+}
+
+// Upload copies a local file into the store.
+func (l *LocalObjectStore) Upload(localPath, key string) error {
+	in, err := os.Open(localPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %s before upload", localPath)
+	}
+	defer in.Close()
+
+	return l.UploadFrom(in, key)
+}
+
+// UploadFrom writes everything read from body into the store.
+func (l *LocalObjectStore) UploadFrom(body io.Reader, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create directory for %s", key)
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to store %s", key)
+	}
+
+	_, err = io.Copy(out, body)
+	if err != nil {
+		out.Close()
+		return errors.Wrapf(err, "failed to store %s", key)
+	}
+
+	err = out.Close()
+	if err != nil {
+		return errors.Wrapf(err, "failed to store %s", key)
+	}
+
+	return nil
+}
+
+// Download copies an object from the store to a local file.
+func (l *LocalObjectStore) Download(key, localPath string) (int64, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return 0, err
+	}
+
+	nBytes, err := copyFile(path, localPath)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to retrieve %s", key)
+	}
+
+	return nBytes, nil
+}
+
+// Delete removes an object from the store.
+func (l *LocalObjectStore) Delete(key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to delete %s", key)
+	}
+
+	return nil
+}
+
+// path resolves key to a path inside the root directory, refusing
+// keys which would escape it.
+// CreateMultipartUpload starts a multipart upload, whose parts are kept
+// in a directory of their own until the upload is completed.
+func (l *LocalObjectStore) CreateMultipartUpload(key string) (string, error) {
+	if _, err := l.path(key); err != nil {
+		return "", err
+	}
+
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to generate multipart upload ID")
+	}
+	uploadID := hex.EncodeToString(id)
+
+	err = os.MkdirAll(l.multipartDir(uploadID), 0700)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to create directory for multipart upload of %s", key)
+	}
+
+	return uploadID, nil
+}
+
+// UploadPart stores a part of a multipart upload. Its ETag is its
+// checksum.
+func (l *LocalObjectStore) UploadPart(key, uploadID string, number int32, localPath, checksum string) (string, error) {
+	dir, err := l.multipartUpload(uploadID)
+	if err != nil {
+		return "", err
+	}
+
+	partPath := filepath.Join(dir, strconv.Itoa(int(number)))
+	_, err = copyFile(localPath, partPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to store part %d of %s", number, key)
+	}
+
+	sum, err := FileChecksum(partPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to verify part %d of %s", number, key)
+	}
+	if sum != checksum {
+		os.Remove(partPath)
+		return "", errors.Errorf("part %d of %s has checksum %s instead of %s", number, key, sum, checksum)
+	}
+
+	return sum, nil
+}
+
+// CompleteMultipartUpload concatenates the parts into the object and
+// removes them.
+func (l *LocalObjectStore) CompleteMultipartUpload(key, uploadID string, parts []Part) error {
+	dir, err := l.multipartUpload(uploadID)
+	if err != nil {
+		return err
+	}
+
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create directory for %s", key)
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to store %s", key)
+	}
+	defer out.Close()
+
+	for _, part := range parts {
+		partPath := filepath.Join(dir, strconv.Itoa(int(part.Number)))
+		sum, err := FileChecksum(partPath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read part %d of %s", part.Number, key)
+		}
+		if sum != part.ETag {
+			return errors.Errorf("part %d of %s has ETag %s instead of %s", part.Number, key, sum, part.ETag)
+		}
+
+		in, err := os.Open(partPath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read part %d of %s", part.Number, key)
+		}
+		_, err = io.Copy(out, in)
+		in.Close()
+		if err != nil {
+			return errors.Wrapf(err, "failed to store %s", key)
+		}
+	}
+
+	err = out.Close()
+	if err != nil {
+		return errors.Wrapf(err, "failed to store %s", key)
+	}
+
+	return os.RemoveAll(dir)
+}
+
+// AbortMultipartUpload removes the parts of a multipart upload.
+func (l *LocalObjectStore) AbortMultipartUpload(key, uploadID string) error {
+	dir, err := l.multipartUpload(uploadID)
+	if err != nil {
+		return err
+	}
+
+	err = os.RemoveAll(dir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to abort multipart upload of %s", key)
+	}
+
+	return nil
+}
+
+// PresignUpload is not supported by local storage.
+func (l *LocalObjectStore) PresignUpload(key string, size int64, checksum string, expires time.Duration) (*PresignedRequest, error) {
+	return nil, ErrPresignNotSupported
+}
+
+// PresignUploadPart is not supported by local storage.
+func (l *LocalObjectStore) PresignUploadPart(key, uploadID string, number int32, size int64, checksum string, expires time.Duration) (*PresignedRequest, error) {
+	return nil, ErrPresignNotSupported
+}
+
+// Checksum returns the size and checksum of a stored file.
+func (l *LocalObjectStore) Checksum(key string) (int64, string, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return 0, "", err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, "", errors.Wrapf(err, "failed to stat %s", key)
+	}
+	sum, err := FileChecksum(path)
+	if err != nil {
+		return 0, "", errors.Wrapf(err, "failed to read %s", key)
+	}
+
+	return info.Size(), sum, nil
+}
+
+// multipartDir returns the directory holding the parts of a multipart
+// upload.
+func (l *LocalObjectStore) multipartDir(uploadID string) string {
+	return filepath.Join(l.root, ".multipart", uploadID)
+}
+
+// multipartUpload returns the directory of an existing multipart
+// upload.
+func (l *LocalObjectStore) multipartUpload(uploadID string) (string, error) {
+	if _, err := hex.DecodeString(uploadID); err != nil || uploadID == "" {
+		return "", errors.Errorf("invalid multipart upload ID %s", uploadID)
+	}
+
+	dir := l.multipartDir(uploadID)
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return "", errors.Errorf("multipart upload %s does not exist", uploadID)
+	}
+
+	return dir, nil
+}
+
+func (l *LocalObjectStore) path(key string) (string, error) {
+	path := filepath.Join(l.root, filepath.Clean("/"+key))
+	if !strings.HasPrefix(path, l.root+string(filepath.Separator)) {
+		return "", errors.Errorf("invalid object key %s", key)
+	}
+
+	return path, nil
+}
+
+func copyFile(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+
+	nBytes, err := io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return 0, err
+	}
+
+	return nBytes, out.Close()
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package objectstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mattermost/awat/internal/common"
+	"github.com/mattermost/awat/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalObjectStore(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewLocalObjectStore(filepath.Join(root, "bucket"))
+	require.NoError(t, err)
+
+	source := filepath.Join(root, "source.zip")
+	require.NoError(t, os.WriteFile(source, []byte("archive contents"), 0600))
+
+	t.Run("missing object", func(t *testing.T) {
+		exists, err := store.Exists("missing.zip")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("upload, download and delete", func(t *testing.T) {
+		require.NoError(t, store.Upload(source, "nested/archive.zip"))
+
+		exists, err := store.Exists("nested/archive.zip")
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		destination := filepath.Join(root, "destination.zip")
+		nBytes, err := store.Download("nested/archive.zip", destination)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len("archive contents")), nBytes)
+
+		contents, err := os.ReadFile(destination)
+		require.NoError(t, err)
+		assert.Equal(t, "archive contents", string(contents))
+
+		require.NoError(t, store.Delete("nested/archive.zip"))
+		exists, err = store.Exists("nested/archive.zip")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("keys cannot escape the root", func(t *testing.T) {
+		require.NoError(t, store.Upload(source, "../../escaped.zip"))
+		_, err := os.Stat(filepath.Join(root, "escaped.zip"))
+		assert.True(t, os.IsNotExist(err))
+
+		exists, err := store.Exists("escaped.zip")
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("multipart upload", func(t *testing.T) {
+		uploadID, err := store.CreateMultipartUpload("multipart.zip")
+		require.NoError(t, err)
+
+		var parts []Part
+		for i, content := range []string{"first ", "second"} {
+			partPath := filepath.Join(root, "part")
+			require.NoError(t, os.WriteFile(partPath, []byte(content), 0600))
+			sum := sha256.Sum256([]byte(content))
+			part := Part{Number: int32(i + 1), Checksum: hex.EncodeToString(sum[:])}
+
+			_, err = store.UploadPart("multipart.zip", uploadID, part.Number, partPath, hex.EncodeToString(make([]byte, sha256.Size)))
+			require.Error(t, err, "the checksum is verified")
+
+			part.ETag, err = store.UploadPart("multipart.zip", uploadID, part.Number, partPath, part.Checksum)
+			require.NoError(t, err)
+			parts = append(parts, part)
+		}
+
+		require.NoError(t, store.CompleteMultipartUpload("multipart.zip", uploadID, parts))
+
+		destination := filepath.Join(root, "multipart.zip")
+		_, err = store.Download("multipart.zip", destination)
+		require.NoError(t, err)
+		contents, err := os.ReadFile(destination)
+		require.NoError(t, err)
+		assert.Equal(t, "first second", string(contents))
+
+		_, err = store.UploadPart("multipart.zip", uploadID, 3, source, parts[0].Checksum)
+		assert.Error(t, err, "completed uploads take no more parts")
+
+		uploadID, err = store.CreateMultipartUpload("aborted.zip")
+		require.NoError(t, err)
+		require.NoError(t, store.AbortMultipartUpload("aborted.zip", uploadID))
+		assert.Error(t, store.CompleteMultipartUpload("aborted.zip", uploadID, nil))
+	})
+
+	t.Run("checksum", func(t *testing.T) {
+		require.NoError(t, store.Upload(source, "checksum.zip"))
+
+		size, checksum, err := store.Checksum("checksum.zip")
+		require.NoError(t, err)
+		sum := sha256.Sum256([]byte("archive contents"))
+		assert.Equal(t, int64(len("archive contents")), size)
+		assert.Equal(t, hex.EncodeToString(sum[:]), checksum)
+
+		_, err = store.PresignUpload("checksum.zip", size, checksum, time.Hour)
+		assert.ErrorIs(t, err, ErrPresignNotSupported)
+	})
+
+	t.Run("verified download", func(t *testing.T) {
+		require.NoError(t, store.Upload(source, "verified.zip"))
+		sum := sha256.Sum256([]byte("archive contents"))
+		destination := filepath.Join(t.TempDir(), "verified.zip")
+
+		_, err := DownloadVerified(store, "verified.zip", destination, hex.EncodeToString(sum[:]))
+		require.NoError(t, err)
+
+		_, err = DownloadVerified(store, "verified.zip", destination, "")
+		require.NoError(t, err, "downloads without a checksum are not verified")
+
+		_, err = DownloadVerified(store, "verified.zip", destination, hex.EncodeToString(sum[:16]))
+		assert.ErrorContains(t, err, "verified.zip has checksum")
+	})
+
+	t.Run("unsupported storage type", func(t *testing.T) {
+		_, err := New("ftp", root)
+		assert.Error(t, err)
+	})
+}
+
+func TestUploadWithProgress(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewLocalObjectStore(filepath.Join(root, "bucket"))
+	require.NoError(t, err)
+
+	source := filepath.Join(root, "source.zip")
+	require.NoError(t, os.WriteFile(source, []byte("archive contents"), 0600))
+
+	var phases []string
+	var done, total int64
+	ctx := common.WithProgress(context.Background(), func(phase, message string, d, tot int64) {
+		phases = append(phases, phase)
+		done, total = d, tot
+	})
+
+	require.NoError(t, UploadWithProgress(ctx, store, source, "archive.zip"))
+	require.NotEmpty(t, phases)
+	for _, phase := range phases {
+		assert.Equal(t, model.TranslationPhaseUpload, phase)
+	}
+	assert.Equal(t, int64(len("archive contents")), done)
+	assert.Equal(t, int64(len("archive contents")), total)
+
+	contents, err := os.ReadFile(filepath.Join(root, "bucket", "archive.zip"))
+	require.NoError(t, err)
+	assert.Equal(t, "archive contents", string(contents))
+}
+
+func TestDownloadWithProgress(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewLocalObjectStore(filepath.Join(root, "bucket"))
+	require.NoError(t, err)
+
+	source := filepath.Join(root, "source.zip")
+	require.NoError(t, os.WriteFile(source, []byte("archive contents"), 0600))
+	require.NoError(t, store.Upload(source, "archive.zip"))
+
+	var phase string
+	var done, total int64
+	ctx := common.WithProgress(context.Background(), func(p, message string, d, tot int64) {
+		phase, done, total = p, d, tot
+	})
+
+	written, err := DownloadWithProgress(ctx, store, "archive.zip", filepath.Join(root, "downloaded.zip"), "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("archive contents")), written)
+	assert.Equal(t, model.TranslationPhaseDownload, phase)
+	assert.Equal(t, written, done)
+	assert.Equal(t, written, total)
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package objectstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Supported storage backends.
+const (
+	StorageTypeS3    = "s3"
+	StorageTypeLocal = "local"
+)
+
+// ObjectStore abstracts the storage backend where input archives are
+// uploaded to and translated archives are written to, so that every
+// component of the AWAT reads and writes archives the same way
+// regardless of where they are kept.
+type ObjectStore interface {
+	// Bucket returns the name of the bucket, or the root directory for
+	// local storage, that objects are stored in.
+	Bucket() string
+
+	// Exists returns true if an object with the given key exists.
+	Exists(key string) (bool, error)
+
+	// Upload stores the file at localPath under the given key.
+	Upload(localPath, key string) error
+
+	// UploadFrom stores everything read from body under the given key.
+	UploadFrom(body io.Reader, key string) error
+
+	// Download writes the object with the given key to localPath and
+	// returns the number of bytes written.
+	Download(key, localPath string) (int64, error)
+
+	// Delete removes the object with the given key.
+	Delete(key string) error
+
+	// CreateMultipartUpload starts storing the object with the given
+	// key in parts and returns the ID of the multipart upload.
+	CreateMultipartUpload(key string) (string, error)
+
+	// UploadPart stores the file at localPath as the part with the
+	// given number, starting at 1, of a multipart upload and returns
+	// its ETag. The checksum is the hex encoded SHA-256 of the file,
+	// which is verified by the store.
+	UploadPart(key, uploadID string, number int32, localPath, checksum string) (string, error)
+
+	// CompleteMultipartUpload assembles the object from the given
+	// parts, in order.
+	CompleteMultipartUpload(key, uploadID string, parts []Part) error
+
+	// AbortMultipartUpload discards a multipart upload and its parts.
+	AbortMultipartUpload(key, uploadID string) error
+
+	// PresignUpload returns a request which stores an object of the
+	// given size and hex encoded SHA-256 under the given key without
+	// credentials until it expires.
+	PresignUpload(key string, size int64, checksum string, expires time.Duration) (*PresignedRequest, error)
+
+	// PresignUploadPart returns a request which stores a part of a
+	// multipart upload without credentials until it expires.
+	PresignUploadPart(key, uploadID string, number int32, size int64, checksum string, expires time.Duration) (*PresignedRequest, error)
+
+	// Checksum returns the size and hex encoded SHA-256 of the object
+	// with the given key.
+	Checksum(key string) (int64, string, error)
+}
+
+// ErrPresignNotSupported is returned by stores which cannot presign
+// requests.
+var ErrPresignNotSupported = errors.New("presigned requests are not supported by this storage type")
+
+// PresignedRequest is a request which may be sent without credentials,
+// along with the headers which were signed.
+type PresignedRequest struct {
+	Method string
+	URL    string
+	Header http.Header
+}
+
+// Part is a stored part of a multipart upload.
+type Part struct {
+	Number   int32
+	ETag     string
+	Checksum string
+}
+
+// New returns an ObjectStore for the given storage type. For S3 the
+// bucket is the name of the S3 bucket; for local storage it is the
+// directory which objects are stored in.
+func New(storageType, bucket string) (ObjectStore, error) {
+	switch storageType {
+	case StorageTypeS3:
+		return NewS3ObjectStore(bucket)
+	case StorageTypeLocal:
+		return NewLocalObjectStore(bucket)
+	}
+
+	return nil, fmt.Errorf("%s is not a supported storage type", storageType)
+}
+
+// DownloadVerified downloads the object stored under key to the file
+// at path like ObjectStore.Download and, unless checksum is empty,
+// verifies that the file has the hex encoded SHA-256 checksum.
+func DownloadVerified(store ObjectStore, key, path, checksum string) (int64, error) {
+	written, err := store.Download(key, path)
+	if err != nil || checksum == "" {
+		return written, err
+	}
+
+	actual, err := FileChecksum(path)
+	if err != nil {
+		return written, errors.Wrapf(err, "failed to determine checksum of %s", path)
+	}
+	if actual != checksum {
+		return written, errors.Errorf("%s has checksum %s instead of %s", key, actual, checksum)
+	}
+
+	return written, nil
+}
+
+// FileChecksum returns the hex encoded SHA-256 of a file.
+func FileChecksum(path string) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, in)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package objectstore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattermost/awat/internal/common"
+	"github.com/mattermost/awat/model"
+	"github.com/pkg/errors"
+)
+
+// downloadProgressInterval is how often the progress of a download is
+// reported.
+const downloadProgressInterval = time.Second
+
+// DownloadWithProgress downloads the object stored under key to the
+// file at path like DownloadVerified, reporting the number of bytes
+// downloaded to the ProgressFunc of ctx as the download phase of a
+// Translation. The total is only known once the download finished.
+func DownloadWithProgress(ctx context.Context, store ObjectStore, key, path, checksum string) (int64, error) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(downloadProgressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				// Stores write the file as the object is received.
+				info, err := os.Stat(path)
+				if err == nil {
+					common.ReportProgress(ctx, model.TranslationPhaseDownload, fmt.Sprintf("Downloaded %d bytes", info.Size()), info.Size(), 0)
+				}
+			}
+		}
+	}()
+
+	written, err := DownloadVerified(store, key, path, checksum)
+	close(done)
+	<-stopped
+	if err != nil {
+		return written, err
+	}
+
+	common.ReportProgress(ctx, model.TranslationPhaseDownload, fmt.Sprintf("Downloaded %d bytes", written), written, written)
+	return written, nil
+}
+
+// UploadWithProgress stores the file at localPath under the given key
+// like ObjectStore.Upload, reporting the number of bytes uploaded to
+// the ProgressFunc of ctx as the upload phase of a Translation.
+func UploadWithProgress(ctx context.Context, store ObjectStore, localPath, key string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %s before upload", localPath)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "failed to stat %s before upload", localPath)
+	}
+
+	common.ReportProgress(ctx, model.TranslationPhaseUpload, fmt.Sprintf("Uploading %d bytes", info.Size()), 0, info.Size())
+
+	return store.UploadFrom(&progressReader{file: file, ctx: ctx, size: info.Size()}, key)
+}
+
+// progressReader counts the bytes read from a file. It implements
+// io.ReaderAt and io.Seeker like the file, so that stores may still
+// read parts of it concurrently.
+type progressReader struct {
+	file *os.File
+	ctx  context.Context
+	size int64
+	read atomic.Int64
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.file.Read(p)
+	r.report(n)
+	return n, err
+}
+
+func (r *progressReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.file.ReadAt(p, off)
+	r.report(n)
+	return n, err
+}
+
+func (r *progressReader) Seek(offset int64, whence int) (int64, error) {
+	return r.file.Seek(offset, whence)
+}
+
+func (r *progressReader) report(n int) {
+	if n == 0 {
+		return
+	}
+
+	// Stores may read parts more than once, e.g. to checksum them.
+	read := min(r.read.Add(int64(n)), r.size)
+	common.ReportProgress(r.ctx, model.TranslationPhaseUpload, fmt.Sprintf("Uploaded %d of %d bytes", read, r.size), read, r.size)
+}
@@ -0,0 +1,307 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package objectstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3manager "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/mattermost/awat/internal/common"
+	"github.com/pkg/errors"
+)
+
+// S3ObjectStore is an ObjectStore backed by an S3 bucket.
+type S3ObjectStore struct {
+	s3Client *s3.Client
+	bucket   string
+}
+
+// NewS3ObjectStore creates a new S3ObjectStore for the given bucket
+// using the default AWS configuration.
+func NewS3ObjectStore(bucket string) (*S3ObjectStore, error) {
+	awsConfig, err := common.NewAWSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3ObjectStore{
+		s3Client: s3.NewFromConfig(awsConfig),
+		bucket:   bucket,
+	}, nil
+}
+
+// Bucket returns the name of the S3 bucket.
+func (s *S3ObjectStore) Bucket() string {
+	return s.bucket
+}
+
+// Exists checks if an object exists in the S3 bucket.
+func (s *S3ObjectStore) Exists(key string) (bool, error) {
+	_, err := s.s3Client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+
+	if err != nil {
+		var awsErr smithy.APIError
+		if errors.As(err, &awsErr) {
+			switch awsErr.ErrorCode() {
+			case "NoSuchBucket":
+				return false, errors.Errorf("bucket %s does not exist", s.bucket)
+			case "NotFound":
+				return false, nil
+			}
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Upload uploads a local file to the S3 bucket.
+func (s *S3ObjectStore) Upload(localPath, key string) error {
+	body, err := os.Open(localPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %s before upload", localPath)
+	}
+	defer body.Close()
+
+	return s.UploadFrom(body, key)
+}
+
+// UploadFrom uploads everything read from body to the S3 bucket. Bodies
+// which also implement io.ReaderAt and io.Seeker, like files, are
+// uploaded in concurrent parts.
+func (s *S3ObjectStore) UploadFrom(body io.Reader, key string) error {
+	uploader := s3manager.NewUploader(s.s3Client)
+	_, err := uploader.Upload(
+		context.TODO(),
+		&s3.PutObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(key),
+			Body:   body,
+		})
+	if err != nil {
+		return errors.Wrapf(err, "failed to upload %s to bucket %s", key, s.bucket)
+	}
+
+	return nil
+}
+
+// Download downloads an object from the S3 bucket to a local file.
+func (s *S3ObjectStore) Download(key, localPath string) (int64, error) {
+	output, err := os.Create(localPath)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to create %s to download to", localPath)
+	}
+	defer output.Close()
+
+	downloader := s3manager.NewDownloader(s.s3Client)
+	nBytes, err := downloader.Download(
+		context.TODO(),
+		output,
+		&s3.GetObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(key),
+		})
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to download %s from bucket %s", key, s.bucket)
+	}
+
+	return nBytes, nil
+}
+
+// Delete removes an object from the S3 bucket.
+func (s *S3ObjectStore) Delete(key string) error {
+	_, err := s.s3Client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to delete %s from bucket %s", key, s.bucket)
+	}
+
+	return nil
+}
+
+// CreateMultipartUpload starts a multipart upload to the S3 bucket
+// whose parts are verified with their SHA-256.
+func (s *S3ObjectStore) CreateMultipartUpload(key string) (string, error) {
+	output, err := s.s3Client.CreateMultipartUpload(context.TODO(), &s3.CreateMultipartUploadInput{
+		Bucket:            aws.String(s.bucket),
+		Key:               aws.String(key),
+		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to start multipart upload of %s to bucket %s", key, s.bucket)
+	}
+
+	return aws.ToString(output.UploadId), nil
+}
+
+// UploadPart uploads a local file as a part of a multipart upload to
+// the S3 bucket.
+func (s *S3ObjectStore) UploadPart(key, uploadID string, number int32, localPath, checksum string) (string, error) {
+	body, err := os.Open(localPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to open %s before upload", localPath)
+	}
+	defer body.Close()
+
+	info, err := body.Stat()
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to stat %s", localPath)
+	}
+
+	encodedChecksum, err := base64Checksum(checksum)
+	if err != nil {
+		return "", err
+	}
+
+	output, err := s.s3Client.UploadPart(context.TODO(), &s3.UploadPartInput{
+		Bucket:         aws.String(s.bucket),
+		Key:            aws.String(key),
+		UploadId:       aws.String(uploadID),
+		PartNumber:     aws.Int32(number),
+		Body:           body,
+		ContentLength:  aws.Int64(info.Size()),
+		ChecksumSHA256: aws.String(encodedChecksum),
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to upload part %d of %s to bucket %s", number, key, s.bucket)
+	}
+
+	return aws.ToString(output.ETag), nil
+}
+
+// CompleteMultipartUpload completes a multipart upload to the S3
+// bucket.
+func (s *S3ObjectStore) CompleteMultipartUpload(key, uploadID string, parts []Part) error {
+	completedParts := make([]types.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		encodedChecksum, err := base64Checksum(part.Checksum)
+		if err != nil {
+			return err
+		}
+		completedParts = append(completedParts, types.CompletedPart{
+			PartNumber:     aws.Int32(part.Number),
+			ETag:           aws.String(part.ETag),
+			ChecksumSHA256: aws.String(encodedChecksum),
+		})
+	}
+
+	_, err := s.s3Client.CompleteMultipartUpload(context.TODO(), &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completedParts},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to complete multipart upload of %s to bucket %s", key, s.bucket)
+	}
+
+	return nil
+}
+
+// AbortMultipartUpload aborts a multipart upload to the S3 bucket.
+func (s *S3ObjectStore) AbortMultipartUpload(key, uploadID string) error {
+	_, err := s.s3Client.AbortMultipartUpload(context.TODO(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to abort multipart upload of %s to bucket %s", key, s.bucket)
+	}
+
+	return nil
+}
+
+// PresignUpload presigns a PutObject request, which must carry the
+// checksum of the object so that S3 rejects a corrupted upload.
+func (s *S3ObjectStore) PresignUpload(key string, size int64, checksum string, expires time.Duration) (*PresignedRequest, error) {
+	encodedChecksum, err := base64Checksum(checksum)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := s3.NewPresignClient(s.s3Client).PresignPutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:         aws.String(s.bucket),
+		Key:            aws.String(key),
+		ContentLength:  aws.Int64(size),
+		ChecksumSHA256: aws.String(encodedChecksum),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to presign upload of %s to bucket %s", key, s.bucket)
+	}
+
+	return &PresignedRequest{Method: request.Method, URL: request.URL, Header: request.SignedHeader}, nil
+}
+
+// PresignUploadPart presigns an UploadPart request, which must carry
+// the checksum of the part.
+func (s *S3ObjectStore) PresignUploadPart(key, uploadID string, number int32, size int64, checksum string, expires time.Duration) (*PresignedRequest, error) {
+	encodedChecksum, err := base64Checksum(checksum)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := s3.NewPresignClient(s.s3Client).PresignUploadPart(context.TODO(), &s3.UploadPartInput{
+		Bucket:         aws.String(s.bucket),
+		Key:            aws.String(key),
+		UploadId:       aws.String(uploadID),
+		PartNumber:     aws.Int32(number),
+		ContentLength:  aws.Int64(size),
+		ChecksumSHA256: aws.String(encodedChecksum),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to presign upload of part %d of %s to bucket %s", number, key, s.bucket)
+	}
+
+	return &PresignedRequest{Method: request.Method, URL: request.URL, Header: request.SignedHeader}, nil
+}
+
+// Checksum streams an object from the S3 bucket to determine its size
+// and SHA-256, as the checksum S3 keeps of objects uploaded in parts is
+// not that of the object.
+func (s *S3ObjectStore) Checksum(key string) (int64, string, error) {
+	output, err := s.s3Client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, "", errors.Wrapf(err, "failed to get %s from bucket %s", key, s.bucket)
+	}
+	defer output.Body.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, output.Body)
+	if err != nil {
+		return 0, "", errors.Wrapf(err, "failed to read %s from bucket %s", key, s.bucket)
+	}
+
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// base64Checksum converts a hex encoded checksum to the base64
+// encoding S3 expects.
+func base64Checksum(checksum string) (string, error) {
+	sum, err := hex.DecodeString(checksum)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid checksum %s", checksum)
+	}
+
+	return base64.StdEncoding.EncodeToString(sum), nil
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package rocketchat
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/awat/internal/mbif"
+	"github.com/pkg/errors"
+)
+
+// A CSV export follows the layout of the Rocket.Chat CSV importer:
+//
+//	users.csv                   username,email,name
+//	channels.csv                name,creator,public|private,members
+//	<channel>/<any>.csv         username,timestamp,text[,id,thread id,file]
+//	directMessages/<any>.csv    username,recipients,timestamp,text[,id,thread id,file]
+//
+// Channel members and the recipients of direct messages are usernames
+// separated by semicolons, and timestamps are milliseconds since the
+// epoch. The optional columns give messages an ID for other messages to
+// reply to and attach the file at the given path in the archive.
+const (
+	usersFile         = "users.csv"
+	channelsFile      = "channels.csv"
+	directMessagesDir = "directMessages"
+)
+
+// isCSVExport returns true if the archive holds a CSV export.
+func isCSVExport(files map[string]*zip.File) bool {
+	_, ok := files[usersFile]
+	return ok
+}
+
+// readCSV fills the Workspace from a CSV export.
+func (t *transformer) readCSV(files map[string]*zip.File) error {
+	users, err := readRecords(files[usersFile])
+	if err != nil {
+		return err
+	}
+	for i, record := range users {
+		if len(record) < 2 {
+			return errors.Errorf("%s:%d: expected username and email", usersFile, i+1)
+		}
+		user := &mbif.User{ID: record[0], Username: record[0], Email: record[1]}
+		if len(record) > 2 {
+			user.FirstName = record[2]
+		}
+		t.workspace.Users = append(t.workspace.Users, user)
+	}
+
+	channels := make(map[string]string)
+	if file, ok := files[channelsFile]; ok {
+		records, err := readRecords(file)
+		if err != nil {
+			return err
+		}
+		for i, record := range records {
+			if len(record) < 3 {
+				return errors.Errorf("%s:%d: expected name, creator and privacy", channelsFile, i+1)
+			}
+			channel := &mbif.Channel{
+				ID:      "channel:" + record[0],
+				Name:    record[0],
+				Private: strings.EqualFold(record[2], "private"),
+				Members: []string{record[1]},
+			}
+			if len(record) > 3 {
+				channel.Members = append(channel.Members, splitUsernames(record[3])...)
+			}
+			channels[record[0]] = channel.ID
+			t.workspace.Channels = append(t.workspace.Channels, channel)
+		}
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	directChannels := make(map[string]bool)
+	for _, name := range names {
+		dir := path.Dir(name)
+		if dir == "." || !strings.HasSuffix(strings.ToLower(name), ".csv") {
+			continue
+		}
+
+		records, err := readRecords(files[name])
+		if err != nil {
+			return err
+		}
+
+		if dir == directMessagesDir {
+			err = t.readDirectMessages(files, name, records, directChannels)
+		} else {
+			channelID, ok := channels[path.Base(dir)]
+			if !ok {
+				t.logger.Warnf("Skipping %s of unknown channel %s", name, path.Base(dir))
+				continue
+			}
+			err = t.readMessages(files, name, records, channelID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readMessages reads the messages of a channel.
+func (t *transformer) readMessages(files map[string]*zip.File, name string, records [][]string, channelID string) error {
+	for i, record := range records {
+		if len(record) < 3 {
+			return errors.Errorf("%s:%d: expected username, timestamp and text", name, i+1)
+		}
+		err := t.addMessage(files, fmt.Sprintf("%s:%d", name, i+1), channelID, record[0], record[1], record[2], record[3:])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readDirectMessages reads direct messages, creating a conversation for
+// every distinct set of participants.
+func (t *transformer) readDirectMessages(files map[string]*zip.File, name string, records [][]string, directChannels map[string]bool) error {
+	for i, record := range records {
+		if len(record) < 4 {
+			return errors.Errorf("%s:%d: expected username, recipients, timestamp and text", name, i+1)
+		}
+
+		members := append(splitUsernames(record[1]), record[0])
+		sort.Strings(members)
+		members = dedupe(members)
+		channelID := "dm:" + strings.Join(members, ";")
+		if !directChannels[channelID] {
+			directChannels[channelID] = true
+			t.workspace.DirectChannels = append(t.workspace.DirectChannels, &mbif.DirectChannel{
+				ID:      channelID,
+				Members: members,
+			})
+		}
+
+		err := t.addMessage(files, fmt.Sprintf("%s:%d", name, i+1), channelID, record[0], record[2], record[3], record[4:])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addMessage adds a message read from a CSV record, where optional
+// holds the optional ID, thread ID and file columns.
+func (t *transformer) addMessage(files map[string]*zip.File, location, channelID, username, timestamp, text string, optional []string) error {
+	createAt, err := strconv.ParseInt(strings.TrimSpace(timestamp), 10, 64)
+	if err != nil {
+		return errors.Wrapf(err, "%s: invalid timestamp", location)
+	}
+
+	post := &mbif.Post{
+		ID:        location,
+		ChannelID: channelID,
+		UserID:    username,
+		Message:   text,
+		CreateAt:  createAt,
+	}
+	if len(optional) > 0 && optional[0] != "" {
+		post.ID = channelID + "/" + optional[0]
+	}
+	if len(optional) > 1 && optional[1] != "" {
+		post.ThreadID = channelID + "/" + optional[1]
+	}
+	if len(optional) > 2 && optional[2] != "" {
+		file, ok := files[path.Clean(optional[2])]
+		if !ok {
+			t.logger.Warnf("%s: file %s is not part of the export", location, optional[2])
+		} else {
+			name := t.attachmentNames.Unique(attachmentName(file.Name), "attachment")
+			err = t.extractFile(file, name)
+			if err != nil {
+				return err
+			}
+			post.Attachments = append(post.Attachments, name)
+		}
+	}
+
+	t.workspace.Posts = append(t.workspace.Posts, post)
+
+	return nil
+}
+
+// readRecords reads every record of a CSV file, allowing for records
+// with differing numbers of fields.
+func readRecords(file *zip.File) ([][]string, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s", file.Name)
+	}
+	defer reader.Close()
+
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+
+	var records [][]string
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", file.Name)
+		}
+		records = append(records, record)
+	}
+}
+
+func splitUsernames(s string) []string {
+	var usernames []string
+	for _, username := range strings.Split(s, ";") {
+		username = strings.TrimSpace(username)
+		if username != "" {
+			usernames = append(usernames, username)
+		}
+	}
+
+	return usernames
+}
+
+func dedupe(sorted []string) []string {
+	var unique []string
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			unique = append(unique, s)
+		}
+	}
+
+	return unique
+}
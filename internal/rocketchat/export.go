@@ -0,0 +1,214 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package rocketchat
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/binary"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// A Rocket.Chat export is a .zip holding either the output of
+// mongodump for the Rocket.Chat database, or a CSV export in the format
+// of the Rocket.Chat CSV importer. The collections of a mongodump are
+// read from the <collection>.bson files anywhere in the archive.
+
+// Collections of the Rocket.Chat database read from a mongodump.
+const (
+	usersCollection         = "users"
+	roomsCollection         = "rocketchat_room"
+	subscriptionsCollection = "rocketchat_subscription"
+	messagesCollection      = "rocketchat_message"
+	uploadsCollection       = "rocketchat_uploads"
+	uploadFilesCollection   = "rocketchat_uploads.files"
+	uploadChunksCollection  = "rocketchat_uploads.chunks"
+)
+
+// Room types.
+const (
+	publicRoomType  = "c"
+	privateRoomType = "p"
+	directRoomType  = "d"
+)
+
+// maxDocumentSize is the largest BSON document MongoDB stores.
+const maxDocumentSize = 16 * 1024 * 1024
+
+// Email is an email address of a user.
+type Email struct {
+	Address string `bson:"address"`
+}
+
+// User is a Rocket.Chat user.
+type User struct {
+	ID       string   `bson:"_id"`
+	Username string   `bson:"username"`
+	Name     string   `bson:"name"`
+	Emails   []Email  `bson:"emails"`
+	Roles    []string `bson:"roles"`
+	Active   bool     `bson:"active"`
+	Type     string   `bson:"type"`
+}
+
+// IsAdmin returns true if the user has the admin role.
+func (u *User) IsAdmin() bool {
+	for _, role := range u.Roles {
+		if role == "admin" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Room is a Rocket.Chat channel, private group or direct message
+// conversation.
+type Room struct {
+	ID          string   `bson:"_id"`
+	Type        string   `bson:"t"`
+	Name        string   `bson:"name"`
+	FName       string   `bson:"fname"`
+	Topic       string   `bson:"topic"`
+	Description string   `bson:"description"`
+	UserIDs     []string `bson:"uids"`
+	Archived    bool     `bson:"archived"`
+}
+
+// UserRef is the reference to a user embedded in other documents.
+type UserRef struct {
+	ID       string `bson:"_id"`
+	Username string `bson:"username"`
+}
+
+// Subscription is the membership of a user in a room.
+type Subscription struct {
+	RoomID string  `bson:"rid"`
+	User   UserRef `bson:"u"`
+}
+
+// FileRef is the reference to an upload embedded in a message.
+type FileRef struct {
+	ID   string `bson:"_id"`
+	Name string `bson:"name"`
+}
+
+// Reaction holds the usernames of the users who reacted to a message
+// with an emoji.
+type Reaction struct {
+	Usernames []string `bson:"usernames"`
+}
+
+// Message is a message posted to a room.
+type Message struct {
+	ID        string              `bson:"_id"`
+	RoomID    string              `bson:"rid"`
+	Msg       string              `bson:"msg"`
+	Type      string              `bson:"t"`
+	Timestamp time.Time           `bson:"ts"`
+	EditedAt  time.Time           `bson:"editedAt"`
+	User      UserRef             `bson:"u"`
+	ThreadID  string              `bson:"tmid"`
+	Pinned    bool                `bson:"pinned"`
+	Reactions map[string]Reaction `bson:"reactions"`
+	File      *FileRef            `bson:"file"`
+	Files     []FileRef           `bson:"files"`
+}
+
+// IsUserMessage returns true if the message was written by a user, as
+// opposed to being a system message about an event in the room.
+func (m *Message) IsUserMessage() bool {
+	return m.Type == ""
+}
+
+// Upload is a file uploaded to a room.
+type Upload struct {
+	ID     string `bson:"_id"`
+	Name   string `bson:"name"`
+	RoomID string `bson:"rid"`
+}
+
+// GridFSFile describes a file stored in GridFS.
+type GridFSFile struct {
+	ID        string `bson:"_id"`
+	Length    int64  `bson:"length"`
+	ChunkSize int64  `bson:"chunkSize"`
+}
+
+// GridFSChunk is a chunk of a file stored in GridFS.
+type GridFSChunk struct {
+	FileID string `bson:"files_id"`
+	N      int64  `bson:"n"`
+	Data   []byte `bson:"data"`
+}
+
+// findCollections returns the mongodump files of the archive, keyed by
+// collection name.
+func findCollections(archive *zip.Reader) map[string]*zip.File {
+	collections := make(map[string]*zip.File)
+	for _, file := range archive.File {
+		name := path.Base(file.Name)
+		if file.FileInfo().IsDir() || !strings.HasSuffix(name, ".bson") {
+			continue
+		}
+		collections[strings.TrimSuffix(name, ".bson")] = file
+	}
+
+	return collections
+}
+
+// readCollection decodes every document of a mongodump file in turn and
+// passes it to handle. Collections missing from the dump are treated as
+// empty.
+func readCollection[T any](collections map[string]*zip.File, collection string, handle func(*T) error) error {
+	file, ok := collections[collection]
+	if !ok {
+		return nil
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %s", file.Name)
+	}
+	defer reader.Close()
+
+	buffered := bufio.NewReader(reader)
+	for {
+		var length int32
+		err = binary.Read(buffered, binary.LittleEndian, &length)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", file.Name)
+		}
+		if length < 5 || length > maxDocumentSize {
+			return errors.Errorf("%s holds a document of invalid length %d", file.Name, length)
+		}
+
+		document := make([]byte, length)
+		binary.LittleEndian.PutUint32(document, uint32(length))
+		_, err = io.ReadFull(buffered, document[4:])
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", file.Name)
+		}
+
+		var value T
+		err = bson.Unmarshal(document, &value)
+		if err != nil {
+			return errors.Wrapf(err, "failed to decode document in %s", file.Name)
+		}
+		err = handle(&value)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package rocketchat
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattermost/awat/internal/mbif"
+	"github.com/pkg/errors"
+)
+
+// uploadsDir is the directory of the archive in which the files of a
+// FileSystem upload store may be included, named after their upload ID.
+const uploadsDir = "uploads"
+
+// readMongodump fills the Workspace from the collections of a
+// mongodump of the Rocket.Chat database.
+func (t *transformer) readMongodump(archive *zip.Reader, collections map[string]*zip.File) error {
+	usersByName := make(map[string]string)
+	err := readCollection(collections, usersCollection, func(user *User) error {
+		if user.Type == "bot" || user.Type == "app" || user.Username == "" {
+			return nil
+		}
+		wsUser := &mbif.User{
+			ID:        user.ID,
+			Username:  user.Username,
+			FirstName: user.Name,
+			TeamAdmin: user.IsAdmin(),
+		}
+		if len(user.Emails) > 0 {
+			wsUser.Email = user.Emails[0].Address
+		}
+		if !user.Active {
+			wsUser.DeleteAt = t.now
+		}
+		t.workspace.Users = append(t.workspace.Users, wsUser)
+		usersByName[user.Username] = user.ID
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to read users")
+	}
+
+	channels := make(map[string]*mbif.Channel)
+	directChannels := make(map[string]*mbif.DirectChannel)
+	err = readCollection(collections, roomsCollection, func(room *Room) error {
+		switch room.Type {
+		case publicRoomType, privateRoomType:
+			channel := &mbif.Channel{
+				ID:          room.ID,
+				Name:        room.Name,
+				DisplayName: room.FName,
+				Header:      room.Topic,
+				Purpose:     room.Description,
+				Private:     room.Type == privateRoomType,
+			}
+			if room.Archived {
+				channel.DeleteAt = t.now
+			}
+			channels[room.ID] = channel
+			t.workspace.Channels = append(t.workspace.Channels, channel)
+		case directRoomType:
+			directChannel := &mbif.DirectChannel{ID: room.ID, Members: room.UserIDs}
+			directChannels[room.ID] = directChannel
+			t.workspace.DirectChannels = append(t.workspace.DirectChannels, directChannel)
+		default:
+			t.logger.Debugf("Skipping room %s of type %s", room.ID, room.Type)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to read rooms")
+	}
+
+	subscribers := make(map[string][]string)
+	err = readCollection(collections, subscriptionsCollection, func(subscription *Subscription) error {
+		if channel, ok := channels[subscription.RoomID]; ok {
+			channel.Members = append(channel.Members, subscription.User.ID)
+		}
+		if directChannel, ok := directChannels[subscription.RoomID]; ok && len(directChannel.Members) == 0 {
+			// Direct conversations written by older Rocket.Chat versions
+			// only list their members as subscriptions.
+			subscribers[subscription.RoomID] = append(subscribers[subscription.RoomID], subscription.User.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to read subscriptions")
+	}
+	for roomID, members := range subscribers {
+		directChannels[roomID].Members = members
+	}
+
+	fileNames := make(map[string]string)
+	var fileIDs []string
+	postFiles := make(map[*mbif.Post][]string)
+	err = readCollection(collections, messagesCollection, func(message *Message) error {
+		if !message.IsUserMessage() {
+			return nil
+		}
+		post := &mbif.Post{
+			ID:        message.ID,
+			ChannelID: message.RoomID,
+			UserID:    message.User.ID,
+			Message:   message.Msg,
+			CreateAt:  message.Timestamp.UnixMilli(),
+			Pinned:    message.Pinned,
+			ThreadID:  message.ThreadID,
+		}
+		if !message.EditedAt.IsZero() {
+			post.EditAt = message.EditedAt.UnixMilli()
+		}
+		for emoji, reaction := range message.Reactions {
+			for _, username := range reaction.Usernames {
+				post.Reactions = append(post.Reactions, mbif.Reaction{
+					UserID: usersByName[username],
+					Emoji:  strings.Trim(emoji, ":"),
+				})
+			}
+		}
+
+		files := message.Files
+		if len(files) == 0 && message.File != nil {
+			files = []FileRef{*message.File}
+		}
+		for _, file := range files {
+			if _, ok := fileNames[file.ID]; !ok {
+				fileNames[file.ID] = file.Name
+				fileIDs = append(fileIDs, file.ID)
+			}
+			postFiles[post] = append(postFiles[post], file.ID)
+		}
+
+		t.workspace.Posts = append(t.workspace.Posts, post)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to read messages")
+	}
+
+	err = readCollection(collections, uploadsCollection, func(upload *Upload) error {
+		if _, ok := fileNames[upload.ID]; ok && upload.Name != "" {
+			fileNames[upload.ID] = upload.Name
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to read uploads")
+	}
+
+	for _, fileID := range fileIDs {
+		t.attachments[fileID] = t.attachmentNames.Unique(attachmentName(fileNames[fileID]), "attachment")
+	}
+
+	err = t.extractUploads(archive)
+	if err != nil {
+		return err
+	}
+	err = t.extractGridFS(collections)
+	if err != nil {
+		return err
+	}
+
+	for post, fileIDs := range postFiles {
+		for _, fileID := range fileIDs {
+			if !t.extracted[fileID] {
+				t.logger.Warnf("File %s of message %s is not part of the export", fileID, post.ID)
+				continue
+			}
+			post.Attachments = append(post.Attachments, t.attachments[fileID])
+		}
+	}
+
+	return nil
+}
+
+// extractUploads extracts the files of a FileSystem upload store
+// included in the uploads directory of the archive.
+func (t *transformer) extractUploads(archive *zip.Reader) error {
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() || path.Base(path.Dir(file.Name)) != uploadsDir {
+			continue
+		}
+		fileID := path.Base(file.Name)
+		name, ok := t.attachments[fileID]
+		if !ok {
+			continue
+		}
+
+		err := t.extractFile(file, name)
+		if err != nil {
+			return err
+		}
+		t.extracted[fileID] = true
+	}
+
+	return nil
+}
+
+// extractGridFS writes the files of a GridFS upload store, which the
+// dump holds in chunks, to the attachment directory.
+func (t *transformer) extractGridFS(collections map[string]*zip.File) error {
+	chunkSizes := make(map[string]int64)
+	err := readCollection(collections, uploadFilesCollection, func(file *GridFSFile) error {
+		if _, ok := t.attachments[file.ID]; ok && !t.extracted[file.ID] {
+			chunkSizes[file.ID] = file.ChunkSize
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to read GridFS files")
+	}
+
+	err = readCollection(collections, uploadChunksCollection, func(chunk *GridFSChunk) error {
+		chunkSize, ok := chunkSizes[chunk.FileID]
+		if !ok {
+			return nil
+		}
+
+		localPath := filepath.Join(t.attachmentDir, t.attachments[chunk.FileID])
+		output, err := os.OpenFile(localPath, os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return errors.Wrapf(err, "failed to open attachment %s", localPath)
+		}
+		_, err = output.WriteAt(chunk.Data, chunk.N*chunkSize)
+		if err != nil {
+			output.Close()
+			return errors.Wrapf(err, "failed to write attachment %s", localPath)
+		}
+		t.extracted[chunk.FileID] = true
+
+		return output.Close()
+	})
+
+	return errors.Wrap(err, "failed to read GridFS chunks")
+}
+
+// extractFile copies a file of the archive to the attachment directory.
+func (t *transformer) extractFile(file *zip.File, name string) error {
+	reader, err := file.Open()
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %s", file.Name)
+	}
+	defer reader.Close()
+
+	output, err := os.Create(filepath.Join(t.attachmentDir, name))
+	if err != nil {
+		return errors.Wrapf(err, "failed to create attachment %s", name)
+	}
+	defer output.Close()
+
+	_, err = io.Copy(output, reader)
+	if err != nil {
+		return errors.Wrapf(err, "failed to extract %s", file.Name)
+	}
+
+	return output.Close()
+}
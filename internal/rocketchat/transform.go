@@ -0,0 +1,108 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package rocketchat
+
+import (
+	"archive/zip"
+	"path"
+
+	"github.com/mattermost/awat/internal/mbif"
+	"github.com/mattermost/awat/model"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// emailSource is used to build placeholder email addresses for users
+// whose address is not part of the export.
+const emailSource = "rocketchat"
+
+// transformer holds the state of a single Rocket.Chat to MBIF
+// transformation.
+type transformer struct {
+	logger        log.FieldLogger
+	attachmentDir string
+	workspace     *mbif.Workspace
+
+	// now is used as the deletion time of deactivated users and
+	// archived channels, which the export holds no time for.
+	now int64
+
+	attachmentNames mbif.Names
+
+	// attachments maps the IDs of uploads to the names they are
+	// extracted to, and extracted records the uploads whose content was
+	// found in the export.
+	attachments map[string]string
+	extracted   map[string]bool
+}
+
+// TransformRocketChat reads the Rocket.Chat mongodump or CSV export in
+// the archive at inputArchive and writes its contents as MBIF to
+// mbifPath, extracting uploaded files to attachmentDir. Everything is
+// imported into the team of the Translation.
+func TransformRocketChat(translation *model.Translation, inputArchive, mbifPath, attachmentDir string, logger log.FieldLogger) error {
+	archive, err := zip.OpenReader(inputArchive)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open Rocket.Chat export %s", inputArchive)
+	}
+	defer archive.Close()
+
+	t := &transformer{
+		logger:        logger,
+		attachmentDir: attachmentDir,
+		workspace: &mbif.Workspace{
+			TeamName:    translation.Team,
+			EmailSource: emailSource,
+		},
+		now:             model.GetMillis(),
+		attachmentNames: make(mbif.Names),
+		attachments:     make(map[string]string),
+		extracted:       make(map[string]bool),
+	}
+
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	collections := findCollections(&archive.Reader)
+	switch {
+	case isCSVExport(files):
+		err = t.readCSV(files)
+	case collections[usersCollection] != nil && collections[messagesCollection] != nil:
+		err = t.readMongodump(&archive.Reader, collections)
+	default:
+		return errors.New("archive holds neither a mongodump nor a CSV export of Rocket.Chat")
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read Rocket.Chat export")
+	}
+
+	writer, err := mbif.NewWriter(mbifPath)
+	if err != nil {
+		return err
+	}
+
+	err = t.workspace.Write(writer)
+	if err != nil {
+		writer.Close()
+		return err
+	}
+
+	logger.Infof("Wrote %d lines of MBIF for %d users", writer.Lines(), len(t.workspace.Users))
+
+	return writer.Close()
+}
+
+// attachmentName returns the base name of a file, or an empty string if
+// it has none.
+func attachmentName(name string) string {
+	name = path.Base(name)
+	if name == "." || name == "/" {
+		return ""
+	}
+
+	return name
+}
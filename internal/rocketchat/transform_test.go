@@ -0,0 +1,174 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package rocketchat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mattermost/awat/internal/mbif"
+	"github.com/mattermost/awat/internal/testlib"
+	"github.com/mattermost/awat/internal/validators"
+	"github.com/mattermost/awat/model"
+	"github.com/mattermost/mattermost/server/v8/channels/app/imports"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var testTime = time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+
+// testDump is a small mongodump of a Rocket.Chat database with a
+// public channel holding a thread, a reaction and a file stored in
+// GridFS, a direct message and a deactivated user.
+var testDump = map[string][]any{
+	"users": {
+		bson.M{"_id": "u1", "username": "alice", "name": "Alice Smith", "emails": bson.A{bson.M{"address": "alice@example.com"}}, "roles": bson.A{"user", "admin"}, "active": true, "type": "user"},
+		bson.M{"_id": "u2", "username": "bob", "name": "Bob", "active": true, "type": "user"},
+		bson.M{"_id": "u3", "username": "carol", "name": "Carol", "emails": bson.A{bson.M{"address": "carol@example.com"}}, "active": false, "type": "user"},
+		bson.M{"_id": "rocket.cat", "username": "rocket.cat", "type": "bot"},
+	},
+	"rocketchat_room": {
+		bson.M{"_id": "GENERAL", "t": "c", "name": "general", "topic": "Company wide"},
+		bson.M{"_id": "r1", "t": "p", "name": "secret-plans", "fname": "Secret Plans"},
+		bson.M{"_id": "u1u2", "t": "d", "uids": bson.A{"u1", "u2"}},
+	},
+	"rocketchat_subscription": {
+		bson.M{"rid": "GENERAL", "u": bson.M{"_id": "u1", "username": "alice"}},
+		bson.M{"rid": "GENERAL", "u": bson.M{"_id": "u2", "username": "bob"}},
+		bson.M{"rid": "r1", "u": bson.M{"_id": "u3", "username": "carol"}},
+	},
+	"rocketchat_message": {
+		bson.M{"_id": "m1", "rid": "GENERAL", "msg": "Hello everyone", "ts": testTime, "u": bson.M{"_id": "u1", "username": "alice"},
+			"pinned": true, "reactions": bson.M{":thumbsup:": bson.M{"usernames": bson.A{"bob"}}}},
+		bson.M{"_id": "m2", "rid": "GENERAL", "msg": "Hi Alice", "ts": testTime.Add(time.Minute), "u": bson.M{"_id": "u2", "username": "bob"},
+			"tmid": "m1", "editedAt": testTime.Add(2 * time.Minute)},
+		bson.M{"_id": "m3", "rid": "GENERAL", "t": "uj", "msg": "carol", "ts": testTime, "u": bson.M{"_id": "u3", "username": "carol"}},
+		bson.M{"_id": "m4", "rid": "GENERAL", "msg": "", "ts": testTime.Add(time.Hour), "u": bson.M{"_id": "u1", "username": "alice"},
+			"file": bson.M{"_id": "f1", "name": "report.txt"}, "files": bson.A{bson.M{"_id": "f1", "name": "report.txt"}}},
+		bson.M{"_id": "m5", "rid": "u1u2", "msg": "Psst", "ts": testTime, "u": bson.M{"_id": "u2", "username": "bob"}},
+	},
+	"rocketchat_uploads": {
+		bson.M{"_id": "f1", "name": "report.txt", "rid": "GENERAL"},
+	},
+	"rocketchat_uploads.files": {
+		bson.M{"_id": "f1", "length": int64(11), "chunkSize": int64(6)},
+	},
+	"rocketchat_uploads.chunks": {
+		bson.M{"files_id": "f1", "n": int64(1), "data": []byte("world")},
+		bson.M{"files_id": "f1", "n": int64(0), "data": []byte("hello ")},
+	},
+}
+
+// testCSV is a small CSV export with a thread, a file, a direct
+// message and a group message.
+var testCSV = map[string]string{
+	"users.csv":    "alice,alice@example.com,Alice\nbob,bob@example.com,Bob\ncarol,carol@example.com,Carol\n",
+	"channels.csv": "general,alice,public,bob;carol\nprivate-stuff,bob,private,alice\n",
+	"general/messages.csv": "alice,1682935200000,Hello,1,,\n" +
+		"bob,1682935260000,A reply,2,1,\n" +
+		"carol,1682935320000,See attached,3,,files/notes.txt\n",
+	"files/notes.txt": "notes",
+	"directMessages/messages.csv": "alice,bob,1682935200000,Hi Bob\n" +
+		"bob,alice,1682935260000,Hi Alice\n" +
+		"carol,alice;bob,1682935320000,Hi both\n",
+}
+
+func transform(t *testing.T, files map[string][]byte) (map[string][]imports.LineImportData, string) {
+	logger := testlib.MakeLogger(t)
+	workdir := t.TempDir()
+	inputArchive := testlib.WriteZip(t, filepath.Join(workdir, "rocketchat-export.zip"), files)
+	attachmentDir := filepath.Join(workdir, "attachments")
+	require.NoError(t, os.MkdirAll(attachmentDir, 0700))
+	mbifPath := filepath.Join(workdir, "MBIF.jsonl")
+
+	translation := &model.Translation{ID: model.NewID(), Type: model.RocketChatWorkspaceBackupType, Team: "myteam"}
+	err := TransformRocketChat(translation, inputArchive, mbifPath, attachmentDir, logger)
+	require.NoError(t, err)
+
+	outputPath := filepath.Join(workdir, "output.zip")
+	_, _, err = mbif.CreateArchive(outputPath, mbifPath, attachmentDir)
+	require.NoError(t, err)
+	report, err := validators.NewMattermostValidator().Validate(outputPath)
+	require.NoError(t, err)
+	assert.Empty(t, report.Errors)
+
+	return testlib.ReadMBIFLinesByType(t, mbifPath), attachmentDir
+}
+
+func TestTransformMongodump(t *testing.T) {
+	files := make(map[string][]byte)
+	for collection, documents := range testDump {
+		var content []byte
+		for _, document := range documents {
+			raw, err := bson.Marshal(document)
+			require.NoError(t, err)
+			content = append(content, raw...)
+		}
+		files["dump/rocketchat/"+collection+".bson"] = content
+	}
+
+	lines, attachmentDir := transform(t, files)
+
+	require.Len(t, lines["channel"], 2)
+	assert.Equal(t, "general", *lines["channel"][0].Channel.Name)
+	assert.Equal(t, "Company wide", *lines["channel"][0].Channel.Header)
+	assert.Equal(t, "Secret Plans", *lines["channel"][1].Channel.DisplayName)
+
+	require.Len(t, lines["user"], 3)
+	alice := lines["user"][0].User
+	assert.Equal(t, "alice", *alice.Username)
+	assert.Equal(t, "team_user team_admin", *(*alice.Teams)[0].Roles)
+	assert.Equal(t, "bob@rocketchat.invalid", *lines["user"][1].User.Email)
+	assert.NotNil(t, lines["user"][2].User.DeleteAt)
+
+	posts := lines["post"]
+	require.Len(t, posts, 2)
+	first := posts[0].Post
+	assert.Equal(t, "Hello everyone", *first.Message)
+	assert.True(t, *first.IsPinned)
+	require.NotNil(t, first.Reactions)
+	assert.Equal(t, "thumbsup", *(*first.Reactions)[0].EmojiName)
+	require.NotNil(t, first.Replies)
+	assert.Equal(t, "Hi Alice", *(*first.Replies)[0].Message)
+	assert.NotNil(t, (*first.Replies)[0].EditAt)
+
+	require.NotNil(t, posts[1].Post.Attachments)
+	assert.Equal(t, "attachments/report.txt", *(*posts[1].Post.Attachments)[0].Path)
+	content, err := os.ReadFile(filepath.Join(attachmentDir, "report.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(content))
+
+	require.Len(t, lines["direct_channel"], 1)
+	require.Len(t, lines["direct_post"], 1)
+	assert.Equal(t, "Psst", *lines["direct_post"][0].DirectPost.Message)
+}
+
+func TestTransformCSV(t *testing.T) {
+	files := make(map[string][]byte)
+	for name, content := range testCSV {
+		files[name] = []byte(content)
+	}
+
+	lines, _ := transform(t, files)
+
+	require.Len(t, lines["channel"], 2)
+	assert.Equal(t, "O", string(*lines["channel"][0].Channel.Type))
+	assert.Equal(t, "P", string(*lines["channel"][1].Channel.Type))
+	require.Len(t, lines["user"], 3)
+
+	posts := lines["post"]
+	require.Len(t, posts, 2)
+	require.NotNil(t, posts[0].Post.Replies)
+	assert.Equal(t, "A reply", *(*posts[0].Post.Replies)[0].Message)
+	require.NotNil(t, posts[1].Post.Attachments)
+	assert.Equal(t, "attachments/notes.txt", *(*posts[1].Post.Attachments)[0].Path)
+
+	require.Len(t, lines["direct_channel"], 2)
+	require.Len(t, lines["direct_post"], 3)
+	assert.Len(t, *lines["direct_post"][2].DirectPost.ChannelMembers, 3)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package rocketchat
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/mattermost/awat/internal/mbif"
+	"github.com/mattermost/awat/internal/objectstore"
+	"github.com/mattermost/awat/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// RocketChatTranslator is responsible for translating Rocket.Chat
+// exports into a format compatible with Mattermost.
+type RocketChatTranslator struct {
+	objectStore        objectstore.ObjectStore
+	workingDir         string
+	outputZipLocalPath string
+	outputChecksum     string
+}
+
+// NewRocketChatTranslator creates a new Translator instance for
+// translating Rocket.Chat exports.
+func NewRocketChatTranslator(objectStore objectstore.ObjectStore, workingDir string) *RocketChatTranslator {
+	return &RocketChatTranslator{
+		objectStore: objectStore,
+		workingDir:  workingDir,
+	}
+}
+
+// Translate satisfies the Translator interface for the
+// RocketChatTranslator. It converts the Rocket.Chat export referenced
+// by the Translation into a Mattermost archive and uploads it to the
+// object store. On success it returns the file name of the output zip
+// file without a path.
+func (rt *RocketChatTranslator) Translate(ctx context.Context, translation *model.Translation) (string, error) {
+	logger := log.New().WithField("translation", translation.ID)
+
+	outputPath, checksum, err := mbif.Translate(ctx, rt.objectStore, rt.workingDir, "input.zip", translation, TransformRocketChat, logger)
+	if err != nil {
+		return "", err
+	}
+	rt.outputZipLocalPath = outputPath
+	rt.outputChecksum = checksum
+
+	logger.Info("Finished translation")
+
+	return filepath.Base(outputPath), nil
+}
+
+// GetOutputArchiveLocalPath returns the local file path of the translated archive.
+func (rt *RocketChatTranslator) GetOutputArchiveLocalPath() (string, error) {
+	return rt.outputZipLocalPath, nil
+}
+
+// GetOutputArchiveChecksum returns the checksum of the translated archive.
+func (rt *RocketChatTranslator) GetOutputArchiveChecksum() (string, error) {
+	return rt.outputChecksum, nil
+}
+
+// Cleanup performs necessary cleanup operations after the translation process.
+func (rt *RocketChatTranslator) Cleanup() error {
+	if rt.outputZipLocalPath == "" {
+		return nil
+	}
+
+	return os.Remove(rt.outputZipLocalPath)
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package slack
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattermost/awat/internal/mbif"
+	"github.com/mattermost/awat/model"
+	"github.com/pkg/errors"
+)
+
+// AttachmentStore stores the attached files of a Slack export in a
+// directory by their contents: each file is stored as <hash>/<name>,
+// where hash is the hex encoded SHA-256 of its contents, so that a file
+// attached under several IDs is stored only once. It is not safe for
+// concurrent use.
+type AttachmentStore struct {
+	dir    string
+	paths  map[string]string
+	hashes map[string]string
+	report model.AttachmentReport
+}
+
+// NewAttachmentStore creates the directory dir, if needed, and returns
+// an AttachmentStore storing attached files in it.
+func NewAttachmentStore(dir string) (*AttachmentStore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create attachments directory %s", dir)
+	}
+
+	return &AttachmentStore{
+		dir:    dir,
+		paths:  map[string]string{},
+		hashes: map[string]string{},
+	}, nil
+}
+
+// Path returns the path the attached file with the given ID is to be
+// referenced by from an import line, or an empty string if the file is
+// not stored.
+func (s *AttachmentStore) Path(id string) string {
+	stored, ok := s.paths[id]
+	if !ok {
+		return ""
+	}
+
+	return mbif.AttachmentPath(filepath.ToSlash(stored))
+}
+
+// Report returns how many of the attached files and bytes were stored
+// and how many bytes were saved by storing identical files only once.
+func (s *AttachmentStore) Report() model.AttachmentReport {
+	return s.report
+}
+
+// has returns true if the attached file with the given ID is stored.
+func (s *AttachmentStore) has(id string) bool {
+	_, ok := s.paths[id]
+	return ok
+}
+
+// createTemp creates an empty file in the directory for an attached
+// file to be written to before it is added, and returns its path.
+// Unlike adding files, it may be called concurrently.
+func (s *AttachmentStore) createTemp() (string, error) {
+	temp, err := os.CreateTemp(s.dir, "attachment-")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create temporary file for attached file")
+	}
+
+	return temp.Name(), temp.Close()
+}
+
+// add stores the attached file with the given ID and name written to
+// the file at path, which is moved into place or removed if the file
+// is stored already.
+func (s *AttachmentStore) add(id, name, path string) error {
+	if s.has(id) {
+		return os.Remove(path)
+	}
+
+	size, hash, err := hashFile(path)
+	if err != nil {
+		return err
+	}
+
+	s.report.AttachedFiles++
+	if stored, ok := s.hashes[hash]; ok {
+		s.paths[id] = stored
+		s.report.BytesSaved += size
+		return os.Remove(path)
+	}
+
+	stored := filepath.Join(hash, attachmentName(id, name))
+	err = os.Mkdir(filepath.Join(s.dir, hash), 0700)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create directory of attached file %s", id)
+	}
+	err = os.Rename(path, filepath.Join(s.dir, stored))
+	if err != nil {
+		return errors.Wrapf(err, "failed to store attached file %s", id)
+	}
+
+	s.paths[id] = stored
+	s.hashes[hash] = stored
+	s.report.UniqueAttachments++
+	s.report.AttachmentBytes += size
+
+	return nil
+}
+
+// hashFile returns the size of the file at path and the hex encoded
+// SHA-256 of its contents.
+func hashFile(path string) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", errors.Wrapf(err, "failed to open %s", path)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, "", errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// attachmentName returns the base of the name of an attached file, so
+// that names cannot escape the directory they are stored in, or that of
+// the ID of the file if it has no name.
+func attachmentName(id, name string) string {
+	for _, candidate := range []string{name, id} {
+		base := filepath.Base(strings.ReplaceAll(candidate, "\\", "/"))
+		if base != "." && base != "/" && base != ".." {
+			return base
+		}
+	}
+
+	return "attachment"
+}
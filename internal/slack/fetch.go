@@ -0,0 +1,314 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package slack
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/awat/internal/common"
+	"github.com/pkg/errors"
+)
+
+// maxFetchRetryDelay caps the delay between two attempts of fetching
+// an attached file.
+const maxFetchRetryDelay = time.Minute
+
+// FetchOptions controls how the files attached to the posts of a
+// Slack export are fetched.
+type FetchOptions struct {
+	// Workers is the number of files fetched concurrently.
+	Workers int
+
+	// Timeout is how long a single attempt of fetching a file may
+	// take.
+	Timeout time.Duration
+
+	// Retries is how often fetching a file which failed for a
+	// transient reason, like a timeout, a server error or a rate
+	// limit, is retried before the file is given up.
+	Retries int
+
+	// RetryDelay is the delay before the first retry; it doubles with
+	// every further retry. Rate limited requests wait as long as
+	// Slack asks for instead.
+	RetryDelay time.Duration
+
+	// Token is the Slack token sent with every request to Slack over
+	// HTTPS, which is needed for the files of most workspaces.
+	Token string
+
+	// HTTPClient is the client to fetch the files with, or
+	// http.DefaultClient if it is nil.
+	HTTPClient *http.Client
+}
+
+// DefaultFetchOptions are the FetchOptions used unless configured
+// otherwise.
+var DefaultFetchOptions = FetchOptions{
+	Workers:    8,
+	Timeout:    5 * time.Minute,
+	Retries:    5,
+	RetryDelay: time.Second,
+}
+
+// FailedAttachment is an attached file which could not be fetched,
+// listed in the failure manifest of a Translation.
+type FailedAttachment struct {
+	ID       string
+	Name     string
+	URL      string `json:",omitempty"`
+	Post     string
+	Attempts int
+	Error    string
+}
+
+// rateLimitedError is the error of a request Slack rejected because of
+// its rate limits, which may be retried after the given delay.
+type rateLimitedError struct {
+	retryAfter time.Duration
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("rate limited by Slack for %s", e.retryAfter)
+}
+
+// attachmentFetcher fetches attached files into temporary files of an
+// AttachmentStore, which are added to it by the receiver of the
+// results. When
+// Slack rate limits one request, every worker holds off until the
+// limit is lifted.
+type attachmentFetcher struct {
+	client      *http.Client
+	options     FetchOptions
+	attachments *AttachmentStore
+
+	mu          sync.Mutex
+	pausedUntil time.Time
+}
+
+func newAttachmentFetcher(options FetchOptions, attachments *AttachmentStore) *attachmentFetcher {
+	client := options.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &attachmentFetcher{
+		client:      client,
+		options:     options,
+		attachments: attachments,
+	}
+}
+
+// fetchResult is the outcome of fetching an attached file. On success
+// the file was written to path.
+type fetchResult struct {
+	attachment attachedFile
+	path       string
+	attempts   int
+	err        error
+}
+
+// fetchAll fetches the attachments on options.Workers goroutines and
+// sends the result of every attachment to results, which is closed
+// once all were fetched or ctx is done.
+func (f *attachmentFetcher) fetchAll(ctx context.Context, attachments []attachedFile, results chan<- fetchResult) {
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for i := range attachments {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	workers := max(f.options.Workers, 1)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				results <- f.fetch(ctx, attachments[job])
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(results)
+}
+
+// fetch fetches an attached file to a temporary file, retrying
+// transient failures. Nothing is left behind of a file which could not
+// be fetched.
+func (f *attachmentFetcher) fetch(ctx context.Context, attachment attachedFile) fetchResult {
+	result := fetchResult{attachment: attachment}
+
+	// Check there's an Id, Name and either UrlPrivateDownload or UrlPrivate property.
+	file := attachment.file
+	if len(file.ID) < 1 || len(file.Name) < 1 || !(len(file.URLPrivate) > 0 || len(file.URLPrivateDownload) > 0) {
+		result.err = errors.Errorf("file_share post has missing properties on it's File object: %s", attachment.post.Ts)
+		return result
+	}
+
+	result.path, result.err = f.attachments.createTemp()
+	if result.err != nil {
+		return result
+	}
+	defer func() {
+		if result.err != nil {
+			os.Remove(result.path)
+		}
+	}()
+
+	for {
+		err := f.waitForRateLimit(ctx)
+		if err != nil {
+			result.err = err
+			return result
+		}
+
+		result.attempts++
+		result.err = f.fetchOnce(ctx, file, result.path)
+		if result.err == nil || ctx.Err() != nil || common.IsPermanent(result.err) || result.attempts > f.options.Retries {
+			return result
+		}
+
+		delay := f.delayBeforeRetry(result.attempts)
+		var rateLimited *rateLimitedError
+		if errors.As(result.err, &rateLimited) {
+			f.pause(rateLimited.retryAfter)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return result
+		case <-time.After(delay):
+		}
+	}
+}
+
+// fetchOnce makes one attempt of fetching the file to path. Errors
+// which retrying will not fix are marked as permanent.
+func (f *attachmentFetcher) fetchOnce(ctx context.Context, file *SlackFile, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, f.options.Timeout)
+	defer cancel()
+
+	url := file.downloadURL()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return common.Permanent(errors.Wrapf(err, "failed to create request for the file: %s", url))
+	}
+	if f.options.Token != "" && isSlackURL(request.URL) {
+		request.Header.Set("Authorization", "Bearer "+f.options.Token)
+	}
+	response, err := f.client.Do(request)
+	if err != nil {
+		return errors.Wrapf(err, "failed to download the file: %s", url)
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusTooManyRequests:
+		retryAfter := f.options.RetryDelay
+		seconds, err := strconv.Atoi(response.Header.Get("Retry-After"))
+		if err == nil && seconds > 0 {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return &rateLimitedError{retryAfter: retryAfter}
+	case response.StatusCode >= http.StatusInternalServerError:
+		return errors.Errorf("failed to download the file: %s: status %d", url, response.StatusCode)
+	case response.StatusCode != http.StatusOK:
+		return common.Permanent(errors.Errorf("failed to download the file: %s: status %d", url, response.StatusCode))
+	}
+
+	// Slack serves its login page rather than the file to requests
+	// without a valid token.
+	if isWebPage(response) && !strings.HasPrefix(file.Mimetype, "text/html") {
+		return common.Permanent(errors.Errorf("failed to download the file: %s: Slack responded with a web page rather than the file, the Slack token is most likely missing or lacks the files:read scope", url))
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return common.Permanent(errors.Wrapf(err, "failed to create %s", path))
+	}
+	_, err = io.Copy(out, response.Body)
+	if err != nil {
+		out.Close()
+		return errors.Wrapf(err, "failed to download the file: %s", url)
+	}
+
+	return out.Close()
+}
+
+// isSlackURL returns true if the URL is served by Slack over HTTPS, so
+// that the Slack token is not sent to the other hosts the files of an
+// export may link to.
+func isSlackURL(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	return u.Scheme == "https" && (host == "slack.com" || strings.HasSuffix(host, ".slack.com"))
+}
+
+// isWebPage returns true if the response holds an HTML page.
+func isWebPage(response *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "text/html"
+}
+
+// delayBeforeRetry returns how long to wait after the given failed
+// attempt.
+func (f *attachmentFetcher) delayBeforeRetry(attempt int) time.Duration {
+	delay := f.options.RetryDelay
+	for i := 1; i < attempt && delay < maxFetchRetryDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, maxFetchRetryDelay)
+}
+
+// pause holds off every request for the given duration.
+func (f *attachmentFetcher) pause(duration time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	until := time.Now().Add(duration)
+	if until.After(f.pausedUntil) {
+		f.pausedUntil = until
+	}
+}
+
+// waitForRateLimit waits until requests are no longer held off.
+func (f *attachmentFetcher) waitForRateLimit(ctx context.Context) error {
+	f.mu.Lock()
+	wait := time.Until(f.pausedUntil)
+	f.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
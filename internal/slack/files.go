@@ -6,98 +6,195 @@ package slack
 
 import (
 	"archive/zip"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
-	"io/ioutil"
-	"net/http"
 	"os"
 	"strings"
 
+	"github.com/mattermost/awat/internal/common"
+	"github.com/mattermost/awat/model"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
-// FetchAttachedFiles takes the Slack input file at absolute path
-// inputArchive and parses it. Upon discovering references to attached
-// files, those files are fetched from Slack's servers and added to
-// outputArchive, which at the end will contain all the data from
-// inputArchive as well as all attached files
-func FetchAttachedFiles(logger logrus.FieldLogger, inputArchive string, outputArchive string) error {
+// FetchAttachedFiles reads the Slack export at absolute path
+// inputArchive one file at a time. The files attached to the posts of
+// its day files are fetched from Slack's servers, and the files the
+// export holds in its __uploads directory are extracted, into
+// attachments. Every file is fetched once, however many posts it is
+// attached to, and not at all if the export holds it. The attached
+// files are fetched once all of inputArchive was read, so that the
+// number of files fetched out of the total can be reported as progress.
+// They are fetched concurrently and retried as configured by options;
+// the files which could not be fetched are returned. Cancelling ctx
+// aborts the fetch.
+func FetchAttachedFiles(ctx context.Context, logger logrus.FieldLogger, inputArchive string, attachments *AttachmentStore, options FetchOptions) ([]FailedAttachment, error) {
 	// Open the input archive.
 	r, err := zip.OpenReader(inputArchive)
 	if err != nil {
-		return errors.Wrapf(err, "failed to open input archive %s for reading", inputArchive)
+		return nil, errors.Wrapf(err, "failed to open input archive %s for reading", inputArchive)
 	}
 	defer r.Close()
 
-	// Open the output archive.
-	f, err := os.Create(outputArchive)
-	if err != nil {
-		return errors.Wrapf(err, "failed to create output archive %s for writing", outputArchive)
-	}
-	defer f.Close()
-
-	// Create a zip writer on the output archive.
-	w := zip.NewWriter(f)
-
 	// Run through all the files in the input archive.
+	var attached []attachedFile
 	for _, file := range r.File {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
 
-		// Open the file from the input archive.
-		inReader, err := file.Open()
-		if err != nil {
-			logger.WithError(err).Errorf("failed to open file in input archive: %s", file.Name)
+		// Check if the file name matches the pattern for files we need to parse.
+		splits := strings.Split(file.Name, "/")
+		if len(splits) == 3 && splits[0] == "__uploads" && splits[2] != "" {
+			err = extractAttachedFile(file, attachments, splits[1], splits[2])
+			if err != nil {
+				return nil, err
+			}
 			continue
 		}
-
-		// Read the file into a byte array.
-		inBuf, err := ioutil.ReadAll(inReader)
-		if err != nil {
-			logger.WithError(err).Errorf("Failed to read file in input archive: %s\n\n%s", file.Name, err)
+		if len(splits) != 2 || strings.HasPrefix(splits[0], "__") || !strings.HasSuffix(splits[1], ".json") {
 			continue
 		}
 
-		// Now write this file to the output archive.
-		outFile, err := w.Create(file.Name)
+		// Parse this file.
+		found, err := findAttachedFiles(logger, file)
 		if err != nil {
-			return errors.Wrapf(err, "failed to create file in output archive: %s", file.Name)
+			logger.WithError(err).Errorf("failed to process file %s", file.Name)
+			continue
 		}
-		_, err = outFile.Write(inBuf)
-		if err != nil {
-			logger.WithError(err).Errorf("failed to write file in output archive: %s", file.Name)
+		attached = append(attached, found...)
+	}
+
+	// Every file is fetched once, unless the export holds it already.
+	fetch := make([]attachedFile, 0, len(attached))
+	fetching := map[string]bool{}
+	for _, attachment := range attached {
+		id := attachment.file.ID
+		if id != "" && (attachments.has(id) || fetching[id]) {
 			continue
 		}
+		if id != "" {
+			fetching[id] = true
+		}
+		fetch = append(fetch, attachment)
+	}
 
-		// Check if the file name matches the pattern for files we need to parse.
-		splits := strings.Split(file.Name, "/")
-		if len(splits) == 2 && !strings.HasPrefix(splits[0], "__") && strings.HasSuffix(splits[1], ".json") {
-			// Parse this file.
-			err = processChannelPostsWithFiles(logger, w, file.Name, inBuf)
-			if err != nil {
-				logger.WithError(err).Errorf("failed to process file %s", file.Name)
-				continue
-			}
+	// Fetch the attached files.
+	return fetchAttachedFiles(ctx, logger, fetch, options, attachments)
+}
+
+// fetchAttachedFiles fetches the attachments into the AttachmentStore,
+// reporting the number of files fetched as progress. It returns the
+// attachments which could not be fetched.
+func fetchAttachedFiles(ctx context.Context, logger logrus.FieldLogger, attached []attachedFile, options FetchOptions, attachments *AttachmentStore) ([]FailedAttachment, error) {
+	total := int64(len(attached))
+	common.ReportProgress(ctx, model.TranslationPhaseFetchAttachments,
+		fmt.Sprintf("Fetching %d attached files", total), 0, total)
+
+	results := make(chan fetchResult)
+	go newAttachmentFetcher(options, attachments).fetchAll(ctx, attached, results)
+
+	var failed []FailedAttachment
+	var done int64
+	var storeErr error
+	for result := range results {
+		done++
+		file := result.attachment.file
+		switch {
+		case result.err != nil:
+			logger.WithError(result.err).Warnf("failed to fetch attached file %s of post %s after %d attempts", file.ID, result.attachment.post.Ts, result.attempts)
+			failed = append(failed, FailedAttachment{
+				ID:       file.ID,
+				Name:     file.Name,
+				URL:      file.downloadURL(),
+				Post:     result.attachment.post.Ts,
+				Attempts: result.attempts,
+				Error:    result.err.Error(),
+			})
+		case storeErr != nil:
+			// the results are drained so that the workers finish
+			os.Remove(result.path)
+		default:
+			storeErr = attachments.add(file.ID, file.Name, result.path)
+			logger.Debugf("Downloaded attachment %s.", file.ID)
 		}
+
+		common.ReportProgress(ctx, model.TranslationPhaseFetchAttachments,
+			fmt.Sprintf("Fetched %d of %d attached files", done, total), done, total)
+	}
+
+	if storeErr != nil {
+		return nil, storeErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return failed, nil
+}
+
+// extractAttachedFile adds the file with the given ID and name held by
+// the export to attachments.
+func extractAttachedFile(file *zip.File, attachments *AttachmentStore, id, name string) error {
+	if attachments.has(id) {
+		return nil
 	}
 
-	// Close the output zip writer.
-	err = w.Close()
+	path, err := attachments.createTemp()
 	if err != nil {
-		logger.WithError(err).Warnf("failed to close the output archive %s", outputArchive)
+		return err
 	}
+	// once added, the file was moved or removed already
+	defer os.Remove(path)
 
-	return nil
+	in, err := file.Open()
+	if err != nil {
+		return errors.Wrapf(err, "failed to open file in input archive: %s", file.Name)
+	}
+	defer in.Close()
+
+	out, err := os.Create(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s", path)
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return errors.Wrapf(err, "failed to extract file in input archive: %s", file.Name)
+	}
+	err = out.Close()
+	if err != nil {
+		return errors.Wrapf(err, "failed to extract file in input archive: %s", file.Name)
+	}
+
+	return attachments.add(id, name, path)
+}
+
+// attachedFile is a file attached to a post.
+type attachedFile struct {
+	file *SlackFile
+	post *SlackPost
 }
 
-// processChannelPostsWithFiles actually fetches and adds a found file to the
-// archive specified at file
-func processChannelPostsWithFiles(logger logrus.FieldLogger, w *zip.Writer, fileName string, inBuf []byte) error {
+// findAttachedFiles parses the posts of the channel day file and
+// returns the files attached to them.
+func findAttachedFiles(logger logrus.FieldLogger, file *zip.File) ([]attachedFile, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open file in input archive: %s", file.Name)
+	}
+	defer reader.Close()
+
 	// Parse the JSON of the file.
 	var posts []SlackPost
-	if err := json.Unmarshal(inBuf, &posts); err != nil {
-		return errors.Wrapf(err, "failed to parse the JSON file: %s", fileName)
+	if err = json.NewDecoder(reader).Decode(&posts); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the JSON file: %s", file.Name)
 	}
 
+	var attachments []attachedFile
+
 	// Loop through all the posts.
 	for _, post := range posts {
 		// Support for legacy file_share posts.
@@ -117,54 +214,15 @@ func processChannelPostsWithFiles(logger logrus.FieldLogger, w *zip.Writer, file
 			continue
 		}
 
-		// Loop through all the files.
+		// Collect all the files, keeping only what identifies the post
+		// rather than all of it.
+		ref := &SlackPost{Ts: post.Ts}
 		for _, file := range post.Files {
-			processSingleFile(logger, w, file, &post)
+			attachments = append(attachments, attachedFile{file: file, post: ref})
 		}
 	}
 
-	return nil
-}
-
-func processSingleFile(logger logrus.FieldLogger, w *zip.Writer, file *SlackFile, post *SlackPost) error {
-	// Check there's an Id, Name and either UrlPrivateDownload or UrlPrivate property.
-	if len(file.ID) < 1 || len(file.Name) < 1 || !(len(file.URLPrivate) > 0 || len(file.URLPrivateDownload) > 0) {
-		return errors.New("file_share post has missing properties on it's File object: " + post.Ts + "\n")
-	}
-
-	// Figure out the download URL to use.
-	var downloadURL string
-	if len(file.URLPrivateDownload) > 0 {
-		downloadURL = file.URLPrivateDownload
-	} else {
-		downloadURL = file.URLPrivate
-	}
-
-	// Build the output file path.
-	outputPath := "__uploads/" + file.ID + "/" + file.Name
-
-	// Create the file in the zip output file.
-	outFile, err := w.Create(outputPath)
-	if err != nil {
-		return errors.Wrapf(err, "failed to create output file in output archive: %s", outputPath)
-	}
-
-	// Fetch the file.
-	response, err := http.Get(downloadURL)
-	if err != nil {
-		return errors.Wrapf(err, "failed to download the file: %s", downloadURL)
-	}
-	defer response.Body.Close()
-
-	// Save the file to the output zip file.
-	_, err = io.Copy(outFile, response.Body)
-	if err != nil {
-		return errors.Wrapf(err, "failed to write the downloaded file to the output archive: %s", outputPath)
-	}
-
-	// Success at last.
-	logger.Debugf("Downloaded attachment into output archive: %s.\n", file.ID)
-	return nil
+	return attachments, nil
 }
 
 // SlackFile is a holding type for files attached to Slack messages
@@ -175,6 +233,15 @@ type SlackFile struct {
 	Name               string `json:"name"`
 	URLPrivate         string `json:"url_private"`
 	URLPrivateDownload string `json:"url_private_download"`
+	Mimetype           string `json:"mimetype"`
+}
+
+// downloadURL returns the URL to fetch the file from.
+func (f *SlackFile) downloadURL() string {
+	if len(f.URLPrivateDownload) > 0 {
+		return f.URLPrivateDownload
+	}
+	return f.URLPrivate
 }
 
 // SlackPost is a holding type for Slack posts
@@ -6,52 +6,352 @@ package slack
 
 import (
 	"archive/zip"
-	"io/ioutil"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/mattermost/awat/internal/common"
+	"github.com/mattermost/awat/model"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-// TODO make it so that this doesn't actually reach out to Slack's servers..
-// but it's only a few MB and it's public and probably nobody will notice or care
+// redirectTransport sends every request to the server at target, so
+// that the attached files of an archive are fetched from a test server
+// rather than from Slack.
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (t *redirectTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	request = request.Clone(request.Context())
+	request.URL.Scheme = t.target.Scheme
+	request.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(request)
+}
+
+func testFetchOptions(t *testing.T, handler http.Handler) FetchOptions {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	target, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	return FetchOptions{
+		Workers:    4,
+		Timeout:    5 * time.Second,
+		Retries:    2,
+		RetryDelay: 10 * time.Millisecond,
+		HTTPClient: &http.Client{Transport: &redirectTransport{target: target}},
+	}
+}
+
+// writeTestArchive writes a Slack export holding a single day file of
+// the given posts to path.
+func writeTestArchive(t *testing.T, path string, posts []SlackPost) string {
+	input, err := os.Create(path)
+	require.NoError(t, err)
+	zw := zip.NewWriter(input)
+	channel, err := zw.Create("general/2021-03-31.json")
+	require.NoError(t, err)
+	require.NoError(t, json.NewEncoder(channel).Encode(posts))
+	require.NoError(t, zw.Close())
+	require.NoError(t, input.Close())
+
+	return path
+}
+
+// readAttachments returns the contents of the files stored in the
+// AttachmentStore by their ID.
+func readAttachments(t *testing.T, attachments *AttachmentStore) map[string]string {
+	contents := map[string]string{}
+	for id, stored := range attachments.paths {
+		content, err := os.ReadFile(filepath.Join(attachments.dir, stored))
+		require.NoError(t, err)
+		contents[id] = string(content)
+	}
+
+	return contents
+}
+
 func TestFetchAttachedFiles(t *testing.T) {
-	tempFile, err := ioutil.TempFile(os.TempDir(), "awat-slack-test-attached-files")
+	attachments, err := NewAttachmentStore(filepath.Join(t.TempDir(), "attachments"))
 	require.NoError(t, err)
 	logger := logrus.New()
 
-	err = FetchAttachedFiles(logger, "../../test/dummy-slack-workspace-archive.zip", tempFile.Name())
+	var phase string
+	var done, total int64
+	ctx := common.WithProgress(context.Background(), func(p, message string, d, tot int64) {
+		phase, done, total = p, d, tot
+	})
+
+	options := testFetchOptions(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.URL.Path)
+	}))
+
+	failed, err := FetchAttachedFiles(ctx, logger, "../../test/dummy-slack-workspace-archive.zip", attachments, options)
 	assert.NoError(t, err)
+	assert.Equal(t, model.TranslationPhaseFetchAttachments, phase)
+	assert.Equal(t, int64(11), total)
+	assert.Equal(t, total, done)
+
+	// one of the posts refers to a file without a URL
+	require.Len(t, failed, 1)
+	assert.Equal(t, "F017UH7SHEK", failed[0].ID)
+	assert.Equal(t, 0, failed[0].Attempts)
+
+	uploads := map[string]string{
+		"F01TP8NLE00": "kitten1.jpg",
+		"F01SZEKQ2H0": "20200609_151659.jpg",
+		"F01TC38M2HX": "emacs.png",
+		"F01SJM9E2BZ": "Headphone_Stand_2_parts.zip",
+		"F01SZLXD3PD": "Ergodox_Tent.zip",
+		"F01SWCK89C5": "Untitled",
+		"F01T5KQN1U4": "Untitled",
+		"F01SZG8FHFU": "20200310_121556.jpg",
+		"F01TPAKE3AL": "20200303_131253.jpg",
+		"F01TC55H8TB": "20190609_200033.jpg",
+	}
+
+	assert.Len(t, readAttachments(t, attachments), len(uploads))
+	for id, name := range uploads {
+		assert.True(t, strings.HasPrefix(attachments.Path(id), "attachments/"), id)
+		assert.True(t, strings.HasSuffix(attachments.Path(id), "/"+name), id)
+	}
+	assert.Equal(t, 10, attachments.Report().UniqueAttachments)
+}
+
+func TestFetchAttachedFilesUploads(t *testing.T) {
+	dir := t.TempDir()
+	attachments, err := NewAttachmentStore(filepath.Join(dir, "attachments"))
+	require.NoError(t, err)
+	logger := logrus.New()
+
+	posts := []SlackPost{
+		{Ts: "1", Files: []*SlackFile{{ID: "F1", Name: "held.txt", URLPrivate: "https://files.slack.com/held"}}},
+		{Ts: "2", Files: []*SlackFile{{ID: "F2", Name: "shared.txt", URLPrivate: "https://files.slack.com/shared"}}},
+		{Ts: "3", Files: []*SlackFile{{ID: "F2", Name: "shared.txt", URLPrivate: "https://files.slack.com/shared"}}},
+		{Ts: "4", Files: []*SlackFile{{ID: "F3", Name: "../../escape.txt", URLPrivate: "https://files.slack.com/escape"}}},
+		{Ts: "5", Files: []*SlackFile{{ID: "F4", Name: "copy.txt", URLPrivate: "https://files.slack.com/shared"}}},
+	}
+	inputArchive := filepath.Join(dir, "input.zip")
+	input, err := os.Create(inputArchive)
+	require.NoError(t, err)
+	zw := zip.NewWriter(input)
+	channel, err := zw.Create("general/2021-03-31.json")
+	require.NoError(t, err)
+	require.NoError(t, json.NewEncoder(channel).Encode(posts))
+	upload, err := zw.Create("__uploads/F1/held.txt")
+	require.NoError(t, err)
+	_, err = io.WriteString(upload, "held")
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.NoError(t, input.Close())
+
+	var mu sync.Mutex
+	requests := map[string]int{}
+	options := testFetchOptions(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		_, _ = io.WriteString(w, r.URL.Path)
+	}))
 
-	zr, err := zip.OpenReader(tempFile.Name())
+	failed, err := FetchAttachedFiles(context.Background(), logger, inputArchive, attachments, options)
 	require.NoError(t, err)
+	assert.Empty(t, failed)
 
-	uploads := map[string]bool{
-		"__uploads/F01TP8NLE00/kitten1.jpg":                 false,
-		"__uploads/F01SZEKQ2H0/20200609_151659.jpg":         false,
-		"__uploads/F01TC38M2HX/emacs.png":                   false,
-		"__uploads/F01SJM9E2BZ/Headphone_Stand_2_parts.zip": false,
-		"__uploads/F01SZLXD3PD/Ergodox_Tent.zip":            false,
-		"__uploads/F01SWCK89C5/Untitled":                    false,
-		"__uploads/F01T5KQN1U4/Untitled":                    false,
-		"__uploads/F01SZG8FHFU/20200310_121556.jpg":         false,
-		"__uploads/F01TPAKE3AL/20200303_131253.jpg":         false,
-		"__uploads/F01TC55H8TB/20190609_200033.jpg":         false,
+	assert.Equal(t, map[string]int{"/shared": 2, "/escape": 1}, requests, "files are fetched once by ID unless held by the export")
+	assert.Equal(t, map[string]string{
+		"F1": "held",
+		"F2": "/shared",
+		"F3": "/escape",
+		"F4": "/shared",
+	}, readAttachments(t, attachments))
+	assert.True(t, strings.HasSuffix(attachments.Path("F3"), "/escape.txt"))
+	assert.Equal(t, attachments.Path("F2"), attachments.Path("F4"), "identical files are stored once")
+
+	entries, err := os.ReadDir(filepath.Join(dir, "attachments"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	assert.Equal(t, model.AttachmentReport{
+		AttachedFiles:     4,
+		UniqueAttachments: 3,
+		AttachmentBytes:   int64(len("held") + len("/shared") + len("/escape")),
+		BytesSaved:        int64(len("/shared")),
+	}, attachments.Report())
+}
+
+func TestFetchAttachedFilesRetries(t *testing.T) {
+	dir := t.TempDir()
+	logger := logrus.New()
+
+	posts := []SlackPost{
+		{Ts: "1", Files: []*SlackFile{{ID: "F1", Name: "ok.txt", URLPrivate: "https://files.slack.com/ok"}}},
+		{Ts: "2", Files: []*SlackFile{{ID: "F2", Name: "flaky.txt", URLPrivateDownload: "https://files.slack.com/flaky"}}},
+		{Ts: "3", Files: []*SlackFile{{ID: "F3", Name: "limited.txt", URLPrivate: "https://files.slack.com/limited"}}},
+		{Ts: "4", Files: []*SlackFile{{ID: "F4", Name: "missing.txt", URLPrivate: "https://files.slack.com/missing"}}},
+		{Ts: "5", Files: []*SlackFile{{ID: "F5", Name: "broken.txt", URLPrivate: "https://files.slack.com/broken"}}},
+		{Ts: "6", Files: []*SlackFile{{ID: "F6", Name: "no-url.txt"}}},
 	}
+	inputArchive := writeTestArchive(t, filepath.Join(dir, "input.zip"), posts)
+
+	var mu sync.Mutex
+	requests := map[string]int{}
+	options := testFetchOptions(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		count := requests[r.URL.Path]
+		mu.Unlock()
 
-	for _, f := range zr.File {
-		if !strings.HasPrefix(f.Name, "__uploads") {
-			continue
+		switch r.URL.Path {
+		case "/flaky":
+			if count == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+		case "/limited":
+			if count == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
 		}
-		_, ok := uploads[f.Name]
-		assert.True(t, ok)
-		uploads[f.Name] = true
+		_, _ = io.WriteString(w, r.URL.Path)
+	}))
+
+	attachments, err := NewAttachmentStore(filepath.Join(dir, "attachments"))
+	require.NoError(t, err)
+	failed, err := FetchAttachedFiles(context.Background(), logger, inputArchive, attachments, options)
+	require.NoError(t, err)
+
+	failedByID := map[string]FailedAttachment{}
+	for _, attachment := range failed {
+		failedByID[attachment.ID] = attachment
 	}
+	require.Len(t, failedByID, 3)
+	assert.Equal(t, 1, failedByID["F4"].Attempts, "client errors are not retried")
+	assert.Equal(t, 3, failedByID["F5"].Attempts, "server errors are retried")
+	assert.Equal(t, "5", failedByID["F5"].Post)
+	assert.Equal(t, 0, failedByID["F6"].Attempts)
+
+	assert.Equal(t, map[string]string{
+		"F1": "/ok",
+		"F2": "/flaky",
+		"F3": "/limited",
+	}, readAttachments(t, attachments))
+
+	entries, err := os.ReadDir(filepath.Join(dir, "attachments"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 3, "nothing is left of the files which could not be fetched")
+}
+
+func TestFetchAttachedFilesCancelled(t *testing.T) {
+	dir := t.TempDir()
+	logger := logrus.New()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	options := testFetchOptions(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	options.RetryDelay = time.Hour
 
-	for _, v := range uploads {
-		assert.True(t, v)
+	attachments, err := NewAttachmentStore(filepath.Join(dir, "attachments"))
+	require.NoError(t, err)
+	_, err = FetchAttachedFiles(ctx, logger, "../../test/dummy-slack-workspace-archive.zip", attachments, options)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestFetchAttachedFilesToken(t *testing.T) {
+	dir := t.TempDir()
+	logger := logrus.New()
+
+	posts := []SlackPost{
+		{Ts: "1", Files: []*SlackFile{{ID: "F1", Name: "kitten.jpg", URLPrivate: "https://files.slack.com/kitten", Mimetype: "image/jpeg"}}},
+		{Ts: "2", Files: []*SlackFile{{ID: "F2", Name: "page.html", URLPrivate: "https://files.slack.com/page", Mimetype: "text/html"}}},
+	}
+	inputArchive := writeTestArchive(t, filepath.Join(dir, "input.zip"), posts)
+
+	options := testFetchOptions(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer xoxb-token" || r.URL.Path == "/page" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = io.WriteString(w, "<html><body>Sign in to Slack</body></html>")
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		_, _ = io.WriteString(w, "kitten")
+	}))
+
+	t.Run("without a token", func(t *testing.T) {
+		attachments, err := NewAttachmentStore(filepath.Join(dir, "without"))
+		require.NoError(t, err)
+		failed, err := FetchAttachedFiles(context.Background(), logger, inputArchive, attachments, options)
+		require.NoError(t, err)
+		require.Len(t, failed, 1)
+		assert.Equal(t, "F1", failed[0].ID)
+		assert.Equal(t, 1, failed[0].Attempts)
+		assert.Contains(t, failed[0].Error, "files:read")
+	})
+
+	t.Run("with a token", func(t *testing.T) {
+		options.Token = "xoxb-token"
+		attachments, err := NewAttachmentStore(filepath.Join(dir, "with"))
+		require.NoError(t, err)
+		failed, err := FetchAttachedFiles(context.Background(), logger, inputArchive, attachments, options)
+		require.NoError(t, err)
+		assert.Empty(t, failed)
+	})
+}
+
+func TestFetchAttachedFilesTokenOnlySentToSlack(t *testing.T) {
+	dir := t.TempDir()
+	logger := logrus.New()
+
+	posts := []SlackPost{
+		{Ts: "1", Files: []*SlackFile{{ID: "F1", Name: "slack.jpg", URLPrivate: "https://files.slack.com/slack", Mimetype: "image/jpeg"}}},
+		{Ts: "2", Files: []*SlackFile{{ID: "F2", Name: "foreign.jpg", URLPrivate: "https://example.com/foreign", Mimetype: "image/jpeg"}}},
+		{Ts: "3", Files: []*SlackFile{{ID: "F3", Name: "lookalike.jpg", URLPrivate: "https://slack.com.example.com/lookalike", Mimetype: "image/jpeg"}}},
+		{Ts: "4", Files: []*SlackFile{{ID: "F4", Name: "plain.jpg", URLPrivate: "http://files.slack.com/plain", Mimetype: "image/jpeg"}}},
 	}
+	inputArchive := writeTestArchive(t, filepath.Join(dir, "input.zip"), posts)
+
+	var mu sync.Mutex
+	authorization := map[string]string{}
+	options := testFetchOptions(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		authorization[r.URL.Path] = r.Header.Get("Authorization")
+		mu.Unlock()
+		w.Header().Set("Content-Type", "image/jpeg")
+		_, _ = io.WriteString(w, "kitten")
+	}))
+	options.Token = "xoxb-token"
+
+	attachments, err := NewAttachmentStore(filepath.Join(dir, "attachments"))
+	require.NoError(t, err)
+	failed, err := FetchAttachedFiles(context.Background(), logger, inputArchive, attachments, options)
+	require.NoError(t, err)
+	assert.Empty(t, failed)
+	assert.Equal(t, map[string]string{
+		"/slack":     "Bearer xoxb-token",
+		"/foreign":   "",
+		"/lookalike": "",
+		"/plain":     "",
+	}, authorization)
 }
@@ -6,98 +6,361 @@ package slack
 
 import (
 	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/mattermost/awat/internal/common"
 	"github.com/mattermost/awat/model"
+	mmmodel "github.com/mattermost/mattermost/server/public/model"
 	mmetl "github.com/mattermost/mmetl/services/slack"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
+// transformBatchSize is the number of posts after which a batch of
+// channels is transformed and written out. The posts of a channel are
+// always transformed together, as its threads may span several days,
+// so a batch may hold more posts if a single channel does.
+const transformBatchSize = 50000
+
+// filesMarker is appended to the text of the posts files are attached
+// to before they are handed to mmetl, followed by the index of the
+// files, so that the files can be added to the posts mmetl creates.
+const filesMarker = "\x00awat-files:"
+
 // TransformSlack takes an absolute filepath inputFilePath which points
-// to a Slack workspace archive which already contains file
-// attachments and outputs an MBIF to outputFilePath with references
-// in the JSONL lines that make up the MBIF referring to any attached
-// files in attachmentsDir. The attached files will also be extracted
-// from the file at inputFilePath and stored in attachmentsDir
-func TransformSlack(translation *model.Translation, inputFilePath, outputFilePath, attachmentsDir, workdir string, logger log.FieldLogger) error {
+// to a Slack workspace archive and outputs an MBIF to outputFilePath
+// with references in the JSONL lines that make up the MBIF referring
+// to the attached files in attachments, where FetchAttachedFiles
+// stored them. Files attached to posts which are missing from
+// attachments are left out.
+//
+// Only the users and channels of the export are held in memory. The
+// day files of the channels are read and transformed in batches of
+// about transformBatchSize posts, whose import lines are written to a
+// temporary file in workdir, so memory use does not grow with the size
+// of the export. The number of posts transformed is reported as
+// progress.
+func TransformSlack(ctx context.Context, translation *model.Translation, inputFilePath, outputFilePath string, attachments *AttachmentStore, workdir string, logger log.FieldLogger) error {
 	logger.Debug("Reading zip file")
 
-	fileReader, err := os.Open(inputFilePath)
+	zipReader, err := zip.OpenReader(inputFilePath)
 	if err != nil {
 		return err
 	}
-	defer fileReader.Close()
+	defer zipReader.Close()
 
-	zipFileInfo, err := fileReader.Stat()
+	slackTransformer := mmetl.NewTransformer(translation.Team, logger)
+
+	slackExport, channels, dayFiles, err := parseSlackMetadata(slackTransformer, &zipReader.Reader)
 	if err != nil {
 		return err
 	}
 
-	zipReader, err := zip.NewReader(fileReader, zipFileInfo.Size())
+	logger.Debug("Running mmetl transformation processes")
+
+	slackTransformer.TransformUsers(slackExport.Users, true, "")
+	err = slackTransformer.TransformAllChannels(slackExport)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "failed to transform slack channels")
 	}
+	slackTransformer.PopulateUserMemberships()
+	slackTransformer.PopulateChannelMemberships()
 
-	logger.Debug("Running mmetl transformation processes")
+	counts := make(map[string]int64, len(channels))
+	var total int64
+	for _, channel := range channels {
+		for _, file := range dayFiles[channel] {
+			n, err := countPosts(file)
+			if err != nil {
+				logger.WithError(err).Warnf("failed to count the posts of %s", file.Name)
+			}
+			counts[channel] += n
+		}
+		total += counts[channel]
+	}
+	common.ReportProgress(ctx, model.TranslationPhaseTransform, fmt.Sprintf("Transforming %d posts", total), 0, total)
 
-	slackTransformer := mmetl.NewTransformer(translation.Team, logger)
+	postsFile, err := os.CreateTemp(workdir, "posts-")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary file for posts")
+	}
+	defer os.Remove(postsFile.Name())
+	defer postsFile.Close()
+
+	var done, posts int64
+	for len(channels) > 0 {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		var batch []string
+		var batchSize int64
+		for len(channels) > 0 && (len(batch) == 0 || batchSize+counts[channels[0]] <= transformBatchSize) {
+			batch = append(batch, channels[0])
+			batchSize += counts[channels[0]]
+			channels = channels[1:]
+		}
+
+		n, err := transformPosts(slackTransformer, slackExport, batch, dayFiles, attachments, postsFile)
+		if err != nil {
+			return err
+		}
+		posts += n
+		done += batchSize
+
+		common.ReportProgress(ctx, model.TranslationPhaseTransform, fmt.Sprintf("Transformed %d of %d posts", done, total), done, total)
+	}
+
+	// this total may include bots
+	users := len(slackTransformer.Intermediate.UsersById)
 
-	slackExport, err := slackTransformer.ParseSlackExportFile(zipReader, false)
+	err = validateTransformation(users, posts)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "slack transformation failed validation")
+	}
+
+	err = exportSlack(slackTransformer, postsFile, outputFilePath)
+	if err != nil {
+		return errors.Wrap(err, "failed to run mmetl export")
+	}
+
+	translation.Users = users
+
+	logger.Info("Transformation succeeded")
+	return nil
+}
+
+// parseSlackMetadata parses the users and channels of the Slack export
+// and returns them along with the names of the channels which have
+// posts, in the order they appear in, and their day files.
+func parseSlackMetadata(t *mmetl.Transformer, zipReader *zip.Reader) (*mmetl.SlackExport, []string, map[string][]*zip.File, error) {
+	slackExport := &mmetl.SlackExport{TeamName: t.TeamName}
+	var channels []string
+	dayFiles := map[string][]*zip.File{}
+
+	for _, file := range zipReader.File {
+		var channelType mmmodel.ChannelType
+		switch file.Name {
+		case "users.json":
+		case "channels.json":
+			channelType = mmmodel.ChannelTypeOpen
+		case "dms.json":
+			channelType = mmmodel.ChannelTypeDirect
+		case "groups.json":
+			channelType = mmmodel.ChannelTypePrivate
+		case "mpims.json":
+			channelType = mmmodel.ChannelTypeGroup
+		default:
+			splits := strings.Split(file.Name, "/")
+			if len(splits) == 2 && strings.HasSuffix(splits[1], ".json") {
+				if _, ok := dayFiles[splits[0]]; !ok {
+					channels = append(channels, splits[0])
+				}
+				dayFiles[splits[0]] = append(dayFiles[splits[0]], file)
+			}
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "failed to open file in input archive: %s", file.Name)
+		}
+
+		if channelType == "" {
+			slackExport.Users, _ = t.SlackParseUsers(reader)
+			reader.Close()
+			continue
+		}
+
+		parsed, _ := t.SlackParseChannels(reader, channelType)
+		reader.Close()
+		switch channelType {
+		case mmmodel.ChannelTypeOpen:
+			slackExport.PublicChannels = parsed
+		case mmmodel.ChannelTypeDirect:
+			slackExport.DirectChannels = parsed
+		case mmmodel.ChannelTypePrivate:
+			slackExport.PrivateChannels = parsed
+		case mmmodel.ChannelTypeGroup:
+			slackExport.GroupChannels = parsed
+		}
+		slackExport.Channels = append(slackExport.Channels, parsed...)
 	}
 
-	err = slackTransformer.Transform(
-		slackExport,
-		attachmentsDir,
-		false, // skip attachments
-		true,  // discard invalid props
-		true,  // allow downloads
-		true,  // skip empty email
-		"",    // default email domain
-	)
+	return slackExport, channels, dayFiles, nil
+}
+
+// countPosts returns the number of posts in the day file without
+// holding more than one of them in memory.
+func countPosts(file *zip.File) (int64, error) {
+	reader, err := file.Open()
 	if err != nil {
-		return errors.Wrap(err, "failed to transform slack export")
+		return 0, err
 	}
+	defer reader.Close()
 
-	err = validateIntermediate(slackTransformer.Intermediate)
+	decoder := json.NewDecoder(reader)
+	_, err = decoder.Token()
 	if err != nil {
-		return errors.Wrap(err, "slack transformation failed validation")
+		return 0, err
 	}
 
-	// TODO maybe change mmetl to include the correct paths during
-	// Transform -- however this seems to be fairly involved so for now
-	// just fix these paths after the fact
-	for _, post := range slackTransformer.Intermediate.Posts {
-		for i, attachment := range post.Attachments {
-			path, err := filepath.Abs("/data" + strings.TrimPrefix(attachment, workdir))
+	var n int64
+	for decoder.More() {
+		err = decoder.Decode(&struct{}{})
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// transformPosts transforms the posts of the given channels and writes
+// their import lines to w, returning the number of lines written. The
+// transformed posts are dropped afterwards.
+func transformPosts(t *mmetl.Transformer, slackExport *mmetl.SlackExport, channels []string, dayFiles map[string][]*zip.File, attachments *AttachmentStore, w io.Writer) (int64, error) {
+	posts := make(map[string][]mmetl.SlackPost, len(channels))
+	for _, channel := range channels {
+		for _, file := range dayFiles[channel] {
+			reader, err := file.Open()
 			if err != nil {
-				return err
+				return 0, errors.Wrapf(err, "failed to open file in input archive: %s", file.Name)
 			}
-			post.Attachments[i] = path
+			// errors are logged by mmetl, the posts parsed until then
+			// are kept
+			dayPosts, _ := t.SlackParsePosts(reader)
+			reader.Close()
+			posts[channel] = append(posts[channel], dayPosts...)
 		}
 	}
 
-	err = slackTransformer.Export(outputFilePath)
+	posts = t.SlackConvertUserMentions(slackExport.Users, posts)
+	posts = t.SlackConvertChannelMentions(slackExport.Channels, posts)
+	posts = t.SlackConvertPostsMarkup(posts)
+
+	// mmetl would copy the attached files once more, so they are added
+	// to the transformed posts here instead.
+	var files [][]*mmetl.SlackFile
+	for _, channelPosts := range posts {
+		for i := range channelPosts {
+			post := &channelPosts[i]
+			if !post.IsPlainMessage() && !post.IsBotMessage() {
+				continue
+			}
+			attached := post.Files
+			if post.File != nil {
+				attached = []*mmetl.SlackFile{post.File}
+			}
+			if len(attached) == 0 {
+				continue
+			}
+			post.Text += filesMarker + strconv.Itoa(len(files))
+			post.File, post.Files = nil, nil
+			files = append(files, attached)
+		}
+	}
+
+	slackExport.Posts = posts
+	defer func() {
+		slackExport.Posts = nil
+		t.Intermediate.Posts = nil
+	}()
+
+	err := t.TransformPosts(slackExport, "", true, true, false)
 	if err != nil {
-		return errors.Wrap(err, "failed to run mmetl export")
+		return 0, errors.Wrap(err, "failed to transform slack posts")
 	}
 
-	// this total may include bots
-	translation.Users = len(slackTransformer.Intermediate.UsersById)
+	var n int64
+	for _, post := range t.Intermediate.Posts {
+		addAttachedFiles(post, files, attachments)
+		for _, reply := range post.Replies {
+			addAttachedFiles(reply, files, attachments)
+		}
 
-	logger.Info("Transformation succeeded")
-	return nil
+		err = mmetl.ExportWriteLine(w, mmetl.GetImportLineFromPost(post, t.TeamName))
+		if err != nil {
+			return n, errors.Wrap(err, "failed to write post")
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// addAttachedFiles removes the marker added by transformPosts from the
+// message of the post and adds the files it refers to which are stored
+// in attachments.
+func addAttachedFiles(post *mmetl.IntermediatePost, files [][]*mmetl.SlackFile, attachments *AttachmentStore) {
+	i := strings.LastIndex(post.Message, filesMarker)
+	if i < 0 {
+		return
+	}
+	index, err := strconv.Atoi(post.Message[i+len(filesMarker):])
+	if err != nil || index < 0 || index >= len(files) {
+		return
+	}
+	post.Message = post.Message[:i]
+
+	for _, file := range files[index] {
+		if path := attachments.Path(file.Id); path != "" {
+			post.Attachments = append(post.Attachments, path)
+		}
+	}
+}
+
+// exportSlack writes the MBIF to outputFilePath, made of the users and
+// channels of the transformer followed by the posts written to
+// postsFile.
+func exportSlack(t *mmetl.Transformer, postsFile *os.File, outputFilePath string) error {
+	output, err := os.Create(outputFilePath)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+
+	if err = t.ExportVersion(output); err != nil {
+		return err
+	}
+	if err = t.ExportChannels(t.Intermediate.PublicChannels, output); err != nil {
+		return err
+	}
+	if err = t.ExportChannels(t.Intermediate.PrivateChannels, output); err != nil {
+		return err
+	}
+	if err = t.ExportUsers(output); err != nil {
+		return err
+	}
+	if err = t.ExportDirectChannels(t.Intermediate.GroupChannels, output); err != nil {
+		return err
+	}
+	if err = t.ExportDirectChannels(t.Intermediate.DirectChannels, output); err != nil {
+		return err
+	}
+
+	if _, err = postsFile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err = io.Copy(output, postsFile); err != nil {
+		return err
+	}
+
+	return output.Close()
 }
 
-func validateIntermediate(intermediate *mmetl.Intermediate) error {
-	if len(intermediate.UsersById) == 0 {
+func validateTransformation(users int, posts int64) error {
+	if users == 0 {
 		return errors.New("slack translation resulted in 0 users")
 	}
-	if len(intermediate.Posts) == 0 {
+	if posts == 0 {
 		return errors.New("slack translation resulted in 0 posts")
 	}
 
@@ -5,13 +5,16 @@
 package slack
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"io/ioutil"
 	"os"
 	"strings"
 	"testing"
 
+	"github.com/mattermost/awat/internal/common"
 	"github.com/mattermost/awat/model"
-	mmetl "github.com/mattermost/mmetl/services/slack"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -21,14 +24,27 @@ func TestTransformSlack(t *testing.T) {
 	tempDir, err := os.MkdirTemp("", "awat-slack-test-transform-slack")
 	require.NoError(t, err)
 
-	err = os.MkdirAll(tempDir+"/attachments", 0666)
+	// two of the attached files are identical
+	attachments, err := NewAttachmentStore(tempDir + "/attachments")
 	require.NoError(t, err)
+	for _, id := range []string{"F01TP8NLE00", "F01SZEKQ2H0"} {
+		path := tempDir + "/" + id
+		require.NoError(t, os.WriteFile(path, []byte("kitten"), 0600))
+		require.NoError(t, attachments.add(id, "kitten1.jpg", path))
+	}
+	hash := sha256.Sum256([]byte("kitten"))
+	attachmentPath := "attachments/" + hex.EncodeToString(hash[:]) + "/kitten1.jpg"
+
+	var done, total int64
+	ctx := common.WithProgress(context.Background(), func(phase, message string, d, tot int64) {
+		done, total = d, tot
+	})
 
 	mbifOutputFile, err := ioutil.TempFile(tempDir, "mbif")
 	require.NoError(t, err)
 	defer mbifOutputFile.Close()
 
-	err = TransformSlack(&model.Translation{
+	err = TransformSlack(ctx, &model.Translation{
 		ID:             model.NewID(),
 		InstallationID: model.NewID(),
 		Team:           "some team",
@@ -42,11 +58,13 @@ func TestTransformSlack(t *testing.T) {
 	},
 		"../../test/dummy-slack-workspace-archive.zip",
 		mbifOutputFile.Name(),
-		tempDir+"/attachments",
+		attachments,
 		tempDir,
 		log.New(),
 	)
 	require.NoError(t, err)
+	assert.Equal(t, total, done)
+	assert.Greater(t, total, int64(0))
 
 	mbifOutputFile, err = os.Open(mbifOutputFile.Name())
 	require.NoError(t, err)
@@ -57,35 +75,45 @@ func TestTransformSlack(t *testing.T) {
 	lines := strings.SplitAfter(string(mbifRaw), "\n")
 
 	found := false
+	attached := 0
 	// find a known line of output just to make sure things went more or less okay
 	for _, l := range lines {
 		if strings.HasPrefix(l, `{"type":"post","post":{"team":"some team","channel":"leads","user":"james","type":"","message":"@jasonbot","props":null,"create_at":1539794482000,"edit_at":null,"replies":[],"attachments":[]}}`) {
 			found = true
 		}
+		// only the attached files in the attachments directory are
+		// referenced
+		if strings.Contains(l, `"attachments":[{"path":"`+attachmentPath+`"}]`) {
+			attached++
+		}
+		assert.NotContains(t, l, `\u0000`)
+		assert.NotContains(t, l, `bulk-export-attachments`)
 	}
 
 	// TODO: greatly improve checking in tests
 	assert.True(t, found)
+	assert.Equal(t, 2, attached)
 	assert.GreaterOrEqual(t, len(lines), 200)
 }
 
-func TestValidateIntermediate(t *testing.T) {
+func TestValidateTransformation(t *testing.T) {
 	var testCases = []struct {
-		name         string
-		intermediate *mmetl.Intermediate
-		valid        bool
+		name  string
+		users int
+		posts int64
+		valid bool
 	}{
-		{"no users", &mmetl.Intermediate{Posts: []*mmetl.IntermediatePost{{Message: "test"}}}, false},
-		{"no posts", &mmetl.Intermediate{UsersById: map[string]*mmetl.IntermediateUser{"user1": {Username: "user1"}}}, false},
-		{"valid", &mmetl.Intermediate{UsersById: map[string]*mmetl.IntermediateUser{"user1": {Username: "user1"}}, Posts: []*mmetl.IntermediatePost{{Message: "test"}}}, true},
+		{"no users", 0, 1, false},
+		{"no posts", 1, 0, false},
+		{"valid", 1, 1, true},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			if tc.valid {
-				assert.NoError(t, validateIntermediate(tc.intermediate))
+				assert.NoError(t, validateTransformation(tc.users, tc.posts))
 			} else {
-				assert.Error(t, validateIntermediate(tc.intermediate))
+				assert.Error(t, validateTransformation(tc.users, tc.posts))
 			}
 		})
 	}
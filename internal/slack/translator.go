@@ -7,15 +7,20 @@ package slack
 import (
 	"archive/zip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
 
-	s3manager "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/mattermost/awat/internal/common"
+	"github.com/mattermost/awat/internal/mbif"
+	"github.com/mattermost/awat/internal/objectstore"
+	"github.com/mattermost/awat/internal/validators"
 	"github.com/mattermost/awat/model"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -23,34 +28,32 @@ import (
 
 // SlackTranslator is responsible for translating Slack workspace archives into a format compatible with Mattermost.
 type SlackTranslator struct {
-	s3Client           *s3.Client
-	bucket             string
+	objectStore        objectstore.ObjectStore
 	workingDir         string
 	outputZipLocalPath string
+	outputChecksum     string
+	fetchOptions       FetchOptions
 }
 
-// NewSlackTranslator creates a new Translator instance for translating Slack workspaces.
-func NewSlackTranslator(bucket, workingDir string) (*SlackTranslator, error) {
-	awsConfig, err := common.NewAWSConfig()
-	if err != nil {
-		return nil, err
-	}
-
-	s3Client := s3.NewFromConfig(awsConfig)
-
+// NewSlackTranslator creates a new Translator instance for translating
+// Slack workspaces, which fetches attached files as configured by
+// fetchOptions.
+func NewSlackTranslator(objectStore objectstore.ObjectStore, workingDir string, fetchOptions FetchOptions) *SlackTranslator {
 	return &SlackTranslator{
-		s3Client:   s3Client,
-		bucket:     bucket,
-		workingDir: workingDir,
-	}, nil
+		objectStore:  objectStore,
+		workingDir:   workingDir,
+		fetchOptions: fetchOptions,
+	}
 }
 
 // Translate satisfies the Translator interface for the
 // SlackTranslator. It performs the Translation represented by the
-// input struct and uploads the resulting .zip archive to S3. On
+// input struct and uploads the resulting .zip archive to the object
+// store. On
 // success it returns the file name of the output zip file without a
-// path and on error it returns the error and an empty string
-func (st *SlackTranslator) Translate(translation *model.Translation) (string, error) {
+// path and on error it returns the error and an empty string.
+// Cancelling ctx stops the translation between steps.
+func (st *SlackTranslator) Translate(ctx context.Context, translation *model.Translation) (string, error) {
 	workdir := fmt.Sprintf("%s/%s", st.workingDir, translation.ID)
 	err := os.Mkdir(workdir, 0700)
 	if err != nil {
@@ -60,44 +63,80 @@ func (st *SlackTranslator) Translate(translation *model.Translation) (string, er
 
 	logger := log.New()
 
-	inputArchiveName, err := st.fetchSlackArchive(logger, workdir, translation.Resource)
+	common.ReportProgress(ctx, model.TranslationPhaseDownload, "Downloading the Slack archive", 0, 0)
+	inputArchiveName, err := st.fetchSlackArchive(ctx, logger, workdir, translation.Resource, translation.InputChecksum)
 	if err != nil {
 		return "", err
 	}
 
+	// Catch broken exports before spending time on fetching the
+	// attached files.
+	logger.Infof("Validating Slack archive for Translation %s", translation.ID)
+	common.ReportProgress(ctx, model.TranslationPhaseValidate, "Validating the Slack archive", 0, 0)
+	report, err := validators.NewSlackValidator().Validate(inputArchiveName)
+	if err != nil {
+		return "", err
+	}
+	for _, warning := range report.Warnings {
+		logger.Warn(warning.String())
+	}
+	if err = report.Err(); err != nil {
+		return "", common.Permanent(err)
+	}
+
 	attachmentDirName := fmt.Sprintf("%s/attachments", workdir)
-	archiveWithFilesName, err := st.addFilesToSlackArchive(
-		logger,
-		workdir,
-		attachmentDirName,
-		inputArchiveName,
-	)
+	attachments, err := NewAttachmentStore(attachmentDirName)
+	if err != nil {
+		return "", err
+	}
+	err = st.fetchAttachedFiles(ctx, logger, translation.ID, workdir, attachments, inputArchiveName)
 	if err != nil {
-		return "", errors.Wrap(err, "failed add files to slack archive")
+		return "", errors.Wrap(err, "failed to fetch attached files")
+	}
+
+	if err = ctx.Err(); err != nil {
+		return "", err
 	}
 
 	mbifName := fmt.Sprintf("%s/%s_MBIF.jsonl", workdir, translation.InstallationID)
 	logger.Infof("Transforming Slack archive for Translation %s to MBIF", translation.ID)
+	common.ReportProgress(ctx, model.TranslationPhaseTransform, "Transforming the Slack archive to MBIF with mmetl", 0, 0)
 	err = TransformSlack(
+		ctx,
 		translation,
-		archiveWithFilesName,
+		inputArchiveName,
 		mbifName,
-		attachmentDirName,
+		attachments,
 		workdir,
 		logger,
 	)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to transform Slack archive to MBIF")
+		return "", common.Permanent(errors.Wrap(err, "failed to transform Slack archive to MBIF"))
+	}
+
+	translation.AttachmentReport = attachments.Report()
+
+	err = os.Remove(inputArchiveName)
+	if err != nil {
+		logger.WithError(err).Errorf("failed to remove file %s", inputArchiveName)
+	}
+
+	if err = ctx.Err(); err != nil {
+		return "", err
 	}
 
 	logger.Infof("Preparing Mattermost archive for Translation %s for upload", translation.ID)
-	st.outputZipLocalPath, err = st.createOutputZipfile(logger, attachmentDirName, mbifName, translation.ID)
+	st.outputZipLocalPath, st.outputChecksum, err = st.createOutputZipfile(ctx, logger, attachmentDirName, mbifName, translation.ID)
 	if err != nil {
 		return "", err
 	}
 
+	if err = ctx.Err(); err != nil {
+		return "", err
+	}
+
 	logger.Infof("Uploading Mattermost archive for Translation %s", translation.ID)
-	err = st.uploadTransformedZip(st.outputZipLocalPath, st.bucket)
+	err = st.uploadTransformedZip(ctx, st.outputZipLocalPath)
 	if err != nil {
 		return "", err
 	}
@@ -114,6 +153,11 @@ func (st *SlackTranslator) GetOutputArchiveLocalPath() (string, error) {
 	return st.outputZipLocalPath, nil
 }
 
+// GetOutputArchiveChecksum returns the checksum of the translated archive.
+func (st *SlackTranslator) GetOutputArchiveChecksum() (string, error) {
+	return st.outputChecksum, nil
+}
+
 // Cleanup performs necessary cleanup operations after the translation process.
 func (st *SlackTranslator) Cleanup() error {
 	if st.outputZipLocalPath == "" {
@@ -124,153 +168,181 @@ func (st *SlackTranslator) Cleanup() error {
 }
 
 // fetchSlackArchive is responsible for downloading the input archive
-// from S3 and writing it out to workdir, which is assumed to be of
-// sufficient capacity for the archive
-func (st *SlackTranslator) fetchSlackArchive(logger log.FieldLogger, workdir, resource string) (string, error) {
-
-	downloader := s3manager.NewDownloader(st.s3Client)
+// from the object store and writing it out to workdir, which is
+// assumed to be of sufficient capacity for the archive. Unless checksum
+// is empty, the downloaded archive must have that checksum.
+func (st *SlackTranslator) fetchSlackArchive(ctx context.Context, logger log.FieldLogger, workdir, resource, checksum string) (string, error) {
+	inputArchiveName := workdir + "/input.zip"
 
-	inputArchive, err := os.Create(workdir + "/input.zip")
+	nBytes, err := objectstore.DownloadWithProgress(ctx, st.objectStore, resource, inputArchiveName, checksum)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to open temp file to download input archive to")
+		return "", errors.Wrapf(err, "failed to download %s from bucket %s", resource, st.objectStore.Bucket())
 	}
 
-	nBytes, err := downloader.Download(
-		context.TODO(),
-		inputArchive,
-		&s3.GetObjectInput{
-			Bucket: &st.bucket,
-			Key:    &resource,
-		})
+	logger.Debugf("Successfully downloaded %d bytes from bucket %s key %s",
+		nBytes, st.objectStore.Bucket(), resource)
 
-	if err != nil {
-		return "", errors.Wrapf(err, "failed to download %s from bucket %s", resource, st.bucket)
-	}
+	return inputArchiveName, nil
+}
+
+// fetchAttachedFiles fetches the files attached to the posts of the
+// input archive and extracts the files it holds into attachments. The
+// attached files which could not be fetched are listed in a manifest
+// uploaded to the object store.
+func (st *SlackTranslator) fetchAttachedFiles(ctx context.Context, logger log.FieldLogger, translationID, workdir string, attachments *AttachmentStore, inputArchiveName string) error {
+	logger.Infof("Downloading attached files to %s", attachments.dir)
 
-	err = inputArchive.Close()
+	failed, err := FetchAttachedFiles(ctx, logger, inputArchiveName, attachments, st.fetchOptions)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to close temporary file after writing incoming archive to it")
+		return err
 	}
 
-	logger.Debugf("Successfully downloaded %d bytes from bucket %s key %s",
-		nBytes, st.bucket, resource)
+	report := attachments.Report()
+	logger.Infof("Stored %d attached files as %d unique files of %d bytes, saving %d bytes", report.AttachedFiles, report.UniqueAttachments, report.AttachmentBytes, report.BytesSaved)
 
-	return inputArchive.Name(), nil
-}
-
-// addFilesToSlackArchive prepares the input and fetches attached
-// files, writing the output to workdir and removing the input archive
-// when complete
-func (st *SlackTranslator) addFilesToSlackArchive(logger log.FieldLogger, workdir, attachmentDirName, inputArchiveName string) (string, error) {
-	defer func() {
-		err := os.Remove(inputArchiveName)
+	if len(failed) > 0 {
+		logger.Warnf("Failed to fetch %d attached files, which are left out of the translation", len(failed))
+		err = st.uploadFailedAttachments(workdir, translationID, failed)
 		if err != nil {
-			logger.Errorf("failed to remove file %s", inputArchiveName)
+			return err
 		}
-	}()
+	}
 
-	logger.Infof("Downloading attached files to %s", attachmentDirName)
+	return nil
+}
 
-	withFiles, err := os.Create(workdir + "/inputWithFiles.zip")
+// uploadFailedAttachments uploads the manifest of the attached files
+// which could not be fetched to the object store as
+// <translationID>_failed_attachments.json.
+func (st *SlackTranslator) uploadFailedAttachments(workdir, translationID string, failed []FailedAttachment) error {
+	manifest, err := json.MarshalIndent(failed, "", "  ")
 	if err != nil {
-		return "", errors.Wrap(err, "failed to open temp file to convert input archive to")
+		return errors.Wrap(err, "failed to encode the manifest of failed attachments")
 	}
 
-	err = FetchAttachedFiles(logger, inputArchiveName, withFiles.Name())
+	key := FailedAttachmentsManifestKey(translationID)
+	manifestName := fmt.Sprintf("%s/%s", workdir, key)
+	err = os.WriteFile(manifestName, manifest, 0600)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to fetch attached files")
+		return errors.Wrap(err, "failed to write the manifest of failed attachments")
 	}
 
-	err = os.MkdirAll(attachmentDirName, 0700)
+	err = st.objectStore.Upload(manifestName, key)
 	if err != nil {
-		return "", errors.Wrapf(err, "failed to create attachments directory %s", attachmentDirName)
+		return errors.Wrapf(err, "failed to upload the manifest of failed attachments to bucket %s", st.objectStore.Bucket())
 	}
 
-	return withFiles.Name(), nil
+	return nil
+}
+
+// FailedAttachmentsManifestKey returns the key of the manifest of the
+// attached files of the Translation which could not be fetched.
+func FailedAttachmentsManifestKey(translationID string) string {
+	return translationID + "_failed_attachments.json"
 }
 
 // createOutputZip file compresses the output from the Translate
-// process into a .zip that can be injested by Mattermost
-func (st *SlackTranslator) createOutputZipfile(logger log.FieldLogger, attachmentDirName, mbifName, translationID string) (string, error) {
+// process into a .zip that can be injested by Mattermost, returning
+// its path and its checksum, which is computed while it is written. The
+// bytes of the MBIF and attachments added are reported as progress
+func (st *SlackTranslator) createOutputZipfile(ctx context.Context, logger log.FieldLogger, attachmentDirName, mbifName, translationID string) (string, string, error) {
 	output, err := os.Create(fmt.Sprintf("%s/%s.zip", st.workingDir, translationID))
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	defer output.Close()
 
-	outputZipfile := zip.NewWriter(output)
+	hash := sha256.New()
+	outputZipfile := zip.NewWriter(io.MultiWriter(output, hash))
 	defer outputZipfile.Close()
 
 	mbifInOutputZipfile, err := outputZipfile.Create("MBIF.jsonl")
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	mbifInputFile, err := os.Open(mbifName)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	_, err = io.Copy(mbifInOutputZipfile, mbifInputFile)
+	written, err := io.Copy(mbifInOutputZipfile, mbifInputFile)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	mbifInputFile.Close()
 
-	attachmentFiles, err := ioutil.ReadDir(attachmentDirName)
+	// attached files are stored as <hash>/<name> in the attachments
+	// directory, once for every distinct content
+	var attachmentFiles []string
+	total := written
+	err = filepath.Walk(attachmentDirName, func(localPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			attachmentFiles = append(attachmentFiles, localPath)
+			total += info.Size()
+		}
+		return nil
+	})
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
+	reportArchived := func() {
+		common.ReportProgress(ctx, model.TranslationPhaseArchive,
+			fmt.Sprintf("Added %d of %d bytes to the Mattermost archive", written, total), written, total)
+	}
+	reportArchived()
+
 	for _, attachment := range attachmentFiles {
-		if attachment.IsDir() {
-			continue
-		}
-		attachmentInZipfile, err := outputZipfile.Create(fmt.Sprintf("/data/attachments/%s", attachment.Name()))
+		name, err := filepath.Rel(attachmentDirName, attachment)
 		if err != nil {
-			logger.WithError(err).Error("failed to write attachment")
-			continue
+			return "", "", err
 		}
-		attachmentFile, err := os.Open(fmt.Sprintf("%s/%s", attachmentDirName, attachment.Name()))
+		attachmentInZipfile, err := outputZipfile.Create(path.Join("data", mbif.AttachmentPath(filepath.ToSlash(name))))
 		if err != nil {
-			logger.WithError(err).Errorf("failed to open attachment file %s", attachmentDirName+attachment.Name())
+			logger.WithError(err).Error("failed to write attachment")
 			continue
 		}
-		defer attachmentFile.Close()
-		_, err = io.Copy(attachmentInZipfile, attachmentFile)
+		n, err := copyAttachment(attachmentInZipfile, attachment)
 		if err != nil {
 			logger.
 				WithError(err).
-				Errorf("failed to copy attachment %s", attachment.Name())
+				Errorf("failed to copy attachment %s", name)
 			continue
 		}
+		written += n
+		reportArchived()
+	}
+
+	// the archive must be complete for its checksum to be known
+	err = outputZipfile.Close()
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to finalize output archive")
 	}
 
-	return output.Name(), nil
+	return output.Name(), hex.EncodeToString(hash.Sum(nil)), nil
 }
 
-// uploadTransformedZip uploads the prepared Mattermost-compatible
-// archive to S3 for future import
-func (st *SlackTranslator) uploadTransformedZip(output, bucket string) error {
-	uploader := s3manager.NewUploader(st.s3Client)
-	body, err := os.Open(output)
+// copyAttachment copies the attached file at path to w.
+func copyAttachment(w io.Writer, path string) (int64, error) {
+	attachmentFile, err := os.Open(path)
 	if err != nil {
-		return nil
+		return 0, err
 	}
-	defer body.Close()
+	defer attachmentFile.Close()
 
+	return io.Copy(w, attachmentFile)
+}
+
+// uploadTransformedZip uploads the prepared Mattermost-compatible
+// archive to the object store for future import
+func (st *SlackTranslator) uploadTransformedZip(ctx context.Context, output string) error {
 	outputNameSplitPath := strings.Split(output, "/")
 	outputShortName := outputNameSplitPath[len(outputNameSplitPath)-1]
-	_, err = uploader.Upload(
-		context.TODO(),
-		&s3.PutObjectInput{
-			Bucket: &bucket,
-			Body:   body,
-			Key:    &outputShortName,
-		})
-	if err != nil {
-		return err
-	}
-	return nil
+
+	return objectstore.UploadWithProgress(ctx, st.objectStore, output, outputShortName)
 }
@@ -0,0 +1,127 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package store
+
+import (
+	sq "github.com/Masterminds/squirrel"
+	"github.com/mattermost/awat/model"
+	"github.com/pkg/errors"
+)
+
+var eventSelect sq.SelectBuilder
+
+// EventTableName is the name of the database table used for storing
+// the stream of events.
+var EventTableName = "Event"
+
+func init() {
+	eventSelect = sq.
+		Select(
+			"Sequence",
+			"ID",
+			"Kind",
+			"Type",
+			"ResourceID",
+			"TranslationID",
+			"InstallationID",
+			"OldState",
+			"NewState",
+			"Phase",
+			"Message",
+			"Done",
+			"Total",
+			"Timestamp",
+		).
+		From(EventTableName)
+}
+
+// CreateEvent appends an event to the stream of events.
+func (sqlStore *SQLStore) CreateEvent(event *model.Event) error {
+	return sqlStore.createEvent(sqlStore.db, event)
+}
+
+func (sqlStore *SQLStore) createEvent(e execer, event *model.Event) error {
+	_, err := sqlStore.execBuilder(e, sq.
+		Insert(EventTableName).
+		SetMap(map[string]interface{}{
+			"ID":             event.ID,
+			"Kind":           event.Kind,
+			"Type":           event.Type,
+			"ResourceID":     event.ResourceID,
+			"TranslationID":  event.TranslationID,
+			"InstallationID": event.InstallationID,
+			"OldState":       event.OldState,
+			"NewState":       event.NewState,
+			"Phase":          event.Phase,
+			"Message":        event.Message,
+			"Done":           event.Done,
+			"Total":          event.Total,
+			"Timestamp":      event.Timestamp,
+		}),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s event %s", event.Kind, event.ID)
+	}
+
+	return nil
+}
+
+// GetEvents returns up to limit events matching the filter, in the
+// order they were created.
+func (sqlStore *SQLStore) GetEvents(filter *model.EventFilter, limit uint64) ([]*model.Event, error) {
+	query := eventSelect.
+		Where("Sequence > ?", filter.After).
+		OrderBy("Sequence ASC").
+		Limit(limit)
+	if filter.InstallationID != "" {
+		query = query.Where("InstallationID = ?", filter.InstallationID)
+	}
+	if filter.TranslationID != "" {
+		query = query.Where("TranslationID = ?", filter.TranslationID)
+	}
+	if filter.ImportID != "" {
+		query = query.Where("Type = ?", model.WebhookEventImport).Where("ResourceID = ?", filter.ImportID)
+	}
+
+	events := []*model.Event{}
+	err := sqlStore.selectBuilder(sqlStore.db, &events, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get events")
+	}
+
+	return events, nil
+}
+
+// GetLatestEventSequence returns the Sequence of the latest event, or
+// 0 if there are no events.
+func (sqlStore *SQLStore) GetLatestEventSequence() (int64, error) {
+	var sequence int64
+	err := sqlStore.getBuilder(sqlStore.db, &sequence,
+		sq.Select("COALESCE(MAX(Sequence), 0)").From(EventTableName))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get the latest event")
+	}
+
+	return sequence, nil
+}
+
+// DeleteEventsBefore deletes the events created before the given time
+// and returns how many were deleted.
+func (sqlStore *SQLStore) DeleteEventsBefore(timestamp int64) (int64, error) {
+	result, err := sqlStore.execBuilder(sqlStore.db, sq.
+		Delete(EventTableName).
+		Where("Timestamp < ?", timestamp),
+	)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to delete old events")
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to count deleted events")
+	}
+
+	return deleted, nil
+}
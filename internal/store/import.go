@@ -15,6 +15,10 @@ import (
 // ImportTableName is the name of the database table used for storing import records.
 const ImportTableName = "Import"
 
+// ImportTransitionTableName is the name of the database table
+// recording the state changes of Imports.
+const ImportTransitionTableName = "ImportTransition"
+
 var importSelect sq.SelectBuilder
 
 func init() {
@@ -24,12 +28,17 @@ func init() {
 			"CreateAt",
 			"ID",
 			"LockedBy",
+			"LockExpiresAt",
 			"ImportBy",
+			"ImportByExpiresAt",
 			"StartAt",
 			"TranslationID",
 			"State",
+			"StateChangeAt",
 			"Resource",
 			"Error",
+			"ImportProfile",
+			"InstallationSnapshot",
 		).
 		From(ImportTableName)
 }
@@ -53,13 +62,33 @@ func (sqlStore *SQLStore) GetImport(id string) (*model.Import, error) {
 	return imprt, nil
 }
 
-// GetAllImports returns all of the Imports in the database
-// TODO pagination
-func (sqlStore *SQLStore) GetAllImports() ([]*model.Import, error) {
+// GetImports returns the page of Imports matching the filters of
+// options, in the order they ask for. The type and installation of an
+// Import are those of its Translation.
+func (sqlStore *SQLStore) GetImports(options *model.ListOptions) ([]*model.Import, error) {
+	query := applyListOptions(importSelect, options)
+	if options.State != "" {
+		query = query.Where("State = ?", options.State)
+	}
+	if options.Type != "" || options.InstallationID != "" {
+		translations := sq.Select("ID").From(TranslationTableName)
+		if options.Type != "" {
+			translations = translations.Where("Type = ?", options.Type)
+		}
+		if options.InstallationID != "" {
+			translations = translations.Where("InstallationID = ?", options.InstallationID)
+		}
+		sql, args, err := translations.ToSql()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to build sql")
+		}
+		query = query.Where("TranslationID IN ("+sql+")", args...)
+	}
+
 	imprts := &[]*model.Import{}
-	err := sqlStore.selectBuilder(sqlStore.db, imprts, importSelect)
+	err := sqlStore.selectBuilder(sqlStore.db, imprts, query)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "failed to get imports")
 	}
 
 	return *imprts, nil
@@ -103,12 +132,20 @@ func (sqlStore *SQLStore) GetAndClaimNextReadyImport(provisionerID string) (*mod
 	return imp, nil
 }
 
-// CreateImport stores a new import.
+// CreateImport stores a new import and records its first
+// ImportTransition.
 func (sqlStore *SQLStore) CreateImport(imp *model.Import) error {
 	imp.ID = model.NewID()
 	imp.CreateAt = model.GetMillis()
+	imp.StateChangeAt = imp.CreateAt
 
-	_, err := sqlStore.execBuilder(sqlStore.db, sq.
+	tx, err := sqlStore.beginTransaction(sqlStore.db)
+	if err != nil {
+		return err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	_, err = sqlStore.execBuilder(tx, sq.
 		Insert(ImportTableName).
 		SetMap(map[string]interface{}{
 			"ID":            imp.ID,
@@ -119,16 +156,37 @@ func (sqlStore *SQLStore) CreateImport(imp *model.Import) error {
 			"ImportBy":      imp.ImportBy,
 			"TranslationID": imp.TranslationID,
 			"State":         imp.State,
+			"StateChangeAt": imp.StateChangeAt,
 			"Resource":      imp.Resource,
 			"Error":         imp.Error,
+
+			"ImportProfile":        imp.ImportProfile,
+			"InstallationSnapshot": imp.InstallationSnapshot,
 		}),
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	err = sqlStore.createImportTransition(tx, &model.ImportTransition{
+		ImportID: imp.ID,
+		NewState: imp.State,
+		CreateAt: imp.CreateAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // UpdateImport writes changes to the input Import to the database
 func (sqlStore *SQLStore) UpdateImport(imp *model.Import) error {
-	_, err := sqlStore.execBuilder(sqlStore.db, sq.
+	return sqlStore.updateImport(sqlStore.db, imp)
+}
+
+func (sqlStore *SQLStore) updateImport(e execer, imp *model.Import) error {
+	_, err := sqlStore.execBuilder(e, sq.
 		Update(ImportTableName).
 		SetMap(map[string]interface{}{
 			"CreateAt":      imp.CreateAt,
@@ -139,14 +197,159 @@ func (sqlStore *SQLStore) UpdateImport(imp *model.Import) error {
 			"StartAt":       imp.StartAt,
 			"TranslationID": imp.TranslationID,
 			"State":         imp.State,
+			"StateChangeAt": imp.StateChangeAt,
 			"Resource":      imp.Resource,
 			"Error":         imp.Error,
+
+			"ImportProfile":        imp.ImportProfile,
+			"InstallationSnapshot": imp.InstallationSnapshot,
 		}).
 		Where("ID = ?", imp.ID),
 	)
 	return err
 }
 
+// TransitionImport moves the given Import to state, writing its other
+// changes along, and records the ImportTransition with the state of its
+// Installation and the reason.
+func (sqlStore *SQLStore) TransitionImport(imp *model.Import, state, installationState, reason string) error {
+	tx, err := sqlStore.beginTransaction(sqlStore.db)
+	if err != nil {
+		return err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	transition := &model.ImportTransition{
+		ImportID:          imp.ID,
+		OldState:          imp.State,
+		NewState:          state,
+		InstallationState: installationState,
+		Reason:            reason,
+		CreateAt:          model.GetMillis(),
+	}
+	updated := *imp
+	updated.State = state
+	updated.StateChangeAt = transition.CreateAt
+
+	err = sqlStore.updateImport(tx, &updated)
+	if err != nil {
+		return errors.Wrapf(err, "failed to move Import %s to state %s", imp.ID, state)
+	}
+	err = sqlStore.createImportTransition(tx, transition)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	*imp = updated
+	return nil
+}
+
+// CancelImport moves the given Import to state, provided it is neither
+// locked by a supervisor nor has changed state since it was read, and
+// records the ImportTransition with the reason. It returns false if
+// the Import could not be cancelled.
+func (sqlStore *SQLStore) CancelImport(imp *model.Import, state, reason string) (bool, error) {
+	tx, err := sqlStore.beginTransaction(sqlStore.db)
+	if err != nil {
+		return false, err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	now := model.GetMillis()
+	result, err := sqlStore.execBuilder(
+		tx, sq.
+			Update(ImportTableName).
+			SetMap(map[string]interface{}{
+				"State":         state,
+				"StateChangeAt": now,
+			}).
+			Where("ID = ?", imp.ID).
+			Where("State = ?", imp.State).
+			Where("LockedBy = ?", ""),
+	)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to cancel Import %s", imp.ID)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to cancel Import %s", imp.ID)
+	}
+	if rows != 1 {
+		return false, nil
+	}
+
+	err = sqlStore.createImportTransition(tx, &model.ImportTransition{
+		ImportID: imp.ID,
+		OldState: imp.State,
+		NewState: state,
+		Reason:   reason,
+		CreateAt: now,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+
+	imp.State = state
+	imp.StateChangeAt = now
+	return true, nil
+}
+
+func (sqlStore *SQLStore) createImportTransition(e execer, transition *model.ImportTransition) error {
+	transition.ID = model.NewID()
+	_, err := sqlStore.execBuilder(e, sq.
+		Insert(ImportTransitionTableName).
+		SetMap(map[string]interface{}{
+			"ID":                transition.ID,
+			"ImportID":          transition.ImportID,
+			"OldState":          transition.OldState,
+			"NewState":          transition.NewState,
+			"InstallationState": transition.InstallationState,
+			"Reason":            transition.Reason,
+			"CreateAt":          transition.CreateAt,
+		}),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to record transition of Import %s", transition.ImportID)
+	}
+
+	return nil
+}
+
+// GetImportTransitions returns the ImportTransitions of the Import with
+// the given ID, oldest first.
+func (sqlStore *SQLStore) GetImportTransitions(importID string) ([]*model.ImportTransition, error) {
+	transitions := []*model.ImportTransition{}
+	err := sqlStore.selectBuilder(sqlStore.db, &transitions, sq.
+		Select(
+			"ID",
+			"ImportID",
+			"OldState",
+			"NewState",
+			"InstallationState",
+			"Reason",
+			"CreateAt",
+		).
+		From(ImportTransitionTableName).
+		Where("ImportID = ?", importID).
+		OrderBy("CreateAt ASC"),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get transitions of Import %s", importID)
+	}
+
+	return transitions, nil
+}
+
 // GetImportsByInstallation provides a convenience function for
 // looking up all Imports that belong to a given Installation
 func (sqlStore *SQLStore) GetImportsByInstallation(id string) ([]*model.Import, error) {
@@ -217,16 +420,20 @@ func (sqlStore *SQLStore) GetUnlockedImportPendingWork() ([]*model.Import, error
 }
 
 // TryLockImport attempts to lock the input Import with the given
-// owner, but will not do so if the column already contains something,
-// and will return an error instead in that case
+// owner with a lease of LockLease, but will not do so if the column
+// already contains something, and will return an error instead in that
+// case
 func (sqlStore *SQLStore) TryLockImport(imp *model.Import, owner string) error {
 	sqlStore.logger.Infof("Locking Import %s as %s", imp.ID, owner)
-	imp.LockedBy = owner
+	expiresAt := leaseExpiry(LockLease)
 
 	result, err := sqlStore.execBuilder(
 		sqlStore.db, sq.
 			Update(ImportTableName).
-			SetMap(map[string]interface{}{"LockedBy": owner}).
+			SetMap(map[string]interface{}{
+				"LockedBy":      owner,
+				"LockExpiresAt": expiresAt,
+			}).
 			Where("ID = ?", imp.ID).
 			Where("LockedBy = ?", ""),
 	)
@@ -235,20 +442,50 @@ func (sqlStore *SQLStore) TryLockImport(imp *model.Import, owner string) error {
 	}
 	if rows, err := result.RowsAffected(); rows != 1 || err != nil {
 		if err != nil {
-			return errors.Wrapf(err, "wrong number of rows while trying to unlock %s", imp.ID)
+			return errors.Wrapf(err, "wrong number of rows while trying to lock %s", imp.ID)
 		}
-		return errors.Errorf("wrong number of rows while trying to unlock %s", imp.ID)
+		return errors.Errorf("wrong number of rows while trying to lock %s", imp.ID)
 	}
+
+	imp.LockedBy = owner
+	imp.LockExpiresAt = expiresAt
 	return nil
 }
 
-// UnlockImport clears the lock for the given Import
+// RenewImportLock extends the lease of the lock the owner holds on the
+// Import with the given ID by LockLease. It returns false if the owner
+// no longer holds the lock.
+func (sqlStore *SQLStore) RenewImportLock(id, owner string) (bool, error) {
+	result, err := sqlStore.execBuilder(
+		sqlStore.db, sq.
+			Update(ImportTableName).
+			SetMap(map[string]interface{}{"LockExpiresAt": leaseExpiry(LockLease)}).
+			Where("ID = ?", id).
+			Where("LockedBy = ?", owner),
+	)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to renew lock on Import %s", id)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to renew lock on Import %s", id)
+	}
+
+	return rows == 1, nil
+}
+
+// UnlockImport clears the lock for the given Import, unless it has
+// passed to another owner in the meantime
 func (sqlStore *SQLStore) UnlockImport(imp *model.Import) error {
 	_, err := sqlStore.execBuilder(
 		sqlStore.db, sq.
 			Update(ImportTableName).
-			SetMap(map[string]interface{}{"LockedBy": ""}).
-			Where("ID = ?", imp.ID),
+			SetMap(map[string]interface{}{
+				"LockedBy":      "",
+				"LockExpiresAt": 0,
+			}).
+			Where("ID = ?", imp.ID).
+			Where("LockedBy = ?", imp.LockedBy),
 	)
 	if err != nil {
 		return errors.Wrapf(err, "failed to unlock Import %s", imp.ID)
@@ -257,16 +494,20 @@ func (sqlStore *SQLStore) UnlockImport(imp *model.Import) error {
 }
 
 // tryLockImportByProvisioner attempts to lock the input Import with the given
-// owner, but will not do so if the column already contains something,
-// and will return an error instead in that case
+// owner with a lease of ImportClaimLease, but will not do so if the
+// column already contains something, and will return an error instead
+// in that case
 func (sqlStore *SQLStore) tryLockImportByProvisioner(imp *model.Import, owner string) error {
 	sqlStore.logger.Infof("Locking Import %s by %s", imp.ID, owner)
-	imp.ImportBy = owner
+	expiresAt := leaseExpiry(ImportClaimLease)
 
 	result, err := sqlStore.execBuilder(
 		sqlStore.db, sq.
 			Update(ImportTableName).
-			SetMap(map[string]interface{}{"ImportBy": owner}).
+			SetMap(map[string]interface{}{
+				"ImportBy":          owner,
+				"ImportByExpiresAt": expiresAt,
+			}).
 			Where("ID = ?", imp.ID).
 			Where("ImportBy = ?", ""),
 	)
@@ -275,9 +516,106 @@ func (sqlStore *SQLStore) tryLockImportByProvisioner(imp *model.Import, owner st
 	}
 	if rows, err := result.RowsAffected(); rows != 1 || err != nil {
 		if err != nil {
-			return errors.Wrapf(err, "wrong number of rows while trying to unlock %s", imp.ID)
+			return errors.Wrapf(err, "wrong number of rows while trying to lock %s", imp.ID)
 		}
-		return errors.Errorf("wrong number of rows while trying to unlock %s", imp.ID)
+		return errors.Errorf("wrong number of rows while trying to lock %s", imp.ID)
 	}
+
+	imp.ImportBy = owner
+	imp.ImportByExpiresAt = expiresAt
 	return nil
 }
+
+// RenewImportClaim extends the lease of the claim the Provisioner with
+// the given ID holds on the Import by ImportClaimLease. It returns
+// false if the Provisioner no longer holds the claim.
+func (sqlStore *SQLStore) RenewImportClaim(id, provisionerID string) (bool, error) {
+	result, err := sqlStore.execBuilder(
+		sqlStore.db, sq.
+			Update(ImportTableName).
+			SetMap(map[string]interface{}{"ImportByExpiresAt": leaseExpiry(ImportClaimLease)}).
+			Where("ID = ?", id).
+			Where("ImportBy = ?", provisionerID),
+	)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to renew claim on Import %s", id)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to renew claim on Import %s", id)
+	}
+
+	return rows == 1, nil
+}
+
+// GetImportsWithExpiredLocks returns the Imports whose lock or claim by
+// a Provisioner has a lease which expired before now.
+func (sqlStore *SQLStore) GetImportsWithExpiredLocks(now int64) ([]*model.Import, error) {
+	var imports []*model.Import
+	err := sqlStore.selectBuilder(sqlStore.db, &imports,
+		importSelect.
+			Where(sq.Or{
+				sq.And{sq.NotEq{"LockedBy": ""}, sq.Lt{"LockExpiresAt": now}},
+				sq.And{sq.NotEq{"ImportBy": ""}, sq.Lt{"ImportByExpiresAt": now}},
+			}),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query for imports with expired locks")
+	}
+
+	return imports, nil
+}
+
+// ReleaseImportLock clears the lock on the given Import on behalf of
+// its owner and records a LockEvent with the reason. It returns false
+// if the lock changed since the Import was read.
+func (sqlStore *SQLStore) ReleaseImportLock(imp *model.Import, reason string) (bool, error) {
+	released, err := sqlStore.releaseLock(lockRelease{
+		table:      ImportTableName,
+		resource:   model.LockResourceImport,
+		resourceID: imp.ID,
+		lock:       model.LockLockedBy,
+		owner:      imp.LockedBy,
+		expiresAt:  imp.LockExpiresAt,
+		reason:     reason,
+	})
+	if err != nil || !released {
+		return released, err
+	}
+
+	imp.LockedBy = ""
+	imp.LockExpiresAt = 0
+	return true, nil
+}
+
+// ReleaseImportClaim clears the claim of a Provisioner on the given
+// Import on behalf of the Provisioner and records a LockEvent with the
+// reason. An Import which has not completed yet is made available to
+// be claimed again. It returns false if the claim changed since the
+// Import was read.
+func (sqlStore *SQLStore) ReleaseImportClaim(imp *model.Import, reason string) (bool, error) {
+	release := lockRelease{
+		table:      ImportTableName,
+		resource:   model.LockResourceImport,
+		resourceID: imp.ID,
+		lock:       model.LockImportBy,
+		owner:      imp.ImportBy,
+		expiresAt:  imp.ImportByExpiresAt,
+		reason:     reason,
+	}
+	if imp.CompleteAt == 0 {
+		release.set = map[string]interface{}{"StartAt": 0}
+	}
+
+	released, err := sqlStore.releaseLock(release)
+	if err != nil || !released {
+		return released, err
+	}
+
+	imp.ImportBy = ""
+	imp.ImportByExpiresAt = 0
+	if imp.CompleteAt == 0 {
+		imp.StartAt = 0
+	}
+	return true, nil
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package store
+
+import (
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/mattermost/awat/model"
+	"github.com/pkg/errors"
+)
+
+// sortColumns maps the fields lists may be sorted by to their columns.
+var sortColumns = map[string]string{
+	model.SortByCreateAt:   "CreateAt",
+	model.SortByCompleteAt: "CompleteAt",
+}
+
+// applyListOptions applies the creation time filters, the sort order
+// and the paging of the ListOptions to a query of a table with CreateAt
+// and CompleteAt columns. The other filters are left to the caller.
+func applyListOptions(query sq.SelectBuilder, options *model.ListOptions) sq.SelectBuilder {
+	if options.CreatedAfter != 0 {
+		query = query.Where("CreateAt > ?", options.CreatedAfter)
+	}
+	if options.CreatedBefore != 0 {
+		query = query.Where("CreateAt < ?", options.CreatedBefore)
+	}
+
+	column, ok := sortColumns[options.SortBy]
+	if !ok {
+		column = sortColumns[model.SortByCreateAt]
+	}
+	order := "ASC"
+	if options.SortOrder == model.SortDescending {
+		order = "DESC"
+	}
+	// The ID breaks ties, so that pages neither overlap nor skip
+	// items.
+	query = query.OrderBy(fmt.Sprintf("%s %s", column, order), fmt.Sprintf("ID %s", order))
+
+	if options.PerPage != model.AllPerPage {
+		query = query.
+			Limit(uint64(options.PerPage)).
+			Offset(uint64(options.Page * options.PerPage))
+	}
+
+	return query
+}
+
+// translationStateCondition returns the condition matching the
+// Translations in the given state, as told by model.Translation.State.
+func translationStateCondition(state string) (sq.Sqlizer, error) {
+	switch state {
+	case model.TranslationStateCancelled:
+		return sq.NotEq{"CancelAt": 0}, nil
+	case model.TranslationStateFailed:
+		return sq.And{sq.Eq{"CancelAt": 0}, sq.NotEq{"FailAt": 0}}, nil
+	case model.TranslationStateRequested:
+		return sq.Eq{"CancelAt": 0, "FailAt": 0, "StartAt": 0}, nil
+	case model.TranslationStateInProgress:
+		return sq.And{sq.Eq{"CancelAt": 0, "FailAt": 0, "CompleteAt": 0}, sq.NotEq{"StartAt": 0}}, nil
+	case model.TranslationStateComplete:
+		return sq.And{sq.Eq{"CancelAt": 0, "FailAt": 0}, sq.NotEq{"StartAt": 0, "CompleteAt": 0}}, nil
+	default:
+		return nil, errors.Errorf("unknown translation state %q", state)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package store
+
+import (
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/mattermost/awat/model"
+	"github.com/pkg/errors"
+)
+
+// LockEventTableName is the name of the database table recording
+// released locks.
+const LockEventTableName = "LockEvent"
+
+// LockLease is how long a lock taken by a supervisor stays valid
+// without being renewed.
+const LockLease = 2 * time.Minute
+
+// ImportClaimLease is how long the claim of a Provisioner on an Import
+// stays valid without being renewed. It is longer than LockLease as
+// the Provisioner only renews its claim now and then, and the import
+// supervisor renews it while the Installation is busy importing.
+const ImportClaimLease = time.Hour
+
+// lockRelease describes the release of a lock on behalf of its owner.
+type lockRelease struct {
+	table      string
+	resource   string
+	resourceID string
+	lock       string
+	owner      string
+	expiresAt  int64
+	reason     string
+	// set holds the columns to update in addition to clearing the
+	// lock and its expiry.
+	set map[string]interface{}
+}
+
+// releaseLock clears the lock described by release and records a
+// LockEvent for it, provided the lock is still held by the same owner
+// with the same expiry, so that a lease renewed in the meantime is not
+// released. It returns false if the lock changed.
+func (sqlStore *SQLStore) releaseLock(release lockRelease) (bool, error) {
+	tx, err := sqlStore.beginTransaction(sqlStore.db)
+	if err != nil {
+		return false, err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	expiresColumn := "LockExpiresAt"
+	if release.lock == model.LockImportBy {
+		expiresColumn = "ImportByExpiresAt"
+	}
+
+	set := map[string]interface{}{
+		release.lock:  "",
+		expiresColumn: 0,
+	}
+	for column, value := range release.set {
+		set[column] = value
+	}
+
+	result, err := sqlStore.execBuilder(tx, sq.
+		Update(release.table).
+		SetMap(set).
+		Where("ID = ?", release.resourceID).
+		Where(release.lock+" = ?", release.owner).
+		Where(expiresColumn+" = ?", release.expiresAt),
+	)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to release %s of %s %s", release.lock, release.resource, release.resourceID)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to release %s of %s %s", release.lock, release.resource, release.resourceID)
+	}
+	if rows != 1 {
+		return false, nil
+	}
+
+	_, err = sqlStore.execBuilder(tx, sq.
+		Insert(LockEventTableName).
+		SetMap(map[string]interface{}{
+			"ID":         model.NewID(),
+			"CreateAt":   model.GetMillis(),
+			"Resource":   release.resource,
+			"ResourceID": release.resourceID,
+			"Lock":       release.lock,
+			"Owner":      release.owner,
+			"Reason":     release.reason,
+		}),
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to record lock event")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// leaseExpiry returns when a lease of the given duration taken now
+// expires.
+func leaseExpiry(lease time.Duration) int64 {
+	return model.GetMillis() + lease.Milliseconds()
+}
@@ -126,4 +126,316 @@ var migrations = []migration{
 			return nil
 		},
 	},
+	// Add Translation.CancelAt column so Translations can be cancelled
+	{semver.MustParse("0.5.0"), semver.MustParse("0.6.0"),
+		func(e execer) error {
+			_, err := e.Exec(`ALTER TABLE Translation ADD COLUMN CancelAt BigInt NOT NULL DEFAULT 0`)
+			return err
+		},
+	},
+	// Make Translation.Error usable and add the columns tracking failed
+	// and retried Translations
+	{semver.MustParse("0.6.0"), semver.MustParse("0.7.0"),
+		func(e execer) error {
+			_, err := e.Exec(`UPDATE Translation SET Error = '' WHERE Error IS NULL`)
+			if err != nil {
+				return err
+			}
+
+			_, err = e.Exec(`
+				ALTER TABLE Translation
+				    ALTER COLUMN Error SET DEFAULT '',
+				    ALTER COLUMN Error SET NOT NULL,
+				    ADD COLUMN FailAt BigInt NOT NULL DEFAULT 0,
+				    ADD COLUMN RetryAt BigInt NOT NULL DEFAULT 0,
+				    ADD COLUMN Attempts Integer NOT NULL DEFAULT 0;
+		`)
+			return err
+		},
+	},
+	// Add lock leases and the LockEvent table recording released locks
+	{semver.MustParse("0.7.0"), semver.MustParse("0.8.0"),
+		func(e execer) error {
+			_, err := e.Exec(`ALTER TABLE Translation ADD COLUMN LockExpiresAt BigInt NOT NULL DEFAULT 0`)
+			if err != nil {
+				return err
+			}
+
+			_, err = e.Exec(`
+				ALTER TABLE Import
+				    ADD COLUMN LockExpiresAt BigInt NOT NULL DEFAULT 0,
+				    ADD COLUMN ImportByExpiresAt BigInt NOT NULL DEFAULT 0;
+		`)
+			if err != nil {
+				return err
+			}
+
+			_, err = e.Exec(`
+				CREATE TABLE LockEvent (
+						ID          TEXT PRIMARY KEY NOT NULL,
+						CreateAt    BigInt NOT NULL,
+						Resource    TEXT NOT NULL,
+						ResourceID  TEXT NOT NULL,
+						Lock        TEXT NOT NULL,
+						Owner       TEXT NOT NULL,
+						Reason      TEXT NOT NULL
+				);
+		`)
+			return err
+		},
+	},
+	// Add Upload.Validation column holding the validation report of
+	// an upload as JSON
+	{semver.MustParse("0.8.0"), semver.MustParse("0.9.0"),
+		func(e execer) error {
+			_, err := e.Exec(`ALTER TABLE Upload ADD COLUMN Validation TEXT NULL DEFAULT NULL`)
+			return err
+		},
+	},
+	// Add the UploadSession and UploadPart tables tracking archives
+	// uploaded in chunks
+	{semver.MustParse("0.9.0"), semver.MustParse("0.10.0"),
+		func(e execer) error {
+			_, err := e.Exec(`
+				CREATE TABLE UploadSession (
+						ID          TEXT PRIMARY KEY NOT NULL,
+						Type        TEXT NOT NULL,
+						Size        BigInt NOT NULL,
+						ChunkSize   BigInt NOT NULL,
+						MultipartID TEXT NOT NULL,
+						CreateAt    BigInt NOT NULL,
+						CompleteAt  BigInt NOT NULL DEFAULT 0
+				);
+		`)
+			if err != nil {
+				return err
+			}
+
+			_, err = e.Exec(`
+				CREATE TABLE UploadPart (
+						UploadID    TEXT NOT NULL,
+						Number      Integer NOT NULL,
+						Size        BigInt NOT NULL,
+						Checksum    TEXT NOT NULL,
+						ETag        TEXT NOT NULL,
+						CreateAt    BigInt NOT NULL,
+						PRIMARY KEY (UploadID, Number)
+				);
+		`)
+			return err
+		},
+	},
+	// Add the columns of UploadSessions uploaded straight to the bucket
+	{semver.MustParse("0.10.0"), semver.MustParse("0.11.0"),
+		func(e execer) error {
+			_, err := e.Exec(`
+				ALTER TABLE UploadSession
+				    ADD COLUMN Presigned Boolean NOT NULL DEFAULT false,
+				    ADD COLUMN Checksum TEXT NOT NULL DEFAULT '',
+				    ADD COLUMN ValidateArchive Boolean NOT NULL DEFAULT false;
+		`)
+			return err
+		},
+	},
+	// Add the checksums of uploads and of the inputs and outputs of
+	// Translations
+	{semver.MustParse("0.11.0"), semver.MustParse("0.12.0"),
+		func(e execer) error {
+			_, err := e.Exec(`
+				ALTER TABLE Upload
+				    ADD COLUMN Checksum TEXT NOT NULL DEFAULT '';
+		`)
+			if err != nil {
+				return err
+			}
+
+			_, err = e.Exec(`
+				ALTER TABLE Translation
+				    ADD COLUMN InputChecksum TEXT NOT NULL DEFAULT '',
+				    ADD COLUMN OutputChecksum TEXT NOT NULL DEFAULT '';
+		`)
+			return err
+		},
+	},
+	// Add the webhooks notified of state changes and the log of the
+	// deliveries of events to them
+	{semver.MustParse("0.12.0"), semver.MustParse("0.13.0"),
+		func(e execer) error {
+			_, err := e.Exec(`
+				CREATE TABLE Webhook (
+						ID        TEXT PRIMARY KEY NOT NULL,
+						URL       TEXT NOT NULL,
+						Secret    TEXT NOT NULL,
+						CreateAt  BigInt NOT NULL,
+						DeleteAt  BigInt NOT NULL
+				);
+		`)
+			if err != nil {
+				return err
+			}
+
+			_, err = e.Exec(`
+				CREATE TABLE WebhookDelivery (
+						WebhookID      TEXT NOT NULL REFERENCES Webhook(ID),
+						EventID        TEXT NOT NULL,
+						Payload        TEXT NOT NULL,
+						Attempts       Integer NOT NULL,
+						StatusCode     Integer NOT NULL,
+						Error          TEXT NOT NULL,
+						CreateAt       BigInt NOT NULL,
+						NextAttemptAt  BigInt NOT NULL,
+						DeliveredAt    BigInt NOT NULL,
+						FailAt         BigInt NOT NULL,
+						PRIMARY KEY (WebhookID, EventID)
+				);
+		`)
+			return err
+		},
+	},
+	// Add the stream of state changes and progress of Translations and
+	// Imports
+	{semver.MustParse("0.13.0"), semver.MustParse("0.14.0"),
+		func(e execer) error {
+			_, err := e.Exec(`
+				CREATE TABLE Event (
+						Sequence        BIGSERIAL PRIMARY KEY,
+						ID              TEXT NOT NULL,
+						Kind            TEXT NOT NULL,
+						Type            TEXT NOT NULL,
+						ResourceID      TEXT NOT NULL,
+						TranslationID   TEXT NOT NULL,
+						InstallationID  TEXT NOT NULL,
+						OldState        TEXT NOT NULL,
+						NewState        TEXT NOT NULL,
+						Phase           TEXT NOT NULL,
+						Message         TEXT NOT NULL,
+						Done            BigInt NOT NULL,
+						Total           BigInt NOT NULL,
+						Timestamp       BigInt NOT NULL
+				);
+		`)
+			if err != nil {
+				return err
+			}
+
+			_, err = e.Exec(`
+				CREATE INDEX Event_Timestamp ON Event (Timestamp);
+		`)
+			return err
+		},
+	},
+	// Add the progress of Translations
+	{semver.MustParse("0.14.0"), semver.MustParse("0.15.0"),
+		func(e execer) error {
+			_, err := e.Exec(`
+				ALTER TABLE Translation
+				    ADD COLUMN Phase TEXT NOT NULL DEFAULT '',
+				    ADD COLUMN PhaseStartAt BIGINT NOT NULL DEFAULT 0,
+				    ADD COLUMN FilesDone BIGINT NOT NULL DEFAULT 0,
+				    ADD COLUMN FilesTotal BIGINT NOT NULL DEFAULT 0,
+				    ADD COLUMN BytesDone BIGINT NOT NULL DEFAULT 0,
+				    ADD COLUMN BytesTotal BIGINT NOT NULL DEFAULT 0,
+				    ADD COLUMN PostsDone BIGINT NOT NULL DEFAULT 0,
+				    ADD COLUMN PostsTotal BIGINT NOT NULL DEFAULT 0,
+				    ADD COLUMN ProgressAt BIGINT NOT NULL DEFAULT 0;
+		`)
+			return err
+		},
+	},
+	// Add the encrypted Slack token of Translations
+	{semver.MustParse("0.15.0"), semver.MustParse("0.16.0"),
+		func(e execer) error {
+			_, err := e.Exec(`
+				ALTER TABLE Translation
+				    ADD COLUMN SlackToken TEXT NOT NULL DEFAULT '';
+		`)
+			return err
+		},
+	},
+	// Add the attachment deduplication statistics of Translations
+	{semver.MustParse("0.16.0"), semver.MustParse("0.17.0"),
+		func(e execer) error {
+			_, err := e.Exec(`
+				ALTER TABLE Translation
+				    ADD COLUMN AttachedFiles INTEGER NOT NULL DEFAULT 0,
+				    ADD COLUMN UniqueAttachments INTEGER NOT NULL DEFAULT 0,
+				    ADD COLUMN AttachmentBytes BIGINT NOT NULL DEFAULT 0,
+				    ADD COLUMN BytesSaved BIGINT NOT NULL DEFAULT 0;
+		`)
+			return err
+		},
+	},
+	// Add the time Imports changed state, from which their deadlines
+	// are counted, and the ImportTransition table recording the state
+	// changes. Imports pending work get their full deadline from now.
+	{semver.MustParse("0.17.0"), semver.MustParse("0.18.0"),
+		func(e execer) error {
+			_, err := e.Exec(`
+				ALTER TABLE Import
+				    ADD COLUMN StateChangeAt BIGINT NOT NULL DEFAULT 0;
+
+				UPDATE Import SET StateChangeAt = (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT;
+		`)
+			if err != nil {
+				return err
+			}
+
+			_, err = e.Exec(`
+				CREATE TABLE ImportTransition (
+						ID                 TEXT PRIMARY KEY NOT NULL,
+						ImportID           TEXT NOT NULL,
+						OldState           TEXT NOT NULL,
+						NewState           TEXT NOT NULL,
+						InstallationState  TEXT NOT NULL,
+						Reason             TEXT NOT NULL,
+						CreateAt           BigInt NOT NULL
+				);
+		`)
+			if err != nil {
+				return err
+			}
+
+			_, err = e.Exec(`
+				CREATE INDEX ImportTransition_ImportID ON ImportTransition (ImportID);
+		`)
+			return err
+		},
+	},
+	// Add the ImportProfile requested for a Translation, and the
+	// ImportProfile and original configuration of the Installation
+	// recorded when an Import adjusts it.
+	{semver.MustParse("0.18.0"), semver.MustParse("0.19.0"),
+		func(e execer) error {
+			_, err := e.Exec(`ALTER TABLE Translation ADD COLUMN ImportProfile TEXT NULL DEFAULT NULL`)
+			if err != nil {
+				return err
+			}
+
+			_, err = e.Exec(`
+				ALTER TABLE Import
+				    ADD COLUMN ImportProfile TEXT NULL DEFAULT NULL,
+				    ADD COLUMN InstallationSnapshot TEXT NULL DEFAULT NULL;
+		`)
+			return err
+		},
+	},
+	// Add the time the archive of a completed upload session is due to
+	// be verified, so that verifying it survives restarts, and the hash
+	// of the part of the archive received so far.
+	{semver.MustParse("0.19.0"), semver.MustParse("0.20.0"),
+		func(e execer) error {
+			_, err := e.Exec(`
+				ALTER TABLE UploadSession
+				    ADD COLUMN VerifyAt BIGINT NOT NULL DEFAULT 0,
+				    ADD COLUMN HashState BYTEA NULL DEFAULT NULL,
+				    ADD COLUMN HashedSize BIGINT NOT NULL DEFAULT 0;
+		`)
+			if err != nil {
+				return err
+			}
+
+			_, err = e.Exec(`CREATE INDEX UploadSession_VerifyAt ON UploadSession (VerifyAt) WHERE VerifyAt > 0`)
+			return err
+		},
+	},
 }
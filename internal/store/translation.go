@@ -20,16 +20,39 @@ var translationSelect sq.SelectBuilder
 func init() {
 	translationSelect = sq.
 		Select(
+			"Attempts",
+			"CancelAt",
 			"CompleteAt",
 			"CreateAt",
+			"Error",
+			"FailAt",
+			"RetryAt",
 			"StartAt",
 			"ID",
 			"InstallationID",
 			"LockedBy",
+			"LockExpiresAt",
 			"Resource",
 			"Team",
 			"Users",
 			"Type",
+			"InputChecksum",
+			"OutputChecksum",
+			"SlackToken",
+			"Phase",
+			"PhaseStartAt",
+			"FilesDone",
+			"FilesTotal",
+			"BytesDone",
+			"BytesTotal",
+			"PostsDone",
+			"PostsTotal",
+			"ProgressAt",
+			"AttachedFiles",
+			"UniqueAttachments",
+			"AttachmentBytes",
+			"BytesSaved",
+			"ImportProfile",
 		).
 		From(TranslationTableName)
 }
@@ -54,13 +77,28 @@ func (sqlStore *SQLStore) GetTranslation(id string) (*model.Translation, error)
 
 }
 
-// GetAllTranslations returns every Translation in the DB
-// TODO pagination
-func (sqlStore *SQLStore) GetAllTranslations() ([]*model.Translation, error) {
+// GetTranslations returns the page of Translations matching the
+// filters of options, in the order they ask for
+func (sqlStore *SQLStore) GetTranslations(options *model.ListOptions) ([]*model.Translation, error) {
+	query := applyListOptions(translationSelect, options)
+	if options.State != "" {
+		condition, err := translationStateCondition(options.State)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(condition)
+	}
+	if options.Type != "" {
+		query = query.Where("Type = ?", options.Type)
+	}
+	if options.InstallationID != "" {
+		query = query.Where("InstallationID = ?", options.InstallationID)
+	}
+
 	translations := &[]*model.Translation{}
-	err := sqlStore.selectBuilder(sqlStore.db, translations, translationSelect)
+	err := sqlStore.selectBuilder(sqlStore.db, translations, query)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "failed to get translations")
 	}
 
 	return *translations, nil
@@ -87,14 +125,17 @@ func (sqlStore *SQLStore) GetTranslationsByInstallation(id string) ([]*model.Tra
 	return *translations, nil
 }
 
-// GetTranslationReadyToStart returns a batch of Translations that
-// are ready to go, with a maximum of ten, sorted from oldest to
-// newest
+// GetTranslationReadyToStart returns the oldest Translation that is
+// ready to go, skipping those waiting for their next attempt after a
+// failure
 func (sqlStore *SQLStore) GetTranslationReadyToStart() (*model.Translation, error) {
 	translations := []*model.Translation{}
 	err := sqlStore.selectBuilder(sqlStore.db, &translations,
 		translationSelect.
 			Where("StartAt = 0").
+			Where("CancelAt = 0").
+			Where("FailAt = 0").
+			Where("RetryAt <= ?", model.GetMillis()).
 			Where("LockedBy = ''").
 			OrderBy("CreateAt ASC").
 			Limit(1),
@@ -123,6 +164,11 @@ func (sqlStore *SQLStore) CreateTranslation(translation *model.Translation) erro
 			"CreateAt":       translation.CreateAt,
 			"StartAt":        translation.StartAt,
 			"CompleteAt":     translation.CompleteAt,
+			"CancelAt":       translation.CancelAt,
+			"FailAt":         translation.FailAt,
+			"RetryAt":        translation.RetryAt,
+			"Attempts":       translation.Attempts,
+			"Error":          translation.Error,
 			"InstallationID": translation.InstallationID,
 			"LockedBy":       translation.LockedBy,
 			"Resource":       translation.Resource,
@@ -130,12 +176,20 @@ func (sqlStore *SQLStore) CreateTranslation(translation *model.Translation) erro
 			"Users":          translation.Users,
 			"Type":           translation.Type,
 			"UploadID":       translation.UploadID,
+			"InputChecksum":  translation.InputChecksum,
+			"OutputChecksum": translation.OutputChecksum,
+			"SlackToken":     translation.SlackToken,
+			"ImportProfile":  translation.ImportProfile,
 		}),
 	)
 	return err
 }
 
-// UpdateTranslation stores changes to the provided translation in the database.
+// UpdateTranslation stores changes to the provided translation in the
+// database. CancelAt is left alone so that a cancellation is never
+// undone by the worker of a running Translation; use CancelTranslation
+// to set it. The lock is left alone as well, as it is managed by
+// TryLockTranslation and UnlockTranslation.
 func (sqlStore *SQLStore) UpdateTranslation(translation *model.Translation) error {
 	_, err := sqlStore.execBuilder(sqlStore.db, sq.
 		Update(TranslationTableName).
@@ -143,28 +197,154 @@ func (sqlStore *SQLStore) UpdateTranslation(translation *model.Translation) erro
 			"CompleteAt":     translation.CompleteAt,
 			"CreateAt":       translation.CreateAt,
 			"StartAt":        translation.StartAt,
+			"FailAt":         translation.FailAt,
+			"RetryAt":        translation.RetryAt,
+			"Attempts":       translation.Attempts,
+			"Error":          translation.Error,
 			"ID":             translation.ID,
 			"InstallationID": translation.InstallationID,
-			"LockedBy":       translation.LockedBy,
 			"Resource":       translation.Resource,
 			"Team":           translation.Team,
 			"Users":          translation.Users,
 			"Type":           translation.Type,
+			"OutputChecksum": translation.OutputChecksum,
+
+			"AttachedFiles":     translation.AttachedFiles,
+			"UniqueAttachments": translation.UniqueAttachments,
+			"AttachmentBytes":   translation.AttachmentBytes,
+			"BytesSaved":        translation.BytesSaved,
 		}).Where("ID = ?", translation.ID),
 	)
 	return err
 }
 
+// UpdateTranslationProgress stores how far along the running
+// Translation with the given ID got. Nothing else about the Translation
+// is changed, so that progress may be recorded while the Translation is
+// updated otherwise.
+func (sqlStore *SQLStore) UpdateTranslationProgress(id string, progress *model.TranslationProgress) error {
+	_, err := sqlStore.execBuilder(sqlStore.db, sq.
+		Update(TranslationTableName).
+		SetMap(map[string]interface{}{
+			"Phase":        progress.Phase,
+			"PhaseStartAt": progress.PhaseStartAt,
+			"FilesDone":    progress.FilesDone,
+			"FilesTotal":   progress.FilesTotal,
+			"BytesDone":    progress.BytesDone,
+			"BytesTotal":   progress.BytesTotal,
+			"PostsDone":    progress.PostsDone,
+			"PostsTotal":   progress.PostsTotal,
+			"ProgressAt":   progress.ProgressAt,
+		}).Where("ID = ?", id),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to update progress of translation %s", id)
+	}
+
+	return nil
+}
+
+// DeleteTranslationSlackToken deletes the Slack token of the
+// Translation with the given ID, which is no longer needed once the
+// Translation completed.
+func (sqlStore *SQLStore) DeleteTranslationSlackToken(id string) error {
+	_, err := sqlStore.execBuilder(sqlStore.db, sq.
+		Update(TranslationTableName).
+		Set("SlackToken", "").
+		Where("ID = ?", id),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to delete the Slack token of Translation %s", id)
+	}
+
+	return nil
+}
+
+// CancelTranslation marks the given translation as cancelled unless it
+// has completed, failed or been cancelled already, in which case it
+// returns false. The Slack token of the translation is deleted.
+func (sqlStore *SQLStore) CancelTranslation(translation *model.Translation) (bool, error) {
+	cancelAt := model.GetMillis()
+
+	result, err := sqlStore.execBuilder(
+		sqlStore.db, sq.
+			Update(TranslationTableName).
+			SetMap(map[string]interface{}{
+				"CancelAt":   cancelAt,
+				"SlackToken": "",
+			}).
+			Where("ID = ?", translation.ID).
+			Where("CancelAt = 0").
+			Where("CompleteAt = 0").
+			Where("FailAt = 0"),
+	)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to cancel Translation %s", translation.ID)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to cancel Translation %s", translation.ID)
+	}
+	if rows != 1 {
+		return false, nil
+	}
+
+	translation.CancelAt = cancelAt
+	return true, nil
+}
+
+// RetryTranslation resets the given failed translation so that it is
+// started again with a fresh set of attempts. It returns false if the
+// translation has not failed or is locked.
+func (sqlStore *SQLStore) RetryTranslation(translation *model.Translation) (bool, error) {
+	result, err := sqlStore.execBuilder(
+		sqlStore.db, sq.
+			Update(TranslationTableName).
+			SetMap(map[string]interface{}{
+				"StartAt":  0,
+				"FailAt":   0,
+				"RetryAt":  0,
+				"Attempts": 0,
+				"Error":    "",
+			}).
+			Where("ID = ?", translation.ID).
+			Where("FailAt <> 0").
+			Where("CancelAt = 0").
+			Where("LockedBy = ?", ""),
+	)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to retry Translation %s", translation.ID)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to retry Translation %s", translation.ID)
+	}
+	if rows != 1 {
+		return false, nil
+	}
+
+	translation.StartAt = 0
+	translation.FailAt = 0
+	translation.RetryAt = 0
+	translation.Attempts = 0
+	translation.Error = ""
+	return true, nil
+}
+
 // TryLockTranslation attempts to claim the given translation for the
-// owner ID provided and returns an error if it fails to do so
+// owner ID provided with a lease of LockLease and returns an error if
+// it fails to do so
 func (sqlStore *SQLStore) TryLockTranslation(translation *model.Translation, owner string) error {
 	sqlStore.logger.Infof("Locking Translation %s as %s", translation.ID, owner)
-	translation.LockedBy = owner
+	expiresAt := leaseExpiry(LockLease)
 
 	result, err := sqlStore.execBuilder(
 		sqlStore.db, sq.
 			Update(TranslationTableName).
-			SetMap(map[string]interface{}{"LockedBy": owner}).
+			SetMap(map[string]interface{}{
+				"LockedBy":      owner,
+				"LockExpiresAt": expiresAt,
+			}).
 			Where("ID = ?", translation.ID).
 			Where("LockedBy = ?", ""),
 	)
@@ -173,19 +353,105 @@ func (sqlStore *SQLStore) TryLockTranslation(translation *model.Translation, own
 	}
 	if rows, err := result.RowsAffected(); rows != 1 || err != nil {
 		if err != nil {
-			return errors.Wrapf(err, "wrong number of rows while trying to unlock %s", translation.ID)
+			return errors.Wrapf(err, "wrong number of rows while trying to lock %s", translation.ID)
 		}
-		return errors.Errorf("wrong number of rows while trying to unlock %s", translation.ID)
+		return errors.Errorf("wrong number of rows while trying to lock %s", translation.ID)
 	}
+
+	translation.LockedBy = owner
+	translation.LockExpiresAt = expiresAt
 	return nil
 }
 
-// UnlockTranslation clears the lock on the given translation
+// RenewTranslationLock extends the lease of the lock the owner holds on
+// the translation with the given ID by LockLease. It returns false if
+// the owner no longer holds the lock.
+func (sqlStore *SQLStore) RenewTranslationLock(id, owner string) (bool, error) {
+	result, err := sqlStore.execBuilder(
+		sqlStore.db, sq.
+			Update(TranslationTableName).
+			SetMap(map[string]interface{}{"LockExpiresAt": leaseExpiry(LockLease)}).
+			Where("ID = ?", id).
+			Where("LockedBy = ?", owner),
+	)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to renew lock on Translation %s", id)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to renew lock on Translation %s", id)
+	}
+
+	return rows == 1, nil
+}
+
+// UnlockTranslation clears the lock on the given translation, unless
+// it has passed to another owner in the meantime
 func (sqlStore *SQLStore) UnlockTranslation(translation *model.Translation) error {
-	translation.LockedBy = ""
-	err := sqlStore.UpdateTranslation(translation)
+	_, err := sqlStore.execBuilder(
+		sqlStore.db, sq.
+			Update(TranslationTableName).
+			SetMap(map[string]interface{}{
+				"LockedBy":      "",
+				"LockExpiresAt": 0,
+			}).
+			Where("ID = ?", translation.ID).
+			Where("LockedBy = ?", translation.LockedBy),
+	)
 	if err != nil {
 		return errors.Wrapf(err, "failed to unlock Translation %s", translation.ID)
 	}
+
+	translation.LockedBy = ""
+	translation.LockExpiresAt = 0
 	return nil
 }
+
+// GetTranslationsWithExpiredLock returns the locked translations whose
+// lease expired before now.
+func (sqlStore *SQLStore) GetTranslationsWithExpiredLock(now int64) ([]*model.Translation, error) {
+	var translations []*model.Translation
+	err := sqlStore.selectBuilder(sqlStore.db, &translations,
+		translationSelect.
+			Where("LockedBy <> ''").
+			Where("LockExpiresAt < ?", now),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query for translations with expired locks")
+	}
+
+	return translations, nil
+}
+
+// ReleaseTranslationLock clears the lock on the given translation on
+// behalf of its owner and records a LockEvent with the reason. A
+// translation which was interrupted while running is made ready to
+// start again. It returns false if the lock changed since the
+// translation was read.
+func (sqlStore *SQLStore) ReleaseTranslationLock(translation *model.Translation, reason string) (bool, error) {
+	release := lockRelease{
+		table:      TranslationTableName,
+		resource:   model.LockResourceTranslation,
+		resourceID: translation.ID,
+		lock:       model.LockLockedBy,
+		owner:      translation.LockedBy,
+		expiresAt:  translation.LockExpiresAt,
+		reason:     reason,
+	}
+	interrupted := translation.CompleteAt == 0 && translation.FailAt == 0
+	if interrupted {
+		release.set = map[string]interface{}{"StartAt": 0}
+	}
+
+	released, err := sqlStore.releaseLock(release)
+	if err != nil || !released {
+		return released, err
+	}
+
+	translation.LockedBy = ""
+	translation.LockExpiresAt = 0
+	if interrupted {
+		translation.StartAt = 0
+	}
+	return true, nil
+}
@@ -24,6 +24,8 @@ func init() {
 			"CompleteAt",
 			"CreateAt",
 			"Error",
+			"Checksum",
+			"Validation",
 		).
 		From(UploadTableName)
 }
@@ -45,12 +47,19 @@ func (sqlStore *SQLStore) GetUpload(id string) (*model.Upload, error) {
 	return upload, nil
 }
 
-// GetUploads will fetch a list of uploads.
-func (sqlStore *SQLStore) GetUploads() ([]*model.Upload, error) {
+// GetUploads will fetch the page of uploads matching the filters of
+// options, in the order they ask for. Uploads have neither a state nor
+// an installation to filter by.
+func (sqlStore *SQLStore) GetUploads(options *model.ListOptions) ([]*model.Upload, error) {
+	query := applyListOptions(uploadSelect, options)
+	if options.Type != "" {
+		query = query.Where("Type = ?", options.Type)
+	}
+
 	uploads := &[]*model.Upload{}
-	err := sqlStore.selectBuilder(sqlStore.db, uploads, uploadSelect)
+	err := sqlStore.selectBuilder(sqlStore.db, uploads, query)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "failed to get uploads")
 	}
 
 	return *uploads, nil
@@ -87,3 +96,36 @@ func (sqlStore *SQLStore) CompleteUpload(uploadID, errorMessage string) error {
 	)
 	return err
 }
+
+// UpdateUploadValidation stores the report of the validation of an
+// upload
+func (sqlStore *SQLStore) UpdateUploadValidation(uploadID string, report *model.ValidationReport) error {
+	_, err := sqlStore.execBuilder(sqlStore.db, sq.
+		Update(UploadTableName).
+		Where("ID = ?", uploadID).
+		SetMap(map[string]interface{}{
+			"Validation": report,
+		}),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to store validation report of upload %s", uploadID)
+	}
+
+	return nil
+}
+
+// UpdateUploadChecksum stores the checksum of the archive of an upload
+func (sqlStore *SQLStore) UpdateUploadChecksum(uploadID, checksum string) error {
+	_, err := sqlStore.execBuilder(sqlStore.db, sq.
+		Update(UploadTableName).
+		Where("ID = ?", uploadID).
+		SetMap(map[string]interface{}{
+			"Checksum": checksum,
+		}),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to store checksum of upload %s", uploadID)
+	}
+
+	return nil
+}
@@ -0,0 +1,287 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package store
+
+import (
+	"database/sql"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/mattermost/awat/model"
+	"github.com/pkg/errors"
+)
+
+var uploadSessionSelect sq.SelectBuilder
+var uploadPartSelect sq.SelectBuilder
+
+// UploadSessionTableName is the name of the database table used for
+// storing uploads in chunks.
+var UploadSessionTableName = "UploadSession"
+
+// UploadPartTableName is the name of the database table used for
+// storing the chunks received for an upload session.
+var UploadPartTableName = "UploadPart"
+
+func init() {
+	uploadSessionSelect = sq.
+		Select(
+			"ID",
+			"Type",
+			"Size",
+			"ChunkSize",
+			"MultipartID",
+			"Presigned",
+			"Checksum",
+			"ValidateArchive",
+			"CreateAt",
+			"CompleteAt",
+			"VerifyAt",
+			"HashState",
+			"HashedSize",
+		).
+		From(UploadSessionTableName)
+
+	uploadPartSelect = sq.
+		Select(
+			"UploadID",
+			"Number",
+			"Size",
+			"Checksum",
+			"ETag",
+			"CreateAt",
+		).
+		From(UploadPartTableName).
+		OrderBy("Number ASC")
+}
+
+// CreateUploadSession stores a new upload session along with the
+// Upload it creates.
+func (sqlStore *SQLStore) CreateUploadSession(session *model.UploadSession) error {
+	tx, err := sqlStore.beginTransaction(sqlStore.db)
+	if err != nil {
+		return err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	session.CreateAt = model.GetMillis()
+	_, err = sqlStore.execBuilder(tx, sq.
+		Insert(UploadTableName).
+		SetMap(map[string]interface{}{
+			"CreateAt":   session.CreateAt,
+			"CompleteAt": 0,
+			"ID":         session.ID,
+			"Error":      "",
+			"Type":       session.Type,
+		}),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create upload %s", session.ID)
+	}
+
+	_, err = sqlStore.execBuilder(tx, sq.
+		Insert(UploadSessionTableName).
+		SetMap(map[string]interface{}{
+			"ID":              session.ID,
+			"Type":            session.Type,
+			"Size":            session.Size,
+			"ChunkSize":       session.ChunkSize,
+			"MultipartID":     session.MultipartID,
+			"Presigned":       session.Presigned,
+			"Checksum":        session.Checksum,
+			"ValidateArchive": session.ValidateArchive,
+			"CreateAt":        session.CreateAt,
+			"CompleteAt":      0,
+			"VerifyAt":        0,
+			"HashedSize":      0,
+		}),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create upload session %s", session.ID)
+	}
+
+	return tx.Commit()
+}
+
+// GetUploadSession fetches an upload session and the chunks received
+// for it from the database by ID.
+func (sqlStore *SQLStore) GetUploadSession(id string) (*model.UploadSession, error) {
+	session := new(model.UploadSession)
+
+	err := sqlStore.getBuilder(sqlStore.db, session,
+		uploadSessionSelect.Where("ID = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get upload session by id")
+	}
+
+	parts := []*model.UploadPart{}
+	err = sqlStore.selectBuilder(sqlStore.db, &parts,
+		uploadPartSelect.Where("UploadID = ?", id))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get parts of upload session %s", id)
+	}
+	session.Parts = parts
+
+	return session, nil
+}
+
+// AddUploadPart records a chunk received for an upload session,
+// replacing a chunk with the same number uploaded earlier.
+func (sqlStore *SQLStore) AddUploadPart(part *model.UploadPart) error {
+	part.CreateAt = model.GetMillis()
+	_, err := sqlStore.execBuilder(sqlStore.db, sq.
+		Insert(UploadPartTableName).
+		SetMap(map[string]interface{}{
+			"UploadID": part.UploadID,
+			"Number":   part.Number,
+			"Size":     part.Size,
+			"Checksum": part.Checksum,
+			"ETag":     part.ETag,
+			"CreateAt": part.CreateAt,
+		}).
+		Suffix(`ON CONFLICT (UploadID, Number) DO UPDATE SET
+			Size = EXCLUDED.Size,
+			Checksum = EXCLUDED.Checksum,
+			ETag = EXCLUDED.ETag,
+			CreateAt = EXCLUDED.CreateAt`),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to store part %d of upload session %s", part.Number, part.UploadID)
+	}
+
+	return nil
+}
+
+// UpdateUploadSessionHash records the hash of the first hashedSize
+// bytes of the archive of an upload session, provided the session is
+// not complete and no other request changed the hash since the session
+// was read. Returns true if the hash was recorded.
+func (sqlStore *SQLStore) UpdateUploadSessionHash(session *model.UploadSession, state []byte, hashedSize int64) (bool, error) {
+	result, err := sqlStore.execBuilder(sqlStore.db, sq.
+		Update(UploadSessionTableName).
+		Set("HashState", state).
+		Set("HashedSize", hashedSize).
+		Where("ID = ?", session.ID).
+		Where("HashedSize = ?", session.HashedSize).
+		Where("CompleteAt = 0"),
+	)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to update hash of upload session %s", session.ID)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to count updated upload sessions")
+	}
+
+	return rows == 1, nil
+}
+
+// ResetUploadSessionHash discards the hash of the archive of an upload
+// session, whose checksum is then computed once it was assembled.
+func (sqlStore *SQLStore) ResetUploadSessionHash(id string) error {
+	_, err := sqlStore.execBuilder(sqlStore.db, sq.
+		Update(UploadSessionTableName).
+		Set("HashState", nil).
+		Set("HashedSize", 0).
+		Where("ID = ?", id),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to reset hash of upload session %s", id)
+	}
+
+	return nil
+}
+
+// CompleteUploadSession marks an upload session as complete, after
+// which it takes no more chunks, and if verify is set has its archive
+// verified right away. It returns false if the session was already
+// complete.
+func (sqlStore *SQLStore) CompleteUploadSession(id string, verify bool) (bool, error) {
+	now := model.GetMillis()
+	var verifyAt int64
+	if verify {
+		verifyAt = now
+	}
+
+	result, err := sqlStore.execBuilder(sqlStore.db, sq.
+		Update(UploadSessionTableName).
+		Set("CompleteAt", now).
+		Set("VerifyAt", verifyAt).
+		Where("ID = ?", id).
+		Where("CompleteAt = 0"),
+	)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to complete upload session %s", id)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to complete upload session %s", id)
+	}
+
+	return rows == 1, nil
+}
+
+// GetUploadSessionsPendingVerification fetches up to limit completed
+// upload sessions whose archive is due to be verified at now, without
+// their chunks.
+func (sqlStore *SQLStore) GetUploadSessionsPendingVerification(now int64, limit uint64) ([]*model.UploadSession, error) {
+	sessions := []*model.UploadSession{}
+
+	err := sqlStore.selectBuilder(sqlStore.db, &sessions,
+		uploadSessionSelect.
+			Where("VerifyAt > 0").
+			Where("VerifyAt <= ?", now).
+			OrderBy("VerifyAt ASC").
+			Limit(limit))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get upload sessions pending verification")
+	}
+
+	return sessions, nil
+}
+
+// ClaimUploadSessionVerification postpones verifying the archive of an
+// upload session to verifyAt, provided no other AWAT claimed it since
+// it was read, so that only one AWAT verifies it. Returns true if the
+// session was claimed.
+func (sqlStore *SQLStore) ClaimUploadSessionVerification(session *model.UploadSession, verifyAt int64) (bool, error) {
+	result, err := sqlStore.execBuilder(sqlStore.db, sq.
+		Update(UploadSessionTableName).
+		Set("VerifyAt", verifyAt).
+		Where("ID = ?", session.ID).
+		Where("VerifyAt = ?", session.VerifyAt),
+	)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to claim verification of upload session %s", session.ID)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to count claimed upload sessions")
+	}
+	if rows == 0 {
+		return false, nil
+	}
+
+	session.VerifyAt = verifyAt
+	return true, nil
+}
+
+// FinishUploadSessionVerification records that the archive of an
+// upload session was verified.
+func (sqlStore *SQLStore) FinishUploadSessionVerification(id string) error {
+	_, err := sqlStore.execBuilder(sqlStore.db, sq.
+		Update(UploadSessionTableName).
+		Set("VerifyAt", 0).
+		Where("ID = ?", id),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to finish verification of upload session %s", id)
+	}
+
+	return nil
+}
@@ -0,0 +1,256 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/mattermost/awat/model"
+	"github.com/pkg/errors"
+)
+
+var webhookSelect sq.SelectBuilder
+var webhookDeliverySelect sq.SelectBuilder
+
+// WebhookTableName is the name of the database table used for storing
+// webhooks.
+var WebhookTableName = "Webhook"
+
+// WebhookDeliveryTableName is the name of the database table used for
+// storing the deliveries of events to webhooks.
+var WebhookDeliveryTableName = "WebhookDelivery"
+
+func init() {
+	webhookSelect = sq.
+		Select(
+			"ID",
+			"URL",
+			"Secret",
+			"CreateAt",
+			"DeleteAt",
+		).
+		From(WebhookTableName)
+
+	webhookDeliverySelect = sq.
+		Select(
+			"WebhookID",
+			"EventID",
+			"Payload",
+			"Attempts",
+			"StatusCode",
+			"Error",
+			"CreateAt",
+			"NextAttemptAt",
+			"DeliveredAt",
+			"FailAt",
+		).
+		From(WebhookDeliveryTableName)
+}
+
+// CreateWebhook stores a new webhook.
+func (sqlStore *SQLStore) CreateWebhook(webhook *model.Webhook) error {
+	webhook.ID = model.NewID()
+	webhook.CreateAt = model.GetMillis()
+
+	_, err := sqlStore.execBuilder(sqlStore.db, sq.
+		Insert(WebhookTableName).
+		SetMap(map[string]interface{}{
+			"ID":       webhook.ID,
+			"URL":      webhook.URL,
+			"Secret":   webhook.Secret,
+			"CreateAt": webhook.CreateAt,
+			"DeleteAt": 0,
+		}),
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to create webhook")
+	}
+
+	return nil
+}
+
+// GetWebhook fetches a webhook, which may be deleted, from the
+// database by ID.
+func (sqlStore *SQLStore) GetWebhook(id string) (*model.Webhook, error) {
+	webhook := new(model.Webhook)
+
+	err := sqlStore.getBuilder(sqlStore.db, webhook,
+		webhookSelect.Where("ID = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get webhook by id")
+	}
+
+	return webhook, nil
+}
+
+// GetWebhooks returns the webhooks which were not deleted.
+func (sqlStore *SQLStore) GetWebhooks() ([]*model.Webhook, error) {
+	webhooks := []*model.Webhook{}
+
+	err := sqlStore.selectBuilder(sqlStore.db, &webhooks,
+		webhookSelect.
+			Where("DeleteAt = 0").
+			OrderBy("CreateAt ASC"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get webhooks")
+	}
+
+	return webhooks, nil
+}
+
+// DeleteWebhook marks a webhook as deleted, which stops events from
+// being sent to it. Its deliveries are kept.
+func (sqlStore *SQLStore) DeleteWebhook(id string) error {
+	_, err := sqlStore.execBuilder(sqlStore.db, sq.
+		Update(WebhookTableName).
+		Set("DeleteAt", model.GetMillis()).
+		Where("ID = ?", id).
+		Where("DeleteAt = 0"),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to delete webhook %s", id)
+	}
+
+	return nil
+}
+
+// CreateWebhookEvent queues the delivery of an event to every webhook
+// which is not deleted and appends it to the stream of events.
+func (sqlStore *SQLStore) CreateWebhookEvent(event *model.WebhookEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal webhook event")
+	}
+
+	tx, err := sqlStore.beginTransaction(sqlStore.db)
+	if err != nil {
+		return err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	_, err = sqlStore.execBuilder(tx, sq.
+		Insert(WebhookDeliveryTableName).
+		Columns(
+			"WebhookID",
+			"EventID",
+			"Payload",
+			"Attempts",
+			"StatusCode",
+			"Error",
+			"CreateAt",
+			"NextAttemptAt",
+			"DeliveredAt",
+			"FailAt",
+		).
+		Select(sq.
+			Select("ID").
+			Column("?::TEXT, ?::TEXT, 0, 0, '', ?::BIGINT, ?::BIGINT, 0, 0", event.ID, string(payload), event.Timestamp, event.Timestamp).
+			From(WebhookTableName).
+			Where("DeleteAt = 0"),
+		),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to queue deliveries of webhook event %s", event.ID)
+	}
+
+	err = sqlStore.createEvent(tx, event.StreamEvent())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetWebhookDeliveriesDue returns up to limit deliveries which are
+// neither delivered nor failed and are due for an attempt at now,
+// oldest first.
+func (sqlStore *SQLStore) GetWebhookDeliveriesDue(now int64, limit uint64) ([]*model.WebhookDelivery, error) {
+	deliveries := []*model.WebhookDelivery{}
+
+	err := sqlStore.selectBuilder(sqlStore.db, &deliveries,
+		webhookDeliverySelect.
+			Where("DeliveredAt = 0").
+			Where("FailAt = 0").
+			Where("NextAttemptAt <= ?", now).
+			OrderBy("CreateAt ASC").
+			Limit(limit))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get webhook deliveries due")
+	}
+
+	return deliveries, nil
+}
+
+// ClaimWebhookDelivery postpones the next attempt of a delivery to
+// nextAttemptAt, provided no other AWAT claimed it since it was read,
+// so that only one AWAT attempts it. Returns true if the delivery was
+// claimed.
+func (sqlStore *SQLStore) ClaimWebhookDelivery(delivery *model.WebhookDelivery, nextAttemptAt int64) (bool, error) {
+	result, err := sqlStore.execBuilder(sqlStore.db, sq.
+		Update(WebhookDeliveryTableName).
+		Set("NextAttemptAt", nextAttemptAt).
+		Where("WebhookID = ?", delivery.WebhookID).
+		Where("EventID = ?", delivery.EventID).
+		Where("NextAttemptAt = ?", delivery.NextAttemptAt),
+	)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to claim delivery of event %s to webhook %s", delivery.EventID, delivery.WebhookID)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to count claimed deliveries")
+	}
+	if rows == 0 {
+		return false, nil
+	}
+
+	delivery.NextAttemptAt = nextAttemptAt
+	return true, nil
+}
+
+// UpdateWebhookDelivery records the outcome of an attempt of a
+// delivery.
+func (sqlStore *SQLStore) UpdateWebhookDelivery(delivery *model.WebhookDelivery) error {
+	_, err := sqlStore.execBuilder(sqlStore.db, sq.
+		Update(WebhookDeliveryTableName).
+		SetMap(map[string]interface{}{
+			"Attempts":      delivery.Attempts,
+			"StatusCode":    delivery.StatusCode,
+			"Error":         delivery.Error,
+			"NextAttemptAt": delivery.NextAttemptAt,
+			"DeliveredAt":   delivery.DeliveredAt,
+			"FailAt":        delivery.FailAt,
+		}).
+		Where("WebhookID = ?", delivery.WebhookID).
+		Where("EventID = ?", delivery.EventID),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to update delivery of event %s to webhook %s", delivery.EventID, delivery.WebhookID)
+	}
+
+	return nil
+}
+
+// GetWebhookDeliveries returns the deliveries to a webhook, newest
+// first.
+func (sqlStore *SQLStore) GetWebhookDeliveries(webhookID string) ([]*model.WebhookDelivery, error) {
+	deliveries := []*model.WebhookDelivery{}
+
+	err := sqlStore.selectBuilder(sqlStore.db, &deliveries,
+		webhookDeliverySelect.
+			Where("WebhookID = ?", webhookID).
+			OrderBy("CreateAt DESC"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get deliveries to webhook %s", webhookID)
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// diskUsage returns the number of bytes used by the files below dir.
+func diskUsage(dir string) (int64, error) {
+	var usage int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// files may disappear while the translation runs
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			usage += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to determine disk usage of %s", dir)
+	}
+
+	return usage, nil
+}
+
+// FreeDiskSpace returns the number of bytes available to unprivileged
+// users on the file system holding dir.
+func FreeDiskSpace(dir string) (int64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(dir, &stat)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to determine free space of %s", dir)
+	}
+
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
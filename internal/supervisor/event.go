@@ -0,0 +1,123 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package supervisor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mattermost/awat/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// progressInterval is the least time between two progress events of a
+// Translation in the same phase.
+const progressInterval = 5 * time.Second
+
+// pruneInterval is how often the EventPruner deletes old events.
+const pruneInterval = time.Hour
+
+// progressStore defines the interface for recording the progress of
+// Translations.
+type progressStore interface {
+	CreateEvent(event *model.Event) error
+	UpdateTranslationProgress(id string, progress *model.TranslationProgress) error
+}
+
+// progressReporter records the progress of a running Translation with
+// the Translation and in the stream of events. To keep the number of
+// writes down, progress within a phase is recorded at most every
+// progressInterval, except for the end of the phase.
+type progressReporter struct {
+	store       progressStore
+	translation *model.Translation
+	logger      log.FieldLogger
+
+	mu       sync.Mutex
+	progress model.TranslationProgress
+	reported time.Time
+}
+
+func newProgressReporter(store progressStore, translation *model.Translation, logger log.FieldLogger) *progressReporter {
+	return &progressReporter{
+		store:       store,
+		translation: translation,
+		logger:      logger,
+	}
+}
+
+// report satisfies common.ProgressFunc.
+func (p *progressReporter) report(phase, message string, done, total int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	newPhase := phase != p.progress.Phase
+	p.progress.Update(phase, done, total, model.GetMillis())
+
+	finished := total > 0 && done >= total
+	if !newPhase && !finished && now.Sub(p.reported) < progressInterval {
+		return
+	}
+	p.reported = now
+
+	progress := p.progress
+	err := p.store.UpdateTranslationProgress(p.translation.ID, &progress)
+	if err != nil {
+		p.logger.WithError(err).Warnf("Failed to store progress of phase %s", phase)
+	}
+
+	err = p.store.CreateEvent(model.NewProgressEvent(p.translation, phase, message, done, total))
+	if err != nil {
+		p.logger.WithError(err).Warnf("Failed to record progress of phase %s", phase)
+	}
+}
+
+// EventPruner deletes events from the stream once they are older than
+// the retention period, as they are only of interest while following
+// Translations and Imports live.
+type EventPruner struct {
+	store     eventPruneStore
+	logger    log.FieldLogger
+	retention time.Duration
+}
+
+// eventPruneStore defines the interface for deleting old events.
+type eventPruneStore interface {
+	DeleteEventsBefore(timestamp int64) (int64, error)
+}
+
+// NewEventPruner creates a new EventPruner keeping events for the given
+// retention period.
+func NewEventPruner(store eventPruneStore, logger log.FieldLogger, retention time.Duration) *EventPruner {
+	return &EventPruner{
+		store:     store,
+		logger:    logger.WithField("event-pruner", model.NewID()),
+		retention: retention,
+	}
+}
+
+// Start runs the EventPruner on a new goroutine forever.
+func (p *EventPruner) Start() {
+	p.logger.Infof("Event pruner started with a retention of %s", p.retention)
+	go func() {
+		tick := time.NewTicker(pruneInterval)
+		for range tick.C {
+			p.prune(model.GetMillis())
+		}
+	}()
+}
+
+// prune deletes the events which are past the retention period at now.
+func (p *EventPruner) prune(now int64) {
+	deleted, err := p.store.DeleteEventsBefore(now - p.retention.Milliseconds())
+	if err != nil {
+		p.logger.WithError(err).Error("Failed to delete old events")
+		return
+	}
+	if deleted > 0 {
+		p.logger.Debugf("Deleted %d old events", deleted)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package supervisor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/awat/internal/testlib"
+	"github.com/mattermost/awat/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeEventStore struct {
+	events   []*model.Event
+	progress []model.TranslationProgress
+	before   int64
+}
+
+func (s *fakeEventStore) UpdateTranslationProgress(id string, progress *model.TranslationProgress) error {
+	s.progress = append(s.progress, *progress)
+	return nil
+}
+
+func (s *fakeEventStore) CreateEvent(event *model.Event) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *fakeEventStore) DeleteEventsBefore(timestamp int64) (int64, error) {
+	s.before = timestamp
+	return 3, nil
+}
+
+func TestProgressReporter(t *testing.T) {
+	store := &fakeEventStore{}
+	translation := &model.Translation{ID: "translationID", InstallationID: "installationID"}
+	reporter := newProgressReporter(store, translation, testlib.MakeLogger(t))
+
+	reporter.report(model.TranslationPhaseFetchAttachments, "Fetched 0 attachments", 0, 10)
+	reporter.report(model.TranslationPhaseFetchAttachments, "Fetched 1 attachments", 1, 10)
+	reporter.report(model.TranslationPhaseFetchAttachments, "Fetched 2 attachments", 2, 10)
+	reporter.report(model.TranslationPhaseFetchAttachments, "Fetched 10 attachments", 10, 10)
+	reporter.report(model.TranslationPhaseTransform, "Transforming", 0, 0)
+	reporter.report(model.TranslationPhaseTransform, "Still transforming", 0, 0)
+
+	require.Len(t, store.events, 3)
+	require.Len(t, store.progress, 3)
+	assert.Equal(t, int64(10), store.progress[1].FilesDone)
+	assert.Equal(t, int64(10), store.progress[1].FilesTotal)
+	assert.Equal(t, model.TranslationPhaseTransform, store.progress[2].Phase)
+	assert.Equal(t, int64(10), store.progress[2].FilesDone)
+	assert.Equal(t, "Fetched 0 attachments", store.events[0].Message)
+	assert.Equal(t, "Fetched 10 attachments", store.events[1].Message)
+	assert.Equal(t, int64(10), store.events[1].Done)
+	assert.Equal(t, int64(10), store.events[1].Total)
+	assert.Equal(t, model.TranslationPhaseTransform, store.events[2].Phase)
+	for _, event := range store.events {
+		assert.Equal(t, model.EventKindProgress, event.Kind)
+		assert.Equal(t, "translationID", event.TranslationID)
+		assert.Equal(t, "installationID", event.InstallationID)
+	}
+
+	// progress within a phase is reported again after a while
+	reporter.reported = time.Now().Add(-progressInterval)
+	reporter.report(model.TranslationPhaseTransform, "Still transforming", 0, 0)
+	assert.Len(t, store.events, 4)
+}
+
+func TestEventPrunerPrune(t *testing.T) {
+	store := &fakeEventStore{}
+	pruner := NewEventPruner(store, testlib.MakeLogger(t), time.Hour)
+
+	now := model.GetMillis()
+	pruner.prune(now)
+	assert.Equal(t, now-time.Hour.Milliseconds(), store.before)
+}
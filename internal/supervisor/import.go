@@ -7,47 +7,72 @@ package supervisor
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/mattermost/awat/internal/objectstore"
 	"github.com/mattermost/awat/model"
 	cloud "github.com/mattermost/mattermost-cloud/model"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
+// errImportLockLost is returned when the ImportSupervisor lost its lock
+// on an Import while it was working on it.
+var errImportLockLost = errors.New("lost the lock on the import")
+
 // ImportSupervisor is responsible for supervising the import process.
-// It manages the import lifecycle and communicates with other services like AWS and Mattermost Cloud.
+// It manages the import lifecycle and communicates with other services like the object store and Mattermost Cloud.
 type ImportSupervisor struct {
-	id             string
-	logger         log.FieldLogger
-	store          importStore
-	cloud          *cloud.Client
-	bucket         string
-	keepImportData bool
+	id          string
+	logger      log.FieldLogger
+	store       importStore
+	cloud       *cloud.Client
+	objectStore objectstore.ObjectStore
+	options     ImportSupervisorOptions
+}
+
+// ImportSupervisorOptions configures an ImportSupervisor.
+// ImportProfile is used for Translations which were not requested with
+// a profile of their own, and defaults to model.DefaultImportProfile.
+// InstallationTimeout is how long an Import may wait in any state for
+// its Installation, e.g. to become stable, and ImportTimeout how long
+// it may stay in progress. An Import exceeding its deadline fails, with
+// its Installation reverted first if it was adjusted. A zero timeout
+// disables the deadline.
+type ImportSupervisorOptions struct {
+	KeepImportData      bool
+	InstallationTimeout time.Duration
+	ImportTimeout       time.Duration
+	ImportProfile       *model.ImportProfile
 }
 
 // importStore defines the interface for interacting with the import storage.
 type importStore interface {
+	eventStore
 	GetUnlockedImportPendingWork() ([]*model.Import, error)
+	GetImport(id string) (*model.Import, error)
 	GetTranslation(id string) (*model.Translation, error)
 	UpdateImport(imp *model.Import) error
+	TransitionImport(imp *model.Import, state, installationState, reason string) error
 	TryLockImport(imp *model.Import, owner string) error
+	RenewImportLock(id, owner string) (bool, error)
 	UnlockImport(imp *model.Import) error
+	RenewImportClaim(id, provisionerID string) (bool, error)
+	ReleaseImportClaim(imp *model.Import, reason string) (bool, error)
 }
 
 // NewImportSupervisor creates a new ImportSupervisor instance.
 // It initializes the supervisor with provided parameters including the import store, logger, cloud client, etc.
-func NewImportSupervisor(store importStore, logger log.FieldLogger, cloudClient *cloud.Client, bucket string, keepImportData bool) *ImportSupervisor {
+func NewImportSupervisor(store importStore, logger log.FieldLogger, cloudClient *cloud.Client, objectStore objectstore.ObjectStore, options ImportSupervisorOptions) *ImportSupervisor {
 	id := model.NewID()
 	return &ImportSupervisor{
-		id:             id,
-		logger:         logger.WithField("import-supervisor", id),
-		store:          store,
-		cloud:          cloudClient,
-		bucket:         bucket,
-		keepImportData: keepImportData,
+		id:          id,
+		logger:      logger.WithField("import-supervisor", id),
+		store:       store,
+		cloud:       cloudClient,
+		objectStore: objectStore,
+		options:     options,
 	}
 }
 
@@ -95,11 +120,26 @@ func (s *ImportSupervisor) supervise(imp *model.Import) {
 		}
 	}(imp)
 
+	// The Import may have been cancelled or claimed by a Provisioner
+	// since it was fetched.
+	current, err := s.store.GetImport(imp.ID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to refresh import")
+		return
+	}
+	if current == nil {
+		return
+	}
+	*imp = *current
+
 	translation, err := s.store.GetTranslation(imp.TranslationID)
 	if err != nil {
 		logger.WithError(err).Errorf("Failed to look up Translation %s", imp.TranslationID)
 		return
 	}
+	if imp.ImportProfile == nil {
+		imp.ImportProfile = translation.ImportProfile
+	}
 
 	installation, err := s.cloud.GetInstallation(
 		translation.InstallationID,
@@ -112,14 +152,20 @@ func (s *ImportSupervisor) supervise(imp *model.Import) {
 		return
 	}
 
+	oldState := imp.State
 	if installation == nil || installation.State == cloud.InstallationStateDeleted {
 		logger.Error("No Installation found")
-		imp.State = model.ImportStateFailed
-		err := s.store.UpdateImport(imp)
+		newState := model.ImportStateCancelled
+		if imp.State != model.ImportStateCancelRequested {
+			newState = model.ImportStateFailed
+			imp.AddError("installation not found")
+		}
+		err := s.store.TransitionImport(imp, newState, "", "installation not found")
 		if err != nil {
 			logger.WithError(err).Error("Failed to update import")
 			return
 		}
+		emitEvent(s.store, model.NewImportEvent(imp, translation.InstallationID, oldState), logger)
 		return
 	}
 
@@ -127,18 +173,108 @@ func (s *ImportSupervisor) supervise(imp *model.Import) {
 		"installation": installation.ID,
 	})
 
+	var reason string
 	newState := s.transitionImport(imp, installation, logger)
+	if newState == imp.State {
+		newState, reason = s.expireImport(imp, installation, logger)
+		if reason != "" {
+			logger.Warn(reason)
+		}
+	} else if newState == model.ImportStateFailed {
+		reason = imp.Error
+	}
 
-	if newState != imp.State {
-		imp.State = newState
-		err := s.store.UpdateImport(imp)
+	// An expired Import which keeps reverting its Installation stays
+	// in its state, but the expiry is recorded all the same, which also
+	// restarts its deadline.
+	if newState != imp.State || reason != "" {
+		err := s.store.TransitionImport(imp, newState, installation.State, reason)
 		if err != nil {
 			logger.WithError(err).Error("Failed to update import")
 			return
 		}
+		if newState != oldState {
+			emitEvent(s.store, model.NewImportEvent(imp, installation.ID, oldState), logger)
+		}
 	}
 }
 
+// expireImport checks whether the Import stayed in its state past its
+// deadline. If it did, the reason is recorded as the error of the
+// Import, and the state to move it to is returned with the reason.
+// Every Import which may have adjusted its Installation takes the path
+// which reverts it: one which is still importing gives up the claim of
+// its Provisioner and moves to ImportStateComplete, which waits for the
+// Installation to be stable before reverting it and failing, while one
+// which is already reverting it, or was cancelled, keeps doing so. Only
+// an Import which never adjusted its Installation fails right away.
+func (s *ImportSupervisor) expireImport(imp *model.Import, installation *cloud.InstallationDTO, logger log.FieldLogger) (string, string) {
+	timeout := s.options.InstallationTimeout
+	if imp.State == model.ImportStateInProgress {
+		timeout = s.options.ImportTimeout
+	}
+	if timeout <= 0 {
+		return imp.State, ""
+	}
+
+	since := imp.StateChangeAt
+	if since == 0 {
+		since = imp.CreateAt
+	}
+	if time.Since(time.UnixMilli(since)) < timeout {
+		return imp.State, ""
+	}
+
+	if imp.ImportBy != "" {
+		// The Provisioner may still be importing, so it loses its
+		// claim before the Installation is reverted.
+		if imp.CompleteAt == 0 {
+			imp.CompleteAt = model.GetMillis()
+		}
+		released, err := s.store.ReleaseImportClaim(imp, model.LockReleaseReasonExpired)
+		if err != nil {
+			logger.WithError(err).Error("Failed to release claim of provisioner on import")
+			return imp.State, ""
+		}
+		if !released {
+			logger.Warn("Claim of provisioner on import changed, not expiring it yet")
+			return imp.State, ""
+		}
+	}
+
+	reason := fmt.Sprintf("import stayed in state %s for more than %s while the installation was %s", imp.State, timeout, installation.State)
+	imp.AddError(reason)
+
+	switch imp.State {
+	case model.ImportStateRequested:
+		if imp.InstallationSnapshot == nil {
+			// the Installation was never adjusted
+			return model.ImportStateFailed, reason
+		}
+	case model.ImportStateCancelRequested:
+		// reverting the Installation ends in ImportStateCancelled
+		return imp.State, reason
+	}
+
+	if imp.CompleteAt == 0 {
+		imp.CompleteAt = model.GetMillis()
+	}
+	return model.ImportStateComplete, reason
+}
+
+// importProfile returns the ImportProfile the Installation of the
+// Import is adjusted with.
+func (s *ImportSupervisor) importProfile(imp *model.Import) *model.ImportProfile {
+	if imp.ImportProfile != nil {
+		return imp.ImportProfile
+	}
+	if s.options.ImportProfile != nil {
+		return s.options.ImportProfile
+	}
+
+	return model.DefaultImportProfile()
+}
+
 // transitionImport manages the state transition of an import.
 // Depending on the current state of the import and the associated installation, it moves the import to the next state.
 func (s *ImportSupervisor) transitionImport(imp *model.Import, installation *cloud.InstallationDTO, logger log.FieldLogger) string {
@@ -153,6 +289,8 @@ func (s *ImportSupervisor) transitionImport(imp *model.Import, installation *clo
 		return s.transitionImportComplete(imp, installation, logger)
 	case model.ImportStateInstallationPostAdjustment:
 		return s.transitionImportInstallationPostAdjustment(imp, installation, logger)
+	case model.ImportStateCancelRequested:
+		return s.transitionImportCancelRequested(imp, installation, logger)
 	}
 
 	return imp.State
@@ -166,8 +304,34 @@ func (s *ImportSupervisor) transitionImportRequested(imp *model.Import, installa
 		return imp.State
 	}
 
+	// Record the profile and the original configuration before the
+	// Installation is adjusted. An Import sent back to this state by a
+	// failed adjustment keeps the snapshot taken the first time. The
+	// archive is verified before, so that an Import of an archive which
+	// does not match its checksum fails without adjusting the
+	// Installation.
+	if imp.InstallationSnapshot == nil {
+		verified, err := s.verifyArchive(imp, logger)
+		if err != nil {
+			logger.WithError(err).Error("Failed to verify the archive of the import")
+			return imp.State
+		}
+		if !verified {
+			logger.Error(imp.Error)
+			return model.ImportStateFailed
+		}
+
+		imp.ImportProfile = s.importProfile(imp)
+		imp.InstallationSnapshot = takeInstallationSnapshot(installation.Installation)
+		err = s.store.UpdateImport(imp)
+		if err != nil {
+			logger.WithError(err).Error("Failed to record the installation configuration")
+			return imp.State
+		}
+	}
+
 	logger.Info("Running pre-import installation configuration check")
-	patch := getPreImportPatch(installation.Installation, logger)
+	patch := getPreImportPatch(installation.Installation, s.importProfile(imp), logger)
 	if patch == nil {
 		logger.Info("No installation adjustments required")
 		return model.ImportStateInProgress
@@ -184,6 +348,65 @@ func (s *ImportSupervisor) transitionImportRequested(imp *model.Import, installa
 	return model.ImportStateInstallationPreAdjustment
 }
 
+// verifyArchive checks that the archive of the Import has the checksum
+// its Translation recorded when it wrote the archive, if it recorded
+// one. If it does not, the mismatch is added to the errors of the
+// Import and false is returned. The lock on the Import is renewed
+// while the archive is read, which takes longer than its lease for
+// large archives.
+func (s *ImportSupervisor) verifyArchive(imp *model.Import, logger log.FieldLogger) (bool, error) {
+	translation, err := s.store.GetTranslation(imp.TranslationID)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to look up Translation %s", imp.TranslationID)
+	}
+	if translation == nil || translation.OutputChecksum == "" {
+		return true, nil
+	}
+
+	lockCtx, loseLock := context.WithCancelCause(context.Background())
+	defer loseLock(nil)
+	go s.keepLock(lockCtx, loseLock, imp.ID, logger)
+
+	key := fmt.Sprintf("%s.zip", imp.TranslationID)
+	_, checksum, err := s.objectStore.Checksum(key)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to determine checksum of %s", key)
+	}
+	if lockCtx.Err() != nil {
+		return false, context.Cause(lockCtx)
+	}
+	if checksum != translation.OutputChecksum {
+		imp.AddError(fmt.Sprintf("archive %s has checksum %s instead of %s", key, checksum, translation.OutputChecksum))
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// keepLock periodically renews the lock of the ImportSupervisor on the
+// Import with the given ID until ctx is done, calling lost with
+// errImportLockLost if it no longer holds the lock.
+func (s *ImportSupervisor) keepLock(ctx context.Context, lost context.CancelCauseFunc, importID string, logger log.FieldLogger) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			renewed, err := s.store.RenewImportLock(importID, s.id)
+			if err != nil {
+				logger.WithError(err).Warn("Failed to renew lock on import")
+			} else if !renewed {
+				logger.Warn("Import is no longer locked by this supervisor")
+				lost(errImportLockLost)
+				return
+			}
+		}
+	}
+}
+
 // transitionImportInstallationPreAdjustment handles the transition for an import in the 'pre-adjustment' state.
 // It waits for the installation to become stable after initial adjustments.
 func (s *ImportSupervisor) transitionImportInstallationPreAdjustment(imp *model.Import, installation *cloud.InstallationDTO, logger log.FieldLogger) string {
@@ -194,18 +417,8 @@ func (s *ImportSupervisor) transitionImportInstallationPreAdjustment(imp *model.
 
 	logger.Debug("Installation is Stable")
 
-	if installation.Size != model.Size1000String {
-		logger.Debug("Installation is not in the correct size")
-		return model.ImportStateRequested
-	}
-
-	if installation.PriorityEnv[model.S3EnvKey].Value != fmt.Sprintf("%d", model.S3ExtendedTimeout) {
-		logger.Debug("S3 timeout is not extended")
-		return model.ImportStateRequested
-	}
-
-	if installation.PriorityEnv[model.ExtractContentKey].Value != model.ExtractContentDisabled {
-		logger.Debug("File content extraction is not disabled")
+	if getPreImportPatch(installation.Installation, s.importProfile(imp), logger) != nil {
+		logger.Debug("Installation does not have the import configuration yet")
 		return model.ImportStateRequested
 	}
 
@@ -219,6 +432,14 @@ func (s *ImportSupervisor) transitionImportInstallationPreAdjustment(imp *model.
 func (s *ImportSupervisor) transitionImportInProgress(imp *model.Import, installation *cloud.InstallationDTO, logger log.FieldLogger) string {
 	if !startedImportIsComplete(installation) {
 		logger.Debug("Import is still running")
+		if imp.ImportBy != "" && installation.State == cloud.InstallationStateImportInProgress {
+			// The Installation importing shows that the Provisioner
+			// is at work, so renew its claim on its behalf.
+			_, err := s.store.RenewImportClaim(imp.ID, imp.ImportBy)
+			if err != nil {
+				logger.WithError(err).Warn("Failed to renew claim of provisioner on import")
+			}
+		}
 		return imp.State
 	}
 
@@ -231,28 +452,15 @@ func (s *ImportSupervisor) transitionImportInProgress(imp *model.Import, install
 
 	logger.Info("Import completed")
 
-	if s.keepImportData {
+	if s.options.KeepImportData {
 		logger.Debug("Skipping import bundle cleanup")
 		return model.ImportStateComplete
 	}
 
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		logger.WithError(err).Error("Failed to load AWS config")
-		return model.ImportStateComplete
-	}
-
 	key := fmt.Sprintf("%s.zip", imp.TranslationID)
-	ctx, cancelFunc := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancelFunc()
-
-	client := s3.NewFromConfig(cfg)
-	_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: &s.bucket,
-		Key:    &key,
-	})
+	err = s.objectStore.Delete(key)
 	if err != nil {
-		logger.WithError(err).Error("Failed to delete translation from S3")
+		logger.WithError(err).Error("Failed to delete translation from object store")
 		return model.ImportStateComplete
 	}
 
@@ -270,7 +478,7 @@ func (s *ImportSupervisor) transitionImportComplete(imp *model.Import, installat
 	}
 
 	logger.Info("Running post-import installation configuration check")
-	patch := getPostImportPatch(installation.Installation, logger)
+	patch := getPostImportPatch(installation.Installation, s.importProfile(imp), imp.InstallationSnapshot, logger)
 	if patch == nil {
 		logger.Info("No installation adjustments required")
 		if imp.Error != "" {
@@ -300,17 +508,12 @@ func (s *ImportSupervisor) transitionImportInstallationPostAdjustment(imp *model
 
 	logger.Debug("Installation is Stable")
 
-	if installation.Size == model.Size1000String {
-		logger.Warn("Installation is not in the correct size")
-		return model.ImportStateComplete
-	}
-
-	if installation.PriorityEnv[model.S3EnvKey].Value == fmt.Sprintf("%d", model.S3ExtendedTimeout) {
-		logger.Warn("S3 timeout is still extended")
+	if getPostImportPatch(installation.Installation, s.importProfile(imp), imp.InstallationSnapshot, logger) != nil {
+		logger.Warn("Installation has not been reverted yet")
 		return model.ImportStateComplete
 	}
 
-	logger.Info("Installation has been reverted to default configuration")
+	logger.Info("Installation has been reverted to its original configuration")
 
 	if imp.Error != "" {
 		return model.ImportStateFailed
@@ -319,6 +522,34 @@ func (s *ImportSupervisor) transitionImportInstallationPostAdjustment(imp *model
 	return model.ImportStateSucceeded
 }
 
+// transitionImportCancelRequested handles the transition for an import
+// which was cancelled after it began adjusting the installation. Once
+// the installation is stable again, which for an import the
+// Provisioner has already started is only the case after it finished,
+// the import configuration is reverted before the import is marked as
+// cancelled.
+func (s *ImportSupervisor) transitionImportCancelRequested(imp *model.Import, installation *cloud.InstallationDTO, logger log.FieldLogger) string {
+	if installation.State != cloud.InstallationStateStable {
+		logger.Debug("Waiting for installation to be stable")
+		return imp.State
+	}
+
+	logger.Info("Reverting installation configuration of cancelled import")
+	patch := getPostImportPatch(installation.Installation, s.importProfile(imp), imp.InstallationSnapshot, logger)
+	if patch == nil {
+		logger.Info("Import cancelled")
+		return model.ImportStateCancelled
+	}
+
+	err := s.handleInstallationUpdate(installation, patch, logger)
+	if err != nil {
+		logger.WithError(err).Error("Failed to update installation")
+	}
+
+	// Stay in this state until the reverted configuration is applied.
+	return imp.State
+}
+
 // startedImportIsComplete returns true if an Import with a nonzero
 // StartAt value has been completed, and false otherwise.
 func startedImportIsComplete(installation *cloud.InstallationDTO) bool {
@@ -335,34 +566,42 @@ func startedImportIsComplete(installation *cloud.InstallationDTO) bool {
 	return true
 }
 
-func getPreImportPatch(installation *cloud.Installation, logger log.FieldLogger) *cloud.PatchInstallationRequest {
+// takeInstallationSnapshot records the size and the whole PriorityEnv
+// of the Installation.
+func takeInstallationSnapshot(installation *cloud.Installation) *model.InstallationSnapshot {
+	snapshot := &model.InstallationSnapshot{
+		Size:        installation.Size,
+		PriorityEnv: cloud.EnvVarMap{},
+	}
+	for key, env := range installation.PriorityEnv {
+		snapshot.PriorityEnv[key] = env
+	}
+
+	return snapshot
+}
+
+// getPreImportPatch returns the patch adjusting the Installation to the
+// profile, or nil if it is adjusted already.
+func getPreImportPatch(installation *cloud.Installation, profile *model.ImportProfile, logger log.FieldLogger) *cloud.PatchInstallationRequest {
 	var adjustmentRequired bool
 	patch := &cloud.PatchInstallationRequest{}
 
-	importSize := model.Size1000String
-	if installation.Size != importSize {
-		logger.Debugf("Resizing installation to %s", importSize)
-		patch.Size = &importSize
+	if profile.Size != "" && installation.Size != profile.Size {
+		logger.Debugf("Resizing installation to %s", profile.Size)
+		size := profile.Size
+		patch.Size = &size
 		adjustmentRequired = true
 	}
 
 	// For the env overrides we need to look at both the priority and normal env
 	// vars for the installation to see if either is set.
 	envPatches := cloud.EnvVarMap{}
-
-	installationS3TimeoutEnvValue := getInstallationEnvValue(installation, model.S3EnvKey)
-	importS3TimeoutString := fmt.Sprintf("%d", model.S3ExtendedTimeout)
-	if installationS3TimeoutEnvValue != importS3TimeoutString {
-		logger.Debug("Extending S3 timeout to 48 hours")
-		envPatches[model.S3EnvKey] = cloud.EnvVar{Value: importS3TimeoutString}
-		adjustmentRequired = true
-	}
-	installationExtractContent := getInstallationEnvValue(installation, model.ExtractContentKey)
-	importExtractContent := model.ExtractContentDisabled
-	if installationExtractContent != importExtractContent {
-		logger.Debug("Disabling file content extraction")
-		envPatches[model.ExtractContentKey] = cloud.EnvVar{Value: importExtractContent}
-		adjustmentRequired = true
+	for key, value := range profile.Env {
+		if getInstallationEnvValue(installation, key) != value {
+			logger.Debugf("Setting %s to %s", key, value)
+			envPatches[key] = cloud.EnvVar{Value: value}
+			adjustmentRequired = true
+		}
 	}
 	if len(envPatches) != 0 {
 		patch.PriorityEnv = envPatches
@@ -384,30 +623,59 @@ func getInstallationEnvValue(installation *cloud.Installation, key string) strin
 	return installation.MattermostEnv[key].Value
 }
 
-func getPostImportPatch(installation *cloud.Installation, logger log.FieldLogger) *cloud.PatchInstallationRequest {
+// getPostImportPatch returns the patch restoring the Installation to
+// its snapshot, or nil if it is restored already. The Installation is
+// resized to the PostImportSize of the profile if it has one. Imports
+// which started adjusting their Installation before snapshots were
+// taken have none, in which case the Installation is resized to
+// SizeCloud10Users and the env vars of the profile are cleared.
+func getPostImportPatch(installation *cloud.Installation, profile *model.ImportProfile, snapshot *model.InstallationSnapshot, logger log.FieldLogger) *cloud.PatchInstallationRequest {
 	var adjustmentRequired bool
 	patch := &cloud.PatchInstallationRequest{}
 
-	defaultSize := model.SizeCloud10Users
-	if installation.Size == model.Size1000String {
-		logger.Debugf("Resizing installation to %s", defaultSize)
-		patch.Size = &defaultSize
+	size := profile.PostImportSize
+	if size == "" && snapshot != nil {
+		size = snapshot.Size
+	} else if size == "" && profile.Size != "" {
+		size = model.SizeCloud10Users
+	}
+	if size != "" && installation.Size != size {
+		logger.Debugf("Resizing installation to %s", size)
+		patch.Size = &size
 		adjustmentRequired = true
 	}
 
-	if installation.PriorityEnv[model.S3EnvKey].Value == fmt.Sprintf("%d", model.S3ExtendedTimeout) ||
-		installation.PriorityEnv[model.ExtractContentKey].Value == model.ExtractContentDisabled {
-		// NOTE: We want to clear the priority env var instead of setting it to
-		// a default value so that standard group environment variables are not
-		// ignored on the installation. Clearing the priority env vars will
-		// remove other custom env vars that were set. In order to not add extra
-		// complexity that would be needed to see if other custom env vars need
-		// to be re-applied as a follow-up step, we will assume that clearing
-		// everything is okay. Installations receiving imports should always be
-		// newly-created so it's unlikely they should have overrides.
-		logger.Debug("Clearing all priority env to remove import overrides")
-		patch.PriorityEnv = cloud.EnvVarMap{}
-		adjustmentRequired = true
+	// The priority env vars are restored to exactly those of the
+	// snapshot, removing the ones set since, as an env var without a
+	// value is removed by the patch. Without a snapshot, only the env
+	// vars of the profile are reverted.
+	keys := map[string]bool{}
+	for key := range profile.Env {
+		keys[key] = true
+	}
+	if snapshot != nil {
+		for key := range installation.PriorityEnv {
+			keys[key] = true
+		}
+		for key := range snapshot.PriorityEnv {
+			keys[key] = true
+		}
+	}
+
+	envPatches := cloud.EnvVarMap{}
+	for key := range keys {
+		var original cloud.EnvVar
+		if snapshot != nil {
+			original = snapshot.PriorityEnv[key]
+		}
+		if !reflect.DeepEqual(installation.PriorityEnv[key], original) {
+			logger.Debugf("Restoring the original value of %s", key)
+			envPatches[key] = original
+			adjustmentRequired = true
+		}
+	}
+	if len(envPatches) != 0 {
+		patch.PriorityEnv = envPatches
 	}
 
 	if !adjustmentRequired {
@@ -2,8 +2,12 @@ package supervisor
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/mattermost/awat/internal/objectstore"
 	"github.com/mattermost/awat/model"
 	cloud "github.com/mattermost/mattermost-cloud/model"
 	log "github.com/sirupsen/logrus"
@@ -87,9 +91,25 @@ func TestGetPreImportPatch(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.testName, func(t *testing.T) {
 			logger := log.WithField("test", tc.testName)
-			require.Equal(t, tc.patch, getPreImportPatch(tc.installation, logger))
+			require.Equal(t, tc.patch, getPreImportPatch(tc.installation, model.DefaultImportProfile(), logger))
 		})
 	}
+
+	t.Run("custom profile", func(t *testing.T) {
+		profile := &model.ImportProfile{Env: map[string]string{"MM_CUSTOM": "value"}}
+		installation := &cloud.Installation{
+			Size: model.SizeCloud10Users,
+			MattermostEnv: cloud.EnvVarMap{
+				"MM_CUSTOM": cloud.EnvVar{Value: "other"},
+			},
+		}
+		require.Equal(t, &cloud.PatchInstallationRequest{
+			PriorityEnv: cloud.EnvVarMap{"MM_CUSTOM": cloud.EnvVar{Value: "value"}},
+		}, getPreImportPatch(installation, profile, log.WithField("test", "custom profile")))
+
+		installation.MattermostEnv["MM_CUSTOM"] = cloud.EnvVar{Value: "value"}
+		require.Nil(t, getPreImportPatch(installation, profile, log.WithField("test", "custom profile")))
+	})
 }
 
 func TestGetPostImportPatch(t *testing.T) {
@@ -118,8 +138,11 @@ func TestGetPostImportPatch(t *testing.T) {
 				},
 			},
 			&cloud.PatchInstallationRequest{
-				Size:        &defaultSize,
-				PriorityEnv: cloud.EnvVarMap{},
+				Size: &defaultSize,
+				PriorityEnv: cloud.EnvVarMap{
+					model.S3EnvKey:          cloud.EnvVar{},
+					model.ExtractContentKey: cloud.EnvVar{},
+				},
 			},
 		},
 		{
@@ -140,7 +163,9 @@ func TestGetPostImportPatch(t *testing.T) {
 				},
 			},
 			&cloud.PatchInstallationRequest{
-				PriorityEnv: cloud.EnvVarMap{},
+				PriorityEnv: cloud.EnvVarMap{
+					model.S3EnvKey: cloud.EnvVar{},
+				},
 			},
 		},
 	}
@@ -148,7 +173,291 @@ func TestGetPostImportPatch(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.testName, func(t *testing.T) {
 			logger := log.WithField("test", tc.testName)
-			require.Equal(t, tc.patch, getPostImportPatch(tc.installation, logger))
+			require.Equal(t, tc.patch, getPostImportPatch(tc.installation, model.DefaultImportProfile(), nil, logger))
+		})
+	}
+
+	t.Run("restores snapshot", func(t *testing.T) {
+		logger := log.WithField("test", "restores snapshot")
+		profile := model.DefaultImportProfile()
+		original := &cloud.Installation{
+			Size: "100users",
+			PriorityEnv: cloud.EnvVarMap{
+				model.S3EnvKey: cloud.EnvVar{Value: "60000"},
+				"MM_CUSTOM":    cloud.EnvVar{Value: "kept"},
+			},
+		}
+		snapshot := takeInstallationSnapshot(original)
+
+		adjusted := &cloud.Installation{
+			Size: model.Size1000String,
+			PriorityEnv: cloud.EnvVarMap{
+				model.S3EnvKey:          cloud.EnvVar{Value: timeoutString},
+				model.ExtractContentKey: cloud.EnvVar{Value: model.ExtractContentDisabled},
+				"MM_CUSTOM":             cloud.EnvVar{Value: "changed"},
+				"MM_ADDED":              cloud.EnvVar{Value: "added"},
+			},
+		}
+		originalSize := "100users"
+		require.Equal(t, &cloud.PatchInstallationRequest{
+			Size: &originalSize,
+			PriorityEnv: cloud.EnvVarMap{
+				model.S3EnvKey:          cloud.EnvVar{Value: "60000"},
+				model.ExtractContentKey: cloud.EnvVar{},
+				"MM_CUSTOM":             cloud.EnvVar{Value: "kept"},
+				"MM_ADDED":              cloud.EnvVar{},
+			},
+		}, getPostImportPatch(adjusted, profile, snapshot, logger))
+
+		// restoring the patch yields exactly the original PriorityEnv
+		adjusted.PriorityEnv.Patch(getPostImportPatch(adjusted, profile, snapshot, logger).PriorityEnv)
+		require.Equal(t, original.PriorityEnv, adjusted.PriorityEnv)
+
+		require.Nil(t, getPostImportPatch(original, profile, snapshot, logger))
+
+		profile.PostImportSize = model.SizeCloud10Users
+		require.Equal(t, &cloud.PatchInstallationRequest{
+			Size: &defaultSize,
+		}, getPostImportPatch(original, profile, snapshot, logger))
+	})
+}
+
+func TestTransitionImportCancelRequested(t *testing.T) {
+	supervisor := &ImportSupervisor{}
+	logger := log.WithField("test", "cancel")
+	imp := &model.Import{State: model.ImportStateCancelRequested}
+
+	t.Run("installation not stable", func(t *testing.T) {
+		installation := &cloud.InstallationDTO{Installation: &cloud.Installation{
+			State: cloud.InstallationStateImportInProgress,
+			Size:  model.Size1000String,
+		}}
+		require.Equal(t, model.ImportStateCancelRequested, supervisor.transitionImport(imp, installation, logger))
+	})
+
+	t.Run("installation reverted", func(t *testing.T) {
+		installation := &cloud.InstallationDTO{Installation: &cloud.Installation{
+			State: cloud.InstallationStateStable,
+			Size:  model.SizeCloud10Users,
+		}}
+		require.Equal(t, model.ImportStateCancelled, supervisor.transitionImport(imp, installation, logger))
+	})
+}
+
+// fakeImportStore records the claims released by the ImportSupervisor.
+type fakeImportStore struct {
+	importStore
+	translation *model.Translation
+	released    []string
+}
+
+func (s *fakeImportStore) GetTranslation(id string) (*model.Translation, error) {
+	return s.translation, nil
+}
+
+func (s *fakeImportStore) UpdateImport(imp *model.Import) error {
+	return nil
+}
+
+func (s *fakeImportStore) RenewImportLock(id, owner string) (bool, error) {
+	return true, nil
+}
+
+func (s *fakeImportStore) ReleaseImportClaim(imp *model.Import, reason string) (bool, error) {
+	s.released = append(s.released, imp.ImportBy+":"+reason)
+	imp.ImportBy = ""
+	return true, nil
+}
+
+func TestTransitionImportRequestedVerifiesArchive(t *testing.T) {
+	objectStore, err := objectstore.NewLocalObjectStore(t.TempDir())
+	require.NoError(t, err)
+	archive := filepath.Join(t.TempDir(), "archive.zip")
+	require.NoError(t, os.WriteFile(archive, []byte("mattermost archive"), 0600))
+	require.NoError(t, objectStore.Upload(archive, "translationID.zip"))
+	checksum, err := objectstore.FileChecksum(archive)
+	require.NoError(t, err)
+
+	installation := &cloud.InstallationDTO{Installation: &cloud.Installation{
+		State: cloud.InstallationStateStable,
+		Size:  model.Size1000String,
+		PriorityEnv: cloud.EnvVarMap{
+			model.S3EnvKey:          cloud.EnvVar{Value: fmt.Sprintf("%d", model.S3ExtendedTimeout)},
+			model.ExtractContentKey: cloud.EnvVar{Value: model.ExtractContentDisabled},
+		},
+	}}
+	logger := log.WithField("test", "verify")
+
+	t.Run("matching archive", func(t *testing.T) {
+		store := &fakeImportStore{translation: &model.Translation{ID: "translationID", OutputChecksum: checksum}}
+		supervisor := &ImportSupervisor{store: store, objectStore: objectStore}
+		imp := &model.Import{State: model.ImportStateRequested, TranslationID: "translationID"}
+
+		require.Equal(t, model.ImportStateInProgress, supervisor.transitionImport(imp, installation, logger))
+		require.Empty(t, imp.Error)
+		require.NotNil(t, imp.InstallationSnapshot)
+	})
+
+	t.Run("corrupt archive", func(t *testing.T) {
+		store := &fakeImportStore{translation: &model.Translation{ID: "translationID", OutputChecksum: "other checksum"}}
+		supervisor := &ImportSupervisor{store: store, objectStore: objectStore}
+		imp := &model.Import{State: model.ImportStateRequested, TranslationID: "translationID"}
+
+		require.Equal(t, model.ImportStateFailed, supervisor.transitionImport(imp, installation, logger))
+		require.Contains(t, imp.Error, "translationID.zip has checksum "+checksum+" instead of other checksum")
+		require.Nil(t, imp.InstallationSnapshot, "the installation is not adjusted")
+	})
+
+	t.Run("missing archive", func(t *testing.T) {
+		store := &fakeImportStore{translation: &model.Translation{ID: "otherID", OutputChecksum: checksum}}
+		supervisor := &ImportSupervisor{store: store, objectStore: objectStore}
+		imp := &model.Import{State: model.ImportStateRequested, TranslationID: "otherID"}
+
+		require.Equal(t, model.ImportStateRequested, supervisor.transitionImport(imp, installation, logger), "the archive is verified again")
+		require.Empty(t, imp.Error)
+	})
+}
+
+func TestExpireImport(t *testing.T) {
+	store := &fakeImportStore{}
+	supervisor := &ImportSupervisor{store: store, options: ImportSupervisorOptions{
+		InstallationTimeout: time.Hour,
+		ImportTimeout:       3 * time.Hour,
+	}}
+	installation := &cloud.InstallationDTO{Installation: &cloud.Installation{
+		State: cloud.InstallationStateUpdateInProgress,
+	}}
+	logger := log.WithField("test", "expire")
+	ago := func(d time.Duration) int64 {
+		return model.GetMillis() - d.Milliseconds()
+	}
+	snapshot := &model.InstallationSnapshot{}
+
+	var testCases = []struct {
+		testName string
+		imp      *model.Import
+		state    string
+		expired  bool
+	}{
+		{
+			"within deadline",
+			&model.Import{State: model.ImportStateRequested, StateChangeAt: ago(30 * time.Minute)},
+			model.ImportStateRequested,
+			false,
+		},
+		{
+			"requested past deadline",
+			&model.Import{State: model.ImportStateRequested, StateChangeAt: ago(2 * time.Hour)},
+			model.ImportStateFailed,
+			true,
+		},
+		{
+			"requested again past deadline",
+			&model.Import{State: model.ImportStateRequested, StateChangeAt: ago(2 * time.Hour), InstallationSnapshot: snapshot},
+			model.ImportStateComplete,
+			true,
+		},
+		{
+			"deadline counted from creation",
+			&model.Import{State: model.ImportStateRequested, CreateAt: ago(2 * time.Hour)},
+			model.ImportStateFailed,
+			true,
+		},
+		{
+			"pre-adjustment past deadline",
+			&model.Import{State: model.ImportStateInstallationPreAdjustment, StateChangeAt: ago(2 * time.Hour), InstallationSnapshot: snapshot},
+			model.ImportStateComplete,
+			true,
+		},
+		{
+			"in progress within import deadline",
+			&model.Import{State: model.ImportStateInProgress, StateChangeAt: ago(2 * time.Hour)},
+			model.ImportStateInProgress,
+			false,
+		},
+		{
+			"in progress past import deadline",
+			&model.Import{State: model.ImportStateInProgress, StateChangeAt: ago(4 * time.Hour), InstallationSnapshot: snapshot},
+			model.ImportStateComplete,
+			true,
+		},
+		{
+			"complete past deadline",
+			&model.Import{State: model.ImportStateComplete, StateChangeAt: ago(2 * time.Hour), InstallationSnapshot: snapshot, CompleteAt: ago(3 * time.Hour)},
+			model.ImportStateComplete,
+			true,
+		},
+		{
+			"post-adjustment past deadline",
+			&model.Import{State: model.ImportStateInstallationPostAdjustment, StateChangeAt: ago(2 * time.Hour), InstallationSnapshot: snapshot},
+			model.ImportStateComplete,
+			true,
+		},
+		{
+			"cancel requested past deadline",
+			&model.Import{State: model.ImportStateCancelRequested, StateChangeAt: ago(2 * time.Hour), InstallationSnapshot: snapshot},
+			model.ImportStateCancelRequested,
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			oldState := tc.imp.State
+			state, reason := supervisor.expireImport(tc.imp, installation, logger)
+			require.Equal(t, tc.state, state)
+			if !tc.expired {
+				require.Empty(t, reason)
+				require.Empty(t, tc.imp.Error)
+				return
+			}
+			require.Contains(t, reason, oldState)
+			require.Contains(t, reason, cloud.InstallationStateUpdateInProgress)
+			require.Equal(t, reason, tc.imp.Error)
+			if state == model.ImportStateComplete {
+				require.NotZero(t, tc.imp.CompleteAt)
+			}
 		})
 	}
+
+	t.Run("in progress releases provisioner claim", func(t *testing.T) {
+		store.released = nil
+		imp := &model.Import{State: model.ImportStateInProgress, StateChangeAt: ago(4 * time.Hour), InstallationSnapshot: snapshot, ImportBy: "provisioner", StartAt: ago(4 * time.Hour)}
+		state, _ := supervisor.expireImport(imp, installation, logger)
+		require.Equal(t, model.ImportStateComplete, state)
+		require.Equal(t, []string{"provisioner:" + model.LockReleaseReasonExpired}, store.released)
+		require.Empty(t, imp.ImportBy)
+		require.NotZero(t, imp.CompleteAt)
+	})
+
+	t.Run("expired import fails once reverted", func(t *testing.T) {
+		imp := &model.Import{State: model.ImportStateInstallationPreAdjustment, StateChangeAt: ago(2 * time.Hour), InstallationSnapshot: &model.InstallationSnapshot{Size: model.SizeCloud10Users}}
+		state, _ := supervisor.expireImport(imp, installation, logger)
+		imp.State = state
+
+		reverted := &cloud.InstallationDTO{Installation: &cloud.Installation{
+			State: cloud.InstallationStateStable,
+			Size:  model.SizeCloud10Users,
+		}}
+		require.Equal(t, model.ImportStateFailed, supervisor.transitionImport(imp, reverted, logger))
+	})
+
+	t.Run("expired cancelled import is cancelled once reverted", func(t *testing.T) {
+		imp := &model.Import{State: model.ImportStateCancelRequested, StateChangeAt: ago(2 * time.Hour), InstallationSnapshot: &model.InstallationSnapshot{Size: model.SizeCloud10Users}}
+		state, _ := supervisor.expireImport(imp, installation, logger)
+		imp.State = state
+
+		reverted := &cloud.InstallationDTO{Installation: &cloud.Installation{
+			State: cloud.InstallationStateStable,
+			Size:  model.SizeCloud10Users,
+		}}
+		require.Equal(t, model.ImportStateCancelled, supervisor.transitionImport(imp, reverted, logger))
+	})
+
+	t.Run("no deadline", func(t *testing.T) {
+		imp := &model.Import{State: model.ImportStateRequested, StateChangeAt: ago(1000 * time.Hour)}
+		state, reason := (&ImportSupervisor{}).expireImport(imp, installation, logger)
+		require.Equal(t, model.ImportStateRequested, state)
+		require.Empty(t, reason)
+	})
 }
@@ -0,0 +1,97 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package supervisor
+
+import (
+	"time"
+
+	"github.com/mattermost/awat/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// reapInterval is how often the LockReaper looks for expired leases.
+const reapInterval = time.Minute
+
+// LockReaper releases the locks on Translations and Imports whose
+// owners stopped renewing their leases, e.g. because the pod they ran
+// in crashed, so that the work can be picked up again.
+type LockReaper struct {
+	store  lockStore
+	logger log.FieldLogger
+}
+
+// lockStore defines the interface for releasing expired locks.
+type lockStore interface {
+	eventStore
+	GetTranslationsWithExpiredLock(now int64) ([]*model.Translation, error)
+	ReleaseTranslationLock(translation *model.Translation, reason string) (bool, error)
+	GetImportsWithExpiredLocks(now int64) ([]*model.Import, error)
+	ReleaseImportLock(imp *model.Import, reason string) (bool, error)
+	ReleaseImportClaim(imp *model.Import, reason string) (bool, error)
+}
+
+// NewLockReaper creates a new LockReaper.
+func NewLockReaper(store lockStore, logger log.FieldLogger) *LockReaper {
+	return &LockReaper{
+		store:  store,
+		logger: logger.WithField("lock-reaper", model.NewID()),
+	}
+}
+
+// Start runs the LockReaper on a new goroutine forever.
+func (r *LockReaper) Start() {
+	r.logger.Info("Lock reaper started")
+	go func() {
+		tick := time.NewTicker(reapInterval)
+		for range tick.C {
+			r.reap(model.GetMillis())
+		}
+	}()
+}
+
+// reap releases every lock whose lease expired before now.
+func (r *LockReaper) reap(now int64) {
+	translations, err := r.store.GetTranslationsWithExpiredLock(now)
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to query for expired translation locks")
+	}
+	for _, translation := range translations {
+		logger := r.logger.WithFields(log.Fields{"translation": translation.ID, "owner": translation.LockedBy})
+		oldState := translation.State()
+		released, err := r.store.ReleaseTranslationLock(translation, model.LockReleaseReasonExpired)
+		if err != nil {
+			logger.WithError(err).Error("Failed to release expired translation lock")
+		} else if released {
+			logger.Warn("Released expired translation lock")
+			emitEvent(r.store, model.NewTranslationEvent(translation, oldState), logger)
+		}
+	}
+
+	imports, err := r.store.GetImportsWithExpiredLocks(now)
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to query for expired import locks")
+	}
+	for _, imp := range imports {
+		if imp.LockedBy != "" && imp.LockExpiresAt < now {
+			logger := r.logger.WithFields(log.Fields{"import": imp.ID, "owner": imp.LockedBy})
+			released, err := r.store.ReleaseImportLock(imp, model.LockReleaseReasonExpired)
+			if err != nil {
+				logger.WithError(err).Error("Failed to release expired import lock")
+			} else if released {
+				logger.Warn("Released expired import lock")
+			}
+		}
+
+		if imp.ImportBy != "" && imp.ImportByExpiresAt < now {
+			logger := r.logger.WithFields(log.Fields{"import": imp.ID, "provisioner": imp.ImportBy})
+			released, err := r.store.ReleaseImportClaim(imp, model.LockReleaseReasonExpired)
+			if err != nil {
+				logger.WithError(err).Error("Failed to release expired provisioner claim on import")
+			} else if released {
+				logger.Warn("Released expired provisioner claim on import")
+			}
+		}
+	}
+}
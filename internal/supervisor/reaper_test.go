@@ -0,0 +1,84 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package supervisor
+
+import (
+	"testing"
+
+	"github.com/mattermost/awat/internal/testlib"
+	"github.com/mattermost/awat/model"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeLockStore struct {
+	translations []*model.Translation
+	imports      []*model.Import
+
+	releasedTranslations []string
+	releasedImportLocks  []string
+	releasedImportClaims []string
+	events               []*model.WebhookEvent
+}
+
+func (s *fakeLockStore) CreateWebhookEvent(event *model.WebhookEvent) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *fakeLockStore) GetTranslationsWithExpiredLock(now int64) ([]*model.Translation, error) {
+	return s.translations, nil
+}
+
+func (s *fakeLockStore) ReleaseTranslationLock(translation *model.Translation, reason string) (bool, error) {
+	s.releasedTranslations = append(s.releasedTranslations, translation.ID+":"+reason)
+	translation.LockedBy = ""
+	if translation.CompleteAt == 0 && translation.FailAt == 0 {
+		translation.StartAt = 0
+	}
+	return true, nil
+}
+
+func (s *fakeLockStore) GetImportsWithExpiredLocks(now int64) ([]*model.Import, error) {
+	return s.imports, nil
+}
+
+func (s *fakeLockStore) ReleaseImportLock(imp *model.Import, reason string) (bool, error) {
+	s.releasedImportLocks = append(s.releasedImportLocks, imp.ID+":"+reason)
+	return true, nil
+}
+
+func (s *fakeLockStore) ReleaseImportClaim(imp *model.Import, reason string) (bool, error) {
+	s.releasedImportClaims = append(s.releasedImportClaims, imp.ID+":"+reason)
+	return true, nil
+}
+
+func TestLockReaperReap(t *testing.T) {
+	now := int64(1000)
+	store := &fakeLockStore{
+		translations: []*model.Translation{
+			{ID: "t1", InstallationID: "installation", LockedBy: "pod-a/worker-1", LockExpiresAt: now - 1, StartAt: now - 10},
+			{ID: "t2", LockedBy: "pod-a/worker-2", LockExpiresAt: now - 1, StartAt: now - 10, CompleteAt: now - 5},
+		},
+		imports: []*model.Import{
+			{ID: "i1", LockedBy: "pod-a", LockExpiresAt: now - 1, ImportBy: "provisioner", ImportByExpiresAt: now + 1},
+			{ID: "i2", ImportBy: "provisioner", ImportByExpiresAt: now - 1},
+			{ID: "i3", LockedBy: "pod-b", LockExpiresAt: now - 1, ImportBy: "provisioner", ImportByExpiresAt: now - 1},
+		},
+	}
+
+	reaper := NewLockReaper(store, testlib.MakeLogger(t))
+	reaper.reap(now)
+
+	assert.Equal(t, []string{"t1:lease-expired", "t2:lease-expired"}, store.releasedTranslations)
+	if assert.Len(t, store.events, 1) {
+		assert.Equal(t, model.WebhookEventTranslation, store.events[0].Type)
+		assert.Equal(t, "t1", store.events[0].ResourceID)
+		assert.Equal(t, "installation", store.events[0].InstallationID)
+		assert.Equal(t, model.TranslationStateInProgress, store.events[0].OldState)
+		assert.Equal(t, model.TranslationStateRequested, store.events[0].NewState)
+	}
+	assert.Equal(t, []string{"i1:lease-expired", "i3:lease-expired"}, store.releasedImportLocks)
+	assert.Equal(t, []string{"i2:lease-expired", "i3:lease-expired"}, store.releasedImportClaims)
+}
@@ -5,144 +5,484 @@
 package supervisor
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"time"
 
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/mattermost/awat/internal/common"
+	"github.com/mattermost/awat/internal/objectstore"
 	"github.com/mattermost/awat/internal/store"
 	"github.com/mattermost/awat/internal/translator"
 	"github.com/mattermost/awat/internal/validators"
 	"github.com/mattermost/awat/model"
 )
 
-// TranslationSupervisor is responsible for scheduling and launching Translations
-// in series
+// watchInterval is how often the lock on a running Translation is
+// renewed and the Translation is checked for having been cancelled or
+// having exceeded the disk budget of its worker. It needs to be well
+// below store.LockLease.
+const watchInterval = 10 * time.Second
+
+// pollInterval is how long an idle worker waits before looking for
+// work again.
+const pollInterval = 60 * time.Second
+
+// maxRetryDelay caps the delay between two attempts of a Translation.
+const maxRetryDelay = time.Hour
+
+// errTranslationCancelled is the cause of the interruption of a
+// Translation which was cancelled while it was running.
+var errTranslationCancelled = errors.New("translation was cancelled")
+
+// errLockLost is the cause of the interruption of a Translation whose
+// worker lost its lock, e.g. because its lease expired and was reaped
+// while the worker was unable to renew it.
+var errLockLost = errors.New("lost the lock on the translation")
+
+// TranslationSupervisor is responsible for scheduling and launching
+// Translations on a pool of workers
 type TranslationSupervisor struct {
-	logger  log.FieldLogger
-	store   *store.SQLStore
-	bucket  string
-	workdir string
+	logger      log.FieldLogger
+	store       *store.SQLStore
+	objectStore objectstore.ObjectStore
+	workers     []*translationWorker
+	maxAttempts int
+	retryDelay  time.Duration
+
+	attachmentWorkers int
+	encryptor         *common.Encryptor
+}
+
+// TranslationSupervisorOptions holds the settings of a
+// TranslationSupervisor.
+type TranslationSupervisorOptions struct {
+	// Workdir is the directory below which every worker gets its own
+	// working directory.
+	Workdir string
+
+	// Workers is the number of Translations performed concurrently.
+	Workers int
+
+	// InstanceID identifies this instance of the AWAT, e.g. by the
+	// name of its pod. It is combined with the number of a worker to
+	// form the stable identity the worker locks Translations with.
+	InstanceID string
+
+	// DiskBudget is the number of bytes every worker may use below
+	// its working directory. A Translation exceeding it fails.
+	DiskBudget int64
+
+	// MaxAttempts is how often a Translation failing for a transient
+	// reason is attempted.
+	MaxAttempts int
+
+	// RetryDelay is the delay before the second attempt of a
+	// Translation; it doubles with every further attempt.
+	RetryDelay time.Duration
+
+	// AttachmentWorkers is the number of attached files a Translation
+	// fetches concurrently, or 0 for the default of its translator.
+	AttachmentWorkers int
+
+	// Encryptor decrypts the Slack tokens of Translations. Without it,
+	// Translations with a Slack token fail.
+	Encryptor *common.Encryptor
+}
+
+// translationWorker performs one Translation at a time in its own
+// working directory.
+type translationWorker struct {
+	id         string
+	workdir    string
+	diskBudget int64
 }
 
 // NewTranslationSupervisor returns a Supervisor prepared with the needed
-// metadata to operate
-func NewTranslationSupervisor(store *store.SQLStore, logger log.FieldLogger, bucket, workdir string) *TranslationSupervisor {
-	return &TranslationSupervisor{
-		store:   store,
-		logger:  logger.WithField("translation-supervisor", model.NewID()),
-		bucket:  bucket,
-		workdir: workdir,
+// metadata to operate, creating the working directories of its workers.
+func NewTranslationSupervisor(store *store.SQLStore, logger log.FieldLogger, objectStore objectstore.ObjectStore, options TranslationSupervisorOptions) (*TranslationSupervisor, error) {
+	if options.Workers < 1 {
+		return nil, errors.New("at least one translation worker is required")
 	}
+
+	s := &TranslationSupervisor{
+		store:       store,
+		logger:      logger.WithField("translation-supervisor", options.InstanceID),
+		objectStore: objectStore,
+		maxAttempts: options.MaxAttempts,
+		retryDelay:  options.RetryDelay,
+
+		attachmentWorkers: options.AttachmentWorkers,
+		encryptor:         options.Encryptor,
+	}
+
+	for i := 0; i < options.Workers; i++ {
+		worker := &translationWorker{
+			id:         fmt.Sprintf("%s/worker-%d", options.InstanceID, i),
+			workdir:    filepath.Join(options.Workdir, fmt.Sprintf("worker-%d", i)),
+			diskBudget: options.DiskBudget,
+		}
+
+		// The working directory only ever holds files of a running
+		// Translation, so anything left over is from a previous run
+		// of the worker which did not finish.
+		err := os.RemoveAll(worker.workdir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to clear working directory %s", worker.workdir)
+		}
+		err = os.MkdirAll(worker.workdir, 0700)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create working directory %s", worker.workdir)
+		}
+
+		s.workers = append(s.workers, worker)
+	}
+
+	return s, nil
 }
 
-// Start runs the Supervisor's main routine on a new goroutine both
-// periodically and forever
+// Start runs every worker of the Supervisor on its own goroutine
+// forever. A worker looks for the next Translation right after
+// finishing one and waits between looks while there is no work.
 func (s *TranslationSupervisor) Start() {
-	s.logger.Info("Translation supervisor started")
-	go func() {
-		for {
-			s.supervise()
-			time.Sleep(60 * time.Second) // TODO: make this configurable
-		}
-	}()
+	s.logger.Infof("Translation supervisor started with %d workers", len(s.workers))
+	for _, worker := range s.workers {
+		go func(worker *translationWorker) {
+			for {
+				if !s.supervise(worker) {
+					time.Sleep(pollInterval)
+				}
+			}
+		}(worker)
+	}
 }
 
-// supervise queries the database for available Translations and
-// works through the batch returned serially
-func (s *TranslationSupervisor) supervise() {
+// supervise claims the oldest Translation ready to start for the
+// worker and performs it. It returns true if the worker should look
+// for more work right away.
+func (s *TranslationSupervisor) supervise(worker *translationWorker) bool {
 	translation, err := s.store.GetTranslationReadyToStart()
 	if err != nil {
 		s.logger.WithError(err).Error("Failed to query database for pending translations")
-		return
+		return false
 	}
 	if translation == nil {
-		return
+		return false
 	}
 
-	logger := s.logger.WithFields(log.Fields{"translation": translation.ID, "installation": translation.InstallationID})
-	logger.Info("Beginning translation")
+	logger := s.logger.WithFields(log.Fields{"translation": translation.ID, "installation": translation.InstallationID, "worker": worker.id})
 
-	// TODO XXX expose the Pod name as an env var and use it as the second argument here
-	err = s.store.TryLockTranslation(translation, model.NewID())
+	err = s.store.TryLockTranslation(translation, worker.id)
 	if err != nil {
-		logger.WithError(err).Error("failed to lock translation")
-		return
+		// Most likely another worker claimed the Translation first.
+		logger.WithError(err).Debug("Failed to lock translation")
+		return true
 	}
+	logger.Info("Beginning translation")
 	defer func() {
 		if err := s.store.UnlockTranslation(translation); err != nil {
 			logger.WithError(err).Error("error unlocking translation")
 		}
 	}()
 
+	// Losing the lock interrupts the Translation, as well as any work
+	// derived from lockCtx.
+	lockCtx, loseLock := context.WithCancelCause(context.Background())
+	defer loseLock(nil)
+	go s.keepLock(lockCtx, loseLock, translation.ID, worker, logger)
+
+	if s.isCancelled(translation, logger) {
+		logger.Info("Translation was cancelled before it started")
+		return true
+	}
+
+	slackToken, err := s.decryptSlackToken(translation)
+	if err != nil {
+		logger.WithError(err).Error("Failed to decrypt the Slack token")
+		s.recordFailure(translation, common.Permanent(err), logger)
+		return true
+	}
+
 	trans, err := translator.NewTranslator(
 		&translator.TranslatorOptions{
 			ArchiveType: translation.Type,
-			Bucket:      s.bucket,
-			WorkingDir:  s.workdir,
+			ObjectStore: s.objectStore,
+			WorkingDir:  worker.workdir,
+
+			AttachmentWorkers: s.attachmentWorkers,
+			SlackToken:        slackToken,
 		})
 	if err != nil {
 		logger.WithError(err).Error("Failed to create translator")
-		return
+		s.recordFailure(translation, common.Permanent(err), logger)
+		return true
 	}
 
+	oldState := translation.State()
 	translation.StartAt = model.GetMillis()
+	translation.Attempts++
 	err = s.store.UpdateTranslation(translation)
 	if err != nil {
 		logger.WithError(err).Error("Failed to mark translation as started")
-		return
+		return true
 	}
+	emitEvent(s.store, model.NewTranslationEvent(translation, oldState), logger)
 
-	output, err := trans.Translate(translation)
-	if err != nil {
-		logger.WithError(err).Error("Failed translation")
-		return
-	}
+	ctx, cancel := context.WithCancelCause(lockCtx)
+	defer cancel(nil)
+	go s.watchTranslation(ctx, cancel, translation.ID, worker, logger)
+	ctx = common.WithProgress(ctx, newProgressReporter(s.store, translation, logger).report)
 
-	translation.CompleteAt = model.GetMillis()
-	err = s.store.UpdateTranslation(translation)
-	if err != nil {
-		logger.WithError(err).Error("Failed to mark translation as completed")
-		return
-	}
+	output, err := trans.Translate(ctx, translation)
 	defer func() {
 		if err := trans.Cleanup(); err != nil {
 			logger.WithError(err).Error("error cleaning up translation")
 		}
 	}()
+	if ctx.Err() != nil {
+		cause := context.Cause(ctx)
+		if cause == errTranslationCancelled {
+			logger.Info("Translation cancelled")
+			return true
+		}
+		if cause == errLockLost {
+			// whoever holds the lock now is responsible for the
+			// Translation
+			logger.Warn("Translation interrupted after losing its lock")
+			return true
+		}
+		logger.WithError(cause).Error("Translation interrupted")
+		s.recordFailure(translation, cause, logger)
+		return true
+	}
+	if err != nil {
+		logger.WithError(err).Error("Failed translation")
+		s.recordFailure(translation, err, logger)
+		return true
+	}
+	cancel(nil)
+
+	if s.isCancelled(translation, logger) {
+		logger.Info("Translation was cancelled as it finished")
+		return true
+	}
 
 	// Only validate if the origin is not a mattermost type, since we validate those on the API calls
 	if translation.Type != model.MattermostWorkspaceBackupType {
 		logger.Info("Validating translation result")
+		common.ReportProgress(ctx, model.TranslationPhaseValidate, "Validating the Mattermost archive", 0, 0)
 		// Validate the translation before considering it "importable"
 		validator, err := validators.NewValidator(model.MattermostWorkspaceBackupType)
 		if err != nil {
 			logger.WithError(err).Error("error getting validator")
-			return
+			s.recordFailure(translation, err, logger)
+			return true
 		}
 
 		localArchivePath, err := trans.GetOutputArchiveLocalPath()
 		if err != nil {
 			logger.WithError(err).Error("error getting local archive path for validation")
-			return
+			s.recordFailure(translation, err, logger)
+			return true
 		}
 		if localArchivePath != "" {
-			if err := validator.Validate(localArchivePath); err != nil {
+			report, err := validator.Validate(localArchivePath)
+			if err != nil {
+				logger.WithError(err).Error("error validating translation output")
+				s.recordFailure(translation, err, logger)
+				return true
+			}
+			if err := report.Err(); err != nil {
 				logger.WithError(err).Error("validation error on translation output")
-				return
+				s.recordFailure(translation, common.Permanent(errors.Wrap(err, "translation output is invalid")), logger)
+				return true
 			}
 		}
 	} else {
 		logger.Debug("Skipping validation since input already was a mattermost archive, assuming already validated")
 	}
 
-	importResource := fmt.Sprintf("%s/%s", s.bucket, output)
+	checksum, err := trans.GetOutputArchiveChecksum()
+	if err != nil {
+		logger.WithError(err).Error("error getting checksum of translation output")
+		s.recordFailure(translation, err, logger)
+		return true
+	}
+
+	if lockCtx.Err() != nil {
+		logger.Warn("Lost the lock on the translation before it completed")
+		return true
+	}
+
+	oldState = translation.State()
+	translation.CompleteAt = model.GetMillis()
+	translation.OutputChecksum = checksum
+	translation.Error = ""
+	err = s.store.UpdateTranslation(translation)
+	if err != nil {
+		logger.WithError(err).Error("Failed to mark translation as completed")
+		return true
+	}
+	emitEvent(s.store, model.NewTranslationEvent(translation, oldState), logger)
+
+	if translation.SlackToken != "" {
+		err = s.store.DeleteTranslationSlackToken(translation.ID)
+		if err != nil {
+			logger.WithError(err).Error("Failed to delete the Slack token of the completed translation")
+		}
+		translation.SlackToken = ""
+	}
+
+	importResource := fmt.Sprintf("%s/%s", s.objectStore.Bucket(), output)
 	imp := model.NewImport(translation.ID, importResource)
 	err = s.store.CreateImport(imp)
 	if err != nil {
 		logger.WithError(err).Error("Failed to create an import for translation")
-		return
+		return true
 	}
+	emitEvent(s.store, model.NewImportEvent(imp, translation.InstallationID, ""), logger)
 
 	logger.Info("Translation completed")
+	return true
+}
+
+// decryptSlackToken returns the plaintext of the Slack token of the
+// Translation, or an empty string if it has none.
+func (s *TranslationSupervisor) decryptSlackToken(translation *model.Translation) (string, error) {
+	if translation.SlackToken == "" {
+		return "", nil
+	}
+	if s.encryptor == nil {
+		return "", errors.New("the translation has a Slack token, but no encryption key is configured to decrypt it with")
+	}
+
+	return s.encryptor.Decrypt(translation.SlackToken)
+}
+
+// recordFailure stores the failure of the Translation. Unless err is
+// permanent or the Translation has used up its attempts, it is
+// scheduled to be attempted again after a delay which doubles with
+// every attempt; otherwise it is marked as failed.
+func (s *TranslationSupervisor) recordFailure(translation *model.Translation, err error, logger log.FieldLogger) {
+	oldState := translation.State()
+	now := model.GetMillis()
+	s.scheduleRetryOrFail(translation, err, now)
+	if translation.FailAt != 0 {
+		logger.Warnf("Translation failed after %d attempts", translation.Attempts)
+	} else {
+		logger.Infof("Translation will be attempted again in %s", time.Duration(translation.RetryAt-now)*time.Millisecond)
+	}
+
+	updateErr := s.store.UpdateTranslation(translation)
+	if updateErr != nil {
+		logger.WithError(updateErr).Error("Failed to store translation failure")
+		return
+	}
+	emitEvent(s.store, model.NewTranslationEvent(translation, oldState), logger)
+}
+
+// scheduleRetryOrFail updates the Translation for the failure err
+// which happened at now.
+func (s *TranslationSupervisor) scheduleRetryOrFail(translation *model.Translation, err error, now int64) {
+	translation.Error = err.Error()
+	if common.IsPermanent(err) || translation.Attempts >= s.maxAttempts {
+		translation.FailAt = now
+		return
+	}
+
+	translation.StartAt = 0
+	translation.RetryAt = now + s.delayBeforeAttempt(translation.Attempts+1).Milliseconds()
+}
+
+// delayBeforeAttempt returns how long to wait before the given attempt
+// of a Translation.
+func (s *TranslationSupervisor) delayBeforeAttempt(attempt int) time.Duration {
+	delay := s.retryDelay
+	for i := 2; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	return delay
+}
+
+// isCancelled returns true if the Translation has been cancelled since
+// it was read, or if that cannot be determined.
+func (s *TranslationSupervisor) isCancelled(translation *model.Translation, logger log.FieldLogger) bool {
+	current, err := s.store.GetTranslation(translation.ID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to check translation for cancellation")
+		return true
+	}
+
+	return current == nil || current.CancelAt != 0
+}
+
+// keepLock periodically renews the lock of the worker on the
+// Translation with the given ID until ctx is done, calling lost with
+// errLockLost if the worker no longer holds the lock.
+func (s *TranslationSupervisor) keepLock(ctx context.Context, lost context.CancelCauseFunc, translationID string, worker *translationWorker, logger log.FieldLogger) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			renewed, err := s.store.RenewTranslationLock(translationID, worker.id)
+			if err != nil {
+				logger.WithError(err).Warn("Failed to renew lock on translation")
+			} else if !renewed {
+				logger.Warn("Translation is no longer locked by this worker")
+				lost(errLockLost)
+				return
+			}
+		}
+	}
+}
+
+// watchTranslation periodically checks whether the Translation with
+// the given ID was cancelled or the working directory of the worker
+// has grown beyond its disk budget, calling cancel with the reason if
+// so, until ctx is done.
+func (s *TranslationSupervisor) watchTranslation(ctx context.Context, cancel context.CancelCauseFunc, translationID string, worker *translationWorker, logger log.FieldLogger) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			translation, err := s.store.GetTranslation(translationID)
+			if err != nil {
+				logger.WithError(err).Warn("Failed to check translation for cancellation")
+			} else if translation != nil && translation.CancelAt != 0 {
+				logger.Info("Interrupting cancelled translation")
+				cancel(errTranslationCancelled)
+				return
+			}
+
+			if worker.diskBudget <= 0 {
+				continue
+			}
+			usage, err := diskUsage(worker.workdir)
+			if err != nil {
+				logger.WithError(err).Warn("Failed to check disk usage of translation")
+				continue
+			}
+			if usage > worker.diskBudget {
+				logger.Warnf("Interrupting translation using %d bytes of disk space", usage)
+				cancel(common.Permanent(errors.Errorf("translation exceeded the disk budget of %d bytes per worker", worker.diskBudget)))
+				return
+			}
+		}
+	}
 }
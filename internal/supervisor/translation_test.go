@@ -0,0 +1,92 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mattermost/awat/internal/common"
+	"github.com/mattermost/awat/internal/testlib"
+	"github.com/mattermost/awat/model"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelayBeforeAttempt(t *testing.T) {
+	supervisor := &TranslationSupervisor{retryDelay: time.Minute}
+
+	assert.Equal(t, time.Minute, supervisor.delayBeforeAttempt(2))
+	assert.Equal(t, 2*time.Minute, supervisor.delayBeforeAttempt(3))
+	assert.Equal(t, 4*time.Minute, supervisor.delayBeforeAttempt(4))
+	assert.Equal(t, maxRetryDelay, supervisor.delayBeforeAttempt(20))
+}
+
+func TestScheduleRetryOrFail(t *testing.T) {
+	supervisor := &TranslationSupervisor{maxAttempts: 3, retryDelay: time.Minute}
+	now := int64(1000000)
+
+	t.Run("transient failure", func(t *testing.T) {
+		translation := &model.Translation{StartAt: 500, Attempts: 1}
+		supervisor.scheduleRetryOrFail(translation, errors.New("connection reset"), now)
+
+		require.Equal(t, model.TranslationStateRequested, translation.State())
+		assert.Equal(t, "connection reset", translation.Error)
+		assert.Equal(t, now+time.Minute.Milliseconds(), translation.RetryAt)
+	})
+
+	t.Run("attempts used up", func(t *testing.T) {
+		translation := &model.Translation{StartAt: 500, Attempts: 3}
+		supervisor.scheduleRetryOrFail(translation, errors.New("connection reset"), now)
+
+		require.Equal(t, model.TranslationStateFailed, translation.State())
+		assert.Equal(t, now, translation.FailAt)
+	})
+
+	t.Run("permanent failure", func(t *testing.T) {
+		translation := &model.Translation{StartAt: 500, Attempts: 1}
+		err := errors.Wrap(common.Permanent(errors.New("invalid archive")), "failed to transform")
+		supervisor.scheduleRetryOrFail(translation, err, now)
+
+		require.Equal(t, model.TranslationStateFailed, translation.State())
+		assert.Equal(t, "failed to transform: invalid archive", translation.Error)
+	})
+}
+
+func TestNewTranslationSupervisorWorkers(t *testing.T) {
+	workdir := t.TempDir()
+	leftover := filepath.Join(workdir, "worker-1", "crashed-translation", "input.zip")
+	require.NoError(t, os.MkdirAll(filepath.Dir(leftover), 0700))
+	require.NoError(t, os.WriteFile(leftover, []byte("leftover"), 0600))
+
+	supervisor, err := NewTranslationSupervisor(nil, testlib.MakeLogger(t), nil, TranslationSupervisorOptions{
+		Workdir:    workdir,
+		Workers:    2,
+		InstanceID: "awat-0",
+		DiskBudget: 1 << 30,
+	})
+	require.NoError(t, err)
+	require.Len(t, supervisor.workers, 2)
+
+	assert.Equal(t, "awat-0/worker-0", supervisor.workers[0].id)
+	assert.Equal(t, "awat-0/worker-1", supervisor.workers[1].id)
+	assert.Equal(t, filepath.Join(workdir, "worker-1"), supervisor.workers[1].workdir)
+	assert.NoFileExists(t, leftover)
+
+	usage, err := diskUsage(supervisor.workers[0].workdir)
+	require.NoError(t, err)
+	assert.Zero(t, usage)
+
+	require.NoError(t, os.WriteFile(filepath.Join(supervisor.workers[0].workdir, "output.zip"), make([]byte, 1000), 0600))
+	usage, err = diskUsage(supervisor.workers[0].workdir)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), usage)
+
+	_, err = NewTranslationSupervisor(nil, testlib.MakeLogger(t), nil, TranslationSupervisorOptions{Workdir: workdir})
+	assert.Error(t, err)
+}
@@ -0,0 +1,269 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package supervisor
+
+import (
+	"context"
+	"encoding/hex"
+	"os"
+	"time"
+
+	"github.com/mattermost/awat/internal/objectstore"
+	"github.com/mattermost/awat/internal/validators"
+	"github.com/mattermost/awat/model"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// uploadInterval is how often the UploadSupervisor looks for archives
+// which are due to be verified.
+const uploadInterval = 5 * time.Second
+
+// uploadBatchSize is the number of archives verified per interval.
+const uploadBatchSize = 10
+
+// uploadVerificationLease is how long an AWAT has to verify an archive
+// before another AWAT verifies it again. The claim is renewed every
+// uploadVerificationRenewal while the archive is verified, so that
+// verifying the largest archives may take longer than the lease.
+const uploadVerificationLease = 2 * time.Hour
+
+// uploadVerificationRenewal is how often the claim on an archive being
+// verified is renewed.
+const uploadVerificationRenewal = uploadVerificationLease / 4
+
+// errUploadClaimLost is returned when another AWAT claimed the
+// verification of an archive while it was being verified.
+var errUploadClaimLost = errors.New("lost the claim on the verification of the upload")
+
+// UploadSupervisor verifies the archives of completed upload sessions,
+// determines their checksums and then completes their Uploads. An
+// archive which fails verification is deleted and its Upload fails.
+type UploadSupervisor struct {
+	logger      log.FieldLogger
+	store       uploadStore
+	objectStore objectstore.ObjectStore
+	workdir     string
+}
+
+// uploadStore defines the interface for verifying the archives of
+// upload sessions.
+type uploadStore interface {
+	GetUploadSessionsPendingVerification(now int64, limit uint64) ([]*model.UploadSession, error)
+	ClaimUploadSessionVerification(session *model.UploadSession, verifyAt int64) (bool, error)
+	FinishUploadSessionVerification(id string) error
+	UpdateUploadValidation(uploadID string, report *model.ValidationReport) error
+	UpdateUploadChecksum(uploadID, checksum string) error
+	CompleteUpload(uploadID, errorMessage string) error
+}
+
+// NewUploadSupervisor creates a new UploadSupervisor which downloads
+// the archives it validates to workdir.
+func NewUploadSupervisor(store uploadStore, logger log.FieldLogger, objectStore objectstore.ObjectStore, workdir string) *UploadSupervisor {
+	return &UploadSupervisor{
+		logger:      logger.WithField("upload-supervisor", model.NewID()),
+		store:       store,
+		objectStore: objectStore,
+		workdir:     workdir,
+	}
+}
+
+// Start runs the UploadSupervisor on a new goroutine forever.
+func (s *UploadSupervisor) Start() {
+	s.logger.Info("Upload supervisor started")
+	go func() {
+		tick := time.NewTicker(uploadInterval)
+		for range tick.C {
+			s.do(model.GetMillis())
+		}
+	}()
+}
+
+// do verifies the archives which are due at now.
+func (s *UploadSupervisor) do(now int64) {
+	sessions, err := s.store.GetUploadSessionsPendingVerification(now, uploadBatchSize)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to query for upload sessions pending verification")
+		return
+	}
+
+	for _, session := range sessions {
+		logger := s.logger.WithField("upload", session.ID)
+
+		// Claiming the session for the duration of the verification
+		// keeps other AWATs from verifying it concurrently, and has it
+		// verified again should this one stop before completing the
+		// Upload.
+		claimed, err := s.store.ClaimUploadSessionVerification(session, now+uploadVerificationLease.Milliseconds())
+		if err != nil {
+			logger.WithError(err).Error("Failed to claim upload session")
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		claimCtx, loseClaim := context.WithCancelCause(context.Background())
+		go s.keepClaim(claimCtx, loseClaim, *session, uploadVerificationRenewal, logger)
+		err = s.verify(claimCtx, session, logger)
+		loseClaim(nil)
+		if err != nil {
+			logger.WithError(err).Error("Failed to record verification of upload")
+		}
+	}
+}
+
+// keepClaim periodically renews the claim on the verification of the
+// session until ctx is done, calling lost with errUploadClaimLost if
+// another AWAT claimed it in the meantime. It renews the claim on its
+// own copy of the session.
+func (s *UploadSupervisor) keepClaim(ctx context.Context, lost context.CancelCauseFunc, session model.UploadSession, interval time.Duration, logger log.FieldLogger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			claimed, err := s.store.ClaimUploadSessionVerification(&session, model.GetMillis()+uploadVerificationLease.Milliseconds())
+			if err != nil {
+				logger.WithError(err).Warn("Failed to renew claim on upload session")
+			} else if !claimed {
+				logger.Warn("Upload session is no longer claimed by this AWAT")
+				lost(errUploadClaimLost)
+				return
+			}
+		}
+	}
+}
+
+// verify verifies the archive of the session and completes its Upload,
+// unless the claim held while ctx is not done was lost. It returns an
+// error only if the outcome could not be recorded, in which case the
+// archive is verified again once the claim expires.
+func (s *UploadSupervisor) verify(ctx context.Context, session *model.UploadSession, logger log.FieldLogger) error {
+	var uploadError string
+	checksum, err := s.check(session, logger)
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	if err != nil {
+		logger.WithError(err).Error("Upload failed verification")
+		uploadError = err.Error()
+	} else {
+		err = s.store.UpdateUploadChecksum(session.ID, checksum)
+		if err != nil {
+			return errors.Wrap(err, "failed to store checksum of upload")
+		}
+	}
+
+	err = s.store.CompleteUpload(session.ID, uploadError)
+	if err != nil {
+		return errors.Wrap(err, "failed to mark upload complete")
+	}
+	err = s.store.FinishUploadSessionVerification(session.ID)
+	if err != nil {
+		return err
+	}
+
+	if uploadError == "" {
+		logger.Infof("Verified upload of %d bytes", session.Size)
+	}
+	return nil
+}
+
+// check checks the archive of the session and returns its checksum.
+// The archive of a presigned session must have the size and checksum it
+// was presigned for and is validated if that was requested, while the
+// archive of a session uploaded in chunks is always validated, if
+// archives of its type are validated.
+func (s *UploadSupervisor) check(session *model.UploadSession, logger log.FieldLogger) (string, error) {
+	var validator validators.Validator
+	if session.ValidateArchive || !session.Presigned {
+		// there is no validator for archives of some types
+		validator, _ = validators.NewValidator(session.Type)
+	}
+
+	var archivePath string
+	if validator != nil {
+		archive, err := os.CreateTemp(s.workdir, "upload-")
+		if err != nil {
+			return "", errors.Wrap(err, "failed to create file to download archive to")
+		}
+		archive.Close()
+		defer os.Remove(archive.Name())
+
+		_, err = s.objectStore.Download(session.ArchiveName(), archive.Name())
+		if err != nil {
+			return "", errors.Wrap(err, "failed to download archive")
+		}
+		archivePath = archive.Name()
+	}
+
+	size, checksum, err := s.checksum(session, archivePath)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to determine checksum of archive")
+	}
+	if session.Presigned && (size != session.Size || checksum != session.Checksum) {
+		return "", s.reject(session, errors.Errorf("archive has %d bytes with checksum %s instead of %d bytes with checksum %s", size, checksum, session.Size, session.Checksum), logger)
+	}
+
+	if validator != nil {
+		logger.Info("Validating upload")
+		report, err := validator.Validate(archivePath)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to validate archive")
+		}
+		err = s.store.UpdateUploadValidation(session.ID, report)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to store validation report")
+		}
+		if !report.Valid() {
+			logger.WithError(report.Err()).Error("Archive validation failed")
+			return "", s.reject(session, errors.New("archive validation failed"), logger)
+		}
+	}
+
+	return checksum, nil
+}
+
+// checksum returns the size and checksum of the archive of the session,
+// which are known already if its chunks arrived in order, and are
+// otherwise computed from the archive downloaded to archivePath, if it
+// was, or else from the archive in the bucket.
+func (s *UploadSupervisor) checksum(session *model.UploadSession, archivePath string) (int64, string, error) {
+	if session.HashedSize == session.Size {
+		archiveHash, err := session.ArchiveHash()
+		if err == nil {
+			return session.Size, hex.EncodeToString(archiveHash.Sum(nil)), nil
+		}
+	}
+
+	if archivePath == "" {
+		return s.objectStore.Checksum(session.ArchiveName())
+	}
+	stat, err := os.Stat(archivePath)
+	if err != nil {
+		return 0, "", err
+	}
+	checksum, err := objectstore.FileChecksum(archivePath)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return stat.Size(), checksum, nil
+}
+
+// reject deletes the archive of the session, which failed
+// verification for the reason given, and returns the reason.
+func (s *UploadSupervisor) reject(session *model.UploadSession, reason error, logger log.FieldLogger) error {
+	err := s.objectStore.Delete(session.ArchiveName())
+	if err != nil {
+		logger.WithError(err).Warn("Failed to delete archive which failed verification")
+	}
+
+	return reason
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package supervisor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mattermost/awat/internal/objectstore"
+	"github.com/mattermost/awat/internal/testlib"
+	"github.com/mattermost/awat/model"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeUploadStore struct {
+	sessions    []*model.UploadSession
+	claimed     map[string]bool
+	claims      int
+	completeErr error
+
+	checksums map[string]string
+	reports   map[string]*model.ValidationReport
+	completed map[string]string
+	finished  []string
+}
+
+func (s *fakeUploadStore) GetUploadSessionsPendingVerification(now int64, limit uint64) ([]*model.UploadSession, error) {
+	return s.sessions, nil
+}
+
+func (s *fakeUploadStore) ClaimUploadSessionVerification(session *model.UploadSession, verifyAt int64) (bool, error) {
+	s.claims++
+	if s.claimed[session.ID] {
+		return false, nil
+	}
+	session.VerifyAt = verifyAt
+	return true, nil
+}
+
+func (s *fakeUploadStore) FinishUploadSessionVerification(id string) error {
+	s.finished = append(s.finished, id)
+	return nil
+}
+
+func (s *fakeUploadStore) UpdateUploadValidation(uploadID string, report *model.ValidationReport) error {
+	s.reports[uploadID] = report
+	return nil
+}
+
+func (s *fakeUploadStore) UpdateUploadChecksum(uploadID, checksum string) error {
+	s.checksums[uploadID] = checksum
+	return nil
+}
+
+func (s *fakeUploadStore) CompleteUpload(uploadID, errorMessage string) error {
+	if s.completeErr != nil {
+		return s.completeErr
+	}
+	s.completed[uploadID] = errorMessage
+	return nil
+}
+
+func TestUploadSupervisorVerify(t *testing.T) {
+	archive := []byte("not an archive")
+	checksum := model.ChunkChecksum(archive)
+
+	setup := func(t *testing.T, sessions ...*model.UploadSession) (*fakeUploadStore, objectstore.ObjectStore) {
+		objectStore, err := objectstore.NewLocalObjectStore(t.TempDir())
+		require.NoError(t, err)
+		local := filepath.Join(t.TempDir(), "archive")
+		require.NoError(t, os.WriteFile(local, archive, 0600))
+		for _, session := range sessions {
+			require.NoError(t, objectStore.Upload(local, session.ArchiveName()))
+		}
+
+		return &fakeUploadStore{
+			sessions:  sessions,
+			claimed:   map[string]bool{},
+			checksums: map[string]string{},
+			reports:   map[string]*model.ValidationReport{},
+			completed: map[string]string{},
+		}, objectStore
+	}
+	exists := func(t *testing.T, objectStore objectstore.ObjectStore, session *model.UploadSession) bool {
+		exists, err := objectStore.Exists(session.ArchiveName())
+		require.NoError(t, err)
+		return exists
+	}
+	now := model.GetMillis()
+
+	t.Run("verified", func(t *testing.T) {
+		session := &model.UploadSession{ID: "verified", Type: model.DiscordWorkspaceBackupType, Size: int64(len(archive)), Presigned: true, Checksum: checksum, ValidateArchive: true, VerifyAt: now}
+		store, objectStore := setup(t, session)
+
+		NewUploadSupervisor(store, testlib.MakeLogger(t), objectStore, t.TempDir()).do(now)
+
+		assert.Equal(t, map[string]string{"verified": checksum}, store.checksums)
+		assert.Empty(t, store.reports, "there is no validator for Discord exports")
+		assert.Equal(t, map[string]string{"verified": ""}, store.completed)
+		assert.Equal(t, []string{"verified"}, store.finished)
+		assert.True(t, exists(t, objectStore, session))
+	})
+
+	t.Run("wrong checksum", func(t *testing.T) {
+		session := &model.UploadSession{ID: "wrong", Type: model.DiscordWorkspaceBackupType, Size: int64(len(archive)), Presigned: true, Checksum: model.ChunkChecksum(nil), VerifyAt: now}
+		store, objectStore := setup(t, session)
+
+		NewUploadSupervisor(store, testlib.MakeLogger(t), objectStore, t.TempDir()).do(now)
+
+		assert.Empty(t, store.checksums)
+		assert.Contains(t, store.completed["wrong"], "archive has 14 bytes with checksum")
+		assert.Equal(t, []string{"wrong"}, store.finished)
+		assert.False(t, exists(t, objectStore, session), "the archive is deleted")
+	})
+
+	t.Run("failed validation", func(t *testing.T) {
+		session := &model.UploadSession{ID: "invalid", Type: model.ZulipWorkspaceBackupType, Size: int64(len(archive)), Presigned: true, Checksum: checksum, ValidateArchive: true, VerifyAt: now}
+		store, objectStore := setup(t, session)
+
+		NewUploadSupervisor(store, testlib.MakeLogger(t), objectStore, t.TempDir()).do(now)
+
+		require.NotNil(t, store.reports["invalid"])
+		assert.False(t, store.reports["invalid"].Valid())
+		assert.Equal(t, map[string]string{"invalid": "archive validation failed"}, store.completed)
+		assert.Equal(t, []string{"invalid"}, store.finished)
+		assert.False(t, exists(t, objectStore, session), "the archive is deleted")
+	})
+
+	t.Run("chunks hashed as they arrived", func(t *testing.T) {
+		archiveHash := sha256.New()
+		_, _ = archiveHash.Write(archive)
+		state, err := archiveHash.(encoding.BinaryMarshaler).MarshalBinary()
+		require.NoError(t, err)
+		session := &model.UploadSession{ID: "hashed", Type: model.DiscordWorkspaceBackupType, Size: int64(len(archive)), HashState: state, HashedSize: int64(len(archive)), VerifyAt: now}
+		store, objectStore := setup(t, session)
+		require.NoError(t, objectStore.Delete(session.ArchiveName()))
+
+		NewUploadSupervisor(store, testlib.MakeLogger(t), objectStore, t.TempDir()).do(now)
+
+		assert.Equal(t, map[string]string{"hashed": checksum}, store.checksums, "the archive is not read back")
+		assert.Equal(t, map[string]string{"hashed": ""}, store.completed)
+	})
+
+	t.Run("chunks out of order", func(t *testing.T) {
+		session := &model.UploadSession{ID: "unhashed", Type: model.DiscordWorkspaceBackupType, Size: int64(len(archive)), VerifyAt: now}
+		store, objectStore := setup(t, session)
+
+		NewUploadSupervisor(store, testlib.MakeLogger(t), objectStore, t.TempDir()).do(now)
+
+		assert.Equal(t, map[string]string{"unhashed": checksum}, store.checksums)
+		assert.Equal(t, map[string]string{"unhashed": ""}, store.completed)
+	})
+
+	t.Run("chunks failing validation", func(t *testing.T) {
+		session := &model.UploadSession{ID: "chunked", Type: model.ZulipWorkspaceBackupType, Size: int64(len(archive)), VerifyAt: now}
+		store, objectStore := setup(t, session)
+
+		NewUploadSupervisor(store, testlib.MakeLogger(t), objectStore, t.TempDir()).do(now)
+
+		require.NotNil(t, store.reports["chunked"], "archives uploaded in chunks are always validated")
+		assert.Equal(t, map[string]string{"chunked": "archive validation failed"}, store.completed)
+		assert.False(t, exists(t, objectStore, session), "the archive is deleted")
+	})
+
+	t.Run("claimed by another AWAT", func(t *testing.T) {
+		session := &model.UploadSession{ID: "claimed", Type: model.DiscordWorkspaceBackupType, Size: int64(len(archive)), Presigned: true, Checksum: checksum, VerifyAt: now}
+		store, objectStore := setup(t, session)
+		store.claimed["claimed"] = true
+
+		NewUploadSupervisor(store, testlib.MakeLogger(t), objectStore, t.TempDir()).do(now)
+
+		assert.Empty(t, store.completed)
+		assert.Empty(t, store.finished)
+	})
+
+	t.Run("outcome not recorded", func(t *testing.T) {
+		session := &model.UploadSession{ID: "unrecorded", Type: model.DiscordWorkspaceBackupType, Size: int64(len(archive)), Presigned: true, Checksum: checksum, VerifyAt: now}
+		store, objectStore := setup(t, session)
+		store.completeErr = errors.New("problem talking to database")
+
+		NewUploadSupervisor(store, testlib.MakeLogger(t), objectStore, t.TempDir()).do(now)
+
+		assert.Empty(t, store.finished, "the archive is verified again once the claim expires")
+		assert.Equal(t, now+uploadVerificationLease.Milliseconds(), session.VerifyAt)
+	})
+
+	t.Run("claim renewed while verifying", func(t *testing.T) {
+		session := &model.UploadSession{ID: "renewed", Type: model.DiscordWorkspaceBackupType, VerifyAt: now}
+		store, objectStore := setup(t, session)
+		supervisor := NewUploadSupervisor(store, testlib.MakeLogger(t), objectStore, t.TempDir())
+
+		ctx, loseClaim := context.WithCancelCause(context.Background())
+		time.AfterFunc(100*time.Millisecond, func() { loseClaim(nil) })
+		supervisor.keepClaim(ctx, loseClaim, *session, 10*time.Millisecond, supervisor.logger)
+
+		assert.Greater(t, store.claims, 1)
+		assert.Equal(t, now, session.VerifyAt, "the claim is renewed on a copy of the session")
+	})
+
+	t.Run("claim lost while verifying", func(t *testing.T) {
+		session := &model.UploadSession{ID: "lost", Type: model.DiscordWorkspaceBackupType, Size: int64(len(archive)), Presigned: true, Checksum: checksum, VerifyAt: now}
+		store, objectStore := setup(t, session)
+		store.claimed["lost"] = true
+		supervisor := NewUploadSupervisor(store, testlib.MakeLogger(t), objectStore, t.TempDir())
+
+		ctx, loseClaim := context.WithCancelCause(context.Background())
+		supervisor.keepClaim(ctx, loseClaim, *session, 10*time.Millisecond, supervisor.logger)
+		err := supervisor.verify(ctx, session, supervisor.logger)
+
+		assert.Equal(t, errUploadClaimLost, err)
+		assert.Empty(t, store.completed, "the AWAT which claimed it records the outcome")
+		assert.Empty(t, store.finished)
+	})
+}
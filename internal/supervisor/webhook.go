@@ -0,0 +1,223 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package supervisor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mattermost/awat/internal/common"
+	"github.com/mattermost/awat/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// webhookInterval is how often the WebhookSupervisor looks for
+// deliveries which are due.
+const webhookInterval = 5 * time.Second
+
+// webhookTimeout is how long a webhook has to respond to an event.
+const webhookTimeout = 10 * time.Second
+
+// webhookBatchSize is the number of deliveries attempted per interval.
+const webhookBatchSize = 100
+
+// maxWebhookRetryDelay caps the delay between two attempts of a
+// delivery.
+const maxWebhookRetryDelay = time.Hour
+
+// maxWebhookResponseError is the number of bytes of the response of a
+// webhook rejecting an event which are recorded with the delivery.
+const maxWebhookResponseError = 512
+
+// eventStore defines the interface for queueing events to be delivered
+// to webhooks.
+type eventStore interface {
+	CreateWebhookEvent(event *model.WebhookEvent) error
+}
+
+// emitEvent queues the delivery of the event to the webhooks, unless
+// it is nil because the state did not change. The state change has
+// happened already, so failing to queue the event is only logged.
+func emitEvent(store eventStore, event *model.WebhookEvent, logger log.FieldLogger) {
+	if event == nil {
+		return
+	}
+
+	err := store.CreateWebhookEvent(event)
+	if err != nil {
+		logger.WithError(err).Errorf("Failed to queue webhook event for %s state %s", event.Type, event.NewState)
+	}
+}
+
+// WebhookSupervisor delivers the events queued for webhooks, retrying
+// failed deliveries with a delay which doubles with every attempt.
+type WebhookSupervisor struct {
+	logger      log.FieldLogger
+	store       webhookStore
+	encryptor   *common.Encryptor
+	client      *http.Client
+	maxAttempts int
+	retryDelay  time.Duration
+}
+
+// webhookStore defines the interface for delivering webhook events.
+type webhookStore interface {
+	GetWebhook(id string) (*model.Webhook, error)
+	GetWebhookDeliveriesDue(now int64, limit uint64) ([]*model.WebhookDelivery, error)
+	ClaimWebhookDelivery(delivery *model.WebhookDelivery, nextAttemptAt int64) (bool, error)
+	UpdateWebhookDelivery(delivery *model.WebhookDelivery) error
+}
+
+// NewWebhookSupervisor creates a new WebhookSupervisor which attempts
+// every delivery up to maxAttempts times, waiting retryDelay before the
+// second attempt. The encryptor decrypts the secrets of the webhooks.
+func NewWebhookSupervisor(store webhookStore, logger log.FieldLogger, encryptor *common.Encryptor, maxAttempts int, retryDelay time.Duration) *WebhookSupervisor {
+	return &WebhookSupervisor{
+		logger:      logger.WithField("webhook-supervisor", model.NewID()),
+		store:       store,
+		encryptor:   encryptor,
+		client:      &http.Client{Timeout: webhookTimeout},
+		maxAttempts: maxAttempts,
+		retryDelay:  retryDelay,
+	}
+}
+
+// Start runs the WebhookSupervisor on a new goroutine forever.
+func (s *WebhookSupervisor) Start() {
+	s.logger.Info("Webhook supervisor started")
+	go func() {
+		tick := time.NewTicker(webhookInterval)
+		for range tick.C {
+			s.do(model.GetMillis())
+		}
+	}()
+}
+
+// do attempts the deliveries which are due at now.
+func (s *WebhookSupervisor) do(now int64) {
+	deliveries, err := s.store.GetWebhookDeliveriesDue(now, webhookBatchSize)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to query for webhook deliveries")
+		return
+	}
+
+	webhooks := make(map[string]*model.Webhook)
+	for _, delivery := range deliveries {
+		logger := s.logger.WithFields(log.Fields{"webhook": delivery.WebhookID, "event": delivery.EventID})
+
+		// Claiming the delivery for the duration of an attempt keeps
+		// other AWATs from attempting it concurrently, and has it
+		// attempted again should this one stop before recording the
+		// outcome.
+		claimed, err := s.store.ClaimWebhookDelivery(delivery, now+webhookTimeout.Milliseconds()*2)
+		if err != nil {
+			logger.WithError(err).Error("Failed to claim webhook delivery")
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		webhook, ok := webhooks[delivery.WebhookID]
+		if !ok {
+			webhook, err = s.store.GetWebhook(delivery.WebhookID)
+			if err != nil {
+				logger.WithError(err).Error("Failed to look up webhook")
+				continue
+			}
+			webhooks[delivery.WebhookID] = webhook
+		}
+
+		s.deliver(webhook, delivery, logger)
+	}
+}
+
+// deliver attempts the delivery and records its outcome.
+func (s *WebhookSupervisor) deliver(webhook *model.Webhook, delivery *model.WebhookDelivery, logger log.FieldLogger) {
+	now := model.GetMillis()
+	if webhook == nil || webhook.DeleteAt != 0 {
+		delivery.Error = "webhook was deleted"
+		delivery.FailAt = now
+	} else {
+		delivery.Attempts++
+		delivery.StatusCode, delivery.Error = s.post(webhook, delivery)
+		switch {
+		case delivery.Error == "":
+			delivery.DeliveredAt = now
+			logger.Debug("Delivered webhook event")
+		case delivery.Attempts >= s.maxAttempts:
+			delivery.FailAt = now
+			logger.Warnf("Giving up on webhook event after %d attempts: %s", delivery.Attempts, delivery.Error)
+		default:
+			delivery.NextAttemptAt = now + s.delayBeforeAttempt(delivery.Attempts+1).Milliseconds()
+			logger.Infof("Webhook event will be delivered again in %s: %s", time.Duration(delivery.NextAttemptAt-now)*time.Millisecond, delivery.Error)
+		}
+	}
+
+	err := s.store.UpdateWebhookDelivery(delivery)
+	if err != nil {
+		logger.WithError(err).Error("Failed to record webhook delivery")
+	}
+}
+
+// post sends the event of the delivery to the webhook, returning the
+// status code of the response and, unless the webhook accepted the
+// event with a 2xx response, the reason it was not delivered.
+func (s *WebhookSupervisor) post(webhook *model.Webhook, delivery *model.WebhookDelivery) (int, string) {
+	if s.encryptor == nil {
+		return 0, "no encryption key is configured to decrypt the webhook secret with"
+	}
+	secret, err := s.encryptor.Decrypt(webhook.Secret)
+	if err != nil {
+		return 0, err.Error()
+	}
+
+	payload := []byte(delivery.Payload)
+	request, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err.Error()
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(model.WebhookTimestampHeader, timestamp)
+	request.Header.Set(model.WebhookSignatureHeader, model.SignWebhookPayload(secret, timestamp, payload))
+	request.Header.Set(model.WebhookEventHeader, delivery.EventID)
+
+	resp, err := s.client.Do(request)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, ""
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseError))
+	message := fmt.Sprintf("webhook responded with status %d", resp.StatusCode)
+	if len(body) > 0 {
+		message = fmt.Sprintf("%s: %s", message, body)
+	}
+	return resp.StatusCode, message
+}
+
+// delayBeforeAttempt returns how long to wait before the given attempt
+// of a delivery.
+func (s *WebhookSupervisor) delayBeforeAttempt(attempt int) time.Duration {
+	delay := s.retryDelay
+	for i := 2; i < attempt && delay < maxWebhookRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxWebhookRetryDelay {
+		delay = maxWebhookRetryDelay
+	}
+
+	return delay
+}
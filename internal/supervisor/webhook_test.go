@@ -0,0 +1,199 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package supervisor
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/awat/internal/common"
+	"github.com/mattermost/awat/internal/testlib"
+	"github.com/mattermost/awat/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeWebhookStore struct {
+	webhooks   map[string]*model.Webhook
+	deliveries []*model.WebhookDelivery
+	claimed    map[string]bool
+	updated    []model.WebhookDelivery
+}
+
+func (s *fakeWebhookStore) GetWebhook(id string) (*model.Webhook, error) {
+	return s.webhooks[id], nil
+}
+
+func (s *fakeWebhookStore) GetWebhookDeliveriesDue(now int64, limit uint64) ([]*model.WebhookDelivery, error) {
+	return s.deliveries, nil
+}
+
+func (s *fakeWebhookStore) ClaimWebhookDelivery(delivery *model.WebhookDelivery, nextAttemptAt int64) (bool, error) {
+	if s.claimed[delivery.EventID] {
+		return false, nil
+	}
+	delivery.NextAttemptAt = nextAttemptAt
+	return true, nil
+}
+
+func (s *fakeWebhookStore) UpdateWebhookDelivery(delivery *model.WebhookDelivery) error {
+	s.updated = append(s.updated, *delivery)
+	return nil
+}
+
+func TestWebhookSupervisorDeliver(t *testing.T) {
+	var status int
+	var received []string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !model.VerifyWebhookSignature("secret", body, r.Header.Get(model.WebhookTimestampHeader), r.Header.Get(model.WebhookSignatureHeader), time.Now()) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		received = append(received, r.Header.Get(model.WebhookEventHeader))
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("busy"))
+	}))
+	defer receiver.Close()
+
+	encryptor, err := common.NewEncryptor(strings.Repeat("ab", common.EncryptionKeySize))
+	require.NoError(t, err)
+	encrypt := func(secret string) string {
+		encrypted, err := encryptor.Encrypt(secret)
+		require.NoError(t, err)
+		return encrypted
+	}
+
+	newStore := func() *fakeWebhookStore {
+		return &fakeWebhookStore{
+			webhooks: map[string]*model.Webhook{
+				"hook":      {ID: "hook", URL: receiver.URL, Secret: encrypt("secret")},
+				"wrong":     {ID: "wrong", URL: receiver.URL, Secret: encrypt("other secret")},
+				"plaintext": {ID: "plaintext", URL: receiver.URL, Secret: "secret"},
+				"deleted":   {ID: "deleted", URL: receiver.URL, Secret: encrypt("secret"), DeleteAt: 1},
+			},
+			claimed: map[string]bool{},
+		}
+	}
+	now := model.GetMillis()
+
+	t.Run("delivered", func(t *testing.T) {
+		status = http.StatusNoContent
+		received = nil
+		store := newStore()
+		store.deliveries = []*model.WebhookDelivery{
+			{WebhookID: "hook", EventID: "e1", Payload: `{"ID":"e1"}`},
+			{WebhookID: "hook", EventID: "e2", Payload: `{"ID":"e2"}`},
+		}
+		store.claimed["e2"] = true
+
+		supervisor := NewWebhookSupervisor(store, testlib.MakeLogger(t), encryptor, 3, time.Minute)
+		supervisor.do(now)
+
+		assert.Equal(t, []string{"e1"}, received)
+		require.Len(t, store.updated, 1)
+		assert.Equal(t, 1, store.updated[0].Attempts)
+		assert.Equal(t, http.StatusNoContent, store.updated[0].StatusCode)
+		assert.Empty(t, store.updated[0].Error)
+		assert.NotZero(t, store.updated[0].DeliveredAt)
+	})
+
+	t.Run("rejected and retried", func(t *testing.T) {
+		status = http.StatusServiceUnavailable
+		received = nil
+		store := newStore()
+		store.deliveries = []*model.WebhookDelivery{
+			{WebhookID: "hook", EventID: "e1", Payload: `{"ID":"e1"}`, Attempts: 1},
+		}
+
+		supervisor := NewWebhookSupervisor(store, testlib.MakeLogger(t), encryptor, 3, time.Minute)
+		supervisor.do(now)
+
+		require.Len(t, store.updated, 1)
+		delivery := store.updated[0]
+		assert.Equal(t, 2, delivery.Attempts)
+		assert.Equal(t, http.StatusServiceUnavailable, delivery.StatusCode)
+		assert.Equal(t, "webhook responded with status 503: busy", delivery.Error)
+		assert.Zero(t, delivery.DeliveredAt)
+		assert.Zero(t, delivery.FailAt)
+		assert.InDelta(t, model.GetMillis()+2*time.Minute.Milliseconds(), delivery.NextAttemptAt, float64(5*time.Second.Milliseconds()))
+	})
+
+	t.Run("rejected for the last time", func(t *testing.T) {
+		status = http.StatusInternalServerError
+		received = nil
+		store := newStore()
+		store.deliveries = []*model.WebhookDelivery{
+			{WebhookID: "hook", EventID: "e1", Payload: `{"ID":"e1"}`, Attempts: 2},
+		}
+
+		supervisor := NewWebhookSupervisor(store, testlib.MakeLogger(t), encryptor, 3, time.Minute)
+		supervisor.do(now)
+
+		require.Len(t, store.updated, 1)
+		assert.Equal(t, 3, store.updated[0].Attempts)
+		assert.NotZero(t, store.updated[0].FailAt)
+	})
+
+	t.Run("signed with another secret", func(t *testing.T) {
+		status = http.StatusOK
+		received = nil
+		store := newStore()
+		store.deliveries = []*model.WebhookDelivery{
+			{WebhookID: "wrong", EventID: "e1", Payload: `{"ID":"e1"}`},
+		}
+
+		supervisor := NewWebhookSupervisor(store, testlib.MakeLogger(t), encryptor, 3, time.Minute)
+		supervisor.do(now)
+
+		assert.Empty(t, received)
+		require.Len(t, store.updated, 1)
+		assert.Equal(t, http.StatusUnauthorized, store.updated[0].StatusCode)
+	})
+
+	t.Run("secret not encrypted with the key", func(t *testing.T) {
+		received = nil
+		store := newStore()
+		store.deliveries = []*model.WebhookDelivery{
+			{WebhookID: "plaintext", EventID: "e1", Payload: `{"ID":"e1"}`},
+		}
+
+		supervisor := NewWebhookSupervisor(store, testlib.MakeLogger(t), encryptor, 3, time.Minute)
+		supervisor.do(now)
+
+		assert.Empty(t, received)
+		require.Len(t, store.updated, 1)
+		assert.Zero(t, store.updated[0].StatusCode)
+		assert.Contains(t, store.updated[0].Error, "failed to decode ciphertext")
+	})
+
+	t.Run("deleted webhook", func(t *testing.T) {
+		received = nil
+		store := newStore()
+		store.deliveries = []*model.WebhookDelivery{
+			{WebhookID: "deleted", EventID: "e1", Payload: `{"ID":"e1"}`},
+		}
+
+		supervisor := NewWebhookSupervisor(store, testlib.MakeLogger(t), encryptor, 3, time.Minute)
+		supervisor.do(now)
+
+		assert.Empty(t, received)
+		require.Len(t, store.updated, 1)
+		assert.Zero(t, store.updated[0].Attempts)
+		assert.NotZero(t, store.updated[0].FailAt)
+	})
+}
+
+func TestWebhookDelayBeforeAttempt(t *testing.T) {
+	supervisor := &WebhookSupervisor{retryDelay: time.Minute}
+
+	assert.Equal(t, time.Minute, supervisor.delayBeforeAttempt(2))
+	assert.Equal(t, 2*time.Minute, supervisor.delayBeforeAttempt(3))
+	assert.Equal(t, maxWebhookRetryDelay, supervisor.delayBeforeAttempt(20))
+}
@@ -0,0 +1,368 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package teams
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The Teams export is a .zip of Microsoft Graph API responses laid out
+// as follows. Every .json file may either be a bare JSON array or a
+// Graph collection response with the array in its "value" field.
+//
+//	teams.json                                           teams
+//	users.json                                           users
+//	teams/<team>/members.json                            team members
+//	teams/<team>/channels.json                           channels
+//	teams/<team>/channels/<channel>/members.json         channel members
+//	teams/<team>/channels/<channel>/messages.json        messages
+//	teams/<team>/channels/<channel>/replies/<msg>.json   replies to a message
+//	teams/<team>/channels/<channel>/hostedContents/<msg>/<content>
+//	                                                     inline images
+//	teams/<team>/channels/<channel>/files/<attachment>/<name>
+//	                                                     attached files
+
+// Team is a Microsoft Teams team.
+type Team struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+	Description string `json:"description"`
+	Visibility  string `json:"visibility"`
+}
+
+// User is a user from the Microsoft Graph users collection.
+type User struct {
+	ID                string `json:"id"`
+	DisplayName       string `json:"displayName"`
+	GivenName         string `json:"givenName"`
+	Surname           string `json:"surname"`
+	Mail              string `json:"mail"`
+	UserPrincipalName string `json:"userPrincipalName"`
+	JobTitle          string `json:"jobTitle"`
+}
+
+// Member is a member of a team or channel.
+type Member struct {
+	UserID      string   `json:"userId"`
+	DisplayName string   `json:"displayName"`
+	Email       string   `json:"email"`
+	Roles       []string `json:"roles"`
+}
+
+// IsOwner returns true if the member owns the team or channel.
+func (m *Member) IsOwner() bool {
+	for _, role := range m.Roles {
+		if strings.EqualFold(role, "owner") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Channel is a channel of a Microsoft Teams team.
+type Channel struct {
+	ID             string `json:"id"`
+	DisplayName    string `json:"displayName"`
+	Description    string `json:"description"`
+	MembershipType string `json:"membershipType"`
+}
+
+// IsPrivate returns true if only members of the channel can see it.
+func (c *Channel) IsPrivate() bool {
+	return c.MembershipType == "private"
+}
+
+// Identity identifies the author of a message or reaction.
+type Identity struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+}
+
+// IdentitySet holds the identities which can author a message.
+type IdentitySet struct {
+	User        *Identity `json:"user"`
+	Application *Identity `json:"application"`
+}
+
+// MessageBody is the content of a message.
+type MessageBody struct {
+	ContentType string `json:"contentType"`
+	Content     string `json:"content"`
+}
+
+// Attachment is a file or card attached to a message.
+type Attachment struct {
+	ID          string `json:"id"`
+	ContentType string `json:"contentType"`
+	ContentURL  string `json:"contentUrl"`
+	Name        string `json:"name"`
+}
+
+// Reaction is a reaction to a message.
+type Reaction struct {
+	ReactionType    string      `json:"reactionType"`
+	CreatedDateTime string      `json:"createdDateTime"`
+	User            IdentitySet `json:"user"`
+}
+
+// Mention is a user mentioned in a message.
+type Mention struct {
+	ID          int         `json:"id"`
+	MentionText string      `json:"mentionText"`
+	Mentioned   IdentitySet `json:"mentioned"`
+}
+
+// Message is a Microsoft Graph chatMessage.
+type Message struct {
+	ID              string       `json:"id"`
+	ReplyToID       string       `json:"replyToId"`
+	MessageType     string       `json:"messageType"`
+	CreatedDateTime string       `json:"createdDateTime"`
+	DeletedDateTime string       `json:"deletedDateTime"`
+	From            *IdentitySet `json:"from"`
+	Subject         string       `json:"subject"`
+	Body            MessageBody  `json:"body"`
+	Attachments     []Attachment `json:"attachments"`
+	Mentions        []Mention    `json:"mentions"`
+	Reactions       []Reaction   `json:"reactions"`
+	Replies         []*Message   `json:"replies"`
+}
+
+// exportChannel is a channel together with its content.
+type exportChannel struct {
+	Channel
+	Members  []Member
+	Messages []*Message
+
+	// files maps the ID of an attachment or hosted content to the
+	// files holding its content.
+	files map[string][]*zip.File
+
+	// hostedContents maps the ID of a message to the inline images
+	// it contains.
+	hostedContents map[string][]*zip.File
+}
+
+// exportTeam is a team together with its channels.
+type exportTeam struct {
+	Team
+	Members  []Member
+	Channels []*exportChannel
+}
+
+// export is the parsed content of a Teams export archive.
+type export struct {
+	Teams []*exportTeam
+	Users []User
+}
+
+// readExport parses the Teams export held in archive.
+func readExport(archive *zip.Reader) (*export, error) {
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		files[strings.TrimPrefix(file.Name, "/")] = file
+	}
+
+	var teams []Team
+	err := readCollection(files, "teams.json", true, &teams)
+	if err != nil {
+		return nil, err
+	}
+
+	exp := &export{}
+	err = readCollection(files, "users.json", false, &exp.Users)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, team := range teams {
+		expTeam := &exportTeam{Team: team}
+		teamDir := path.Join("teams", team.ID)
+
+		err = readCollection(files, path.Join(teamDir, "members.json"), false, &expTeam.Members)
+		if err != nil {
+			return nil, err
+		}
+
+		var channels []Channel
+		err = readCollection(files, path.Join(teamDir, "channels.json"), false, &channels)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, channel := range channels {
+			expChannel, err := readChannel(files, path.Join(teamDir, "channels", channel.ID), channel)
+			if err != nil {
+				return nil, err
+			}
+			expTeam.Channels = append(expTeam.Channels, expChannel)
+		}
+
+		exp.Teams = append(exp.Teams, expTeam)
+	}
+
+	return exp, nil
+}
+
+// readChannel reads the members, messages, replies and files of the
+// channel stored below channelDir.
+func readChannel(files map[string]*zip.File, channelDir string, channel Channel) (*exportChannel, error) {
+	expChannel := &exportChannel{
+		Channel:        channel,
+		files:          make(map[string][]*zip.File),
+		hostedContents: make(map[string][]*zip.File),
+	}
+
+	err := readCollection(files, path.Join(channelDir, "members.json"), false, &expChannel.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []*Message
+	err = readCollection(files, path.Join(channelDir, "messages.json"), false, &messages)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*Message, len(messages))
+	for _, message := range messages {
+		if message.ReplyToID != "" {
+			continue
+		}
+		byID[message.ID] = message
+		expChannel.Messages = append(expChannel.Messages, message)
+	}
+
+	// Replies may be included in messages.json, either nested in their
+	// parent or alongside it, or be stored in their own files.
+	replies := []*Message{}
+	for _, message := range messages {
+		if message.ReplyToID != "" {
+			replies = append(replies, message)
+		}
+	}
+
+	repliesDir := channelDir + "/replies/"
+	hostedContentsDir := channelDir + "/hostedContents/"
+	filesDir := channelDir + "/files/"
+	var names []string
+	for name := range files {
+		if strings.HasPrefix(name, channelDir+"/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		switch {
+		case strings.HasPrefix(name, repliesDir) && strings.HasSuffix(name, ".json"):
+			var fileReplies []*Message
+			err = readCollection(files, name, true, &fileReplies)
+			if err != nil {
+				return nil, err
+			}
+			parentID := strings.TrimSuffix(path.Base(name), ".json")
+			for _, reply := range fileReplies {
+				if reply.ReplyToID == "" {
+					reply.ReplyToID = parentID
+				}
+				replies = append(replies, reply)
+			}
+		case strings.HasPrefix(name, hostedContentsDir):
+			parts := strings.Split(strings.TrimPrefix(name, hostedContentsDir), "/")
+			if len(parts) == 2 {
+				expChannel.hostedContents[parts[0]] = append(expChannel.hostedContents[parts[0]], files[name])
+			}
+		case strings.HasPrefix(name, filesDir):
+			parts := strings.Split(strings.TrimPrefix(name, filesDir), "/")
+			if len(parts) == 2 {
+				expChannel.files[parts[0]] = append(expChannel.files[parts[0]], files[name])
+			}
+		}
+	}
+
+	for _, reply := range replies {
+		parent, ok := byID[reply.ReplyToID]
+		if !ok {
+			// The parent is missing from the export, so keep the
+			// reply as a message of its own rather than losing it.
+			expChannel.Messages = append(expChannel.Messages, reply)
+			continue
+		}
+		if !containsMessage(parent.Replies, reply.ID) {
+			parent.Replies = append(parent.Replies, reply)
+		}
+	}
+
+	return expChannel, nil
+}
+
+func containsMessage(messages []*Message, id string) bool {
+	for _, message := range messages {
+		if message.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readCollection decodes the JSON collection stored in the file with
+// the given name into v. A missing file is an error only if required
+// is true.
+func readCollection(files map[string]*zip.File, name string, required bool, v interface{}) error {
+	file, ok := files[name]
+	if !ok {
+		if required {
+			return errors.Errorf("%s not found in Teams export", name)
+		}
+		return nil
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %s", name)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", name)
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		var collection struct {
+			Value json.RawMessage `json:"value"`
+		}
+		err = json.Unmarshal(data, &collection)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse %s", name)
+		}
+		data = collection.Value
+		if len(data) == 0 {
+			return nil
+		}
+	}
+
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse %s", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package teams
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	mentionPattern   = regexp.MustCompile(`(?is)<at\s+id="?(\d+)"?[^>]*>.*?</at>`)
+	linkPattern      = regexp.MustCompile(`(?is)<a\s[^>]*href="([^"]*)"[^>]*>(.*?)</a>`)
+	lineBreakPattern = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>|</h\d>`)
+	listItemPattern  = regexp.MustCompile(`(?i)<li[^>]*>`)
+	boldPattern      = regexp.MustCompile(`(?i)</?(b|strong)(\s[^>]*)?>`)
+	italicPattern    = regexp.MustCompile(`(?i)</?(i|em)(\s[^>]*)?>`)
+	strikePattern    = regexp.MustCompile(`(?i)</?(s|strike|del)(\s[^>]*)?>`)
+	codeBlockPattern = regexp.MustCompile(`(?i)</?pre(\s[^>]*)?>`)
+	codePattern      = regexp.MustCompile(`(?i)</?code(\s[^>]*)?>`)
+	tagPattern       = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankLinePattern = regexp.MustCompile(`\n{3,}`)
+)
+
+// reactionEmojis maps the reaction types of Microsoft Teams to
+// Mattermost emoji names.
+var reactionEmojis = map[string]string{
+	"like":      "+1",
+	"heart":     "heart",
+	"laugh":     "laughing",
+	"surprised": "open_mouth",
+	"sad":       "cry",
+	"angry":     "angry",
+	"👍":         "+1",
+	"❤️":        "heart",
+	"😆":         "laughing",
+	"😮":         "open_mouth",
+	"😢":         "cry",
+	"😡":         "angry",
+}
+
+// reactionEmoji returns the Mattermost emoji name for a Teams reaction
+// type, or an empty string if there is no equivalent.
+func reactionEmoji(reactionType string) string {
+	return reactionEmojis[strings.ToLower(reactionType)]
+}
+
+// messageText converts the body of a Teams message to Mattermost
+// markdown. Mentions are replaced with the Mattermost username of the
+// mentioned user, which is looked up with username.
+func messageText(message *Message, username func(userID, displayName string) string) string {
+	content := message.Body.Content
+	if !strings.EqualFold(message.Body.ContentType, "html") {
+		content = strings.TrimSpace(content)
+	} else {
+		content = htmlToMarkdown(content, message.Mentions, username)
+	}
+
+	if message.Subject != "" {
+		content = fmt.Sprintf("**%s**\n%s", strings.TrimSpace(message.Subject), content)
+	}
+
+	return strings.TrimSpace(content)
+}
+
+func htmlToMarkdown(content string, mentions []Mention, username func(userID, displayName string) string) string {
+	content = mentionPattern.ReplaceAllStringFunc(content, func(match string) string {
+		id := mentionPattern.FindStringSubmatch(match)[1]
+		for _, mention := range mentions {
+			if fmt.Sprint(mention.ID) != id || mention.Mentioned.User == nil {
+				continue
+			}
+			name := username(mention.Mentioned.User.ID, mention.Mentioned.User.DisplayName)
+			if name != "" {
+				return "@" + name
+			}
+		}
+		return html.UnescapeString(tagPattern.ReplaceAllString(match, ""))
+	})
+
+	content = linkPattern.ReplaceAllStringFunc(content, func(match string) string {
+		parts := linkPattern.FindStringSubmatch(match)
+		text := strings.TrimSpace(tagPattern.ReplaceAllString(parts[2], ""))
+		if text == "" || text == parts[1] {
+			return parts[1]
+		}
+		return fmt.Sprintf("[%s](%s)", text, parts[1])
+	})
+
+	content = strings.NewReplacer("\r\n", " ", "\n", " ").Replace(content)
+	content = lineBreakPattern.ReplaceAllString(content, "\n")
+	content = listItemPattern.ReplaceAllString(content, "- ")
+	content = boldPattern.ReplaceAllString(content, "**")
+	content = italicPattern.ReplaceAllString(content, "_")
+	content = strikePattern.ReplaceAllString(content, "~~")
+	content = codeBlockPattern.ReplaceAllString(content, "\n```\n")
+	content = codePattern.ReplaceAllString(content, "`")
+	content = tagPattern.ReplaceAllString(content, "")
+	content = html.UnescapeString(content)
+	content = strings.ReplaceAll(content, "\u00a0", " ")
+
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	content = blankLinePattern.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+
+	return content
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package teams
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageText(t *testing.T) {
+	username := func(userID, displayName string) string {
+		if userID == "u1" {
+			return "jane.doe"
+		}
+		return ""
+	}
+
+	var testCases = []struct {
+		name     string
+		message  *Message
+		expected string
+	}{
+		{
+			"plain text",
+			&Message{Body: MessageBody{ContentType: "text", Content: "  hello  "}},
+			"hello",
+		},
+		{
+			"formatting and entities",
+			&Message{Body: MessageBody{ContentType: "html", Content: "<div><b>bold</b> <i>it</i> &amp; <s>gone</s><br>next&nbsp;line</div>"}},
+			"**bold** _it_ & ~~gone~~\nnext line",
+		},
+		{
+			"links",
+			&Message{Body: MessageBody{ContentType: "html", Content: `<a href="https://example.com">site</a> <a href="https://x.y">https://x.y</a>`}},
+			"[site](https://example.com) https://x.y",
+		},
+		{
+			"lists",
+			&Message{Body: MessageBody{ContentType: "html", Content: "<ul><li>one</li><li>two</li></ul>"}},
+			"- one\n- two",
+		},
+		{
+			"known and unknown mentions",
+			&Message{
+				Body: MessageBody{ContentType: "html", Content: `<at id="0">Jane</at> and <at id="1">Bob</at>`},
+				Mentions: []Mention{
+					{ID: 0, Mentioned: IdentitySet{User: &Identity{ID: "u1"}}},
+					{ID: 1, Mentioned: IdentitySet{User: &Identity{ID: "u9"}}},
+				},
+			},
+			"@jane.doe and Bob",
+		},
+		{
+			"subject",
+			&Message{Subject: "Announcement", Body: MessageBody{ContentType: "html", Content: "<p>Details</p>"}},
+			"**Announcement**\nDetails",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, messageText(tc.message, username))
+		})
+	}
+}
+
+func TestReactionEmoji(t *testing.T) {
+	assert.Equal(t, "+1", reactionEmoji("like"))
+	assert.Equal(t, "laughing", reactionEmoji("Laugh"))
+	assert.Equal(t, "", reactionEmoji("unknown"))
+}
@@ -0,0 +1,522 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package teams
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/awat/internal/mbif"
+	"github.com/mattermost/awat/model"
+	mmmodel "github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/v8/channels/app/imports"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// emailSource is used to build placeholder email addresses for users
+// whose address is not part of the export.
+const emailSource = "teams"
+
+// transformer holds the state of a single Teams to MBIF
+// transformation.
+type transformer struct {
+	logger        log.FieldLogger
+	export        *export
+	attachmentDir string
+
+	// destinationTeam is the team every channel is imported into, or
+	// empty if each Teams team becomes a Mattermost team of its own.
+	destinationTeam string
+
+	teamNames    map[string]string
+	channelNames map[string]string
+	usernames    map[string]string
+	users        map[string]*imports.UserImportData
+	userOrder    []string
+
+	// memberships records the teams and channels of users by their
+	// Teams user ID.
+	memberships *mbif.Memberships
+
+	takenUsernames  mbif.Names
+	attachmentNames mbif.Names
+}
+
+// TransformTeams reads the Teams export at inputArchive and writes its
+// contents as MBIF to mbifPath, extracting attachments to
+// attachmentDir. If the Translation names a team, every Teams team is
+// merged into it and channel names are prefixed with the name of the
+// team they came from when the export holds more than one team.
+func TransformTeams(translation *model.Translation, inputArchive, mbifPath, attachmentDir string, logger log.FieldLogger) error {
+	archive, err := zip.OpenReader(inputArchive)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open Teams export %s", inputArchive)
+	}
+	defer archive.Close()
+
+	exp, err := readExport(&archive.Reader)
+	if err != nil {
+		return errors.Wrap(err, "failed to read Teams export")
+	}
+
+	t := &transformer{
+		logger:          logger,
+		export:          exp,
+		attachmentDir:   attachmentDir,
+		destinationTeam: translation.Team,
+		teamNames:       make(map[string]string),
+		channelNames:    make(map[string]string),
+		usernames:       make(map[string]string),
+		users:           make(map[string]*imports.UserImportData),
+		memberships:     mbif.NewMemberships(),
+		takenUsernames:  make(mbif.Names),
+		attachmentNames: make(mbif.Names),
+	}
+
+	writer, err := mbif.NewWriter(mbifPath)
+	if err != nil {
+		return err
+	}
+
+	err = t.transform(writer)
+	if err != nil {
+		writer.Close()
+		return err
+	}
+
+	logger.Infof("Wrote %d lines of MBIF for %d teams and %d users", writer.Lines(), len(exp.Teams), len(t.users))
+
+	return writer.Close()
+}
+
+func (t *transformer) transform(writer *mbif.Writer) error {
+	for _, user := range t.export.Users {
+		t.addUser(user.ID, user)
+	}
+
+	teamLines, channelLines := t.mapTeamsAndChannels()
+
+	// Posts are built before the users are written because posting in
+	// or reacting to a channel makes a user a member of it.
+	var posts []*imports.PostImportData
+	for _, team := range t.export.Teams {
+		for _, channel := range team.Channels {
+			channelPosts, err := t.channelPosts(team, channel)
+			if err != nil {
+				return errors.Wrapf(err, "failed to transform messages of channel %s", channel.DisplayName)
+			}
+			posts = append(posts, channelPosts...)
+		}
+	}
+
+	for _, team := range teamLines {
+		err := writer.Team(team)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, channel := range channelLines {
+		err := writer.Channel(channel)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, userID := range t.userOrder {
+		err := writer.User(t.userLine(userID))
+		if err != nil {
+			return err
+		}
+	}
+
+	sort.SliceStable(posts, func(i, j int) bool {
+		return *posts[i].CreateAt < *posts[j].CreateAt
+	})
+	for _, post := range posts {
+		err := writer.Post(post)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mapTeamsAndChannels assigns Mattermost names to every team and
+// channel of the export and records memberships of team and channel
+// members.
+func (t *transformer) mapTeamsAndChannels() ([]*imports.TeamImportData, []*imports.ChannelImportData) {
+	var teamLines []*imports.TeamImportData
+	teamNames := make(mbif.Names)
+	channelNames := make(map[string]mbif.Names)
+	merge := t.destinationTeam != ""
+	prefix := merge && len(t.export.Teams) > 1
+
+	for _, team := range t.export.Teams {
+		teamName := t.destinationTeam
+		if !merge {
+			teamName = teamNames.Unique(mbif.ChannelName(team.DisplayName), "team-"+mbif.ChannelName(team.ID))
+			teamType := mmmodel.TeamOpen
+			if strings.EqualFold(team.Visibility, "private") {
+				teamType = mmmodel.TeamInvite
+			}
+			teamLines = append(teamLines, &imports.TeamImportData{
+				Name:        mmmodel.NewString(teamName),
+				DisplayName: mmmodel.NewString(mbif.DisplayName(team.DisplayName)),
+				Type:        mmmodel.NewString(teamType),
+				Description: mmmodel.NewString(team.Description),
+			})
+		}
+		t.teamNames[team.ID] = teamName
+		if channelNames[teamName] == nil {
+			channelNames[teamName] = make(mbif.Names)
+		}
+
+		members := team.Members
+		if len(members) == 0 {
+			// Without a membership list every known user joins the team.
+			for _, user := range t.export.Users {
+				members = append(members, Member{UserID: user.ID})
+			}
+		}
+		for _, member := range members {
+			t.addMember(member)
+			t.memberships.JoinTeam(member.UserID, teamName)
+			if member.IsOwner() {
+				t.memberships.MakeTeamAdmin(member.UserID, teamName)
+			}
+		}
+	}
+
+	var channelLines []*imports.ChannelImportData
+	for _, team := range t.export.Teams {
+		teamName := t.teamNames[team.ID]
+		for _, channel := range team.Channels {
+			displayName := channel.DisplayName
+			name := mbif.ChannelName(displayName)
+			if prefix {
+				displayName = fmt.Sprintf("%s: %s", team.DisplayName, channel.DisplayName)
+				name = mbif.ChannelName(team.DisplayName + " " + channel.DisplayName)
+			} else if strings.EqualFold(channel.DisplayName, "General") {
+				// The General channel of a team is its default channel.
+				name = mmmodel.DefaultChannelName
+				displayName = "Town Square"
+			}
+			name = channelNames[teamName].Unique(name, "channel-"+mbif.ChannelName(channel.ID))
+			t.channelNames[channel.ID] = name
+
+			channelType := mmmodel.ChannelTypeOpen
+			if channel.IsPrivate() {
+				channelType = mmmodel.ChannelTypePrivate
+			}
+			channelLines = append(channelLines, &imports.ChannelImportData{
+				Team:        mmmodel.NewString(teamName),
+				Name:        mmmodel.NewString(name),
+				DisplayName: mmmodel.NewString(mbif.DisplayName(displayName)),
+				Type:        &channelType,
+				Purpose:     mmmodel.NewString(mbif.Truncate(channel.Description, mmmodel.ChannelPurposeMaxRunes)),
+			})
+
+			members := channel.Members
+			if len(members) == 0 && !channel.IsPrivate() {
+				members = team.Members
+			}
+			for _, member := range members {
+				t.addMember(member)
+				t.memberships.JoinChannel(member.UserID, teamName, name)
+			}
+		}
+	}
+
+	return teamLines, channelLines
+}
+
+// channelPosts builds the posts, and their replies, of a channel.
+func (t *transformer) channelPosts(team *exportTeam, channel *exportChannel) ([]*imports.PostImportData, error) {
+	teamName := t.teamNames[team.ID]
+	channelName := t.channelNames[channel.ID]
+
+	var posts []*imports.PostImportData
+	for _, message := range channel.Messages {
+		author := t.author(message)
+		if author == "" {
+			continue
+		}
+		createAt, err := parseTime(message.CreatedDateTime)
+		if err != nil {
+			t.logger.WithError(err).Warnf("Skipping message %s with invalid creation time", message.ID)
+			continue
+		}
+
+		text, attachments, err := t.content(channel, message)
+		if err != nil {
+			return nil, err
+		}
+		t.memberships.JoinChannel(message.From.User.ID, teamName, channelName)
+
+		post := &imports.PostImportData{
+			Team:      mmmodel.NewString(teamName),
+			Channel:   mmmodel.NewString(channelName),
+			User:      mmmodel.NewString(author),
+			Message:   mmmodel.NewString(text),
+			CreateAt:  &createAt,
+			Reactions: t.reactions(message, teamName, channelName),
+		}
+		if len(attachments) > 0 {
+			post.Attachments = &attachments
+		}
+
+		var replies []imports.ReplyImportData
+		for _, reply := range message.Replies {
+			replyAuthor := t.author(reply)
+			if replyAuthor == "" {
+				continue
+			}
+			replyCreateAt, err := parseTime(reply.CreatedDateTime)
+			if err != nil {
+				t.logger.WithError(err).Warnf("Skipping reply %s with invalid creation time", reply.ID)
+				continue
+			}
+
+			replyText, replyAttachments, err := t.content(channel, reply)
+			if err != nil {
+				return nil, err
+			}
+			t.memberships.JoinChannel(reply.From.User.ID, teamName, channelName)
+
+			importReply := imports.ReplyImportData{
+				User:      mmmodel.NewString(replyAuthor),
+				Message:   mmmodel.NewString(replyText),
+				CreateAt:  &replyCreateAt,
+				Reactions: t.reactions(reply, teamName, channelName),
+			}
+			if len(replyAttachments) > 0 {
+				importReply.Attachments = &replyAttachments
+			}
+			replies = append(replies, importReply)
+		}
+		if len(replies) > 0 {
+			sort.SliceStable(replies, func(i, j int) bool {
+				return *replies[i].CreateAt < *replies[j].CreateAt
+			})
+			post.Replies = &replies
+		}
+
+		posts = append(posts, post)
+	}
+
+	return posts, nil
+}
+
+// author returns the Mattermost username of the author of a message,
+// or an empty string if the message should not be imported.
+func (t *transformer) author(message *Message) string {
+	if message.DeletedDateTime != "" {
+		return ""
+	}
+	if message.MessageType != "" && message.MessageType != "message" {
+		return ""
+	}
+	if message.From == nil || message.From.User == nil {
+		t.logger.Debugf("Skipping message %s which was not sent by a user", message.ID)
+		return ""
+	}
+
+	return t.addUser(message.From.User.ID, User{
+		ID:          message.From.User.ID,
+		DisplayName: message.From.User.DisplayName,
+	})
+}
+
+// content returns the text of a message and extracts its attached
+// files and inline images to the attachment directory.
+func (t *transformer) content(channel *exportChannel, message *Message) (string, []imports.AttachmentImportData, error) {
+	text := messageText(message, func(userID, displayName string) string {
+		return t.addUser(userID, User{ID: userID, DisplayName: displayName})
+	})
+
+	var attachments []imports.AttachmentImportData
+	for _, file := range channel.hostedContents[message.ID] {
+		attachment, err := t.extractAttachment(file)
+		if err != nil {
+			return "", nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	var links []string
+	for _, attachment := range message.Attachments {
+		if attachment.ContentType != "reference" {
+			continue
+		}
+		files, ok := channel.files[attachment.ID]
+		if !ok {
+			// The file was not exported, so at least keep a link to it.
+			if attachment.ContentURL != "" {
+				links = append(links, fmt.Sprintf("[%s](%s)", attachment.Name, attachment.ContentURL))
+			}
+			continue
+		}
+		for _, file := range files {
+			importAttachment, err := t.extractAttachment(file)
+			if err != nil {
+				return "", nil, err
+			}
+			attachments = append(attachments, importAttachment)
+		}
+	}
+	if len(links) > 0 {
+		text = strings.TrimSpace(text + "\n" + strings.Join(links, "\n"))
+	}
+
+	return mbif.Message(text), attachments, nil
+}
+
+// extractAttachment copies a file from the export into the attachment
+// directory.
+func (t *transformer) extractAttachment(file *zip.File) (imports.AttachmentImportData, error) {
+	name := t.attachmentNames.Unique(path.Base(file.Name), "attachment")
+
+	reader, err := file.Open()
+	if err != nil {
+		return imports.AttachmentImportData{}, errors.Wrapf(err, "failed to open %s", file.Name)
+	}
+	defer reader.Close()
+
+	output, err := os.Create(filepath.Join(t.attachmentDir, name))
+	if err != nil {
+		return imports.AttachmentImportData{}, errors.Wrapf(err, "failed to create attachment %s", name)
+	}
+	defer output.Close()
+
+	_, err = io.Copy(output, reader)
+	if err != nil {
+		return imports.AttachmentImportData{}, errors.Wrapf(err, "failed to extract %s", file.Name)
+	}
+
+	return imports.AttachmentImportData{Path: mmmodel.NewString(mbif.AttachmentPath(name))}, nil
+}
+
+// reactions converts the reactions to a message, skipping reactions
+// which have no Mattermost equivalent.
+func (t *transformer) reactions(message *Message, teamName, channelName string) *[]imports.ReactionImportData {
+	var reactions []imports.ReactionImportData
+	for _, reaction := range message.Reactions {
+		emoji := reactionEmoji(reaction.ReactionType)
+		if emoji == "" || reaction.User.User == nil {
+			continue
+		}
+		createAt, err := parseTime(reaction.CreatedDateTime)
+		if err != nil {
+			continue
+		}
+		user := t.addUser(reaction.User.User.ID, User{
+			ID:          reaction.User.User.ID,
+			DisplayName: reaction.User.User.DisplayName,
+		})
+		t.memberships.JoinChannel(reaction.User.User.ID, teamName, channelName)
+
+		reactions = append(reactions, imports.ReactionImportData{
+			User:      mmmodel.NewString(user),
+			EmojiName: mmmodel.NewString(emoji),
+			CreateAt:  &createAt,
+		})
+	}
+	if len(reactions) == 0 {
+		return nil
+	}
+
+	return &reactions
+}
+
+// addMember records a team or channel member as a user.
+func (t *transformer) addMember(member Member) {
+	t.addUser(member.UserID, User{
+		ID:          member.UserID,
+		DisplayName: member.DisplayName,
+		Mail:        member.Email,
+	})
+}
+
+// addUser returns the Mattermost username of the user with the given
+// ID, creating the user from the given details if it is not yet
+// known.
+func (t *transformer) addUser(id string, user User) string {
+	if username, ok := t.usernames[id]; ok {
+		return username
+	}
+
+	email := user.Mail
+	if email == "" && strings.Contains(user.UserPrincipalName, "@") {
+		email = user.UserPrincipalName
+	}
+
+	username := ""
+	if email != "" {
+		username = mbif.Username(strings.SplitN(email, "@", 2)[0])
+	}
+	if username == "" {
+		username = mbif.Username(user.DisplayName)
+	}
+	if username == "" {
+		username = "teams-user-" + mbif.ChannelName(id)
+	}
+	username = t.takenUsernames.Unique(username, "")
+
+	if email == "" {
+		email = mbif.PlaceholderEmail(username, emailSource)
+		t.logger.Debugf("User %s has no email address, using %s", username, email)
+	}
+
+	firstName, lastName := user.GivenName, user.Surname
+	if firstName == "" && lastName == "" {
+		parts := strings.SplitN(strings.TrimSpace(user.DisplayName), " ", 2)
+		firstName = parts[0]
+		if len(parts) == 2 {
+			lastName = parts[1]
+		}
+	}
+
+	t.usernames[id] = username
+	t.userOrder = append(t.userOrder, id)
+	t.users[id] = &imports.UserImportData{
+		Username:  mmmodel.NewString(username),
+		Email:     mmmodel.NewString(strings.ToLower(email)),
+		FirstName: mmmodel.NewString(firstName),
+		LastName:  mmmodel.NewString(lastName),
+		Position:  mmmodel.NewString(user.JobTitle),
+	}
+
+	return username
+}
+
+// userLine builds the import line of a user including the teams and
+// channels the user is a member of.
+func (t *transformer) userLine(userID string) *imports.UserImportData {
+	user := t.users[userID]
+	user.Teams = t.memberships.Teams(userID)
+
+	return user
+}
+
+// parseTime parses a Microsoft Graph timestamp into milliseconds since
+// the epoch.
+func parseTime(value string) (int64, error) {
+	parsed, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return 0, err
+	}
+
+	return parsed.UnixNano() / int64(time.Millisecond), nil
+}
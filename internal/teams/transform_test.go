@@ -0,0 +1,197 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package teams
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/awat/internal/mbif"
+	"github.com/mattermost/awat/internal/testlib"
+	"github.com/mattermost/awat/internal/validators"
+	"github.com/mattermost/awat/model"
+	"github.com/mattermost/mattermost/server/v8/channels/app/imports"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testExport is a small Teams export with two teams, one of which has
+// a private channel, threaded replies, a mention, a reaction, an
+// inline image and an attached file.
+var testExport = map[string]string{
+	"teams.json": `{"value": [
+		{"id": "team1", "displayName": "Engineering", "description": "Builders", "visibility": "public"},
+		{"id": "team2", "displayName": "Sales", "visibility": "private"}
+	]}`,
+	"users.json": `[
+		{"id": "u1", "displayName": "Jane Doe", "givenName": "Jane", "surname": "Doe", "mail": "Jane.Doe@example.com"},
+		{"id": "u2", "displayName": "John Smith", "userPrincipalName": "john@example.com"}
+	]`,
+	"teams/team1/members.json": `[{"userId": "u1", "roles": ["owner"]}, {"userId": "u2", "roles": []}]`,
+	"teams/team1/channels.json": `[
+		{"id": "c1", "displayName": "General", "membershipType": "standard"},
+		{"id": "c2", "displayName": "Secret Project", "membershipType": "private"}
+	]`,
+	"teams/team1/channels/c1/messages.json": `[
+		{
+			"id": "m1", "messageType": "message", "createdDateTime": "2023-03-01T10:00:00.000Z",
+			"from": {"user": {"id": "u1", "displayName": "Jane Doe"}},
+			"body": {"contentType": "html", "content": "<p>Hello <at id=\"0\">John</at>, see <b>this</b> <img src=\"https://graph.microsoft.com/v1.0/hostedContents/hc1/$value\"></p>"},
+			"mentions": [{"id": 0, "mentionText": "John", "mentioned": {"user": {"id": "u2", "displayName": "John Smith"}}}],
+			"reactions": [{"reactionType": "like", "createdDateTime": "2023-03-01T10:05:00Z", "user": {"user": {"id": "u2"}}}],
+			"attachments": [{"id": "a1", "contentType": "reference", "name": "plan.docx", "contentUrl": "https://sharepoint/plan.docx"}]
+		},
+		{
+			"id": "m2", "messageType": "systemEventMessage", "createdDateTime": "2023-03-01T10:01:00Z",
+			"body": {"contentType": "html", "content": "<systemEventMessage/>"}
+		},
+		{
+			"id": "m3", "messageType": "message", "createdDateTime": "2023-03-01T11:00:00Z",
+			"deletedDateTime": "2023-03-01T11:01:00Z",
+			"from": {"user": {"id": "u1"}},
+			"body": {"contentType": "text", "content": "deleted"}
+		}
+	]`,
+	"teams/team1/channels/c1/replies/m1.json": `{"value": [
+		{
+			"id": "r1", "messageType": "message", "createdDateTime": "2023-03-01T10:10:00Z",
+			"from": {"user": {"id": "u3", "displayName": "Guest User"}},
+			"body": {"contentType": "text", "content": "Thanks!"}
+		}
+	]}`,
+	"teams/team1/channels/c1/hostedContents/m1/hc1.png": "png",
+	"teams/team1/channels/c1/files/a1/plan.docx":        "docx",
+	"teams/team1/channels/c2/members.json":              `[{"userId": "u1"}]`,
+	"teams/team1/channels/c2/messages.json": `[
+		{
+			"id": "m4", "messageType": "message", "createdDateTime": "2023-03-02T09:00:00Z",
+			"from": {"user": {"id": "u1"}},
+			"body": {"contentType": "text", "content": "Top secret"}
+		}
+	]`,
+	"teams/team2/channels.json": `[{"id": "c3", "displayName": "General"}]`,
+	"teams/team2/channels/c3/messages.json": `[
+		{
+			"id": "m5", "messageType": "message", "createdDateTime": "2023-03-03T09:00:00Z",
+			"from": {"user": {"id": "u2"}},
+			"body": {"contentType": "text", "content": "Quota reached"}
+		}
+	]`,
+}
+
+func linesOfType(lines []imports.LineImportData, lineType string) []imports.LineImportData {
+	var matching []imports.LineImportData
+	for _, line := range lines {
+		if line.Type == lineType {
+			matching = append(matching, line)
+		}
+	}
+
+	return matching
+}
+
+func TestTransformTeams(t *testing.T) {
+	logger := testlib.MakeLogger(t)
+
+	t.Run("one Mattermost team per Teams team", func(t *testing.T) {
+		workdir := t.TempDir()
+		inputArchive := testlib.WriteZip(t, filepath.Join(workdir, "teams-export.zip"), testExport)
+		attachmentDir := filepath.Join(workdir, "attachments")
+		require.NoError(t, os.MkdirAll(attachmentDir, 0700))
+		mbifPath := filepath.Join(workdir, "MBIF.jsonl")
+
+		translation := &model.Translation{ID: model.NewID(), Type: model.TeamsWorkspaceBackupType}
+		err := TransformTeams(translation, inputArchive, mbifPath, attachmentDir, logger)
+		require.NoError(t, err)
+
+		lines := testlib.ReadMBIFLines(t, mbifPath)
+		require.NotEmpty(t, lines)
+		assert.Equal(t, "version", lines[0].Type)
+
+		teams := linesOfType(lines, "team")
+		require.Len(t, teams, 2)
+		assert.Equal(t, "engineering", *teams[0].Team.Name)
+		assert.Equal(t, "O", *teams[0].Team.Type)
+		assert.Equal(t, "sales", *teams[1].Team.Name)
+		assert.Equal(t, "I", *teams[1].Team.Type)
+
+		channels := linesOfType(lines, "channel")
+		require.Len(t, channels, 3)
+		assert.Equal(t, "town-square", *channels[0].Channel.Name)
+		assert.Equal(t, "secret-project", *channels[1].Channel.Name)
+		assert.EqualValues(t, "P", *channels[1].Channel.Type)
+		assert.Equal(t, "sales", *channels[2].Channel.Team)
+
+		users := linesOfType(lines, "user")
+		require.Len(t, users, 3)
+		assert.Equal(t, "jane.doe", *users[0].User.Username)
+		assert.Equal(t, "jane.doe@example.com", *users[0].User.Email)
+		assert.Equal(t, "team_user team_admin", *(*users[0].User.Teams)[0].Roles)
+		assert.Equal(t, "john", *users[1].User.Username)
+		assert.Equal(t, "guest.user", *users[2].User.Username)
+		assert.Equal(t, "guest.user@teams.invalid", *users[2].User.Email)
+
+		posts := linesOfType(lines, "post")
+		require.Len(t, posts, 3)
+		post := posts[0].Post
+		assert.Equal(t, "Hello @john, see **this**", *post.Message)
+		require.NotNil(t, post.Replies)
+		require.Len(t, *post.Replies, 1)
+		assert.Equal(t, "guest.user", *(*post.Replies)[0].User)
+		require.NotNil(t, post.Reactions)
+		assert.Equal(t, "+1", *(*post.Reactions)[0].EmojiName)
+		require.NotNil(t, post.Attachments)
+		assert.Len(t, *post.Attachments, 2)
+		assert.Equal(t, "attachments/hc1.png", *(*post.Attachments)[0].Path)
+		assert.Equal(t, "attachments/plan.docx", *(*post.Attachments)[1].Path)
+		assert.FileExists(t, filepath.Join(attachmentDir, "plan.docx"))
+
+		outputPath := filepath.Join(workdir, "output.zip")
+		_, _, err = mbif.CreateArchive(outputPath, mbifPath, attachmentDir)
+		require.NoError(t, err)
+		report, err := validators.NewMattermostValidator().Validate(outputPath)
+		require.NoError(t, err)
+		assert.Empty(t, report.Errors)
+	})
+
+	t.Run("all Teams teams merged into the destination team", func(t *testing.T) {
+		workdir := t.TempDir()
+		inputArchive := testlib.WriteZip(t, filepath.Join(workdir, "teams-export.zip"), testExport)
+		attachmentDir := filepath.Join(workdir, "attachments")
+		require.NoError(t, os.MkdirAll(attachmentDir, 0700))
+		mbifPath := filepath.Join(workdir, "MBIF.jsonl")
+
+		translation := &model.Translation{ID: model.NewID(), Type: model.TeamsWorkspaceBackupType, Team: "acme"}
+		err := TransformTeams(translation, inputArchive, mbifPath, attachmentDir, logger)
+		require.NoError(t, err)
+
+		lines := testlib.ReadMBIFLines(t, mbifPath)
+		assert.Empty(t, linesOfType(lines, "team"))
+
+		channels := linesOfType(lines, "channel")
+		require.Len(t, channels, 3)
+		for _, channel := range channels {
+			assert.Equal(t, "acme", *channel.Channel.Team)
+		}
+		assert.Equal(t, "engineering-general", *channels[0].Channel.Name)
+		assert.Equal(t, "Engineering: General", *channels[0].Channel.DisplayName)
+		assert.Equal(t, "sales-general", *channels[2].Channel.Name)
+	})
+
+	t.Run("missing teams.json", func(t *testing.T) {
+		workdir := t.TempDir()
+		inputArchive := filepath.Join(workdir, "empty.zip")
+		archiveFile, err := os.Create(inputArchive)
+		require.NoError(t, err)
+		require.NoError(t, zip.NewWriter(archiveFile).Close())
+		require.NoError(t, archiveFile.Close())
+
+		translation := &model.Translation{ID: model.NewID(), Type: model.TeamsWorkspaceBackupType}
+		err = TransformTeams(translation, inputArchive, filepath.Join(workdir, "MBIF.jsonl"), workdir, logger)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package teams
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/mattermost/awat/internal/mbif"
+	"github.com/mattermost/awat/internal/objectstore"
+	"github.com/mattermost/awat/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// TeamsTranslator is responsible for translating Microsoft Teams
+// exports into a format compatible with Mattermost.
+type TeamsTranslator struct {
+	objectStore        objectstore.ObjectStore
+	workingDir         string
+	outputZipLocalPath string
+	outputChecksum     string
+}
+
+// NewTeamsTranslator creates a new Translator instance for translating
+// Microsoft Teams exports.
+func NewTeamsTranslator(objectStore objectstore.ObjectStore, workingDir string) *TeamsTranslator {
+	return &TeamsTranslator{
+		objectStore: objectStore,
+		workingDir:  workingDir,
+	}
+}
+
+// Translate satisfies the Translator interface for the
+// TeamsTranslator. It converts the Teams export referenced by the
+// Translation into a Mattermost archive and uploads it to the object
+// store. On success it returns the file name of the output zip file
+// without a path.
+func (tt *TeamsTranslator) Translate(ctx context.Context, translation *model.Translation) (string, error) {
+	logger := log.New().WithField("translation", translation.ID)
+
+	outputPath, checksum, err := mbif.Translate(ctx, tt.objectStore, tt.workingDir, "input.zip", translation, TransformTeams, logger)
+	if err != nil {
+		return "", err
+	}
+	tt.outputZipLocalPath = outputPath
+	tt.outputChecksum = checksum
+
+	logger.Info("Finished translation")
+
+	return filepath.Base(outputPath), nil
+}
+
+// GetOutputArchiveLocalPath returns the local file path of the translated archive.
+func (tt *TeamsTranslator) GetOutputArchiveLocalPath() (string, error) {
+	return tt.outputZipLocalPath, nil
+}
+
+// GetOutputArchiveChecksum returns the checksum of the translated archive.
+func (tt *TeamsTranslator) GetOutputArchiveChecksum() (string, error) {
+	return tt.outputChecksum, nil
+}
+
+// Cleanup performs necessary cleanup operations after the translation process.
+func (tt *TeamsTranslator) Cleanup() error {
+	if tt.outputZipLocalPath == "" {
+		return nil
+	}
+
+	return os.Remove(tt.outputZipLocalPath)
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package testlib
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/v8/channels/app/imports"
+	"github.com/stretchr/testify/require"
+)
+
+// WriteZip writes a .zip archive of the given files, by their names, to
+// path and returns the path.
+func WriteZip[T ~string | ~[]byte](tb testing.TB, path string, files map[string]T) string {
+	archiveFile, err := os.Create(path)
+	require.NoError(tb, err)
+	defer archiveFile.Close()
+
+	archive := zip.NewWriter(archiveFile)
+	for name, content := range files {
+		file, err := archive.Create(name)
+		require.NoError(tb, err)
+		_, err = file.Write([]byte(content))
+		require.NoError(tb, err)
+	}
+	require.NoError(tb, archive.Close())
+
+	return path
+}
+
+// ReadMBIFLines returns the lines of the MBIF JSONL file at path in
+// order.
+func ReadMBIFLines(tb testing.TB, path string) []imports.LineImportData {
+	file, err := os.Open(path)
+	require.NoError(tb, err)
+	defer file.Close()
+
+	var lines []imports.LineImportData
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var line imports.LineImportData
+		require.NoError(tb, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	require.NoError(tb, scanner.Err())
+
+	return lines
+}
+
+// ReadMBIFLinesByType returns the lines of the MBIF JSONL file at path
+// grouped by their type.
+func ReadMBIFLinesByType(tb testing.TB, path string) map[string][]imports.LineImportData {
+	lines := make(map[string][]imports.LineImportData)
+	for _, line := range ReadMBIFLines(tb, path) {
+		lines[line.Type] = append(lines[line.Type], line)
+	}
+
+	return lines
+}
@@ -5,11 +5,17 @@
 package translator
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
+	"github.com/mattermost/awat/internal/discord"
 	"github.com/mattermost/awat/internal/mattermost"
+	"github.com/mattermost/awat/internal/objectstore"
+	"github.com/mattermost/awat/internal/rocketchat"
 	"github.com/mattermost/awat/internal/slack"
+	"github.com/mattermost/awat/internal/teams"
+	"github.com/mattermost/awat/internal/zulip"
 	"github.com/mattermost/awat/model"
 )
 
@@ -18,11 +24,16 @@ import (
 type Translator interface {
 
 	// Translate performs the converstion from the input type to a mattermost supported import
-	Translate(translation *model.Translation) (outputFilename string, err error)
+	// and stops early with the context's error if ctx is cancelled
+	Translate(ctx context.Context, translation *model.Translation) (outputFilename string, err error)
 
 	// GetOutputArchiveLocalPath returns the local accesible path to the archive file
 	GetOutputArchiveLocalPath() (string, error)
 
+	// GetOutputArchiveChecksum returns the hex encoded SHA-256 of the
+	// output archive, or an empty string if it is not known
+	GetOutputArchiveChecksum() (string, error)
+
 	// Cleanup cleans up resources, like local files
 	Cleanup() error
 }
@@ -31,25 +42,56 @@ type Translator interface {
 // concrete Translator
 type TranslatorOptions struct {
 	ArchiveType model.BackupType
-	Bucket      string
+	ObjectStore objectstore.ObjectStore
 	WorkingDir  string
+
+	// AttachmentWorkers is the number of attached files fetched
+	// concurrently by translators which fetch them, or 0 for the
+	// default.
+	AttachmentWorkers int
+
+	// SlackToken is the token to fetch the files attached to a Slack
+	// export with, if any.
+	SlackToken string
 }
 
 // NewTranslator returns a Translator capable of translating some
 // foreign workspace archive into a Mattermost backup
-// archive. Currently only Slack is supported.
+// archive. Slack, Microsoft Teams, Discord, Rocket.Chat and Zulip
+// archives are supported.
 func NewTranslator(t *TranslatorOptions) (Translator, error) {
 	if t == nil {
 		return nil, errors.New("options struct must not be nil")
 	}
 
 	if t.ArchiveType == model.SlackWorkspaceBackupType {
-		return slack.NewSlackTranslator(t.Bucket, t.WorkingDir)
+		fetchOptions := slack.DefaultFetchOptions
+		if t.AttachmentWorkers > 0 {
+			fetchOptions.Workers = t.AttachmentWorkers
+		}
+		fetchOptions.Token = t.SlackToken
+		return slack.NewSlackTranslator(t.ObjectStore, t.WorkingDir, fetchOptions), nil
 	}
 
 	if t.ArchiveType == model.MattermostWorkspaceBackupType {
 		return mattermost.NewMattermostTranslator(), nil
 	}
 
+	if t.ArchiveType == model.TeamsWorkspaceBackupType {
+		return teams.NewTeamsTranslator(t.ObjectStore, t.WorkingDir), nil
+	}
+
+	if t.ArchiveType == model.DiscordWorkspaceBackupType {
+		return discord.NewDiscordTranslator(t.ObjectStore, t.WorkingDir), nil
+	}
+
+	if t.ArchiveType == model.RocketChatWorkspaceBackupType {
+		return rocketchat.NewRocketChatTranslator(t.ObjectStore, t.WorkingDir), nil
+	}
+
+	if t.ArchiveType == model.ZulipWorkspaceBackupType {
+		return zulip.NewZulipTranslator(t.ObjectStore, t.WorkingDir), nil
+	}
+
 	return nil, fmt.Errorf("%s is not a supported workspace archive input type", t.ArchiveType)
 }
@@ -1,17 +1,25 @@
 package validators
 
 import (
+	"strings"
+
+	awatmodel "github.com/mattermost/awat/model"
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/v8/cmd/mmctl/commands/importer"
 )
 
+// maxIssues is how many errors are collected before validation of a
+// Mattermost archive is stopped.
+const maxIssues = 100
+
 // MattermostValidator is a type that provides validation functionality for Mattermost data archives.
 type MattermostValidator struct {
 }
 
 // Validate checks the validity of a Mattermost data archive.
 // It uses the mmctl tool's validation process, ensuring the archive is correctly formatted and structured.
-func (v *MattermostValidator) Validate(archiveName string) error {
+// Every problem found in the JSONL file is reported with its line.
+func (v *MattermostValidator) Validate(archiveName string) (*awatmodel.ValidationReport, error) {
 	// TODO: look into ways to populate existing data.
 
 	serverTeams := make(map[string]*model.Team)
@@ -31,7 +39,49 @@ func (v *MattermostValidator) Validate(archiveName string) error {
 		16383,          // max post size - taken from mmctl logic
 	)
 
-	return mmctlValidator.Validate()
+	report := awatmodel.NewValidationReport(awatmodel.MattermostWorkspaceBackupType)
+	mmctlValidator.OnError(func(validationErr *importer.ImportValidationError) error {
+		issue := awatmodel.ValidationIssue{
+			File:   validationErr.FileName,
+			Line:   validationErr.CurrentLine,
+			Entity: entityOfField(validationErr.FieldName),
+			Field:  validationErr.FieldName,
+		}
+		if validationErr.Err != nil {
+			issue.Message = validationErr.Err.Error()
+		}
+		report.AddError(issue)
+		if len(report.Errors) >= maxIssues {
+			return validationErr
+		}
+		return nil
+	})
+
+	err := mmctlValidator.Validate()
+	if err != nil && len(report.Errors) < maxIssues {
+		// the archive could not be read
+		report.AddError(awatmodel.ValidationIssue{Message: err.Error()})
+	}
+	if len(report.Errors) >= maxIssues {
+		report.AddWarning(awatmodel.ValidationIssue{Message: "validation stopped after too many errors"})
+	}
+
+	report.Teams = int(mmctlValidator.TeamCount())
+	report.Channels = int(mmctlValidator.ChannelCount() + mmctlValidator.DirectChannelCount())
+	report.Users = int(mmctlValidator.UserCount())
+	report.Posts = int(mmctlValidator.PostCount() + mmctlValidator.DirectPostCount())
+
+	return report, nil
+}
+
+// entityOfField returns the type of entity a field such as
+// "user.teams[0]" belongs to.
+func entityOfField(field string) string {
+	if i := strings.IndexAny(field, ".["); i >= 0 {
+		return field[:i]
+	}
+
+	return field
 }
 
 // NewMattermostValidator returns a validator for mattermost archive types
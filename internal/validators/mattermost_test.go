@@ -0,0 +1,37 @@
+package validators
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMattermostValidator(t *testing.T) {
+	t.Run("dummy archive", func(t *testing.T) {
+		report, err := NewMattermostValidator().Validate("../../test/dummy-mattermost-workspace-archive.zip")
+		require.NoError(t, err)
+		assert.Empty(t, report.Errors)
+		assert.NotZero(t, report.Users)
+		assert.NotZero(t, report.Posts)
+	})
+
+	t.Run("invalid lines", func(t *testing.T) {
+		archive := writeArchive(t, map[string]string{
+			"import.jsonl": `{"type": "version", "version": 1}
+{"type": "team", "team": {"name": "myteam", "display_name": "My Team", "type": "O"}}
+{"type": "user", "user": {"username": "", "email": "alice@example.com"}}
+{"type": "bogus"}
+`,
+		})
+
+		report, err := NewMattermostValidator().Validate(archive)
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Teams)
+		require.Len(t, report.Errors, 2)
+		assert.Equal(t, "import.jsonl", report.Errors[0].File)
+		assert.Equal(t, uint64(3), report.Errors[0].Line)
+		assert.Equal(t, "user", report.Errors[0].Entity)
+		assert.Equal(t, uint64(4), report.Errors[1].Line)
+	})
+}
@@ -0,0 +1,59 @@
+package validators
+
+import (
+	"archive/zip"
+	"path"
+	"strings"
+
+	"github.com/mattermost/awat/model"
+)
+
+// RocketChatValidator is a type that provides validation functionality for Rocket.Chat exports.
+type RocketChatValidator struct{}
+
+// Validate checks that a Rocket.Chat export is a zip file holding either
+// a mongodump of the users and messages of the Rocket.Chat database or
+// the users.csv of a CSV export.
+func (v *RocketChatValidator) Validate(archiveName string) (*model.ValidationReport, error) {
+	report := model.NewValidationReport(model.RocketChatWorkspaceBackupType)
+
+	archive, err := zip.OpenReader(archiveName)
+	if err != nil {
+		report.AddError(model.ValidationIssue{Message: "failed to open Rocket.Chat export: " + err.Error()})
+		return report, nil
+	}
+	defer archive.Close()
+
+	var hasUsers, hasMessages bool
+	for _, file := range archive.File {
+		if file.Name == "users.csv" {
+			return report, nil
+		}
+		switch path.Base(file.Name) {
+		case "users.bson":
+			hasUsers = true
+		case "rocketchat_message.bson":
+			hasMessages = true
+		}
+	}
+
+	var missing []string
+	if !hasUsers {
+		missing = append(missing, "users.bson")
+	}
+	if !hasMessages {
+		missing = append(missing, "rocketchat_message.bson")
+	}
+	if len(missing) > 0 {
+		report.AddError(model.ValidationIssue{
+			Message: "archive is not a CSV export and its mongodump is missing " + strings.Join(missing, " and "),
+		})
+	}
+
+	return report, nil
+}
+
+// NewRocketChatValidator returns a validator for rocketchat archive types
+func NewRocketChatValidator() *RocketChatValidator {
+	return &RocketChatValidator{}
+}
@@ -0,0 +1,47 @@
+package validators
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRocketChatValidator(t *testing.T) {
+	mongodump := writeArchive(t, map[string]string{
+		"dump/rocketchat/users.bson":              "",
+		"dump/rocketchat/rocketchat_message.bson": "",
+		"dump/rocketchat/rocketchat_room.bson":    "",
+	})
+	content, err := os.ReadFile(mongodump)
+	require.NoError(t, err)
+
+	var testCases = []struct {
+		testName string
+		archive  string
+		errors   []string
+	}{
+		{"mongodump", mongodump, nil},
+		{"CSV export", writeArchive(t, map[string]string{"users.csv": "", "channels.csv": ""}), nil},
+		{"no messages", writeArchive(t, map[string]string{"dump/rocketchat/users.bson": ""}), []string{"archive is not a CSV export and its mongodump is missing rocketchat_message.bson"}},
+		{"users.csv not at the root", writeArchive(t, map[string]string{"export/users.csv": ""}), []string{"archive is not a CSV export and its mongodump is missing users.bson and rocketchat_message.bson"}},
+		{"empty zip", writeArchive(t, nil), []string{"archive is not a CSV export and its mongodump is missing users.bson and rocketchat_message.bson"}},
+		{"truncated zip", writeFile(t, "export.zip", content[:len(content)-30]), []string{"failed to open Rocket.Chat export: zip: not a valid zip file"}},
+		{"tarball", writeFile(t, "export.zip", writeTarball(t, map[string]string{"users.csv": ""})), []string{"failed to open Rocket.Chat export: zip: not a valid zip file"}},
+		{"empty file", writeFile(t, "export.zip", nil), []string{"failed to open Rocket.Chat export: zip: not a valid zip file"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			report, err := NewRocketChatValidator().Validate(tc.archive)
+			require.NoError(t, err)
+
+			var errors []string
+			for _, issue := range report.Errors {
+				errors = append(errors, issue.Message)
+			}
+			assert.Equal(t, tc.errors, errors)
+		})
+	}
+}
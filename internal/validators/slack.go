@@ -1,15 +1,281 @@
 package validators
 
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/awat/model"
+)
+
+// The files of a Slack export describing its users and conversations.
+// Every conversation with messages has a directory holding a file of
+// messages per day, named after the channel, or after the ID of direct
+// messages.
+const (
+	slackUsersFile    = "users.json"
+	slackChannelsFile = "channels.json"
+	slackGroupsFile   = "groups.json"
+	slackMPIMsFile    = "mpims.json"
+	slackDMsFile      = "dms.json"
+)
+
+// slackBotUserID is the ID Slackbot posts with; it is never listed in
+// users.json.
+const slackBotUserID = "USLACKBOT"
+
+// maxReportedIDs limits how many unknown user IDs are listed in a
+// warning.
+const maxReportedIDs = 10
+
+// DefaultMaxShareWithoutEmail is the share of users without an email
+// address above which a Slack export is rejected, as those users are
+// skipped when translating the export.
+const DefaultMaxShareWithoutEmail = 0.5
+
+var dayFilePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}\.json$`)
+
 // SlackValidator is a type that provides validation functionality for Slack data archives.
-type SlackValidator struct{}
+type SlackValidator struct {
+	// MaxShareWithoutEmail is the share of users, from 0 to 1, which
+	// may lack an email address.
+	MaxShareWithoutEmail float64
+}
+
+// slackUser holds the fields of a user in users.json which are
+// validated.
+type slackUser struct {
+	ID      string `json:"id"`
+	IsBot   bool   `json:"is_bot"`
+	Deleted bool   `json:"deleted"`
+	Profile struct {
+		Email string `json:"email"`
+	} `json:"profile"`
+}
+
+// slackChannel holds the fields of a conversation in channels.json,
+// groups.json, mpims.json or dms.json which are validated.
+type slackChannel struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+// slackMessage holds the fields of a message in a day file which are
+// validated.
+type slackMessage struct {
+	User    string `json:"user"`
+	BotID   string `json:"bot_id"`
+	Subtype string `json:"subtype"`
+}
+
+// Validate checks the validity of a Slack data archive. It checks that
+// the archive is a zip file, that users.json and channels.json are
+// present and can be parsed, that every day file of a conversation
+// holds a list of messages, that messages and channels only refer to
+// users in users.json and that not too many users lack an email
+// address.
+func (v *SlackValidator) Validate(archiveName string) (*model.ValidationReport, error) {
+	report := model.NewValidationReport(model.SlackWorkspaceBackupType)
+
+	archive, err := zip.OpenReader(archiveName)
+	if err != nil {
+		report.AddError(model.ValidationIssue{Message: "failed to open Slack export as a zip file: " + err.Error()})
+		return report, nil
+	}
+	defer archive.Close()
+
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		if !file.FileInfo().IsDir() {
+			files[path.Clean(file.Name)] = file
+		}
+	}
+
+	var users []slackUser
+	if !readSlackFile(report, files, slackUsersFile, "user", true, &users) {
+		return report, nil
+	}
+	userIDs := make(map[string]bool, len(users))
+	withoutEmail := 0
+	for _, user := range users {
+		userIDs[user.ID] = true
+		if user.IsBot || user.Deleted {
+			continue
+		}
+		report.Users++
+		if user.Profile.Email == "" {
+			withoutEmail++
+		}
+	}
+	if report.Users == 0 {
+		report.AddError(model.ValidationIssue{File: slackUsersFile, Entity: "user", Message: "no active users"})
+	} else if withoutEmail > 0 {
+		issue := model.ValidationIssue{
+			File:    slackUsersFile,
+			Entity:  "user",
+			Field:   "user.profile.email",
+			Message: fmt.Sprintf("%d of %d users have no email address and will be skipped", withoutEmail, report.Users),
+		}
+		if share := float64(withoutEmail) / float64(report.Users); share > v.maxShareWithoutEmail() {
+			issue.Message += fmt.Sprintf(", which is more than %.0f%%; export the workspace with email addresses", v.maxShareWithoutEmail()*100)
+			report.AddError(issue)
+		} else {
+			report.AddWarning(issue)
+		}
+	}
+
+	// Conversation directories are named after the channel, except
+	// for direct messages which are named after their ID.
+	conversations := make(map[string]bool)
+	unknownUsers := make(map[string]bool)
+	if !readSlackConversations(report, files, slackChannelsFile, true, false, userIDs, conversations, unknownUsers) {
+		return report, nil
+	}
+	readSlackConversations(report, files, slackGroupsFile, false, false, userIDs, conversations, unknownUsers)
+	readSlackConversations(report, files, slackMPIMsFile, false, false, userIDs, conversations, unknownUsers)
+	readSlackConversations(report, files, slackDMsFile, false, true, userIDs, conversations, unknownUsers)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	dayFiles := 0
+	unknownDirs := make(map[string]bool)
+	for _, name := range names {
+		dir, base := path.Split(name)
+		dir = strings.TrimSuffix(dir, "/")
+		if dir == "" || strings.Contains(dir, "/") || !strings.HasSuffix(base, ".json") {
+			continue
+		}
+		if !conversations[dir] {
+			unknownDirs[dir] = true
+			continue
+		}
+		if !dayFilePattern.MatchString(base) {
+			report.AddWarning(model.ValidationIssue{File: name, Message: "not named after a day and will be skipped"})
+			continue
+		}
+
+		var messages []slackMessage
+		if !readSlackFile(report, files, name, "post", true, &messages) {
+			continue
+		}
+		dayFiles++
+		report.Posts += len(messages)
+		for _, message := range messages {
+			if message.User != "" && message.User != slackBotUserID && !userIDs[message.User] && message.BotID == "" {
+				unknownUsers[message.User] = true
+			}
+		}
+	}
+
+	if len(unknownDirs) > 0 {
+		report.AddWarning(model.ValidationIssue{
+			Entity:  "post",
+			Message: fmt.Sprintf("messages of %s will be skipped as they do not belong to a known conversation", listIDs(unknownDirs)),
+		})
+	}
+	if len(unknownUsers) > 0 {
+		report.AddWarning(model.ValidationIssue{
+			Entity:  "user",
+			Message: fmt.Sprintf("%d users referred to by messages or channels are not part of %s: %s", len(unknownUsers), slackUsersFile, listIDs(unknownUsers)),
+		})
+	}
+	if dayFiles == 0 {
+		report.AddError(model.ValidationIssue{Entity: "post", Message: "the export holds no messages"})
+	}
+
+	return report, nil
+}
+
+func (v *SlackValidator) maxShareWithoutEmail() float64 {
+	if v.MaxShareWithoutEmail <= 0 {
+		return DefaultMaxShareWithoutEmail
+	}
+
+	return v.MaxShareWithoutEmail
+}
+
+// readSlackConversations reads one of the files listing conversations,
+// recording the names of their directories in conversations and
+// members missing from userIDs in unknownUsers. It returns false if a
+// required file is missing or any file cannot be parsed.
+func readSlackConversations(report *model.ValidationReport, files map[string]*zip.File, name string, required, byID bool, userIDs, conversations, unknownUsers map[string]bool) bool {
+	var channels []slackChannel
+	if !readSlackFile(report, files, name, "channel", required, &channels) {
+		return false
+	}
+
+	for _, channel := range channels {
+		report.Channels++
+		if byID {
+			conversations[channel.ID] = true
+		} else {
+			conversations[channel.Name] = true
+		}
+		for _, member := range channel.Members {
+			if !userIDs[member] {
+				unknownUsers[member] = true
+			}
+		}
+	}
+
+	return true
+}
+
+// readSlackFile parses the JSON file with the given name into value,
+// recording an error about the entities it holds in the report if the
+// file cannot be parsed or a required file is missing. It returns false
+// in that case, or if an optional file is missing.
+func readSlackFile(report *model.ValidationReport, files map[string]*zip.File, name, entity string, required bool, value interface{}) bool {
+	file, ok := files[name]
+	if !ok {
+		if required {
+			report.AddError(model.ValidationIssue{File: name, Entity: entity, Message: "missing from the export"})
+		}
+		return false
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		report.AddError(model.ValidationIssue{File: name, Entity: entity, Message: "failed to open: " + err.Error()})
+		return false
+	}
+	defer reader.Close()
+
+	err = json.NewDecoder(reader).Decode(value)
+	if err != nil {
+		report.AddError(model.ValidationIssue{File: name, Entity: entity, Message: "failed to parse: " + err.Error()})
+		return false
+	}
+
+	return true
+}
+
+// listIDs returns the sorted IDs in a comma separated list, shortened
+// to maxReportedIDs.
+func listIDs(ids map[string]bool) string {
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+
+	if len(sorted) > maxReportedIDs {
+		return fmt.Sprintf("%s and %d more", strings.Join(sorted[:maxReportedIDs], ", "), len(sorted)-maxReportedIDs)
+	}
 
-// Validate checks the validity of a Slack data archive.
-// Currently, it does not perform any checks and always returns nil (no error).
-func (v *SlackValidator) Validate(archiveName string) error {
-	return nil
+	return strings.Join(sorted, ", ")
 }
 
 // NewSlackValidator returns a validator for slack archive types
 func NewSlackValidator() *SlackValidator {
-	return &SlackValidator{}
+	return &SlackValidator{MaxShareWithoutEmail: DefaultMaxShareWithoutEmail}
 }
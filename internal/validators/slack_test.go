@@ -0,0 +1,124 @@
+package validators
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeArchive(t *testing.T, files map[string]string) string {
+	archivePath := filepath.Join(t.TempDir(), "slack-export.zip")
+	archiveFile, err := os.Create(archivePath)
+	require.NoError(t, err)
+	defer archiveFile.Close()
+
+	archive := zip.NewWriter(archiveFile)
+	for name, content := range files {
+		file, err := archive.Create(name)
+		require.NoError(t, err)
+		_, err = file.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, archive.Close())
+
+	return archivePath
+}
+
+func TestSlackValidatorDummyArchive(t *testing.T) {
+	report, err := NewSlackValidator().Validate("../../test/dummy-slack-workspace-archive.zip")
+	require.NoError(t, err)
+	assert.True(t, report.Valid(), report.Errors)
+	assert.NotZero(t, report.Users)
+	assert.NotZero(t, report.Channels)
+	assert.NotZero(t, report.Posts)
+}
+
+func TestSlackValidator(t *testing.T) {
+	users := `[
+		{"id": "U1", "profile": {"email": "alice@example.com"}},
+		{"id": "U2", "profile": {"email": "bob@example.com"}},
+		{"id": "U3", "profile": {}},
+		{"id": "B1", "is_bot": true, "profile": {}}
+	]`
+
+	t.Run("valid export", func(t *testing.T) {
+		archive := writeArchive(t, map[string]string{
+			"users.json":              users,
+			"channels.json":           `[{"id": "C1", "name": "general", "members": ["U1", "U2", "U9"]}]`,
+			"dms.json":                `[{"id": "D1", "members": ["U1", "U2"]}]`,
+			"general/2020-01-01.json": `[{"user": "U1", "text": "hi"}, {"user": "U8", "text": "hello"}, {"user": "USLACKBOT", "text": "beep"}]`,
+			"D1/2020-01-02.json":      `[{"user": "U2", "text": "psst"}]`,
+			"general/notes.json":      `{}`,
+			"random/2020-01-01.json":  `[]`,
+		})
+
+		report, err := NewSlackValidator().Validate(archive)
+		require.NoError(t, err)
+		assert.Empty(t, report.Errors)
+		assert.Equal(t, 3, report.Users)
+		assert.Equal(t, 2, report.Channels)
+		assert.Equal(t, 4, report.Posts)
+
+		warnings := make([]string, 0, len(report.Warnings))
+		for _, warning := range report.Warnings {
+			warnings = append(warnings, warning.String())
+		}
+		assert.Equal(t, []string{
+			"users.json: user.profile.email: 1 of 3 users have no email address and will be skipped",
+			"general/notes.json: not named after a day and will be skipped",
+			"post: messages of random will be skipped as they do not belong to a known conversation",
+			"user: 2 users referred to by messages or channels are not part of users.json: U8, U9",
+		}, warnings)
+	})
+
+	t.Run("missing channels.json", func(t *testing.T) {
+		archive := writeArchive(t, map[string]string{
+			"users.json": users,
+		})
+
+		report, err := NewSlackValidator().Validate(archive)
+		require.NoError(t, err)
+		assert.EqualError(t, report.Err(), "invalid slack archive: channels.json: channel: missing from the export")
+	})
+
+	t.Run("broken day file", func(t *testing.T) {
+		archive := writeArchive(t, map[string]string{
+			"users.json":              users,
+			"channels.json":           `[{"id": "C1", "name": "general"}]`,
+			"general/2020-01-01.json": `[{"user": `,
+		})
+
+		report, err := NewSlackValidator().Validate(archive)
+		require.NoError(t, err)
+		require.Len(t, report.Errors, 2)
+		assert.Equal(t, "general/2020-01-01.json", report.Errors[0].File)
+		assert.Contains(t, report.Errors[0].Message, "failed to parse")
+		assert.Equal(t, "post: the export holds no messages", report.Errors[1].String())
+	})
+
+	t.Run("too many users without email", func(t *testing.T) {
+		archive := writeArchive(t, map[string]string{
+			"users.json":              `[{"id": "U1", "profile": {}}, {"id": "U2", "profile": {}}]`,
+			"channels.json":           `[{"id": "C1", "name": "general"}]`,
+			"general/2020-01-01.json": `[{"user": "U1"}]`,
+		})
+
+		report, err := NewSlackValidator().Validate(archive)
+		require.NoError(t, err)
+		require.Len(t, report.Errors, 1)
+		assert.Contains(t, report.Errors[0].Message, "2 of 2 users have no email address")
+	})
+
+	t.Run("not a zip file", func(t *testing.T) {
+		archive := filepath.Join(t.TempDir(), "export.zip")
+		require.NoError(t, os.WriteFile(archive, []byte("not a zip"), 0600))
+
+		report, err := NewSlackValidator().Validate(archive)
+		require.NoError(t, err)
+		assert.False(t, report.Valid())
+	})
+}
@@ -7,12 +7,14 @@ import (
 )
 
 // Validator defines an interface for validating data archives.
+// Validate reports the problems found in the archive, returning an
+// error only if the archive could not be checked at all.
 type Validator interface {
-	Validate(archiveName string) error
+	Validate(archiveName string) (*model.ValidationReport, error)
 }
 
 // NewValidator creates a new validator based on the specified archive type.
-// It supports different archive types, such as Mattermost and Slack.
+// It supports different archive types, such as Mattermost, Slack, Rocket.Chat and Zulip.
 // Returns the appropriate validator or an error if the archive type is unsupported.
 func NewValidator(archiveType model.BackupType) (Validator, error) {
 	switch archiveType {
@@ -20,6 +22,10 @@ func NewValidator(archiveType model.BackupType) (Validator, error) {
 		return NewMattermostValidator(), nil
 	case model.SlackWorkspaceBackupType:
 		return NewSlackValidator(), nil
+	case model.RocketChatWorkspaceBackupType:
+		return NewRocketChatValidator(), nil
+	case model.ZulipWorkspaceBackupType:
+		return NewZulipValidator(), nil
 	}
 
 	return nil, fmt.Errorf("can't find validator for type: %s", archiveType)
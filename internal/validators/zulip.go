@@ -0,0 +1,103 @@
+package validators
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/mattermost/awat/model"
+	"github.com/pkg/errors"
+)
+
+// ZulipValidator is a type that provides validation functionality for Zulip realm exports.
+type ZulipValidator struct{}
+
+// Validate checks that a Zulip realm export is a gzipped tarball or a zip
+// file holding realm.json and at least one messages-*.json file.
+func (v *ZulipValidator) Validate(archiveName string) (*model.ValidationReport, error) {
+	report := model.NewValidationReport(model.ZulipWorkspaceBackupType)
+
+	names, err := zulipExportNames(archiveName)
+	if err != nil {
+		report.AddError(model.ValidationIssue{Message: err.Error()})
+		return report, nil
+	}
+
+	var hasRealm, hasMessages bool
+	for _, name := range names {
+		base := path.Base(name)
+		switch {
+		case base == "realm.json":
+			hasRealm = true
+		case strings.HasPrefix(base, "messages-") && strings.HasSuffix(base, ".json"):
+			hasMessages = true
+		}
+	}
+
+	if !hasRealm {
+		report.AddError(model.ValidationIssue{Message: "Zulip export holds no realm.json"})
+	}
+	if !hasMessages {
+		report.AddError(model.ValidationIssue{Message: "Zulip export holds no messages-*.json files"})
+	}
+
+	return report, nil
+}
+
+// zulipExportNames returns the names of the files in a Zulip export.
+func zulipExportNames(archiveName string) ([]string, error) {
+	file, err := os.Open(archiveName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open Zulip export")
+	}
+	defer file.Close()
+
+	buffered := bufio.NewReader(file)
+	magic, err := buffered.Peek(2)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read Zulip export")
+	}
+
+	var names []string
+	if !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		archive, err := zip.OpenReader(archiveName)
+		if err != nil {
+			return nil, errors.Wrap(err, "Zulip export is neither a gzipped tarball nor a zip file")
+		}
+		defer archive.Close()
+
+		for _, file := range archive.File {
+			names = append(names, file.Name)
+		}
+		return names, nil
+	}
+
+	gzipReader, err := gzip.NewReader(buffered)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decompress Zulip export")
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return names, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read Zulip export")
+		}
+		names = append(names, header.Name)
+	}
+}
+
+// NewZulipValidator returns a validator for zulip archive types
+func NewZulipValidator() *ZulipValidator {
+	return &ZulipValidator{}
+}
@@ -0,0 +1,79 @@
+package validators
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTarball(t *testing.T, files map[string]string) []byte {
+	var buffer bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range files {
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content))}))
+		_, err := tarWriter.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+
+	return buffer.Bytes()
+}
+
+func writeFile(t *testing.T, name string, content []byte) string {
+	filePath := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(filePath, content, 0600))
+	return filePath
+}
+
+func TestZulipValidator(t *testing.T) {
+	export := map[string]string{
+		"zulip-export/realm.json":               `{}`,
+		"zulip-export/messages-000001.json":     `{}`,
+		"zulip-export/uploads/records.json":     `[]`,
+		"zulip-export/avatars/records.json":     `[]`,
+		"zulip-export/attachment.json":          `{}`,
+		"zulip-export/migration_status.json":    `{}`,
+		"zulip-export/emoji/records.json":       `[]`,
+		"zulip-export/realm_icons/records.json": `[]`,
+	}
+	withoutMessages := map[string]string{"zulip-export/realm.json": `{}`}
+	withoutRealm := map[string]string{"zulip-export/messages-000001.json": `{}`}
+	tarball := writeTarball(t, export)
+
+	var testCases = []struct {
+		testName string
+		archive  string
+		errors   []string
+	}{
+		{"valid tarball", writeFile(t, "export.tar.gz", tarball), nil},
+		{"valid zip", writeArchive(t, export), nil},
+		{"no messages", writeFile(t, "export.tar.gz", writeTarball(t, withoutMessages)), []string{"Zulip export holds no messages-*.json files"}},
+		{"no realm", writeArchive(t, withoutRealm), []string{"Zulip export holds no realm.json"}},
+		{"empty tarball", writeFile(t, "export.tar.gz", writeTarball(t, nil)), []string{"Zulip export holds no realm.json", "Zulip export holds no messages-*.json files"}},
+		{"truncated tarball", writeFile(t, "export.tar.gz", tarball[:len(tarball)/2]), []string{"failed to read Zulip export: unexpected EOF"}},
+		{"gzipped garbage", writeFile(t, "export.tar.gz", append([]byte{0x1f, 0x8b}, []byte("garbage")...)), []string{"failed to decompress Zulip export: unexpected EOF"}},
+		{"neither tarball nor zip", writeFile(t, "export.tar.gz", []byte("not an archive")), []string{"Zulip export is neither a gzipped tarball nor a zip file: zip: not a valid zip file"}},
+		{"empty file", writeFile(t, "export.tar.gz", nil), []string{"failed to read Zulip export: EOF"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			report, err := NewZulipValidator().Validate(tc.archive)
+			require.NoError(t, err)
+
+			var errors []string
+			for _, issue := range report.Errors {
+				errors = append(errors, issue.Message)
+			}
+			assert.Equal(t, tc.errors, errors)
+		})
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package zulip
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A Zulip realm export is the .tar.gz written by
+// `manage.py export`, or a .zip of the same directory. Its realm.json
+// holds the tables describing the realm, messages-*.json the messages
+// and uploads/ the uploaded files, stored under their path IDs.
+const (
+	realmFile      = "realm.json"
+	messagesPrefix = "messages-"
+	uploadsDir     = "uploads"
+)
+
+// Recipient types.
+const (
+	personalRecipientType = 1
+	streamRecipientType   = 2
+	huddleRecipientType   = 3
+)
+
+// adminRole is the highest role value of realm administrators; realm
+// owners have a lower value still.
+const adminRole = 200
+
+// Realm is the Zulip organization that was exported.
+type Realm struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	StringID string `json:"string_id"`
+}
+
+// UserProfile is a Zulip user.
+type UserProfile struct {
+	ID            int64  `json:"id"`
+	Email         string `json:"email"`
+	DeliveryEmail string `json:"delivery_email"`
+	FullName      string `json:"full_name"`
+	Role          int    `json:"role"`
+	IsActive      bool   `json:"is_active"`
+	IsBot         bool   `json:"is_bot"`
+}
+
+// Stream is a Zulip stream.
+type Stream struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	InviteOnly  bool   `json:"invite_only"`
+	Deactivated bool   `json:"deactivated"`
+}
+
+// Recipient is the recipient of a message: a user, a stream or a
+// huddle, which is a group direct message conversation.
+type Recipient struct {
+	ID     int64 `json:"id"`
+	Type   int   `json:"type"`
+	TypeID int64 `json:"type_id"`
+}
+
+// Subscription is the subscription of a user to a recipient.
+type Subscription struct {
+	UserProfile int64 `json:"user_profile"`
+	Recipient   int64 `json:"recipient"`
+	Active      bool  `json:"active"`
+}
+
+// Reaction is a reaction to a message.
+type Reaction struct {
+	UserProfile int64  `json:"user_profile"`
+	Message     int64  `json:"message"`
+	EmojiName   string `json:"emoji_name"`
+}
+
+// Attachment is an uploaded file.
+type Attachment struct {
+	ID       int64   `json:"id"`
+	PathID   string  `json:"path_id"`
+	FileName string  `json:"file_name"`
+	Messages []int64 `json:"messages"`
+}
+
+// RealmExport holds the tables of realm.json.
+type RealmExport struct {
+	Realms        []Realm        `json:"zerver_realm"`
+	Users         []UserProfile  `json:"zerver_userprofile"`
+	Streams       []Stream       `json:"zerver_stream"`
+	Recipients    []Recipient    `json:"zerver_recipient"`
+	Subscriptions []Subscription `json:"zerver_subscription"`
+	Reactions     []Reaction     `json:"zerver_reaction"`
+	Attachments   []Attachment   `json:"zerver_attachment"`
+}
+
+// Message is a Zulip message.
+type Message struct {
+	ID           int64    `json:"id"`
+	Sender       int64    `json:"sender"`
+	Recipient    int64    `json:"recipient"`
+	Subject      string   `json:"subject"`
+	Content      string   `json:"content"`
+	DateSent     float64  `json:"date_sent"`
+	LastEditTime *float64 `json:"last_edit_time"`
+}
+
+// MessagesExport holds the messages of a messages-*.json file.
+type MessagesExport struct {
+	Messages []Message `json:"zerver_message"`
+}
+
+// extract unpacks the export at inputPath, which is either a gzipped
+// tarball or a zip file, to dir and returns the directory holding
+// realm.json.
+func extract(inputPath, dir string) (string, error) {
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to open %s", inputPath)
+	}
+	defer input.Close()
+
+	buffered := bufio.NewReader(input)
+	magic, err := buffered.Peek(2)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read %s", inputPath)
+	}
+
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		err = extractTarball(buffered, dir)
+	} else {
+		err = extractZip(inputPath, dir)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var root string
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if root == "" && !info.IsDir() && info.Name() == realmFile {
+			root = filepath.Dir(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to search export")
+	}
+	if root == "" {
+		return "", errors.Errorf("export holds no %s", realmFile)
+	}
+
+	return root, nil
+}
+
+func extractTarball(input io.Reader, dir string) error {
+	gzipReader, err := gzip.NewReader(input)
+	if err != nil {
+		return errors.Wrap(err, "failed to decompress export")
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read export")
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		err = extractFile(tarReader, dir, header.Name)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractZip(inputPath, dir string) error {
+	archive, err := zip.OpenReader(inputPath)
+	if err != nil {
+		return errors.Wrap(err, "export is neither a gzipped tarball nor a zip file")
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return errors.Wrapf(err, "failed to open %s", file.Name)
+		}
+		err = extractFile(reader, dir, file.Name)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractFile writes a file of the export below dir, refusing names
+// which would end up outside of it.
+func extractFile(content io.Reader, dir, name string) error {
+	localPath := filepath.Join(dir, filepath.FromSlash(name))
+	if !strings.HasPrefix(localPath, filepath.Clean(dir)+string(filepath.Separator)) {
+		return errors.Errorf("export holds file with invalid name %s", name)
+	}
+
+	err := os.MkdirAll(filepath.Dir(localPath), 0700)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create directory for %s", name)
+	}
+	output, err := os.Create(localPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s", localPath)
+	}
+	defer output.Close()
+
+	_, err = io.Copy(output, content)
+	if err != nil {
+		return errors.Wrapf(err, "failed to extract %s", name)
+	}
+
+	return output.Close()
+}
+
+// readRealm parses realm.json.
+func readRealm(root string) (*RealmExport, error) {
+	var realm RealmExport
+	err := readJSON(filepath.Join(root, realmFile), &realm)
+	if err != nil {
+		return nil, err
+	}
+	if len(realm.Realms) == 0 {
+		return nil, errors.Errorf("%s holds no realm", realmFile)
+	}
+
+	return &realm, nil
+}
+
+// messageFiles returns the paths of the messages-*.json files of the
+// export in order.
+func messageFiles(root string) ([]string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list export")
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), messagesPrefix) && strings.HasSuffix(entry.Name(), ".json") {
+			files = append(files, filepath.Join(root, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+func readJSON(path string, value interface{}) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %s", filepath.Base(path))
+	}
+	defer file.Close()
+
+	err = json.NewDecoder(bufio.NewReader(file)).Decode(value)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse %s", filepath.Base(path))
+	}
+
+	return nil
+}
@@ -0,0 +1,339 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package zulip
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/awat/internal/mbif"
+	"github.com/mattermost/awat/model"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// emailSource is used to build placeholder email addresses for users
+// whose address is not part of the export.
+const emailSource = "zulip"
+
+var (
+	// mentionPattern matches user mentions such as @**Full Name**,
+	// @**Full Name|42** and their silent @_**Full Name** form.
+	mentionPattern = regexp.MustCompile(`@_?\*\*([^*|]+?)(?:\|(\d+))?\*\*`)
+
+	// uploadPattern matches Markdown links to uploaded files.
+	uploadPattern = regexp.MustCompile(`\[([^\]]*)\]\(/user_uploads/([^)\s]+)\)`)
+)
+
+// transformer holds the state of a single Zulip to MBIF
+// transformation.
+type transformer struct {
+	logger        log.FieldLogger
+	root          string
+	attachmentDir string
+	realm         *RealmExport
+	workspace     *mbif.Workspace
+
+	recipients      map[int64]Recipient
+	directChannels  map[string]*mbif.DirectChannel
+	huddleMembers   map[int64][]string
+	topicRoots      map[string]string
+	reactions       map[int64][]Reaction
+	usernames       map[string]string
+	userIDsByName   map[string]string
+	attachmentNames mbif.Names
+	attachments     map[string]string
+	now             int64
+}
+
+// TransformZulip reads the Zulip realm export at inputPath and writes
+// its contents as MBIF to mbifPath, copying uploaded files to
+// attachmentDir. Streams become channels and every topic of a stream
+// becomes a thread, whose root post is the first message of the topic.
+func TransformZulip(translation *model.Translation, inputPath, mbifPath, attachmentDir string, logger log.FieldLogger) error {
+	root, err := extract(inputPath, filepath.Join(filepath.Dir(inputPath), "export"))
+	if err != nil {
+		return errors.Wrap(err, "failed to extract Zulip export")
+	}
+
+	realm, err := readRealm(root)
+	if err != nil {
+		return errors.Wrap(err, "failed to read Zulip export")
+	}
+
+	t := &transformer{
+		logger:          logger,
+		root:            root,
+		attachmentDir:   attachmentDir,
+		realm:           realm,
+		workspace:       &mbif.Workspace{TeamName: translation.Team, EmailSource: emailSource},
+		recipients:      make(map[int64]Recipient, len(realm.Recipients)),
+		directChannels:  make(map[string]*mbif.DirectChannel),
+		huddleMembers:   make(map[int64][]string),
+		topicRoots:      make(map[string]string),
+		reactions:       make(map[int64][]Reaction),
+		userIDsByName:   make(map[string]string),
+		attachmentNames: make(mbif.Names),
+		attachments:     make(map[string]string),
+		now:             model.GetMillis(),
+	}
+	if t.workspace.TeamName == "" {
+		t.workspace.TeamName = mbif.ChannelName(realm.Realms[0].StringID)
+		if t.workspace.TeamName == "" {
+			t.workspace.TeamName = mbif.ChannelName(realm.Realms[0].Name)
+		}
+		if t.workspace.TeamName == "" {
+			t.workspace.TeamName = emailSource
+		}
+		t.workspace.TeamDisplayName = realm.Realms[0].Name
+	}
+
+	t.readRealm()
+
+	files, err := messageFiles(root)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		var messages MessagesExport
+		err = readJSON(file, &messages)
+		if err != nil {
+			return err
+		}
+		sort.Slice(messages.Messages, func(i, j int) bool {
+			return messages.Messages[i].ID < messages.Messages[j].ID
+		})
+		for _, message := range messages.Messages {
+			err = t.addMessage(message)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	writer, err := mbif.NewWriter(mbifPath)
+	if err != nil {
+		return err
+	}
+
+	err = t.workspace.Write(writer)
+	if err != nil {
+		writer.Close()
+		return err
+	}
+
+	logger.Infof("Wrote %d lines of MBIF for %d users", writer.Lines(), len(t.workspace.Users))
+
+	return writer.Close()
+}
+
+// readRealm fills the Workspace with the users and streams of the
+// realm.
+func (t *transformer) readRealm() {
+	for _, profile := range t.realm.Users {
+		if profile.IsBot {
+			continue
+		}
+		email := profile.DeliveryEmail
+		if email == "" {
+			email = profile.Email
+		}
+		firstName, lastName, _ := strings.Cut(profile.FullName, " ")
+		user := &mbif.User{
+			ID:        userID(profile.ID),
+			Email:     email,
+			FirstName: firstName,
+			LastName:  lastName,
+			TeamAdmin: profile.Role > 0 && profile.Role <= adminRole,
+		}
+		if !profile.IsActive {
+			user.DeleteAt = t.now
+		}
+		t.workspace.Users = append(t.workspace.Users, user)
+		t.userIDsByName[profile.FullName] = user.ID
+	}
+	t.usernames = t.workspace.Usernames()
+
+	channels := make(map[int64]*mbif.Channel)
+	for _, stream := range t.realm.Streams {
+		channel := &mbif.Channel{
+			ID:      streamID(stream.ID),
+			Name:    stream.Name,
+			Purpose: stream.Description,
+			Private: stream.InviteOnly,
+		}
+		if stream.Deactivated {
+			channel.DeleteAt = t.now
+		}
+		channels[stream.ID] = channel
+		t.workspace.Channels = append(t.workspace.Channels, channel)
+	}
+
+	for _, recipient := range t.realm.Recipients {
+		t.recipients[recipient.ID] = recipient
+	}
+
+	for _, subscription := range t.realm.Subscriptions {
+		recipient, ok := t.recipients[subscription.Recipient]
+		if !ok {
+			continue
+		}
+		member := userID(subscription.UserProfile)
+		switch recipient.Type {
+		case streamRecipientType:
+			if channel, ok := channels[recipient.TypeID]; ok && subscription.Active {
+				channel.Members = append(channel.Members, member)
+			}
+		case huddleRecipientType:
+			t.huddleMembers[recipient.ID] = append(t.huddleMembers[recipient.ID], member)
+		}
+	}
+
+	for _, reaction := range t.realm.Reactions {
+		t.reactions[reaction.Message] = append(t.reactions[reaction.Message], reaction)
+	}
+}
+
+// addMessage adds a message to the Workspace.
+func (t *transformer) addMessage(message Message) error {
+	recipient, ok := t.recipients[message.Recipient]
+	if !ok {
+		t.logger.Warnf("Skipping message %d to unknown recipient %d", message.ID, message.Recipient)
+		return nil
+	}
+
+	post := &mbif.Post{
+		ID:       strconv.FormatInt(message.ID, 10),
+		UserID:   userID(message.Sender),
+		CreateAt: int64(message.DateSent * 1000),
+	}
+	if message.LastEditTime != nil {
+		post.EditAt = int64(*message.LastEditTime * 1000)
+	}
+
+	content := message.Content
+	switch recipient.Type {
+	case streamRecipientType:
+		post.ChannelID = streamID(recipient.TypeID)
+		topic := post.ChannelID + "/" + message.Subject
+		if rootID, ok := t.topicRoots[topic]; ok {
+			post.ThreadID = rootID
+		} else {
+			t.topicRoots[topic] = post.ID
+			if message.Subject != "" {
+				content = "**" + message.Subject + "**\n" + content
+			}
+		}
+	case personalRecipientType:
+		members := []string{post.UserID, userID(recipient.TypeID)}
+		sort.Strings(members)
+		post.ChannelID = t.directChannel("personal:"+strings.Join(members, ","), members)
+	case huddleRecipientType:
+		post.ChannelID = t.directChannel("huddle:"+strconv.FormatInt(recipient.ID, 10), t.huddleMembers[recipient.ID])
+	default:
+		t.logger.Warnf("Skipping message %d to recipient of unknown type %d", message.ID, recipient.Type)
+		return nil
+	}
+
+	content, err := t.extractUploads(content, post)
+	if err != nil {
+		return err
+	}
+	post.Message = t.convertMentions(content)
+
+	for _, reaction := range t.reactions[message.ID] {
+		post.Reactions = append(post.Reactions, mbif.Reaction{
+			UserID: userID(reaction.UserProfile),
+			Emoji:  reaction.EmojiName,
+		})
+	}
+
+	t.workspace.Posts = append(t.workspace.Posts, post)
+
+	return nil
+}
+
+// directChannel returns the ID of the direct conversation with the
+// given ID and members, adding it to the Workspace if it is new.
+func (t *transformer) directChannel(id string, members []string) string {
+	if _, ok := t.directChannels[id]; !ok {
+		directChannel := &mbif.DirectChannel{ID: id, Members: members}
+		t.directChannels[id] = directChannel
+		t.workspace.DirectChannels = append(t.workspace.DirectChannels, directChannel)
+	}
+
+	return id
+}
+
+// extractUploads copies the uploaded files linked to in content to the
+// attachment directory and attaches them to the post, returning the
+// content without the links. Links to files missing from the export
+// are kept.
+func (t *transformer) extractUploads(content string, post *mbif.Post) (string, error) {
+	var err error
+	content = uploadPattern.ReplaceAllStringFunc(content, func(link string) string {
+		if err != nil {
+			return link
+		}
+		pathID := uploadPattern.FindStringSubmatch(link)[2]
+
+		name, ok := t.attachments[pathID]
+		if !ok {
+			var file *os.File
+			file, err = os.Open(filepath.Join(t.root, uploadsDir, filepath.FromSlash(path.Clean("/"+pathID))))
+			if os.IsNotExist(err) {
+				err = nil
+				t.logger.Warnf("Upload %s of message %s is not part of the export", pathID, post.ID)
+				return link
+			}
+			if err != nil {
+				return link
+			}
+			defer file.Close()
+
+			name, err = mbif.SaveAttachment(t.attachmentDir, t.attachmentNames, path.Base(pathID), file)
+			if err != nil {
+				return link
+			}
+			t.attachments[pathID] = name
+		}
+
+		post.Attachments = append(post.Attachments, name)
+		return ""
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to extract uploads of message %s", post.ID)
+	}
+
+	return strings.TrimSpace(content), nil
+}
+
+// convertMentions replaces Zulip user mentions with Mattermost ones.
+func (t *transformer) convertMentions(content string) string {
+	return mentionPattern.ReplaceAllStringFunc(content, func(mention string) string {
+		match := mentionPattern.FindStringSubmatch(mention)
+		id := t.userIDsByName[match[1]]
+		if match[2] != "" {
+			id = "user:" + match[2]
+		}
+		if username, ok := t.usernames[id]; ok {
+			return "@" + username
+		}
+		return "@" + match[1]
+	})
+}
+
+func userID(id int64) string {
+	return "user:" + strconv.FormatInt(id, 10)
+}
+
+func streamID(id int64) string {
+	return "stream:" + strconv.FormatInt(id, 10)
+}
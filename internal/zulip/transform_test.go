@@ -0,0 +1,151 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package zulip
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/awat/internal/mbif"
+	"github.com/mattermost/awat/internal/testlib"
+	"github.com/mattermost/awat/internal/validators"
+	"github.com/mattermost/awat/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testExport is a small Zulip realm export with a stream holding a
+// topic with a reply, a mention and an upload, a private stream, a
+// direct message and a group direct message.
+var testExport = map[string]string{
+	"zulip-export-abc/realm.json": `{
+		"zerver_realm": [{"id": 1, "name": "Example Org", "string_id": "example"}],
+		"zerver_userprofile": [
+			{"id": 10, "email": "user10@zulip.example.com", "delivery_email": "alice@example.com", "full_name": "Alice Smith", "role": 100, "is_active": true},
+			{"id": 11, "email": "bob@example.com", "delivery_email": "", "full_name": "Bob Jones", "role": 400, "is_active": true},
+			{"id": 12, "email": "carol@example.com", "delivery_email": "carol@example.com", "full_name": "Carol", "role": 400, "is_active": false},
+			{"id": 13, "email": "bot@example.com", "full_name": "Welcome Bot", "role": 400, "is_active": true, "is_bot": true}
+		],
+		"zerver_stream": [
+			{"id": 1, "name": "general", "description": "Everything", "invite_only": false},
+			{"id": 2, "name": "leads", "description": "", "invite_only": true}
+		],
+		"zerver_recipient": [
+			{"id": 100, "type": 2, "type_id": 1},
+			{"id": 101, "type": 2, "type_id": 2},
+			{"id": 110, "type": 1, "type_id": 10},
+			{"id": 111, "type": 1, "type_id": 11},
+			{"id": 120, "type": 3, "type_id": 1}
+		],
+		"zerver_subscription": [
+			{"user_profile": 10, "recipient": 100, "active": true},
+			{"user_profile": 11, "recipient": 100, "active": true},
+			{"user_profile": 10, "recipient": 101, "active": true},
+			{"user_profile": 10, "recipient": 120, "active": true},
+			{"user_profile": 11, "recipient": 120, "active": true},
+			{"user_profile": 12, "recipient": 120, "active": true}
+		],
+		"zerver_reaction": [{"user_profile": 11, "message": 1000, "emoji_name": "tada"}],
+		"zerver_attachment": [{"id": 1, "path_id": "1/ab/cdef/plan.txt", "file_name": "plan.txt", "messages": [1002]}]
+	}`,
+	"zulip-export-abc/messages-000001.json": `{"zerver_message": [
+		{"id": 1001, "sender": 11, "recipient": 100, "subject": "launch", "content": "Sounds good @**Alice Smith**", "date_sent": 1682935260.5},
+		{"id": 1000, "sender": 10, "recipient": 100, "subject": "launch", "content": "We launch on Monday", "date_sent": 1682935200.0},
+		{"id": 1002, "sender": 10, "recipient": 100, "subject": "docs", "content": "Here is the [plan.txt](/user_uploads/1/ab/cdef/plan.txt)", "date_sent": 1682935300.0, "last_edit_time": 1682935400.0},
+		{"id": 1003, "sender": 10, "recipient": 111, "subject": "", "content": "Hi @**Bob Jones|11**", "date_sent": 1682935500.0},
+		{"id": 1004, "sender": 12, "recipient": 120, "subject": "", "content": "Hi both", "date_sent": 1682935600.0}
+	]}`,
+	"zulip-export-abc/uploads/1/ab/cdef/plan.txt": "the plan",
+}
+
+func writeTestExport(t *testing.T, dir string) string {
+	exportPath := filepath.Join(dir, "input")
+	exportFile, err := os.Create(exportPath)
+	require.NoError(t, err)
+	defer exportFile.Close()
+
+	gzipWriter := gzip.NewWriter(exportFile)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range testExport {
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0600,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}))
+		_, err = tarWriter.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+
+	return exportPath
+}
+
+func TestTransformZulip(t *testing.T) {
+	logger := testlib.MakeLogger(t)
+	workdir := t.TempDir()
+	inputPath := writeTestExport(t, workdir)
+	attachmentDir := filepath.Join(workdir, "attachments")
+	require.NoError(t, os.MkdirAll(attachmentDir, 0700))
+	mbifPath := filepath.Join(workdir, "MBIF.jsonl")
+
+	translation := &model.Translation{ID: model.NewID(), Type: model.ZulipWorkspaceBackupType}
+	err := TransformZulip(translation, inputPath, mbifPath, attachmentDir, logger)
+	require.NoError(t, err)
+
+	lines := testlib.ReadMBIFLinesByType(t, mbifPath)
+
+	require.Len(t, lines["team"], 1)
+	assert.Equal(t, "example", *lines["team"][0].Team.Name)
+	assert.Equal(t, "Example Org", *lines["team"][0].Team.DisplayName)
+
+	require.Len(t, lines["channel"], 2)
+	assert.Equal(t, "general", *lines["channel"][0].Channel.Name)
+	assert.Equal(t, "Everything", *lines["channel"][0].Channel.Purpose)
+	assert.Equal(t, "P", string(*lines["channel"][1].Channel.Type))
+
+	require.Len(t, lines["user"], 3)
+	alice := lines["user"][0].User
+	assert.Equal(t, "alice", *alice.Username)
+	assert.Equal(t, "alice@example.com", *alice.Email)
+	assert.Equal(t, "Alice", *alice.FirstName)
+	assert.Equal(t, "Smith", *alice.LastName)
+	assert.Equal(t, "team_user team_admin", *(*alice.Teams)[0].Roles)
+	assert.Equal(t, "bob", *lines["user"][1].User.Username)
+	assert.NotNil(t, lines["user"][2].User.DeleteAt)
+
+	posts := lines["post"]
+	require.Len(t, posts, 2)
+	launch := posts[0].Post
+	assert.Equal(t, "**launch**\nWe launch on Monday", *launch.Message)
+	require.NotNil(t, launch.Reactions)
+	assert.Equal(t, "tada", *(*launch.Reactions)[0].EmojiName)
+	require.NotNil(t, launch.Replies)
+	assert.Equal(t, "Sounds good @alice", *(*launch.Replies)[0].Message)
+	assert.Equal(t, int64(1682935260500), *(*launch.Replies)[0].CreateAt)
+
+	docs := posts[1].Post
+	assert.Equal(t, "**docs**\nHere is the", *docs.Message)
+	assert.NotNil(t, docs.EditAt)
+	require.NotNil(t, docs.Attachments)
+	assert.Equal(t, "attachments/plan.txt", *(*docs.Attachments)[0].Path)
+
+	require.Len(t, lines["direct_channel"], 2)
+	directPosts := lines["direct_post"]
+	require.Len(t, directPosts, 2)
+	assert.Equal(t, "Hi @bob", *directPosts[0].DirectPost.Message)
+	assert.Len(t, *directPosts[1].DirectPost.ChannelMembers, 3)
+
+	outputPath := filepath.Join(workdir, "output.zip")
+	_, _, err = mbif.CreateArchive(outputPath, mbifPath, attachmentDir)
+	require.NoError(t, err)
+	report, err := validators.NewMattermostValidator().Validate(outputPath)
+	require.NoError(t, err)
+	assert.Empty(t, report.Errors)
+}
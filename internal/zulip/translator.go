@@ -0,0 +1,73 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package zulip
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/mattermost/awat/internal/mbif"
+	"github.com/mattermost/awat/internal/objectstore"
+	"github.com/mattermost/awat/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// ZulipTranslator is responsible for translating Zulip realm exports
+// into a format compatible with Mattermost.
+type ZulipTranslator struct {
+	objectStore        objectstore.ObjectStore
+	workingDir         string
+	outputZipLocalPath string
+	outputChecksum     string
+}
+
+// NewZulipTranslator creates a new Translator instance for translating
+// Zulip realm exports.
+func NewZulipTranslator(objectStore objectstore.ObjectStore, workingDir string) *ZulipTranslator {
+	return &ZulipTranslator{
+		objectStore: objectStore,
+		workingDir:  workingDir,
+	}
+}
+
+// Translate satisfies the Translator interface for the ZulipTranslator.
+// It converts the Zulip export referenced by the Translation, which may
+// be a gzipped tarball or a zip file, into a Mattermost archive and
+// uploads it to the object store. On success it returns the file name
+// of the output zip file without a path.
+func (zt *ZulipTranslator) Translate(ctx context.Context, translation *model.Translation) (string, error) {
+	logger := log.New().WithField("translation", translation.ID)
+
+	outputPath, checksum, err := mbif.Translate(ctx, zt.objectStore, zt.workingDir, "input", translation, TransformZulip, logger)
+	if err != nil {
+		return "", err
+	}
+	zt.outputZipLocalPath = outputPath
+	zt.outputChecksum = checksum
+
+	logger.Info("Finished translation")
+
+	return filepath.Base(outputPath), nil
+}
+
+// GetOutputArchiveLocalPath returns the local file path of the translated archive.
+func (zt *ZulipTranslator) GetOutputArchiveLocalPath() (string, error) {
+	return zt.outputZipLocalPath, nil
+}
+
+// GetOutputArchiveChecksum returns the checksum of the translated archive.
+func (zt *ZulipTranslator) GetOutputArchiveChecksum() (string, error) {
+	return zt.outputChecksum, nil
+}
+
+// Cleanup performs necessary cleanup operations after the translation process.
+func (zt *ZulipTranslator) Cleanup() error {
+	if zt.outputZipLocalPath == "" {
+		return nil
+	}
+
+	return os.Remove(zt.outputZipLocalPath)
+}
@@ -0,0 +1,18 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package model
+
+// AttachmentReport tells how the attached files of a Translation were
+// stored in its Mattermost archive. Of the AttachedFiles, told apart by
+// the ID the source workspace gave them, UniqueAttachments files with
+// distinct contents and a total size of AttachmentBytes are stored.
+// BytesSaved is the total size of the attached files left out of the
+// archive because a file with identical contents was stored already.
+type AttachmentReport struct {
+	AttachedFiles     int   `json:",omitempty"`
+	UniqueAttachments int   `json:",omitempty"`
+	AttachmentBytes   int64 `json:",omitempty"`
+	BytesSaved        int64 `json:",omitempty"`
+}
@@ -5,18 +5,28 @@
 package model
 
 import (
+	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
+// APIKeyHeader is the header holding the API key a request is
+// authenticated with.
+const APIKeyHeader = "X-Api-Key"
+
 // Client is the programmatic interface to the AWAT API.
 type Client struct {
 	address    string
@@ -33,6 +43,16 @@ func NewClient(address string) *Client {
 	}
 }
 
+// SetAPIKey sets the API key the client authenticates with.
+func (c *Client) SetAPIKey(key string) {
+	c.headers[APIKeyHeader] = key
+}
+
+// SetToken sets the OAuth2 bearer token the client authenticates with.
+func (c *Client) SetToken(token string) {
+	c.headers["Authorization"] = "Bearer " + token
+}
+
 // CreateTranslation creates a new Translation which will start
 // shortly after being created
 func (c *Client) CreateTranslation(translationRequest *TranslationRequest) (*TranslationStatus, error) {
@@ -74,6 +94,73 @@ func (c *Client) GetTranslationStatus(translationID string) (*TranslationStatus,
 	}
 }
 
+// CancelTranslation cancels the Translation with the given ID and
+// returns its TranslationStatus. Completed Translations cannot be
+// cancelled.
+func (c *Client) CancelTranslation(translationID string) (*TranslationStatus, error) {
+	resp, err := c.doDelete(c.buildURL("/translation/%s", translationID))
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return NewTranslationStatusFromReader(resp.Body)
+	case http.StatusNotFound:
+		return nil, nil
+	case http.StatusConflict:
+		return nil, errors.Errorf("translation %s can no longer be cancelled", translationID)
+
+	default:
+		return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
+	}
+}
+
+// RetryTranslation starts the failed Translation with the given ID
+// over and returns its TranslationStatus.
+func (c *Client) RetryTranslation(translationID string) (*TranslationStatus, error) {
+	resp, err := c.doPost(c.buildURL("/translation/%s/retry", translationID), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusAccepted:
+		return NewTranslationStatusFromReader(resp.Body)
+	case http.StatusNotFound:
+		return nil, nil
+	case http.StatusConflict:
+		return nil, errors.Errorf("translation %s has not failed", translationID)
+
+	default:
+		return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
+	}
+}
+
+// UnlockTranslation releases the lock held on the Translation with the
+// given ID and returns its TranslationStatus.
+func (c *Client) UnlockTranslation(translationID string) (*TranslationStatus, error) {
+	resp, err := c.doPost(c.buildURL("/translation/%s/unlock", translationID), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return NewTranslationStatusFromReader(resp.Body)
+	case http.StatusNotFound:
+		return nil, nil
+	case http.StatusConflict:
+		return nil, errors.Errorf("the lock on translation %s changed while releasing it", translationID)
+
+	default:
+		return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
+	}
+}
+
 // GetTranslationStatusesByInstallation returns all Translations that
 // pertain to an Installation
 func (c *Client) GetTranslationStatusesByInstallation(installationID string) ([]*TranslationStatus, error) {
@@ -135,7 +222,13 @@ func (c *Client) GetImportStatusesByTranslation(translationID string) ([]*Import
 // GetAllTranslations gets all Translations from the API and returns
 // them as a JSON list
 func (c *Client) GetAllTranslations() ([]*TranslationStatus, error) {
-	resp, err := c.doGet(c.buildURL("/translations"))
+	return c.ListTranslations(&ListOptions{PerPage: AllPerPage})
+}
+
+// ListTranslations gets the page of Translations selected by options
+// from the API
+func (c *Client) ListTranslations(options *ListOptions) ([]*TranslationStatus, error) {
+	resp, err := c.doGet(c.buildListURL("/translations", options))
 	if err != nil {
 		return nil, err
 	}
@@ -146,14 +239,20 @@ func (c *Client) GetAllTranslations() ([]*TranslationStatus, error) {
 		return NewTranslationStatusListFromReader(resp.Body)
 
 	default:
-		return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
+		return nil, listError(resp)
 	}
 }
 
 // GetAllImports gets all Imports from the API and returns
 // them as a JSON list
 func (c *Client) GetAllImports() ([]*ImportStatus, error) {
-	resp, err := c.doGet(c.buildURL("/imports"))
+	return c.ListImports(&ListOptions{PerPage: AllPerPage})
+}
+
+// ListImports gets the page of Imports selected by options from the
+// API
+func (c *Client) ListImports(options *ListOptions) ([]*ImportStatus, error) {
+	resp, err := c.doGet(c.buildListURL("/imports", options))
 	if err != nil {
 		return nil, err
 	}
@@ -164,8 +263,28 @@ func (c *Client) GetAllImports() ([]*ImportStatus, error) {
 		return NewImportStatusListFromReader(resp.Body)
 
 	default:
-		return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
+		return nil, listError(resp)
+	}
+}
+
+// buildListURL returns the URL listing the items at path selected by
+// options.
+func (c *Client) buildListURL(path string, options *ListOptions) string {
+	query := url.Values{}
+	options.AddToQuery(query)
+
+	return c.buildURL("%s?%s", path, query.Encode())
+}
+
+// listError returns the error of a failed request listing items, which
+// tells why the list options were rejected.
+func listError(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	if len(body) > 0 {
+		return errors.Errorf("failed with status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
 	}
+
+	return errors.Errorf("failed with status code %d", resp.StatusCode)
 }
 
 // GetTranslationReadyToImport gets and claims the next Import waiting
@@ -206,6 +325,27 @@ func (c *Client) ReleaseLockOnImport(importID string) error {
 	}
 }
 
+// RenewImportClaim extends the lease of the claim the Provisioner with
+// the given ID holds on an Import. It should be called periodically
+// while the Provisioner works on the Import.
+func (c *Client) RenewImportClaim(importID, provisionerID string) error {
+	resp, err := c.doPost(c.buildURL("/import/%s/heartbeat", importID), &ImportWorkRequest{ProvisionerID: provisionerID})
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusConflict:
+		return errors.Errorf("provisioner %s no longer holds import %s", provisionerID, importID)
+
+	default:
+		return errors.Errorf("failed with status code %d", resp.StatusCode)
+	}
+}
+
 // CompleteImport marks an Import as finished, with or without an error
 func (c *Client) CompleteImport(completed *ImportCompletedWorkRequest) error {
 	resp, err := c.doPut(c.buildURL("/import"), completed)
@@ -243,6 +383,256 @@ func (c *Client) GetImportStatus(importID string) (*ImportStatus, error) {
 	}
 }
 
+// CancelImport cancels the Import with the given ID and returns its
+// ImportStatus. An Import which is already underway is moved to the
+// import-cancel-requested state until its Installation is reverted.
+func (c *Client) CancelImport(importID string) (*ImportStatus, error) {
+	resp, err := c.doPost(c.buildURL("/import/%s/cancel", importID), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return NewImportStatusFromReader(resp.Body)
+	case http.StatusNotFound:
+		return nil, nil
+	case http.StatusConflict:
+		return nil, errors.Errorf("import %s cannot be cancelled in its current state", importID)
+
+	default:
+		return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
+	}
+}
+
+// GetImportTransitions returns the state changes of the Import with
+// the given ID, oldest first, or nil if there is no such Import.
+func (c *Client) GetImportTransitions(importID string) ([]*ImportTransition, error) {
+	resp, err := c.doGet(c.buildURL("/import/%s/transitions", importID))
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return NewImportTransitionListFromReader(resp.Body)
+	case http.StatusNotFound:
+		return nil, nil
+
+	default:
+		return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
+	}
+}
+
+// UnlockImport releases the lock and the Provisioner claim held on the
+// Import with the given ID and returns its ImportStatus.
+func (c *Client) UnlockImport(importID string) (*ImportStatus, error) {
+	resp, err := c.doPost(c.buildURL("/import/%s/unlock", importID), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return NewImportStatusFromReader(resp.Body)
+	case http.StatusNotFound:
+		return nil, nil
+	case http.StatusConflict:
+		return nil, errors.Errorf("the locks on import %s changed while releasing them", importID)
+
+	default:
+		return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
+	}
+}
+
+// CreateWebhook registers a webhook, which is sent the state changes
+// of Translations and Imports signed with the secret of the request.
+func (c *Client) CreateWebhook(request *WebhookRequest) (*Webhook, error) {
+	resp, err := c.doPost(c.buildURL("/webhooks"), request)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return NewWebhookFromReader(resp.Body)
+	default:
+		return nil, responseError(resp)
+	}
+}
+
+// GetWebhooks returns the webhooks which were not deleted.
+func (c *Client) GetWebhooks() ([]*Webhook, error) {
+	resp, err := c.doGet(c.buildURL("/webhooks"))
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return NewWebhookListFromReader(resp.Body)
+	default:
+		return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
+	}
+}
+
+// GetWebhook returns the webhook with the given ID, or nil if there is
+// none.
+func (c *Client) GetWebhook(webhookID string) (*Webhook, error) {
+	resp, err := c.doGet(c.buildURL("/webhook/%s", webhookID))
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return NewWebhookFromReader(resp.Body)
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
+	}
+}
+
+// DeleteWebhook deletes the webhook with the given ID.
+func (c *Client) DeleteWebhook(webhookID string) error {
+	resp, err := c.doDelete(c.buildURL("/webhook/%s", webhookID))
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return errors.Errorf("webhook %s not found", webhookID)
+	default:
+		return errors.Errorf("failed with status code %d", resp.StatusCode)
+	}
+}
+
+// GetWebhookDeliveries returns the log of the deliveries of events to
+// the webhook with the given ID, newest first.
+func (c *Client) GetWebhookDeliveries(webhookID string) ([]*WebhookDelivery, error) {
+	resp, err := c.doGet(c.buildURL("/webhook/%s/deliveries", webhookID))
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return NewWebhookDeliveryListFromReader(resp.Body)
+	case http.StatusNotFound:
+		return nil, errors.Errorf("webhook %s not found", webhookID)
+	default:
+		return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
+	}
+}
+
+// WatchEvents streams the events matching filter to handler, starting
+// after the event whose Sequence is filter.After, or with the events
+// created from now on if it is 0. Handling ends without an error when
+// handler returns false. A stream which breaks off is resumed after the
+// last event received; failing to connect ends watching with an error.
+func (c *Client) WatchEvents(filter *EventFilter, handler func(event *Event) bool) error {
+	after := filter.After
+	for {
+		done, err := c.streamEvents(filter, &after, handler)
+		if done || err != nil {
+			return err
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// WatchTranslation streams the state changes and progress of the
+// Translation with the given ID and the state changes of its Imports to
+// handler, from now on until handler returns false.
+func (c *Client) WatchTranslation(translationID string, handler func(event *Event) bool) error {
+	return c.WatchEvents(&EventFilter{TranslationID: translationID}, handler)
+}
+
+// streamEvents passes the events of one stream to handler, updating
+// after with the Sequence of every event. It returns true if handler
+// asked to stop.
+func (c *Client) streamEvents(filter *EventFilter, after *int64, handler func(event *Event) bool) (bool, error) {
+	query := url.Values{}
+	if filter.InstallationID != "" {
+		query.Set("installation", filter.InstallationID)
+	}
+	if filter.TranslationID != "" {
+		query.Set("translation", filter.TranslationID)
+	}
+	if filter.ImportID != "" {
+		query.Set("import", filter.ImportID)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, c.buildURL("/events?%s", query.Encode()), nil)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to create http request")
+	}
+	for k, v := range c.headers {
+		req.Header.Add(k, v)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if *after > 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatInt(*after, 10))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	// The stream does not end on its own, so it must not be drained.
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, responseError(resp)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data.Len() == 0 {
+				continue
+			}
+			event, err := NewEventFromReader(strings.NewReader(data.String()))
+			data.Reset()
+			if err != nil {
+				return false, err
+			}
+			*after = event.Sequence
+			if !handler(event) {
+				return true, nil
+			}
+		case strings.HasPrefix(line, "id:"):
+			// The stream starts with the ID of the event it resumes
+			// after, which is where to resume it if it breaks off
+			// before any event is received.
+			sequence, err := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, "id:")), 10, 64)
+			if err == nil {
+				*after = sequence
+			}
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+
+	return false, nil
+}
+
 // closeBody ensures the Body of an http.Response is properly closed.
 func closeBody(r *http.Response) {
 	if r.Body != nil {
@@ -333,9 +723,34 @@ func (c *Client) GetUpload(uploadID string) (*Upload, error) {
 	}
 }
 
+// GetUploadValidation returns the report of the validation of the
+// Upload with the given ID, or nil if the upload was not validated.
+func (c *Client) GetUploadValidation(uploadID string) (*ValidationReport, error) {
+	resp, err := c.doGet(c.buildURL("/upload/%s/validation", uploadID))
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, nil
+	case http.StatusOK:
+		return NewValidationReportFromReader(resp.Body)
+	default:
+		return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
+	}
+}
+
 // GetUploads returns all uploads from the AWAT.
 func (c *Client) GetUploads() ([]*Upload, error) {
-	resp, err := c.doGet(c.buildURL("/uploads"))
+	return c.ListUploads(&ListOptions{PerPage: AllPerPage})
+}
+
+// ListUploads returns the page of uploads selected by options from the
+// AWAT.
+func (c *Client) ListUploads(options *ListOptions) ([]*Upload, error) {
+	resp, err := c.doGet(c.buildListURL("/uploads", options))
 	if err != nil {
 		return nil, err
 	}
@@ -345,7 +760,7 @@ func (c *Client) GetUploads() ([]*Upload, error) {
 	case http.StatusOK:
 		return NewUploadListFromReader(resp.Body)
 	default:
-		return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
+		return nil, listError(resp)
 	}
 }
 
@@ -361,6 +776,9 @@ func (c *Client) UploadArchiveForTranslation(filename string, archiveType Backup
 		return "", errors.Wrap(err, "failed to create HTTP request")
 	}
 
+	for k, v := range c.headers {
+		req.Header.Add(k, v)
+	}
 	req.Header.Set("Content-Type", "application/octet-stream")
 	stat, err := inputFile.Stat()
 	if err != nil {
@@ -373,7 +791,7 @@ func (c *Client) UploadArchiveForTranslation(filename string, archiveType Backup
 	}
 
 	req.ContentLength = size
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return "", errors.Wrap(err, "failed to send HTTP request to AWAT")
 	}
@@ -384,6 +802,13 @@ func (c *Client) UploadArchiveForTranslation(filename string, archiveType Backup
 		return "", errors.New("failed to read response body")
 	}
 
+	if resp.StatusCode == http.StatusBadRequest && strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		upload, err := NewUploadFromReader(bytes.NewReader(bodyBytes))
+		if err == nil && upload.Validation != nil {
+			return "", &ValidationError{UploadID: upload.ID, Report: upload.Validation}
+		}
+	}
+
 	if resp.StatusCode != http.StatusAccepted {
 		return "", errors.Errorf("received unexpected code %d from AWAT: %s", resp.StatusCode, string(bodyBytes))
 	}
@@ -396,7 +821,7 @@ func (c *Client) UploadArchiveForTranslation(filename string, archiveType Backup
 }
 
 func (c *Client) checkIfUploadComplete(uploadID string) (bool, error) {
-	resp, err := http.Get(c.buildURL("/upload/%s", uploadID))
+	resp, err := c.doGet(c.buildURL("/upload/%s", uploadID))
 	if err != nil {
 		return false, err
 	}
@@ -443,3 +868,482 @@ func (c *Client) WaitForUploadToComplete(uploadID string) error {
 
 	return errors.Errorf("timed out waiting for upload %s to complete", uploadID)
 }
+
+// UploadOptions configures UploadArchive.
+type UploadOptions struct {
+	// UploadID is the ID of an upload session to resume, e.g. after
+	// the process uploading the archive was stopped.
+	UploadID string
+
+	// ChunkSize is the size of the chunks the archive is uploaded in.
+	// The AWAT picks it if it is not set.
+	ChunkSize int64
+
+	// Retries is how often a request which failed with a network or
+	// server error is retried before giving up, waiting RetryDelay
+	// before the first retry and twice as long before each one after.
+	Retries    int
+	RetryDelay time.Duration
+}
+
+// DefaultUploadOptions are the UploadOptions of uploads which retry
+// for about an hour before giving up.
+var DefaultUploadOptions = UploadOptions{
+	Retries:    20,
+	RetryDelay: time.Second,
+}
+
+// maxRetryDelay caps the time waited between retries.
+const maxRetryDelay = 5 * time.Minute
+
+// retryableError is the error of a request which may succeed when it
+// is retried.
+type retryableError struct {
+	error
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.error
+}
+
+// responseError returns the error for an unexpected response, which
+// is retryable for server errors.
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	err := errors.Errorf("failed with status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return &retryableError{err}
+	}
+
+	return err
+}
+
+// CreateUploadSession starts an upload of an archive in chunks.
+func (c *Client) CreateUploadSession(request *UploadSessionRequest) (*UploadSession, error) {
+	resp, err := c.doPost(c.buildURL("/upload/session"), request)
+	if err != nil {
+		return nil, &retryableError{err}
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return NewUploadSessionFromReader(resp.Body)
+	default:
+		return nil, responseError(resp)
+	}
+}
+
+// GetUploadSession returns the upload session with the given ID,
+// including the chunks received so far, or nil if there is none.
+func (c *Client) GetUploadSession(uploadID string) (*UploadSession, error) {
+	resp, err := c.doGet(c.buildURL("/upload/session/%s", uploadID))
+	if err != nil {
+		return nil, &retryableError{err}
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, nil
+	case http.StatusOK:
+		return NewUploadSessionFromReader(resp.Body)
+	default:
+		return nil, responseError(resp)
+	}
+}
+
+// UploadChunk uploads the chunk with the given number, starting at 1,
+// of an upload session, reading its size bytes from chunk, along with
+// its checksum.
+func (c *Client) UploadChunk(uploadID string, number int, chunk io.Reader, size int64, checksum string) (*UploadPart, error) {
+	req, err := http.NewRequest(http.MethodPut, c.buildURL("/upload/session/%s/chunk/%d", uploadID, number), chunk)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create http request")
+	}
+	req.ContentLength = size
+	for k, v := range c.headers {
+		req.Header.Add(k, v)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set(ChunkChecksumHeader, checksum)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, &retryableError{err}
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return NewUploadPartFromReader(resp.Body)
+	case http.StatusUnprocessableEntity:
+		// the chunk was corrupted on its way
+		return nil, &retryableError{responseError(resp)}
+	default:
+		return nil, responseError(resp)
+	}
+}
+
+// CompleteUploadSession assembles the archive of an upload session
+// from its chunks, after which the AWAT validates it in the background.
+// It returns the Upload, which is complete once the archive was
+// validated. If the archive failed validation, a *ValidationError is
+// returned.
+func (c *Client) CompleteUploadSession(uploadID string) (*Upload, error) {
+	resp, err := c.doPost(c.buildURL("/upload/session/%s/complete", uploadID), nil)
+	if err != nil {
+		return nil, &retryableError{err}
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted:
+		return NewUploadFromReader(resp.Body)
+	case http.StatusBadRequest:
+		if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+			upload, err := NewUploadFromReader(resp.Body)
+			if err == nil && upload.Validation != nil {
+				return nil, &ValidationError{UploadID: upload.ID, Report: upload.Validation}
+			}
+		}
+		return nil, responseError(resp)
+	default:
+		return nil, responseError(resp)
+	}
+}
+
+// AbortUploadSession discards the chunks of an upload session.
+func (c *Client) AbortUploadSession(uploadID string) error {
+	resp, err := c.doDelete(c.buildURL("/upload/session/%s", uploadID))
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return errors.Errorf("upload session %s does not exist", uploadID)
+	case http.StatusConflict:
+		return errors.Errorf("upload session %s is already complete", uploadID)
+	default:
+		return responseError(resp)
+	}
+}
+
+// UploadArchive uploads the file to S3 via the AWAT in chunks, waits
+// for the AWAT to validate it and returns the completed Upload.
+// Requests which fail with a network or server error are retried, and
+// chunks the AWAT received already are skipped, so that an interrupted
+// upload of a large archive does not start over. If the archive fails
+// validation, a *ValidationError is returned.
+func (c *Client) UploadArchive(filename string, archiveType BackupType, options UploadOptions) (*Upload, error) {
+	logger := log.New()
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read input file %s", filename)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to determine file stats for %s", filename)
+	}
+	size := stat.Size()
+	if size == 0 {
+		return nil, errors.New("provided file appears to be empty")
+	}
+
+	var session *UploadSession
+	if options.UploadID != "" {
+		err = c.retry(options, logger, "fetch upload session", func() error {
+			session, err = c.GetUploadSession(options.UploadID)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if session == nil {
+			return nil, errors.Errorf("upload session %s does not exist", options.UploadID)
+		}
+		if session.Size != size {
+			return nil, errors.Errorf("upload session %s is for an archive of %d bytes, but %s has %d bytes", session.ID, session.Size, filename, size)
+		}
+		logger.Infof("Resuming upload %s at byte %d of %d", session.ID, session.Offset(), session.Size)
+	} else {
+		request := &UploadSessionRequest{Type: archiveType, Size: size, ChunkSize: options.ChunkSize}
+		err = c.retry(options, logger, "start upload", func() error {
+			session, err = c.CreateUploadSession(request)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		logger.Infof("Uploading %s in %d chunks as upload %s", filename, session.Chunks(), session.ID)
+	}
+
+	for number := 1; number <= session.Chunks(); number++ {
+		offset, length := session.ChunkOffset(number), session.ChunkLength(number)
+		var checksum string
+		checksum, err = sectionChecksum(file, offset, length)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read chunk %d of %s", number, filename)
+		}
+		if part := session.Part(number); part != nil && part.Checksum == checksum {
+			continue
+		}
+
+		attempt := 0
+		err = c.retry(options, logger, fmt.Sprintf("upload chunk %d", number), func() error {
+			attempt++
+			if attempt > 1 {
+				// The chunk may have been received even though the
+				// response was lost.
+				current, err := c.GetUploadSession(session.ID)
+				if err != nil {
+					return err
+				}
+				if current == nil {
+					return errors.Errorf("upload session %s does not exist", session.ID)
+				}
+				if part := current.Part(number); part != nil && part.Checksum == checksum {
+					return nil
+				}
+			}
+			_, err = c.UploadChunk(session.ID, number, io.NewSectionReader(file, offset, length), length, checksum)
+			return err
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to upload chunk %d of %s; resume upload %s once the AWAT is reachable", number, filename, session.ID)
+		}
+		logger.Infof("Uploaded chunk %d of %d", number, session.Chunks())
+	}
+
+	err = c.retry(options, logger, "complete upload", func() error {
+		_, err = c.CompleteUploadSession(session.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.waitForVerifiedUpload(session.ID)
+}
+
+// sectionChecksum returns the checksum of length bytes of the file
+// starting at offset.
+func sectionChecksum(file io.ReaderAt, offset, length int64) (string, error) {
+	hash := sha256.New()
+	_, err := io.Copy(hash, io.NewSectionReader(file, offset, length))
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// waitForVerifiedUpload waits for the AWAT to verify the archive of a
+// completed upload session and returns the Upload, or a
+// *ValidationError if the archive failed validation.
+func (c *Client) waitForVerifiedUpload(uploadID string) (*Upload, error) {
+	err := c.WaitForUploadToComplete(uploadID)
+	upload, getErr := c.GetUpload(uploadID)
+	if getErr != nil {
+		return nil, getErr
+	}
+	if upload != nil && upload.Validation != nil && !upload.Validation.Valid() {
+		return nil, &ValidationError{UploadID: upload.ID, Report: upload.Validation}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+// retry calls request until it succeeds, fails with an error which is
+// not retryable or runs out of retries.
+func (c *Client) retry(options UploadOptions, logger log.FieldLogger, action string, request func() error) error {
+	delay := options.RetryDelay
+	for retries := 0; ; retries++ {
+		err := request()
+		var retryable *retryableError
+		if err == nil || !errors.As(err, &retryable) || retries >= options.Retries {
+			return err
+		}
+
+		logger.WithError(err).Warnf("Failed to %s; retrying in %s", action, delay)
+		time.Sleep(delay)
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// PresignUpload requests presigned requests uploading an archive
+// straight to the bucket.
+func (c *Client) PresignUpload(request *PresignRequest) (*PresignedUpload, error) {
+	resp, err := c.doPost(c.buildURL("/upload/presign"), request)
+	if err != nil {
+		return nil, &retryableError{err}
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return NewPresignedUploadFromReader(resp.Body)
+	default:
+		return nil, responseError(resp)
+	}
+}
+
+// CompletePresignedUpload notifies the AWAT that the archive of a
+// presigned upload was uploaded, after which the AWAT verifies it in
+// the background. It returns the Upload, which is complete once the
+// archive was verified.
+func (c *Client) CompletePresignedUpload(uploadID string, request *PresignCompleteRequest) (*Upload, error) {
+	resp, err := c.doPost(c.buildURL("/upload/presign/%s/complete", uploadID), request)
+	if err != nil {
+		return nil, &retryableError{err}
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted:
+		return NewUploadFromReader(resp.Body)
+	case http.StatusBadRequest:
+		if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+			upload, err := NewUploadFromReader(resp.Body)
+			if err == nil && upload.Validation != nil {
+				return nil, &ValidationError{UploadID: upload.ID, Report: upload.Validation}
+			}
+		}
+		return nil, responseError(resp)
+	default:
+		return nil, responseError(resp)
+	}
+}
+
+// UploadArchiveDirect uploads the file straight to the bucket with
+// requests presigned by the AWAT, in parts if it is larger than the
+// chunk size of the options, and waits for the AWAT to verify it. If
+// validateArchive is set, the AWAT validates the archive as well, and a
+// *ValidationError is returned if it is invalid. Requests which fail
+// with a network or server error are retried.
+func (c *Client) UploadArchiveDirect(filename string, archiveType BackupType, validateArchive bool, options UploadOptions) (*Upload, error) {
+	logger := log.New()
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read input file %s", filename)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to determine file stats for %s", filename)
+	}
+	request := &PresignRequest{
+		Type:            archiveType,
+		Size:            stat.Size(),
+		ChunkSize:       options.ChunkSize,
+		ValidateArchive: validateArchive,
+	}
+	if request.Size == 0 {
+		return nil, errors.New("provided file appears to be empty")
+	}
+	if request.ChunkSize == 0 {
+		request.ChunkSize = defaultChunkSize(request.Size)
+	}
+
+	// Compute the checksum of the archive and of each of its parts in
+	// a single pass.
+	archiveHash := sha256.New()
+	for offset := int64(0); offset < request.Size; offset += request.ChunkSize {
+		partHash := sha256.New()
+		_, err = io.Copy(io.MultiWriter(archiveHash, partHash), io.NewSectionReader(file, offset, request.ChunkSize))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", filename)
+		}
+		request.PartChecksums = append(request.PartChecksums, hex.EncodeToString(partHash.Sum(nil)))
+	}
+	request.Checksum = hex.EncodeToString(archiveHash.Sum(nil))
+	if len(request.PartChecksums) == 1 {
+		request.ChunkSize = 0
+		request.PartChecksums = nil
+	}
+
+	var presigned *PresignedUpload
+	err = c.retry(options, logger, "presign upload", func() error {
+		presigned, err = c.PresignUpload(request)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	complete := &PresignCompleteRequest{}
+	if presigned.Request != nil {
+		logger.Infof("Uploading %s as upload %s", filename, presigned.UploadID)
+		err = c.retry(options, logger, "upload archive", func() error {
+			_, err = c.sendPresigned(presigned.Request, io.NewSectionReader(file, 0, request.Size), request.Size)
+			return err
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to upload %s", filename)
+		}
+	} else {
+		logger.Infof("Uploading %s in %d parts as upload %s", filename, len(presigned.Parts), presigned.UploadID)
+		for _, part := range presigned.Parts {
+			var etag string
+			err = c.retry(options, logger, fmt.Sprintf("upload part %d", part.Number), func() error {
+				etag, err = c.sendPresigned(&part.PresignedRequest, io.NewSectionReader(file, part.Offset, part.Size), part.Size)
+				return err
+			})
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to upload part %d of %s", part.Number, filename)
+			}
+			complete.Parts = append(complete.Parts, UploadedPart{
+				Number:   part.Number,
+				ETag:     etag,
+				Checksum: request.PartChecksums[part.Number-1],
+			})
+			logger.Infof("Uploaded part %d of %d", part.Number, len(presigned.Parts))
+		}
+	}
+
+	err = c.retry(options, logger, "complete upload", func() error {
+		_, err = c.CompletePresignedUpload(presigned.UploadID, complete)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.waitForVerifiedUpload(presigned.UploadID)
+}
+
+// sendPresigned sends a presigned request uploading the body straight
+// to the bucket and returns the ETag of the stored object or part.
+func (c *Client) sendPresigned(request *PresignedRequest, body io.Reader, size int64) (string, error) {
+	req, err := request.NewHTTPRequest(body, size)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", &retryableError{err}
+	}
+	defer closeBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return "", responseError(resp)
+	}
+
+	return resp.Header.Get("ETag"), nil
+}
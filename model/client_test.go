@@ -5,9 +5,18 @@
 package model_test
 
 import (
+	"bytes"
 	"errors"
+	"io"
+	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/gorilla/mux"
@@ -76,7 +85,7 @@ func TestTranslationClient(t *testing.T) {
 	t.Run("fetch all translations", func(t *testing.T) {
 		translationID := model.NewID()
 		store.EXPECT().
-			GetAllTranslations().
+			GetTranslations(&model.ListOptions{PerPage: model.AllPerPage}).
 			Return([]*model.Translation{
 				{ID: translationID},
 			}, nil).
@@ -88,6 +97,26 @@ func TestTranslationClient(t *testing.T) {
 		assert.Equal(t, translationID, translations[0].ID)
 	})
 
+	t.Run("list a page of translations", func(t *testing.T) {
+		options := &model.ListOptions{
+			Page:      1,
+			PerPage:   5,
+			State:     model.TranslationStateComplete,
+			SortOrder: model.SortDescending,
+		}
+		store.EXPECT().
+			GetTranslations(options).
+			Return([]*model.Translation{}, nil).
+			Times(1)
+
+		translations, err := client.ListTranslations(options)
+		require.NoError(t, err)
+		assert.Empty(t, translations)
+
+		_, err = client.ListTranslations(&model.ListOptions{State: "bogus"})
+		assert.ErrorContains(t, err, "invalid state")
+	})
+
 	t.Run("start a new translation", func(t *testing.T) {
 		gomock.InOrder(
 			store.EXPECT().GetUpload("foo").Return(nil, nil).Times(1),
@@ -106,6 +135,10 @@ func TestTranslationClient(t *testing.T) {
 				).
 				Return(nil).
 				Times(1),
+			store.EXPECT().
+				CreateWebhookEvent(gomock.Any()).
+				Return(nil).
+				Times(1),
 		)
 
 		translation, err := client.CreateTranslation(&model.TranslationRequest{
@@ -123,6 +156,124 @@ func TestTranslationClient(t *testing.T) {
 		assert.Equal(t, "installationID", translation.InstallationID)
 	})
 
+	t.Run("cancel a translation", func(t *testing.T) {
+		translationID := model.NewID()
+		translation := &model.Translation{ID: translationID}
+
+		gomock.InOrder(
+			store.EXPECT().
+				GetTranslation(translationID).
+				Return(translation, nil).
+				Times(1),
+
+			store.EXPECT().
+				CancelTranslation(translation).
+				DoAndReturn(func(t *model.Translation) (bool, error) {
+					t.CancelAt = 1000
+					return true, nil
+				}).
+				Times(1),
+			store.EXPECT().
+				CreateWebhookEvent(gomock.Any()).
+				Return(nil).
+				Times(1),
+		)
+
+		status, err := client.CancelTranslation(translationID)
+		require.NoError(t, err)
+		assert.Equal(t, model.TranslationStateCancelled, status.State)
+	})
+
+	t.Run("retry a failed translation", func(t *testing.T) {
+		translationID := model.NewID()
+		translation := &model.Translation{ID: translationID, StartAt: 500, FailAt: 1000, Error: "boom"}
+
+		gomock.InOrder(
+			store.EXPECT().
+				GetTranslation(translationID).
+				Return(translation, nil).
+				Times(1),
+
+			store.EXPECT().
+				RetryTranslation(translation).
+				DoAndReturn(func(t *model.Translation) (bool, error) {
+					t.StartAt, t.FailAt, t.Error = 0, 0, ""
+					return true, nil
+				}).
+				Times(1),
+			store.EXPECT().
+				CreateWebhookEvent(gomock.Any()).
+				Return(nil).
+				Times(1),
+		)
+
+		status, err := client.RetryTranslation(translationID)
+		require.NoError(t, err)
+		assert.Equal(t, model.TranslationStateRequested, status.State)
+	})
+
+	t.Run("unlock a translation", func(t *testing.T) {
+		translationID := model.NewID()
+		translation := &model.Translation{ID: translationID, StartAt: 500, LockedBy: "pod-a/worker-1", LockExpiresAt: 1000}
+
+		gomock.InOrder(
+			store.EXPECT().
+				GetTranslation(translationID).
+				Return(translation, nil).
+				Times(1),
+
+			store.EXPECT().
+				ReleaseTranslationLock(translation, model.LockReleaseReasonManual).
+				Return(true, nil).
+				Times(1),
+		)
+
+		status, err := client.UnlockTranslation(translationID)
+		require.NoError(t, err)
+		assert.Equal(t, translationID, status.ID)
+	})
+
+	t.Run("upload an invalid archive", func(t *testing.T) {
+		archive := filepath.Join(t.TempDir(), "export.zip")
+		require.NoError(t, os.WriteFile(archive, []byte("not a zip file"), 0600))
+
+		var report *model.ValidationReport
+		gomock.InOrder(
+			store.EXPECT().
+				CreateUpload(gomock.Any(), model.SlackWorkspaceBackupType).
+				Return(nil).
+				Times(1),
+
+			store.EXPECT().
+				UpdateUploadValidation(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(uploadID string, r *model.ValidationReport) error {
+					report = r
+					return nil
+				}).
+				Times(1),
+
+			store.EXPECT().
+				CompleteUpload(gomock.Any(), gomock.Any()).
+				Return(nil).
+				Times(1),
+		)
+
+		_, err := client.UploadArchiveForTranslation(archive, model.SlackWorkspaceBackupType)
+		var validationErr *model.ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		assert.NotEmpty(t, validationErr.UploadID)
+		assert.False(t, validationErr.Report.Valid())
+
+		store.EXPECT().
+			GetUpload(validationErr.UploadID).
+			Return(&model.Upload{ID: validationErr.UploadID, Validation: report}, nil).
+			Times(1)
+
+		fetched, err := client.GetUploadValidation(validationErr.UploadID)
+		require.NoError(t, err)
+		assert.Equal(t, validationErr.Report, fetched)
+	})
+
 	t.Run("get a translation by Installation ID", func(t *testing.T) {
 		installationID := "installationID"
 		translationID := "translationID"
@@ -208,7 +359,7 @@ func TestImportClient(t *testing.T) {
 		translationID := "translationID"
 
 		store.EXPECT().
-			GetAllImports().
+			GetImports(&model.ListOptions{PerPage: model.AllPerPage}).
 			Return([]*model.Import{
 				{ID: importID, TranslationID: translationID},
 			}, nil).
@@ -305,6 +456,87 @@ func TestImportClient(t *testing.T) {
 		require.NoError(t, err)
 	})
 
+	t.Run("cancel an import", func(t *testing.T) {
+		importID := model.NewID()
+		translationID := "translationID"
+		imprt := &model.Import{ID: importID, TranslationID: translationID, State: model.ImportStateInProgress}
+
+		gomock.InOrder(
+			store.EXPECT().
+				GetImport(importID).
+				Return(imprt, nil).
+				Times(1),
+
+			store.EXPECT().
+				CancelImport(imprt, model.ImportStateCancelRequested, "cancelled").
+				DoAndReturn(func(imp *model.Import, state, reason string) (bool, error) {
+					imp.State = state
+					return true, nil
+				}).
+				Times(1),
+
+			store.EXPECT().
+				GetTranslation(translationID).
+				Return(&model.Translation{ID: translationID}, nil).
+				Times(1),
+
+			store.EXPECT().
+				CreateWebhookEvent(gomock.Any()).
+				Return(nil).
+				Times(1),
+		)
+
+		status, err := client.CancelImport(importID)
+		require.NoError(t, err)
+		assert.Equal(t, model.ImportStateCancelRequested, status.State)
+	})
+
+	t.Run("unlock an import", func(t *testing.T) {
+		importID := model.NewID()
+		translationID := "translationID"
+		imprt := &model.Import{ID: importID, TranslationID: translationID, ImportBy: "provisioner", ImportByExpiresAt: 1000}
+
+		gomock.InOrder(
+			store.EXPECT().
+				GetImport(importID).
+				Return(imprt, nil).
+				Times(1),
+
+			store.EXPECT().
+				ReleaseImportClaim(imprt, model.LockReleaseReasonManual).
+				Return(true, nil).
+				Times(1),
+
+			store.EXPECT().
+				GetTranslation(translationID).
+				Return(&model.Translation{ID: translationID}, nil).
+				Times(1),
+		)
+
+		status, err := client.UnlockImport(importID)
+		require.NoError(t, err)
+		assert.Equal(t, importID, status.ID)
+	})
+
+	t.Run("renew the claim on an import", func(t *testing.T) {
+		importID := model.NewID()
+
+		gomock.InOrder(
+			store.EXPECT().
+				RenewImportClaim(importID, "provisioner").
+				Return(true, nil).
+				Times(1),
+
+			store.EXPECT().
+				RenewImportClaim(importID, "provisioner").
+				Return(false, nil).
+				Times(1),
+		)
+
+		assert.NoError(t, client.RenewImportClaim(importID, "provisioner"))
+		assert.Error(t, client.RenewImportClaim(importID, "provisioner"))
+	})
+
 	t.Run("get an import by Installation ID", func(t *testing.T) {
 		importID := "importID"
 		installationID := "installationID"
@@ -326,3 +558,224 @@ func TestImportClient(t *testing.T) {
 		assert.Equal(t, importID, imports[0].ID)
 	})
 }
+
+func TestUploadClient(t *testing.T) {
+	logger := testlib.MakeLogger(t)
+
+	// newServer starts an AWAT keeping the upload session it creates
+	// in memory and counting the chunks received. The connection of
+	// the first request uploading chunk 2 is dropped, after the chunk
+	// was received if dropAfterReceiving is set.
+	newServer := func(t *testing.T, session **model.UploadSession, chunks *int, dropAfterReceiving bool) *model.Client {
+		store := mock_api.NewMockStore(gomock.NewController(t))
+		router := mux.NewRouter()
+		api.Register(
+			router,
+			&api.Context{
+				Store:   store,
+				Logger:  logger,
+				AWS:     &mock_context.MockAWS{ResourceExists: true},
+				Workdir: t.TempDir(),
+			})
+		var dropped atomic.Bool
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/chunk/2") && dropped.CompareAndSwap(false, true) {
+				if dropAfterReceiving {
+					router.ServeHTTP(httptest.NewRecorder(), r)
+				}
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err == nil {
+					conn.Close()
+				}
+				return
+			}
+			router.ServeHTTP(w, r)
+		}))
+		t.Cleanup(ts.Close)
+
+		store.EXPECT().
+			CreateUploadSession(gomock.Any()).
+			DoAndReturn(func(s *model.UploadSession) error {
+				*session = s
+				return nil
+			}).
+			Times(1)
+		store.EXPECT().
+			GetUploadSession(gomock.Any()).
+			DoAndReturn(func(id string) (*model.UploadSession, error) {
+				copied := **session
+				copied.Parts = append([]*model.UploadPart{}, (*session).Parts...)
+				return &copied, nil
+			}).
+			AnyTimes()
+		store.EXPECT().
+			AddUploadPart(gomock.Any()).
+			DoAndReturn(func(part *model.UploadPart) error {
+				*chunks++
+				(*session).Parts = append((*session).Parts, part)
+				return nil
+			}).
+			AnyTimes()
+		store.EXPECT().
+			UpdateUploadSessionHash(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(s *model.UploadSession, state []byte, hashedSize int64) (bool, error) {
+				(*session).HashState, (*session).HashedSize = state, hashedSize
+				return true, nil
+			}).
+			AnyTimes()
+		store.EXPECT().
+			CompleteUploadSession(gomock.Any(), true).
+			DoAndReturn(func(id string, verify bool) (bool, error) {
+				(*session).CompleteAt = model.GetMillis()
+				return true, nil
+			}).
+			Times(1)
+		store.EXPECT().
+			GetUpload(gomock.Any()).
+			DoAndReturn(func(id string) (*model.Upload, error) {
+				return &model.Upload{ID: id, CompleteAt: model.GetMillis()}, nil
+			}).
+			AnyTimes()
+
+		return model.NewClient(ts.URL)
+	}
+
+	archive := filepath.Join(t.TempDir(), "export.zip")
+	contents := bytes.Repeat([]byte("archive"), int(model.MinUploadChunkSize)/7+1)
+	require.NoError(t, os.WriteFile(archive, contents, 0600))
+
+	options := model.UploadOptions{
+		ChunkSize:  model.MinUploadChunkSize,
+		Retries:    3,
+		RetryDelay: time.Millisecond,
+	}
+
+	t.Run("retry after the connection is dropped", func(t *testing.T) {
+		var session *model.UploadSession
+		chunks := 0
+		client := newServer(t, &session, &chunks, true)
+
+		upload, err := client.UploadArchive(archive, model.DiscordWorkspaceBackupType, options)
+		require.NoError(t, err)
+		assert.Equal(t, session.ID, upload.ID)
+		assert.Equal(t, 2, chunks, "the chunk received before the connection was dropped is not sent again")
+		assert.Equal(t, int64(len(contents)), session.HashedSize, "the chunks are hashed as they arrive")
+	})
+
+	t.Run("resume an interrupted upload", func(t *testing.T) {
+		var session *model.UploadSession
+		chunks := 0
+		client := newServer(t, &session, &chunks, false)
+
+		noRetries := options
+		noRetries.Retries = 0
+		_, err := client.UploadArchive(archive, model.DiscordWorkspaceBackupType, noRetries)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "resume upload "+session.ID)
+		assert.Equal(t, 1, chunks)
+
+		resumed, err := client.GetUploadSession(session.ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.MinUploadChunkSize, resumed.Offset())
+
+		noRetries.UploadID = session.ID
+		upload, err := client.UploadArchive(archive, model.DiscordWorkspaceBackupType, noRetries)
+		require.NoError(t, err)
+		assert.Equal(t, session.ID, upload.ID)
+		assert.Equal(t, 2, chunks, "only the missing chunk is sent")
+	})
+}
+
+func TestDirectUploadClient(t *testing.T) {
+	logger := testlib.MakeLogger(t)
+
+	archive := filepath.Join(t.TempDir(), "export.zip")
+	contents := bytes.Repeat([]byte("archive"), int(model.MinUploadChunkSize)/7+1)
+	require.NoError(t, os.WriteFile(archive, contents, 0600))
+	checksum := model.ChunkChecksum(contents)
+
+	// The bucket verifies the checksum of each part and fails the
+	// first request uploading part 2.
+	var mu sync.Mutex
+	parts := map[string][]byte{}
+	var failed atomic.Bool
+	bucket := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if r.Header.Get("X-Amz-Checksum-Sha256") != model.ChunkChecksum(body) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/2") && failed.CompareAndSwap(false, true) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		mu.Lock()
+		parts[r.URL.Path] = body
+		mu.Unlock()
+		w.Header().Set("ETag", "etag"+r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer bucket.Close()
+
+	store := mock_api.NewMockStore(gomock.NewController(t))
+	router := mux.NewRouter()
+	api.Register(
+		router,
+		&api.Context{
+			Store:   store,
+			Logger:  logger,
+			AWS:     &mock_context.MockAWS{PresignURL: bucket.URL},
+			Workdir: t.TempDir(),
+		})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	var session *model.UploadSession
+	var completeAt atomic.Int64
+	store.EXPECT().
+		CreateUploadSession(gomock.Any()).
+		DoAndReturn(func(s *model.UploadSession) error {
+			session = s
+			return nil
+		}).
+		Times(1)
+	store.EXPECT().
+		GetUploadSession(gomock.Any()).
+		DoAndReturn(func(id string) (*model.UploadSession, error) {
+			return session, nil
+		}).
+		Times(1)
+	store.EXPECT().
+		CompleteUploadSession(gomock.Any(), true).
+		DoAndReturn(func(id string, verify bool) (bool, error) {
+			// the UploadSupervisor verifies the archive right away
+			completeAt.Store(model.GetMillis())
+			return true, nil
+		}).
+		Times(1)
+	store.EXPECT().
+		GetUpload(gomock.Any()).
+		DoAndReturn(func(id string) (*model.Upload, error) {
+			return &model.Upload{ID: id, CompleteAt: completeAt.Load()}, nil
+		}).
+		AnyTimes()
+
+	client := model.NewClient(ts.URL)
+	upload, err := client.UploadArchiveDirect(archive, model.DiscordWorkspaceBackupType, false, model.UploadOptions{
+		ChunkSize:  model.MinUploadChunkSize,
+		Retries:    3,
+		RetryDelay: time.Millisecond,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, session.ID, upload.ID)
+	assert.NotZero(t, upload.CompleteAt)
+	assert.True(t, session.Presigned)
+	assert.Equal(t, checksum, session.Checksum)
+
+	require.Len(t, parts, 2)
+	assert.Equal(t, contents, append(parts["/"+session.ArchiveName()+"/1"], parts["/"+session.ArchiveName()+"/2"]...))
+}
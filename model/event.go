@@ -0,0 +1,82 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package model
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Kinds of the events streamed by the AWAT. State events record the
+// state changes also sent to webhooks; progress events record the
+// progress of a running Translation.
+const (
+	EventKindState    = "state"
+	EventKindProgress = "progress"
+)
+
+// Event is an entry of the stream of events of the AWAT. Sequence
+// orders the events and is used to resume a stream where it stopped.
+// State events carry OldState and NewState of the Translation or Import
+// of the given Type and ResourceID; progress events carry the Phase of
+// the Translation, a Message and how far along the phase it is, as Done
+// out of Total of the units the phase counts, where Total is 0 if it is
+// not known.
+type Event struct {
+	Sequence       int64
+	ID             string
+	Kind           string
+	Type           string
+	ResourceID     string
+	TranslationID  string
+	InstallationID string
+	OldState       string `json:",omitempty"`
+	NewState       string `json:",omitempty"`
+	Phase          string `json:",omitempty"`
+	Message        string `json:",omitempty"`
+	Done           int64  `json:",omitempty"`
+	Total          int64  `json:",omitempty"`
+	Timestamp      int64
+}
+
+// NewProgressEvent returns the event for the Translation having made
+// progress in the given phase.
+func NewProgressEvent(translation *Translation, phase, message string, done, total int64) *Event {
+	return &Event{
+		ID:             NewID(),
+		Kind:           EventKindProgress,
+		Type:           WebhookEventTranslation,
+		ResourceID:     translation.ID,
+		TranslationID:  translation.ID,
+		InstallationID: translation.InstallationID,
+		Phase:          phase,
+		Message:        message,
+		Done:           done,
+		Total:          total,
+		Timestamp:      GetMillis(),
+	}
+}
+
+// NewEventFromReader creates an Event from a Reader.
+func NewEventFromReader(reader io.Reader) (*Event, error) {
+	var event Event
+	err := json.NewDecoder(reader).Decode(&event)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "failed to decode event")
+	}
+	return &event, nil
+}
+
+// EventFilter selects the events of a stream. Every ID which is set
+// must match: the events of a Translation include those of its Imports.
+// Only events with a Sequence above After are selected.
+type EventFilter struct {
+	InstallationID string
+	TranslationID  string
+	ImportID       string
+	After          int64
+}
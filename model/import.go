@@ -21,6 +21,8 @@ const (
 	ImportStateInstallationPostAdjustment = "installation-post-adjustment"
 	ImportStateSucceeded                  = "import-succeeded"
 	ImportStateFailed                     = "import-failed"
+	ImportStateCancelRequested            = "import-cancel-requested"
+	ImportStateCancelled                  = "import-cancelled"
 
 	SizeCloud10Users       = "cloud10users"
 	Size1000String         = "1000users"
@@ -30,6 +32,19 @@ const (
 	ExtractContentKey      = "MM_FILESETTINGS_EXTRACTCONTENT"
 )
 
+// AllImportStates contains every state of an import.
+var AllImportStates = []string{
+	ImportStateRequested,
+	ImportStateInstallationPreAdjustment,
+	ImportStateInProgress,
+	ImportStateComplete,
+	ImportStateInstallationPostAdjustment,
+	ImportStateSucceeded,
+	ImportStateFailed,
+	ImportStateCancelRequested,
+	ImportStateCancelled,
+}
+
 // AllImportStatesPendingWork contains all import states that indicate pending work.
 var AllImportStatesPendingWork = []string{
 	ImportStateRequested,
@@ -37,21 +52,58 @@ var AllImportStatesPendingWork = []string{
 	ImportStateInProgress,
 	ImportStateComplete,
 	ImportStateInstallationPostAdjustment,
+	ImportStateCancelRequested,
 }
 
 // Import represents a completed Translation that is being imported
-// into an Installation in order to track that process
+// into an Installation in order to track that process. StateChangeAt
+// is when it moved to its current State, from which its deadline to
+// leave it is counted. ImportProfile is the profile the Installation is
+// adjusted with, and InstallationSnapshot its configuration before it
+// was, both recorded when the Import starts adjusting it.
 type Import struct {
-	ID            string
-	TranslationID string
-	Resource      string
-	CreateAt      int64
-	StartAt       int64
-	CompleteAt    int64
-	State         string
-	LockedBy      string
-	ImportBy      string
-	Error         string
+	ID                string
+	TranslationID     string
+	Resource          string
+	CreateAt          int64
+	StartAt           int64
+	CompleteAt        int64
+	State             string
+	StateChangeAt     int64
+	LockedBy          string
+	LockExpiresAt     int64
+	ImportBy          string
+	ImportByExpiresAt int64
+	Error             string
+
+	ImportProfile        *ImportProfile        `json:",omitempty"`
+	InstallationSnapshot *InstallationSnapshot `json:",omitempty"`
+}
+
+// CancelState returns the state an Import moves to when it is
+// cancelled, and false if it can no longer be cancelled. Imports which
+// have not adjusted their Installation yet are cancelled right away,
+// while the others wait for the Installation to be reverted first.
+func (i *Import) CancelState() (string, bool) {
+	switch i.State {
+	case ImportStateRequested:
+		return ImportStateCancelled, true
+	case ImportStateInstallationPreAdjustment, ImportStateInProgress:
+		return ImportStateCancelRequested, true
+	}
+
+	return "", false
+}
+
+// AddError records why the Import failed, keeping the reasons recorded
+// before.
+func (i *Import) AddError(reason string) {
+	if i.Error == "" {
+		i.Error = reason
+		return
+	}
+
+	i.Error += "; " + reason
 }
 
 // ImportWorkRequest contains an identifier from the caller in order
@@ -80,7 +132,9 @@ func NewImport(translationID, importResource string) *Import {
 
 // ImportStatus provides a container for returning the State with the
 // Import to the client without explicitly needing to store a state
-// attribute in the database
+// attribute in the database. Checksum is the hex encoded SHA-256 of
+// the archive to import, if it is known, which the Provisioner should
+// verify before importing it.
 type ImportStatus struct {
 	Import
 
@@ -89,6 +143,12 @@ type ImportStatus struct {
 	Team           string
 	State          string
 	Type           BackupType
+	Checksum       string `json:",omitempty"`
+
+	// InstallationChanges lists the settings of the Installation the
+	// import changes, with their original values, which are restored
+	// once it is done.
+	InstallationChanges []InstallationChange `json:",omitempty"`
 }
 
 // NewImportWorkRequestFromReader creates a ImportWorkRequest from a
@@ -0,0 +1,206 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	cloudModel "github.com/mattermost/mattermost-cloud/model"
+	"github.com/pkg/errors"
+)
+
+// ImportProfile declares how an Installation is adjusted for the
+// duration of an import: the Size it is resized to and the priority env
+// vars set on it. Once the import is done, the Installation is resized
+// to PostImportSize, or back to its original size if that is empty, and
+// the env vars get their original values back. An empty Size leaves the
+// size of the Installation alone.
+type ImportProfile struct {
+	Size           string            `json:",omitempty"`
+	Env            map[string]string `json:",omitempty"`
+	PostImportSize string            `json:",omitempty"`
+}
+
+// DefaultImportProfile returns the ImportProfile used unless a request
+// or the server says otherwise, which resizes the Installation to
+// Size1000String, extends its S3 timeout and disables the extraction of
+// file contents.
+func DefaultImportProfile() *ImportProfile {
+	return &ImportProfile{
+		Size: Size1000String,
+		Env: map[string]string{
+			S3EnvKey:          fmt.Sprintf("%d", S3ExtendedTimeout),
+			ExtractContentKey: ExtractContentDisabled,
+		},
+	}
+}
+
+// Validate returns an error if the ImportProfile names an unknown
+// size or sets an env var without a name or a value.
+func (p *ImportProfile) Validate() error {
+	for _, size := range []string{p.Size, p.PostImportSize} {
+		if size == "" {
+			continue
+		}
+		_, err := cloudModel.GetInstallationSize(size)
+		if err != nil {
+			return errors.Wrapf(err, "invalid size %q", size)
+		}
+	}
+	for key, value := range p.Env {
+		if key == "" {
+			return errors.New("import env var names must not be empty")
+		}
+		if value == "" {
+			return errors.Errorf("import env var %s must have a value", key)
+		}
+	}
+
+	return nil
+}
+
+// ParseImportEnv parses the env vars of an ImportProfile from
+// "KEY=VALUE" pairs.
+func ParseImportEnv(pairs []string) (map[string]string, error) {
+	env := map[string]string{}
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, errors.Errorf("import env var %q must have the form KEY=VALUE", pair)
+		}
+		env[key] = value
+	}
+
+	return env, nil
+}
+
+// Scan implements sql.Scanner so that a profile can be read from the
+// JSON stored in the database.
+func (p *ImportProfile) Scan(value interface{}) error {
+	return scanJSON(value, p)
+}
+
+// Value implements driver.Valuer so that a profile is stored in the
+// database as JSON.
+func (p *ImportProfile) Value() (driver.Value, error) {
+	if p == nil {
+		return nil, nil
+	}
+
+	return valueJSON(p)
+}
+
+// InstallationSnapshot records the configuration an Installation had
+// when an import started adjusting it, so that exactly that
+// configuration is restored afterwards: its Size and its whole
+// PriorityEnv.
+type InstallationSnapshot struct {
+	Size        string
+	PriorityEnv cloudModel.EnvVarMap
+}
+
+// InstallationChange is a setting of an Installation an import changes,
+// either its Size or one of its priority env vars, named PriorityEnv.
+// followed by the name of the env var. Original is the value it had
+// before the import, Import the value during the import, and
+// PostImport the value it is set to afterwards. Env vars which are not
+// set have an empty value.
+type InstallationChange struct {
+	Setting    string
+	Original   string
+	Import     string
+	PostImport string
+}
+
+// InstallationChanges returns the changes the ImportProfile of the
+// Import makes to its Installation compared to its
+// InstallationSnapshot, sorted by setting, or nil if the Import has not
+// adjusted its Installation yet.
+func (i *Import) InstallationChanges() []InstallationChange {
+	if i.ImportProfile == nil || i.InstallationSnapshot == nil {
+		return nil
+	}
+	profile, snapshot := i.ImportProfile, i.InstallationSnapshot
+
+	var changes []InstallationChange
+	size := InstallationChange{
+		Setting:    "Size",
+		Original:   snapshot.Size,
+		Import:     snapshot.Size,
+		PostImport: snapshot.Size,
+	}
+	if profile.Size != "" {
+		size.Import = profile.Size
+	}
+	if profile.PostImportSize != "" {
+		size.PostImport = profile.PostImportSize
+	}
+	if size.Import != size.Original || size.PostImport != size.Original {
+		changes = append(changes, size)
+	}
+
+	keys := make([]string, 0, len(profile.Env))
+	for key := range profile.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		original := snapshot.PriorityEnv[key].Value
+		if profile.Env[key] == original {
+			continue
+		}
+		changes = append(changes, InstallationChange{
+			Setting:    "PriorityEnv." + key,
+			Original:   original,
+			Import:     profile.Env[key],
+			PostImport: original,
+		})
+	}
+
+	return changes
+}
+
+// Scan implements sql.Scanner so that a snapshot can be read from the
+// JSON stored in the database.
+func (s *InstallationSnapshot) Scan(value interface{}) error {
+	return scanJSON(value, s)
+}
+
+// Value implements driver.Valuer so that a snapshot is stored in the
+// database as JSON.
+func (s *InstallationSnapshot) Value() (driver.Value, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	return valueJSON(s)
+}
+
+func scanJSON(value interface{}, v interface{}) error {
+	var data []byte
+	switch value := value.(type) {
+	case []byte:
+		data = value
+	case string:
+		data = []byte(value)
+	default:
+		return errors.Errorf("cannot scan %T into a %T", value, v)
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func valueJSON(v interface{}) (driver.Value, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to encode %T", v)
+	}
+
+	return string(data), nil
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package model_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mattermost/awat/model"
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportInstallationChanges(t *testing.T) {
+	imp := &model.Import{}
+	assert.Nil(t, imp.InstallationChanges())
+
+	imp.ImportProfile = model.DefaultImportProfile()
+	imp.InstallationSnapshot = &model.InstallationSnapshot{
+		Size: "100users",
+		PriorityEnv: cloud.EnvVarMap{
+			model.ExtractContentKey: cloud.EnvVar{Value: model.ExtractContentDisabled},
+			"MM_CUSTOM":             cloud.EnvVar{Value: "kept"},
+		},
+	}
+	assert.Equal(t, []model.InstallationChange{
+		{Setting: "Size", Original: "100users", Import: model.Size1000String, PostImport: "100users"},
+		{Setting: "PriorityEnv." + model.S3EnvKey, Import: fmt.Sprintf("%d", model.S3ExtendedTimeout)},
+	}, imp.InstallationChanges())
+
+	imp.ImportProfile = &model.ImportProfile{PostImportSize: model.SizeCloud10Users}
+	assert.Equal(t, []model.InstallationChange{
+		{Setting: "Size", Original: "100users", Import: "100users", PostImport: model.SizeCloud10Users},
+	}, imp.InstallationChanges())
+
+	imp.ImportProfile = &model.ImportProfile{}
+	assert.Nil(t, imp.InstallationChanges())
+}
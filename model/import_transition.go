@@ -0,0 +1,38 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package model
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ImportTransition records an Import moving from OldState to NewState,
+// the state its Installation was in at the time, if it was looked at,
+// and the reason for the move, if there is one beyond the Installation
+// being ready for it. The ImportTransitions of an Import tell how long
+// it stayed in each state and why it failed.
+type ImportTransition struct {
+	ID                string
+	ImportID          string
+	OldState          string
+	NewState          string
+	InstallationState string
+	Reason            string
+	CreateAt          int64
+}
+
+// NewImportTransitionListFromReader creates a list of
+// ImportTransitions from a Reader.
+func NewImportTransitionListFromReader(reader io.Reader) ([]*ImportTransition, error) {
+	var transitions []*ImportTransition
+	err := json.NewDecoder(reader).Decode(&transitions)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "failed to decode import transition list")
+	}
+	return transitions, nil
+}
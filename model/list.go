@@ -0,0 +1,166 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package model
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultPerPage is the number of items listed per page unless
+	// requested otherwise.
+	DefaultPerPage = 100
+
+	// MaxPerPage is the largest number of items which may be listed
+	// per page.
+	MaxPerPage = 1000
+
+	// AllPerPage requests every item at once rather than a page.
+	AllPerPage = -1
+)
+
+// The fields lists may be sorted by.
+const (
+	SortByCreateAt   = "create_at"
+	SortByCompleteAt = "complete_at"
+)
+
+// The orders lists may be sorted in.
+const (
+	SortAscending  = "asc"
+	SortDescending = "desc"
+)
+
+// ListOptions selects which page of the Translations, Imports or
+// Uploads matching its filters is listed, and in which order. Filters
+// which are not set match every item. CreatedAfter and CreatedBefore
+// are exclusive bounds in milliseconds since the epoch. Items are
+// sorted by their creation time, oldest first, unless SortBy and
+// SortOrder say otherwise.
+type ListOptions struct {
+	Page    int
+	PerPage int
+
+	State          string
+	Type           BackupType
+	InstallationID string
+	CreatedAfter   int64
+	CreatedBefore  int64
+
+	SortBy    string
+	SortOrder string
+}
+
+// Validate returns an error if the ListOptions select no valid page or
+// order.
+func (o *ListOptions) Validate() error {
+	if o.Page < 0 {
+		return errors.New("page must not be negative")
+	}
+	if o.PerPage != AllPerPage && (o.PerPage < 1 || o.PerPage > MaxPerPage) {
+		return errors.Errorf("per_page must be between 1 and %d", MaxPerPage)
+	}
+	if o.Type != "" && !o.Type.IsValid() {
+		return errors.Errorf("invalid type %q", o.Type)
+	}
+	switch o.SortBy {
+	case "", SortByCreateAt, SortByCompleteAt:
+	default:
+		return errors.Errorf("invalid sort field %q (valid options: %s, %s)", o.SortBy, SortByCreateAt, SortByCompleteAt)
+	}
+	switch o.SortOrder {
+	case "", SortAscending, SortDescending:
+	default:
+		return errors.Errorf("invalid sort order %q (valid options: %s, %s)", o.SortOrder, SortAscending, SortDescending)
+	}
+
+	return nil
+}
+
+// AddToQuery adds the ListOptions to the query parameters of a request
+// listing items.
+func (o *ListOptions) AddToQuery(query url.Values) {
+	query.Set("page", strconv.Itoa(o.Page))
+	if o.PerPage != 0 {
+		query.Set("per_page", strconv.Itoa(o.PerPage))
+	}
+	if o.State != "" {
+		query.Set("state", o.State)
+	}
+	if o.Type != "" {
+		query.Set("type", string(o.Type))
+	}
+	if o.InstallationID != "" {
+		query.Set("installation", o.InstallationID)
+	}
+	if o.CreatedAfter != 0 {
+		query.Set("created_after", strconv.FormatInt(o.CreatedAfter, 10))
+	}
+	if o.CreatedBefore != 0 {
+		query.Set("created_before", strconv.FormatInt(o.CreatedBefore, 10))
+	}
+	if o.SortBy != "" {
+		query.Set("sort", o.SortBy)
+	}
+	if o.SortOrder != "" {
+		query.Set("order", o.SortOrder)
+	}
+}
+
+// NewListOptionsFromQuery parses the ListOptions of a request listing
+// items from its query parameters. The page size defaults to
+// DefaultPerPage, but requests which ask for neither a page nor a page
+// size list every item, as they did before lists were paged, so that
+// older clients keep getting every item.
+func NewListOptionsFromQuery(query url.Values) (*ListOptions, error) {
+	options := &ListOptions{
+		PerPage:        DefaultPerPage,
+		State:          query.Get("state"),
+		Type:           BackupType(query.Get("type")),
+		InstallationID: query.Get("installation"),
+		SortBy:         query.Get("sort"),
+		SortOrder:      query.Get("order"),
+	}
+
+	if query.Get("page") == "" && query.Get("per_page") == "" {
+		options.PerPage = AllPerPage
+	}
+
+	var err error
+	for name, value := range map[string]*int{
+		"page":     &options.Page,
+		"per_page": &options.PerPage,
+	} {
+		if query.Get(name) == "" {
+			continue
+		}
+		*value, err = strconv.Atoi(query.Get(name))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s", name)
+		}
+	}
+	for name, value := range map[string]*int64{
+		"created_after":  &options.CreatedAfter,
+		"created_before": &options.CreatedBefore,
+	} {
+		if query.Get(name) == "" {
+			continue
+		}
+		*value, err = strconv.ParseInt(query.Get(name), 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s", name)
+		}
+	}
+
+	err = options.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return options, nil
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package model
+
+// Kinds of resources which can be locked.
+const (
+	LockResourceTranslation = "translation"
+	LockResourceImport      = "import"
+)
+
+// Locks which can be held on a resource. LockedBy is held by the
+// supervisor working on a Translation or Import, and ImportBy by the
+// Provisioner performing an Import.
+const (
+	LockLockedBy = "LockedBy"
+	LockImportBy = "ImportBy"
+)
+
+// Reasons for releasing a lock on behalf of its owner.
+const (
+	LockReleaseReasonExpired = "lease-expired"
+	LockReleaseReasonManual  = "manual"
+)
+
+// LockEvent records that a lock on a Translation or Import was released
+// on behalf of its owner, either because the owner stopped renewing
+// its lease or because an administrator unlocked the resource.
+type LockEvent struct {
+	ID         string
+	CreateAt   int64
+	Resource   string
+	ResourceID string
+	Lock       string
+	Owner      string
+	Reason     string
+}
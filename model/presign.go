@@ -0,0 +1,162 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package model
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// PresignRequest is the request to upload an archive of Size bytes
+// with the hex encoded SHA-256 Checksum straight to the bucket. Archives
+// of more than MaxUploadChunkSize bytes are uploaded in parts of
+// ChunkSize bytes, for which PartChecksums holds the checksums in
+// order. If ValidateArchive is set, the archive is validated once it was
+// uploaded, which means downloading it to the AWAT.
+type PresignRequest struct {
+	Type            BackupType
+	Size            int64
+	Checksum        string
+	ChunkSize       int64    `json:",omitempty"`
+	PartChecksums   []string `json:",omitempty"`
+	ValidateArchive bool
+}
+
+// NewPresignRequestFromReader creates a PresignRequest from a Reader.
+func NewPresignRequestFromReader(reader io.Reader) (*PresignRequest, error) {
+	var request PresignRequest
+	err := json.NewDecoder(reader).Decode(&request)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "failed to decode presign request")
+	}
+	return &request, nil
+}
+
+// Validate checks that the request describes an archive which can be
+// uploaded straight to the bucket.
+func (r *PresignRequest) Validate() error {
+	if !r.Type.IsValid() {
+		return errors.Errorf("unsupported archive type %q", r.Type)
+	}
+	if r.Size <= 0 {
+		return errors.New("the size of the archive must be set")
+	}
+	if !isChecksum(r.Checksum) {
+		return errors.New("the checksum must be the hex encoded SHA-256 of the archive")
+	}
+
+	if len(r.PartChecksums) == 0 {
+		if r.Size > MaxUploadChunkSize {
+			return errors.Errorf("archives of more than %d bytes must be uploaded in parts", MaxUploadChunkSize)
+		}
+		return nil
+	}
+
+	if r.ChunkSize < MinUploadChunkSize || r.ChunkSize > MaxUploadChunkSize {
+		return errors.Errorf("chunk size must be between %d and %d bytes", MinUploadChunkSize, MaxUploadChunkSize)
+	}
+	parts := chunks(r.Size, r.ChunkSize)
+	if parts > MaxUploadChunks {
+		return errors.Errorf("an archive of %d bytes needs more than %d parts of %d bytes", r.Size, MaxUploadChunks, r.ChunkSize)
+	}
+	if len(r.PartChecksums) != parts {
+		return errors.Errorf("an archive of %d bytes has %d parts of %d bytes, but %d checksums were given", r.Size, parts, r.ChunkSize, len(r.PartChecksums))
+	}
+	for i, checksum := range r.PartChecksums {
+		if !isChecksum(checksum) {
+			return errors.Errorf("the checksum of part %d must be its hex encoded SHA-256", i+1)
+		}
+	}
+
+	return nil
+}
+
+// PresignedRequest is a request which uploads an archive, or a part of
+// it, straight to the bucket. It must be sent with the given headers.
+type PresignedRequest struct {
+	Method string
+	URL    string
+	Header map[string]string `json:",omitempty"`
+}
+
+// NewHTTPRequest creates the HTTP request uploading the body.
+func (r *PresignedRequest) NewHTTPRequest(body io.Reader, size int64) (*http.Request, error) {
+	req, err := http.NewRequest(r.Method, r.URL, body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create http request")
+	}
+	for k, v := range r.Header {
+		req.Header.Set(k, v)
+	}
+	req.ContentLength = size
+
+	return req, nil
+}
+
+// PresignedPart is a presigned request uploading the part with the
+// given number, starting at 1, which holds Size bytes of the archive
+// starting at Offset.
+type PresignedPart struct {
+	PresignedRequest
+	Number int
+	Offset int64
+	Size   int64
+}
+
+// PresignedUpload holds the requests uploading an archive straight to
+// the bucket, which expire at ExpiresAt. Either Request uploads the
+// whole archive, or each of the Parts uploads a part of it.
+type PresignedUpload struct {
+	UploadID  string
+	ExpiresAt int64
+	Request   *PresignedRequest `json:",omitempty"`
+	Parts     []*PresignedPart  `json:",omitempty"`
+}
+
+// NewPresignedUploadFromReader creates a PresignedUpload from a Reader.
+func NewPresignedUploadFromReader(reader io.Reader) (*PresignedUpload, error) {
+	var upload PresignedUpload
+	err := json.NewDecoder(reader).Decode(&upload)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "failed to decode presigned upload")
+	}
+	return &upload, nil
+}
+
+// UploadedPart is a part of an archive uploaded straight to the bucket,
+// with the ETag the bucket responded with.
+type UploadedPart struct {
+	Number   int
+	ETag     string
+	Checksum string
+}
+
+// PresignCompleteRequest notifies the AWAT that an archive was
+// uploaded straight to the bucket. Parts lists the uploaded parts of an
+// archive uploaded in parts.
+type PresignCompleteRequest struct {
+	Parts []UploadedPart `json:",omitempty"`
+}
+
+// NewPresignCompleteRequestFromReader creates a PresignCompleteRequest
+// from a Reader.
+func NewPresignCompleteRequestFromReader(reader io.Reader) (*PresignCompleteRequest, error) {
+	var request PresignCompleteRequest
+	err := json.NewDecoder(reader).Decode(&request)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "failed to decode presign complete request")
+	}
+	return &request, nil
+}
+
+// isChecksum returns true if checksum is a hex encoded SHA-256.
+func isChecksum(checksum string) bool {
+	sum, err := hex.DecodeString(checksum)
+	return err == nil && len(sum) == 32
+}
@@ -16,10 +16,28 @@ const (
 	TranslationStateRequested  = "translation-requested"
 	TranslationStateInProgress = "translation-in-progress"
 	TranslationStateComplete   = "translation-complete"
+	TranslationStateCancelled  = "translation-cancelled"
+	TranslationStateFailed     = "translation-failed"
 )
 
+// AllTranslationStates contains every state of a translation.
+var AllTranslationStates = []string{
+	TranslationStateRequested,
+	TranslationStateInProgress,
+	TranslationStateComplete,
+	TranslationStateCancelled,
+	TranslationStateFailed,
+}
+
 // Translation represents a single process of converting a foreign
-// workspace archive into a native Mattermost workspace import archive
+// workspace archive into a native Mattermost workspace import archive.
+// InputChecksum is the hex encoded SHA-256 of the input archive, if it
+// was uploaded to the AWAT, and OutputChecksum that of the Mattermost
+// archive once the Translation is complete. SlackToken holds the
+// encrypted token to fetch the files attached to a Slack export with,
+// and is never sent to clients. The TranslationProgress tells how far
+// along its last attempt got, and the AttachmentReport how the attached
+// files were stored once it is complete.
 type Translation struct {
 	ID             string
 	InstallationID string
@@ -31,13 +49,33 @@ type Translation struct {
 	CreateAt       int64
 	StartAt        int64
 	CompleteAt     int64
+	CancelAt       int64
+	FailAt         int64
+	RetryAt        int64
+	Attempts       int
+	Error          string
 	LockedBy       string
+	LockExpiresAt  int64
+	InputChecksum  string         `json:",omitempty"`
+	OutputChecksum string         `json:",omitempty"`
+	SlackToken     string         `json:"-"`
+	ImportProfile  *ImportProfile `json:",omitempty"`
+	TranslationProgress
+	AttachmentReport
 }
 
 // State provides a container for returning the state with the
 // Translation to the client without explicitly needing to store a state
 // attribute in the database
 func (t *Translation) State() string {
+	if t.CancelAt != 0 {
+		return TranslationStateCancelled
+	}
+
+	if t.FailAt != 0 {
+		return TranslationStateFailed
+	}
+
 	if t.StartAt == 0 {
 		return TranslationStateRequested
 	}
@@ -49,10 +87,16 @@ func (t *Translation) State() string {
 	return TranslationStateComplete
 }
 
+// IsCancellable returns true if the Translation has neither completed,
+// failed nor been cancelled yet.
+func (t *Translation) IsCancellable() bool {
+	return t.CancelAt == 0 && t.CompleteAt == 0 && t.FailAt == 0
+}
+
 // NewTranslationFromRequest returns a new Translation from a TranslationRequest.
 func NewTranslationFromRequest(translationRequest *TranslationRequest) *Translation {
 	teamName := translationRequest.Team
-	if translationRequest.Type != MattermostWorkspaceBackupType {
+	if translationRequest.Type != MattermostWorkspaceBackupType && teamName != "" {
 		teamName = cleanTeamName(teamName)
 	}
 
@@ -62,6 +106,7 @@ func NewTranslationFromRequest(translationRequest *TranslationRequest) *Translat
 		Resource:       translationRequest.Archive,
 		UploadID:       translationRequest.UploadID,
 		Team:           teamName,
+		ImportProfile:  translationRequest.ImportProfile,
 	}
 }
 
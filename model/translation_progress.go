@@ -0,0 +1,152 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package model
+
+import "math"
+
+// Phases a running Translation goes through, in order. Which phases
+// are passed depends on the type of the Translation. The download,
+// archive and upload phases count bytes, fetching attachments counts
+// the attached files and transforming counts posts.
+const (
+	TranslationPhaseDownload         = "download"
+	TranslationPhaseValidate         = "validate"
+	TranslationPhaseFetchAttachments = "fetch-attachments"
+	TranslationPhaseTransform        = "transform"
+	TranslationPhaseArchive          = "archive"
+	TranslationPhaseUpload           = "upload"
+)
+
+// translationPhaseWeights are the shares of the duration of a
+// Translation its phases are expected to take, in the order they are
+// passed, by which the progress made in a phase counts towards the
+// progress of the whole Translation. Validating is left out, as it is
+// passed at different points depending on the type of the Translation.
+var translationPhaseWeights = []struct {
+	phase  string
+	weight float64
+}{
+	{TranslationPhaseDownload, 0.1},
+	{TranslationPhaseFetchAttachments, 0.3},
+	{TranslationPhaseTransform, 0.3},
+	{TranslationPhaseArchive, 0.15},
+	{TranslationPhaseUpload, 0.15},
+}
+
+// TranslationProgress is how far along the last attempt of a
+// Translation got. Phase is the phase it is in, which it entered at
+// PhaseStartAt. FilesDone and FilesTotal count the attached files
+// fetched, BytesDone and BytesTotal the bytes of the archive being
+// downloaded, packaged or uploaded, and PostsDone and PostsTotal the
+// posts transformed. A total is 0 while it is not known. ProgressAt is
+// when progress was recorded last.
+type TranslationProgress struct {
+	Phase        string `json:",omitempty"`
+	PhaseStartAt int64  `json:",omitempty"`
+	FilesDone    int64  `json:",omitempty"`
+	FilesTotal   int64  `json:",omitempty"`
+	BytesDone    int64  `json:",omitempty"`
+	BytesTotal   int64  `json:",omitempty"`
+	PostsDone    int64  `json:",omitempty"`
+	PostsTotal   int64  `json:",omitempty"`
+	ProgressAt   int64  `json:",omitempty"`
+}
+
+// Update records that done out of total of the units counted by phase
+// were processed at now. Entering a new phase resets the bytes, which
+// are counted by several phases.
+func (p *TranslationProgress) Update(phase string, done, total, now int64) {
+	if phase != p.Phase {
+		p.Phase = phase
+		p.PhaseStartAt = now
+		p.BytesDone, p.BytesTotal = 0, 0
+	}
+	p.ProgressAt = now
+
+	switch phase {
+	case TranslationPhaseFetchAttachments:
+		p.FilesDone, p.FilesTotal = done, total
+	case TranslationPhaseTransform:
+		p.PostsDone, p.PostsTotal = done, total
+	case TranslationPhaseDownload, TranslationPhaseArchive, TranslationPhaseUpload:
+		p.BytesDone, p.BytesTotal = done, total
+	}
+}
+
+// EstimatePhaseCompletion returns when the current phase is expected
+// to complete if progress continues at the rate it was made at so far,
+// or 0 if that cannot be told because the phase does not count units,
+// their total is not known or no progress was made yet.
+func (p *TranslationProgress) EstimatePhaseCompletion() int64 {
+	done, total := p.phaseCounters()
+	if done <= 0 || total <= 0 {
+		return 0
+	}
+
+	return p.estimate(p.PhaseStartAt, float64(done)/float64(total))
+}
+
+// phaseCounters returns how many of the units counted by the current
+// phase were processed out of their total.
+func (p *TranslationProgress) phaseCounters() (int64, int64) {
+	switch p.Phase {
+	case TranslationPhaseFetchAttachments:
+		return p.FilesDone, p.FilesTotal
+	case TranslationPhaseTransform:
+		return p.PostsDone, p.PostsTotal
+	case TranslationPhaseDownload, TranslationPhaseArchive, TranslationPhaseUpload:
+		return p.BytesDone, p.BytesTotal
+	}
+
+	return 0, 0
+}
+
+// estimate returns when work which started at startAt and got the
+// given fraction done by ProgressAt is expected to complete, or 0 if no
+// progress was made yet.
+func (p *TranslationProgress) estimate(startAt int64, fraction float64) int64 {
+	elapsed := p.ProgressAt - startAt
+	if fraction <= 0 || elapsed <= 0 {
+		return 0
+	}
+	if fraction >= 1 {
+		return p.ProgressAt
+	}
+
+	return p.ProgressAt + int64(float64(elapsed)*(1-fraction)/fraction)
+}
+
+// EstimateCompletion returns when the running Translation is expected
+// to complete if progress continues at the rate it was made at since
+// it started, counting the progress made in each phase by the weight
+// of the phase, or 0 if that cannot be told because the phase it is in
+// does not count units, their total is not known or no progress was
+// made yet. Only Slack translations fetch attachments.
+func (t *Translation) EstimateCompletion() int64 {
+	done, total := t.phaseCounters()
+	if total <= 0 {
+		return 0
+	}
+
+	var passed, current, all float64
+	for _, phase := range translationPhaseWeights {
+		if phase.phase == TranslationPhaseFetchAttachments && t.Type != SlackWorkspaceBackupType {
+			continue
+		}
+		all += phase.weight
+		switch {
+		case phase.phase == t.Phase:
+			current = phase.weight
+		case current == 0:
+			passed += phase.weight
+		}
+	}
+	if current == 0 {
+		return 0
+	}
+
+	fraction := (passed + current*math.Min(1, float64(done)/float64(total))) / all
+	return t.estimate(t.StartAt, fraction)
+}
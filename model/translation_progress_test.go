@@ -0,0 +1,60 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslationProgress(t *testing.T) {
+	progress := &TranslationProgress{}
+
+	progress.Update(TranslationPhaseDownload, 100, 100, 1000)
+	assert.Equal(t, TranslationPhaseDownload, progress.Phase)
+	assert.Equal(t, int64(1000), progress.PhaseStartAt)
+	assert.Equal(t, int64(100), progress.BytesDone)
+
+	progress.Update(TranslationPhaseFetchAttachments, 0, 40, 2000)
+	assert.Equal(t, int64(2000), progress.PhaseStartAt)
+	assert.Zero(t, progress.BytesDone)
+	assert.Zero(t, progress.EstimatePhaseCompletion(), "no progress was made yet")
+
+	progress.Update(TranslationPhaseFetchAttachments, 10, 40, 12000)
+	assert.Equal(t, int64(2000), progress.PhaseStartAt)
+	assert.Equal(t, int64(10), progress.FilesDone)
+	assert.Equal(t, int64(40), progress.FilesTotal)
+	// 10 files took 10 seconds, so the remaining 30 take 30 more
+	assert.Equal(t, int64(42000), progress.EstimatePhaseCompletion())
+
+	progress.Update(TranslationPhaseTransform, 0, 0, 50000)
+	assert.Equal(t, int64(40), progress.FilesTotal, "the files are kept once fetched")
+	assert.Zero(t, progress.EstimatePhaseCompletion(), "the total is not known")
+
+	progress.Update(TranslationPhaseValidate, 0, 0, 60000)
+	assert.Zero(t, progress.EstimatePhaseCompletion(), "validating counts nothing")
+}
+
+func TestTranslationEstimateCompletion(t *testing.T) {
+	translation := &Translation{Type: SlackWorkspaceBackupType, StartAt: 1000}
+
+	translation.Update(TranslationPhaseDownload, 50, 100, 2000)
+	// downloading is a tenth of a Slack translation, so half of it
+	// took 1 second out of 20
+	assert.Equal(t, int64(21000), translation.EstimateCompletion())
+
+	translation.Update(TranslationPhaseValidate, 0, 0, 3000)
+	assert.Zero(t, translation.EstimateCompletion(), "validating counts nothing")
+
+	translation.Type = MattermostWorkspaceBackupType
+	translation.Update(TranslationPhaseTransform, 50, 100, 11000)
+	// without fetching attachments, downloading and half of transforming
+	// are 0.25 out of 0.7, so 10 seconds are followed by 18 more
+	assert.InDelta(t, 29000, translation.EstimateCompletion(), 1)
+
+	translation.Update(TranslationPhaseUpload, 100, 100, 12000)
+	assert.Equal(t, int64(12000), translation.EstimateCompletion())
+}
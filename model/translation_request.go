@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"io"
 	"net/url"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -19,8 +20,38 @@ type BackupType string
 const (
 	SlackWorkspaceBackupType      BackupType = "slack"
 	MattermostWorkspaceBackupType BackupType = "mattermost"
+	TeamsWorkspaceBackupType      BackupType = "teams"
+	DiscordWorkspaceBackupType    BackupType = "discord"
+	RocketChatWorkspaceBackupType BackupType = "rocketchat"
+	ZulipWorkspaceBackupType      BackupType = "zulip"
 )
 
+// IsValid returns true if the BackupType is one the AWAT can handle.
+func (t BackupType) IsValid() bool {
+	switch t {
+	case SlackWorkspaceBackupType,
+		MattermostWorkspaceBackupType,
+		TeamsWorkspaceBackupType,
+		DiscordWorkspaceBackupType,
+		RocketChatWorkspaceBackupType,
+		ZulipWorkspaceBackupType:
+		return true
+	}
+
+	return false
+}
+
+// ArchiveExtensions returns the file extensions the archives of the
+// BackupType may have. Zulip realm exports are gzipped tarballs, which
+// may be zipped as well; every other type is a zip file.
+func (t BackupType) ArchiveExtensions() []string {
+	if t == ZulipWorkspaceBackupType {
+		return append(tarballExtensions, archiveExtension)
+	}
+
+	return []string{archiveExtension}
+}
+
 // TranslationRequest represents a request for translating a workspace archive.
 type TranslationRequest struct {
 	Type            BackupType
@@ -29,6 +60,17 @@ type TranslationRequest struct {
 	Team            string
 	UploadID        *string
 	ValidateArchive bool
+
+	// SlackToken is a bot or user token of the Slack workspace with
+	// the files:read scope, which is needed to fetch the files attached
+	// to the messages of a Slack export. It is stored encrypted and
+	// deleted once the Translation completed or was cancelled.
+	SlackToken string `json:",omitempty"`
+
+	// ImportProfile declares how the Installation is adjusted while
+	// the output is imported into it, in place of the default profile
+	// of the server.
+	ImportProfile *ImportProfile `json:",omitempty"`
 }
 
 // Validate validates the values of a translation create request.
@@ -39,14 +81,29 @@ func (request *TranslationRequest) Validate() error {
 	if len(request.Type) == 0 {
 		return errors.New("must specify backup type")
 	}
+	if !request.Type.IsValid() {
+		return errors.Errorf("%s is not a supported backup type", request.Type)
+	}
 	if request.Type == SlackWorkspaceBackupType && len(request.Team) == 0 {
 		return errors.New("must specify team with slack backup type")
 	}
-	if !IsValidArchiveName(request.Archive) {
-		return errors.New("archive must be a valid zip file")
+	if request.Type != SlackWorkspaceBackupType && len(request.SlackToken) != 0 {
+		return errors.New("a slack token may only be given with slack backup type")
+	}
+	if request.Type == RocketChatWorkspaceBackupType && len(request.Team) == 0 {
+		return errors.New("must specify team with rocketchat backup type")
+	}
+	if request.ImportProfile != nil {
+		err := request.ImportProfile.Validate()
+		if err != nil {
+			return errors.Wrap(err, "invalid import profile")
+		}
+	}
+	if !IsValidArchiveName(request.Archive, request.Type) {
+		return errors.Errorf("archive must be a %s file", strings.Join(request.Type.ArchiveExtensions(), " or "))
 	}
-	if request.Archive == ".zip" {
-		return errors.New("zip archive has no filename")
+	if TrimExtensionFromArchiveFilename(request.Archive) == "" {
+		return errors.New("archive has no filename")
 	}
 
 	return nil
@@ -57,11 +114,16 @@ type TranslationMetadata struct {
 	Options interface{}
 }
 
-// TranslationStatus represents the status of a translation.
+// TranslationStatus represents the status of a translation. PhaseETA
+// is when the phase a running Translation is in is expected to
+// complete, and ETA when the whole Translation is, or 0 if that cannot
+// be estimated.
 type TranslationStatus struct {
 	Translation
 
-	State string
+	State    string
+	PhaseETA int64 `json:",omitempty"`
+	ETA      int64 `json:",omitempty"`
 }
 
 // NewTranslationRequestFromReader creates a TranslationRequest from an io.Reader.
@@ -117,7 +179,7 @@ type ArchiveUploadRequest struct {
 
 // Validate checks if the ArchiveUploadRequest fields are valid.
 func (r ArchiveUploadRequest) Validate() error {
-	if r.Type != SlackWorkspaceBackupType && r.Type != MattermostWorkspaceBackupType {
+	if !r.Type.IsValid() {
 		return errors.New("invalid backup type")
 	}
 
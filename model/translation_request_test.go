@@ -38,6 +38,45 @@ func TestTranslationRequestValid(t *testing.T) {
 				Archive:        "test.zip",
 			},
 		},
+		{
+			"unsupported type",
+			true,
+			&model.TranslationRequest{
+				Type:           model.BackupType("hipchat"),
+				InstallationID: model.NewID(),
+				Archive:        "test.zip",
+			},
+		},
+		{
+			"teams, without team",
+			false,
+			&model.TranslationRequest{
+				Type:           model.TeamsWorkspaceBackupType,
+				InstallationID: model.NewID(),
+				Archive:        "test.zip",
+			},
+		},
+		{
+			"slack, with token",
+			false,
+			&model.TranslationRequest{
+				Type:           model.SlackWorkspaceBackupType,
+				InstallationID: model.NewID(),
+				Archive:        "test.zip",
+				Team:           "test",
+				SlackToken:     "xoxb-test",
+			},
+		},
+		{
+			"slack token for teams",
+			true,
+			&model.TranslationRequest{
+				Type:           model.TeamsWorkspaceBackupType,
+				InstallationID: model.NewID(),
+				Archive:        "test.zip",
+				SlackToken:     "xoxb-test",
+			},
+		},
 		{
 			"not zip file",
 			true,
@@ -47,6 +86,24 @@ func TestTranslationRequestValid(t *testing.T) {
 				Archive:        "test.tar.gz",
 			},
 		},
+		{
+			"zulip tarball",
+			false,
+			&model.TranslationRequest{
+				Type:           model.ZulipWorkspaceBackupType,
+				InstallationID: model.NewID(),
+				Archive:        "zulip-export.tar.gz",
+			},
+		},
+		{
+			"zulip tarball without filename",
+			true,
+			&model.TranslationRequest{
+				Type:           model.ZulipWorkspaceBackupType,
+				InstallationID: model.NewID(),
+				Archive:        ".tgz",
+			},
+		},
 		{
 			"no filename",
 			true,
@@ -56,6 +113,40 @@ func TestTranslationRequestValid(t *testing.T) {
 				Archive:        ".zip",
 			},
 		},
+		{
+			"import profile",
+			false,
+			&model.TranslationRequest{
+				Type:           model.MattermostWorkspaceBackupType,
+				InstallationID: model.NewID(),
+				Archive:        "test.zip",
+				ImportProfile: &model.ImportProfile{
+					Size:           model.Size1000String,
+					Env:            map[string]string{"MM_CUSTOM": "value"},
+					PostImportSize: model.SizeCloud10Users,
+				},
+			},
+		},
+		{
+			"import profile with unknown size",
+			true,
+			&model.TranslationRequest{
+				Type:           model.MattermostWorkspaceBackupType,
+				InstallationID: model.NewID(),
+				Archive:        "test.zip",
+				ImportProfile:  &model.ImportProfile{Size: "hugeusers"},
+			},
+		},
+		{
+			"import profile with empty env var",
+			true,
+			&model.TranslationRequest{
+				Type:           model.MattermostWorkspaceBackupType,
+				InstallationID: model.NewID(),
+				Archive:        "test.zip",
+				ImportProfile:  &model.ImportProfile{Env: map[string]string{"MM_CUSTOM": ""}},
+			},
+		},
 		{
 			"valid",
 			false,
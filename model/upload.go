@@ -14,15 +14,23 @@ import (
 
 const archiveExtension = ".zip"
 
+// tarballExtensions are the extensions of gzipped tarballs.
+var tarballExtensions = []string{".tar.gz", ".tgz"}
+
 // Upload represents the details of an upload process in the system.
 // It includes metadata like the ID, creation and completion timestamps,
 // any errors encountered, and the type of backup being uploaded.
+// Validation holds the report of the validation of the archive, if it
+// was validated. Checksum is the hex encoded SHA-256 of the archive,
+// once the upload is complete.
 type Upload struct {
 	ID         string
 	CompleteAt int64
 	CreateAt   int64
 	Error      string
 	Type       BackupType
+	Checksum   string            `json:",omitempty"`
+	Validation *ValidationReport `json:",omitempty"`
 }
 
 // NewUploadFromReader creates an Upload from a Reader.
@@ -45,13 +53,32 @@ func NewUploadListFromReader(reader io.Reader) ([]*Upload, error) {
 	return uploads, nil
 }
 
+// ArchiveName returns the name the archive of the Upload is stored
+// under, relative to the root of the bucket.
+func (u *Upload) ArchiveName() string {
+	return u.ID + archiveExtension
+}
+
 // TrimExtensionFromArchiveFilename returns the archive filename without the extension, mostly to
 // retrieve the ID from an upload/archive to use on database entries.
 func TrimExtensionFromArchiveFilename(filename string) string {
-	return strings.TrimSuffix(filename, archiveExtension)
+	for _, extension := range append(tarballExtensions, archiveExtension) {
+		if strings.HasSuffix(filename, extension) {
+			return strings.TrimSuffix(filename, extension)
+		}
+	}
+
+	return filename
 }
 
-// IsValidArchiveName checks if the provided filename is a valid for an awat supported archive
-func IsValidArchiveName(filename string) bool {
-	return strings.HasSuffix(filename, archiveExtension)
+// IsValidArchiveName checks if the provided filename is a valid name
+// for an archive of the given type
+func IsValidArchiveName(filename string, archiveType BackupType) bool {
+	for _, extension := range archiveType.ArchiveExtensions() {
+		if strings.HasSuffix(filename, extension) {
+			return true
+		}
+	}
+
+	return false
 }
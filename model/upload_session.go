@@ -0,0 +1,248 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package model
+
+import (
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Archives may be uploaded in chunks, which map to the parts of an S3
+// multipart upload. Every chunk but the last must have the chunk size
+// of its upload session, which S3 requires to be at least 5 MiB, and
+// an upload has at most 10000 chunks.
+const (
+	MinUploadChunkSize     int64 = 5 << 20
+	DefaultUploadChunkSize int64 = 64 << 20
+	MaxUploadChunkSize     int64 = 512 << 20
+	MaxUploadChunks              = 10000
+)
+
+// ChunkChecksumHeader is the header holding the hex encoded SHA-256 of
+// an uploaded chunk.
+const ChunkChecksumHeader = "X-Chunk-Checksum-SHA256"
+
+// UploadSessionRequest is the request to start uploading an archive of
+// Size bytes in chunks. If ChunkSize is not set, the AWAT picks it.
+type UploadSessionRequest struct {
+	Type      BackupType
+	Size      int64
+	ChunkSize int64
+}
+
+// Validate checks that the request describes an archive which can be
+// uploaded in chunks, setting the chunk size if it is missing.
+func (r *UploadSessionRequest) Validate() error {
+	if !r.Type.IsValid() {
+		return errors.Errorf("unsupported archive type %q", r.Type)
+	}
+	if r.Size <= 0 {
+		return errors.New("the size of the archive must be set")
+	}
+
+	if r.ChunkSize == 0 {
+		r.ChunkSize = defaultChunkSize(r.Size)
+	}
+	if r.ChunkSize < MinUploadChunkSize || r.ChunkSize > MaxUploadChunkSize {
+		return errors.Errorf("chunk size must be between %d and %d bytes", MinUploadChunkSize, MaxUploadChunkSize)
+	}
+	if chunks(r.Size, r.ChunkSize) > MaxUploadChunks {
+		return errors.Errorf("an archive of %d bytes needs more than %d chunks of %d bytes", r.Size, MaxUploadChunks, r.ChunkSize)
+	}
+
+	return nil
+}
+
+// NewUploadSessionRequestFromReader creates an UploadSessionRequest
+// from a Reader.
+func NewUploadSessionRequestFromReader(reader io.Reader) (*UploadSessionRequest, error) {
+	var request UploadSessionRequest
+	err := json.NewDecoder(reader).Decode(&request)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "failed to decode upload session request")
+	}
+	return &request, nil
+}
+
+// UploadSession is an upload of an archive in chunks. Its ID is the ID
+// of the Upload it creates. Parts lists the chunks received so far.
+//
+// A Presigned session is uploaded straight to the bucket instead, and
+// the archive verified against its Checksum once the client completes
+// the session, and validated if ValidateArchive is set.
+//
+// VerifyAt is when the archive of a completed session is due to be
+// verified in the background, and 0 once it was. HashState holds the
+// SHA-256 of the first HashedSize bytes of the archive of a session
+// uploaded in chunks, which is computed as the chunks arrive in order,
+// so that the archive need not be read back to determine its checksum.
+type UploadSession struct {
+	ID              string
+	Type            BackupType
+	Size            int64
+	ChunkSize       int64
+	MultipartID     string `json:"-"`
+	Presigned       bool
+	Checksum        string `json:",omitempty"`
+	ValidateArchive bool
+	CreateAt        int64
+	CompleteAt      int64
+	VerifyAt        int64         `json:"-"`
+	HashState       []byte        `json:"-"`
+	HashedSize      int64         `json:"-"`
+	Parts           []*UploadPart `db:"-"`
+}
+
+// UploadPart is a chunk of an UploadSession, numbered from 1.
+type UploadPart struct {
+	UploadID string `json:"-"`
+	Number   int
+	Size     int64
+	Checksum string
+	ETag     string `json:"-"`
+	CreateAt int64
+}
+
+// ArchiveName returns the name the archive is stored under, relative
+// to the root of the bucket.
+func (s *UploadSession) ArchiveName() string {
+	return s.ID + archiveExtension
+}
+
+// Chunks returns the number of chunks the archive is uploaded in.
+func (s *UploadSession) Chunks() int {
+	return chunks(s.Size, s.ChunkSize)
+}
+
+// ChunkLength returns the size of the chunk with the given number.
+func (s *UploadSession) ChunkLength(number int) int64 {
+	if number == s.Chunks() {
+		return s.Size - int64(number-1)*s.ChunkSize
+	}
+
+	return s.ChunkSize
+}
+
+// ChunkOffset returns the offset of the chunk with the given number
+// from the start of the archive.
+func (s *UploadSession) ChunkOffset(number int) int64 {
+	return int64(number-1) * s.ChunkSize
+}
+
+// ArchiveHash returns the SHA-256 of the first HashedSize bytes of the
+// archive, which the following chunks can be added to.
+func (s *UploadSession) ArchiveHash() (hash.Hash, error) {
+	archiveHash := sha256.New()
+	if s.HashedSize == 0 {
+		return archiveHash, nil
+	}
+
+	err := archiveHash.(encoding.BinaryUnmarshaler).UnmarshalBinary(s.HashState)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to restore hash of archive")
+	}
+
+	return archiveHash, nil
+}
+
+// Offset returns the number of bytes from the start of the archive
+// which were received, which is where an interrupted upload resumes.
+func (s *UploadSession) Offset() int64 {
+	parts := s.parts()
+
+	var offset int64
+	for number := 1; parts[number] != nil; number++ {
+		offset += parts[number].Size
+	}
+
+	return offset
+}
+
+// Missing returns the numbers of the chunks which were not received
+// yet, in order.
+func (s *UploadSession) Missing() []int {
+	parts := s.parts()
+
+	var missing []int
+	for number := 1; number <= s.Chunks(); number++ {
+		if parts[number] == nil {
+			missing = append(missing, number)
+		}
+	}
+
+	return missing
+}
+
+// Part returns the received chunk with the given number, or nil.
+func (s *UploadSession) Part(number int) *UploadPart {
+	return s.parts()[number]
+}
+
+func (s *UploadSession) parts() map[int]*UploadPart {
+	parts := make(map[int]*UploadPart, len(s.Parts))
+	for _, part := range s.Parts {
+		parts[part.Number] = part
+	}
+
+	return parts
+}
+
+// MarshalJSON adds the Offset to the JSON of an UploadSession.
+func (s *UploadSession) MarshalJSON() ([]byte, error) {
+	type uploadSession UploadSession
+	return json.Marshal(struct {
+		*uploadSession
+		Offset int64
+	}{(*uploadSession)(s), s.Offset()})
+}
+
+// NewUploadSessionFromReader creates an UploadSession from a Reader.
+func NewUploadSessionFromReader(reader io.Reader) (*UploadSession, error) {
+	var session UploadSession
+	err := json.NewDecoder(reader).Decode(&session)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "failed to decode upload session")
+	}
+	return &session, nil
+}
+
+// NewUploadPartFromReader creates an UploadPart from a Reader.
+func NewUploadPartFromReader(reader io.Reader) (*UploadPart, error) {
+	var part UploadPart
+	err := json.NewDecoder(reader).Decode(&part)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "failed to decode upload part")
+	}
+	return &part, nil
+}
+
+// ChunkChecksum returns the checksum of a chunk as sent in the
+// ChunkChecksumHeader.
+func ChunkChecksum(chunk []byte) string {
+	sum := sha256.Sum256(chunk)
+	return hex.EncodeToString(sum[:])
+}
+
+// defaultChunkSize returns the DefaultUploadChunkSize, or a multiple
+// of it if an archive of the given size needs more than
+// MaxUploadChunks chunks of that size.
+func defaultChunkSize(size int64) int64 {
+	chunkSize := DefaultUploadChunkSize
+	for size > chunkSize*MaxUploadChunks {
+		chunkSize *= 2
+	}
+
+	return chunkSize
+}
+
+func chunks(size, chunkSize int64) int {
+	return int((size + chunkSize - 1) / chunkSize)
+}
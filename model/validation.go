@@ -0,0 +1,151 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ValidationIssue is a problem found in an archive. File is the file in
+// the archive the problem was found in, and Line the line of that file
+// if it is a JSONL file, starting at 1. Entity is the type of entity
+// the problem concerns, e.g. team, channel, user or post, and Field the
+// field of the entity at fault.
+type ValidationIssue struct {
+	File    string `json:",omitempty"`
+	Line    uint64 `json:",omitempty"`
+	Entity  string `json:",omitempty"`
+	Field   string `json:",omitempty"`
+	Message string
+}
+
+// String formats the issue as "file:line: field: message", leaving out
+// what is unknown and naming the entity if the field is unknown.
+func (i ValidationIssue) String() string {
+	var parts []string
+	if i.File != "" {
+		if i.Line > 0 {
+			parts = append(parts, fmt.Sprintf("%s:%d", i.File, i.Line))
+		} else {
+			parts = append(parts, i.File)
+		}
+	}
+	if i.Field != "" {
+		parts = append(parts, i.Field)
+	} else if i.Entity != "" {
+		parts = append(parts, i.Entity)
+	}
+
+	return strings.Join(append(parts, i.Message), ": ")
+}
+
+// ValidationReport is the result of validating an archive. An archive
+// with errors cannot be translated or imported, while warnings point
+// out data which will be skipped. The counts are of the entities found
+// in the archive, where Channels include direct channels and Posts
+// include direct posts.
+type ValidationReport struct {
+	Type     BackupType
+	Errors   []ValidationIssue
+	Warnings []ValidationIssue
+	Teams    int
+	Channels int
+	Users    int
+	Posts    int
+}
+
+// NewValidationReport creates an empty ValidationReport for an archive
+// of the given type.
+func NewValidationReport(archiveType BackupType) *ValidationReport {
+	return &ValidationReport{Type: archiveType}
+}
+
+// NewValidationReportFromReader creates a ValidationReport from a Reader.
+func NewValidationReportFromReader(reader io.Reader) (*ValidationReport, error) {
+	var report ValidationReport
+	err := json.NewDecoder(reader).Decode(&report)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "failed to decode validation report")
+	}
+	return &report, nil
+}
+
+// Valid returns true if no errors were found.
+func (r *ValidationReport) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+// AddError records an error.
+func (r *ValidationReport) AddError(issue ValidationIssue) {
+	r.Errors = append(r.Errors, issue)
+}
+
+// AddWarning records a warning.
+func (r *ValidationReport) AddWarning(issue ValidationIssue) {
+	r.Warnings = append(r.Warnings, issue)
+}
+
+// Err returns an error listing the errors of the report, or nil if
+// there are none.
+func (r *ValidationReport) Err() error {
+	if r.Valid() {
+		return nil
+	}
+
+	messages := make([]string, 0, len(r.Errors))
+	for _, issue := range r.Errors {
+		messages = append(messages, issue.String())
+	}
+
+	return errors.Errorf("invalid %s archive: %s", r.Type, strings.Join(messages, "; "))
+}
+
+// Scan implements sql.Scanner so that a report can be read from the
+// JSON stored in the database.
+func (r *ValidationReport) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.Errorf("cannot scan %T into a ValidationReport", value)
+	}
+
+	return json.Unmarshal(data, r)
+}
+
+// Value implements driver.Valuer so that a report is stored in the
+// database as JSON.
+func (r *ValidationReport) Value() (driver.Value, error) {
+	if r == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode validation report")
+	}
+
+	return string(data), nil
+}
+
+// ValidationError is returned by the Client when an uploaded archive
+// fails validation.
+type ValidationError struct {
+	UploadID string
+	Report   *ValidationReport
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("upload %s failed validation: %s", e.UploadID, e.Report.Err())
+}
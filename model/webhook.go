@@ -0,0 +1,244 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Types of the resources whose state changes are sent to webhooks.
+const (
+	WebhookEventTranslation = "translation"
+	WebhookEventImport      = "import"
+)
+
+// Headers of the requests delivering a WebhookEvent. The timestamp is
+// the Unix time in seconds the request was signed at, and the
+// signature is "sha256=" followed by the hex encoded HMAC-SHA256 of the
+// timestamp, a dot and the body, keyed with the secret of the webhook.
+// The event header holds the ID of the event, which is the same for
+// every attempt of a delivery.
+const (
+	WebhookSignatureHeader = "X-AWAT-Signature"
+	WebhookTimestampHeader = "X-AWAT-Timestamp"
+	WebhookEventHeader     = "X-AWAT-Event"
+)
+
+// WebhookTimestampTolerance is how far the timestamp of a request
+// delivering a WebhookEvent may be from the time it is verified at, so
+// that recorded requests cannot be replayed later on.
+const WebhookTimestampTolerance = 5 * time.Minute
+
+// Webhook is a subscription to the state changes of Translations and
+// Imports, which are POSTed to its URL. The Secret signs the events,
+// is stored encrypted and is never returned by the API.
+type Webhook struct {
+	ID       string
+	URL      string
+	Secret   string `json:"-"`
+	CreateAt int64
+	DeleteAt int64
+}
+
+// WebhookRequest is the request to register a Webhook.
+type WebhookRequest struct {
+	URL    string
+	Secret string
+}
+
+// Validate checks that the request holds an absolute HTTP(S) URL and
+// a secret.
+func (r *WebhookRequest) Validate() error {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return errors.Wrap(err, "invalid webhook URL")
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.Errorf("webhook URL %q must be an absolute http or https URL", r.URL)
+	}
+	if r.Secret == "" {
+		return errors.New("a secret to sign the events with must be set")
+	}
+
+	return nil
+}
+
+// NewWebhookRequestFromReader creates a WebhookRequest from a Reader.
+func NewWebhookRequestFromReader(reader io.Reader) (*WebhookRequest, error) {
+	var request WebhookRequest
+	err := json.NewDecoder(reader).Decode(&request)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "failed to decode webhook request")
+	}
+	return &request, nil
+}
+
+// NewWebhookFromReader creates a Webhook from a Reader.
+func NewWebhookFromReader(reader io.Reader) (*Webhook, error) {
+	var webhook Webhook
+	err := json.NewDecoder(reader).Decode(&webhook)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "failed to decode webhook")
+	}
+	return &webhook, nil
+}
+
+// NewWebhookListFromReader creates a list of Webhooks from a Reader.
+func NewWebhookListFromReader(reader io.Reader) ([]*Webhook, error) {
+	var webhooks []*Webhook
+	err := json.NewDecoder(reader).Decode(&webhooks)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "failed to decode webhook list")
+	}
+	return webhooks, nil
+}
+
+// WebhookEvent is the body POSTed to webhooks when the Translation or
+// Import of the given Type and ResourceID moved from OldState, which is
+// empty for new resources, to NewState. TranslationID is the ID of the
+// Translation, or of the Translation the Import was created from.
+type WebhookEvent struct {
+	ID             string
+	Type           string
+	ResourceID     string
+	TranslationID  string
+	InstallationID string
+	OldState       string
+	NewState       string
+	Timestamp      int64
+}
+
+// NewTranslationEvent returns the event for the Translation having
+// moved from oldState to its current state, or nil if its state did not
+// change.
+func NewTranslationEvent(translation *Translation, oldState string) *WebhookEvent {
+	if translation.State() == oldState {
+		return nil
+	}
+
+	return &WebhookEvent{
+		ID:             NewID(),
+		Type:           WebhookEventTranslation,
+		ResourceID:     translation.ID,
+		TranslationID:  translation.ID,
+		InstallationID: translation.InstallationID,
+		OldState:       oldState,
+		NewState:       translation.State(),
+		Timestamp:      GetMillis(),
+	}
+}
+
+// NewImportEvent returns the event for the Import into the given
+// Installation having moved from oldState to its current state, or nil
+// if its state did not change.
+func NewImportEvent(imp *Import, installationID, oldState string) *WebhookEvent {
+	if imp.State == oldState {
+		return nil
+	}
+
+	return &WebhookEvent{
+		ID:             NewID(),
+		Type:           WebhookEventImport,
+		ResourceID:     imp.ID,
+		TranslationID:  imp.TranslationID,
+		InstallationID: installationID,
+		OldState:       oldState,
+		NewState:       imp.State,
+		Timestamp:      GetMillis(),
+	}
+}
+
+// StreamEvent returns the state Event recording the WebhookEvent in the
+// stream of events.
+func (e *WebhookEvent) StreamEvent() *Event {
+	return &Event{
+		ID:             e.ID,
+		Kind:           EventKindState,
+		Type:           e.Type,
+		ResourceID:     e.ResourceID,
+		TranslationID:  e.TranslationID,
+		InstallationID: e.InstallationID,
+		OldState:       e.OldState,
+		NewState:       e.NewState,
+		Timestamp:      e.Timestamp,
+	}
+}
+
+// NewWebhookEventFromReader creates a WebhookEvent from a Reader.
+func NewWebhookEventFromReader(reader io.Reader) (*WebhookEvent, error) {
+	var event WebhookEvent
+	err := json.NewDecoder(reader).Decode(&event)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "failed to decode webhook event")
+	}
+	return &event, nil
+}
+
+// SignWebhookPayload returns the value of the WebhookSignatureHeader of
+// a request delivering payload to a webhook with the given secret,
+// signed at timestamp, the value of its WebhookTimestampHeader.
+func SignWebhookPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature returns true if signature is the signature of
+// payload signed at timestamp for a webhook with the given secret, and
+// timestamp is within WebhookTimestampTolerance of now. Receivers of
+// events should reject requests which fail verification.
+func VerifyWebhookSignature(secret string, payload []byte, timestamp, signature string, now time.Time) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > WebhookTimestampTolerance || age < -WebhookTimestampTolerance {
+		return false
+	}
+	return hmac.Equal([]byte(SignWebhookPayload(secret, timestamp, payload)), []byte(signature))
+}
+
+// WebhookDelivery records the delivery of an event to a Webhook.
+// Failed attempts are retried at NextAttemptAt with a growing delay
+// until the delivery succeeds, setting DeliveredAt, or gives up,
+// setting FailAt. StatusCode and Error describe the last attempt.
+type WebhookDelivery struct {
+	WebhookID     string
+	EventID       string
+	Payload       string `json:"-"`
+	Attempts      int
+	StatusCode    int
+	Error         string
+	CreateAt      int64
+	NextAttemptAt int64
+	DeliveredAt   int64
+	FailAt        int64
+}
+
+// NewWebhookDeliveryListFromReader creates a list of WebhookDeliveries
+// from a Reader.
+func NewWebhookDeliveryListFromReader(reader io.Reader) ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+	err := json.NewDecoder(reader).Decode(&deliveries)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "failed to decode webhook delivery list")
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+//
+
+package model_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mattermost/awat/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	now := time.Now()
+	payload := []byte(`{"ID":"event"}`)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	signature := model.SignWebhookPayload("secret", timestamp, payload)
+
+	var testCases = []struct {
+		testName  string
+		secret    string
+		payload   string
+		timestamp string
+		signature string
+		now       time.Time
+		valid     bool
+	}{
+		{"valid", "secret", string(payload), timestamp, signature, now, true},
+		{"within tolerance", "secret", string(payload), timestamp, signature, now.Add(model.WebhookTimestampTolerance - time.Second), true},
+		{"other secret", "other", string(payload), timestamp, signature, now, false},
+		{"tampered payload", "secret", `{"ID":"other"}`, timestamp, signature, now, false},
+		{"other timestamp", "secret", string(payload), strconv.FormatInt(now.Unix()-1, 10), signature, now, false},
+		{"stale timestamp", "secret", string(payload), timestamp, signature, now.Add(model.WebhookTimestampTolerance + time.Second), false},
+		{"future timestamp", "secret", string(payload), timestamp, signature, now.Add(-model.WebhookTimestampTolerance - time.Second), false},
+		{"invalid timestamp", "secret", string(payload), "now", signature, now, false},
+		{"no prefix", "secret", string(payload), timestamp, signature[len("sha256="):], now, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.valid, model.VerifyWebhookSignature(tc.secret, []byte(tc.payload), tc.timestamp, tc.signature, tc.now))
+		})
+	}
+}